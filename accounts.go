@@ -0,0 +1,109 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of the UserName of a Windows service.
+const (
+	accountUser    = iota // An account logging on with a password.
+	accountVirtual        // A virtual account, NT SERVICE\<service name>.
+	accountManaged        // A group managed service account, DOMAIN\name$.
+)
+
+const virtualAccountDomain = `NT SERVICE\`
+
+// accountKind returns the kind of the account name.
+func accountKind(name string) int {
+	switch {
+	case len(name) > len(virtualAccountDomain) && strings.EqualFold(name[:len(virtualAccountDomain)], virtualAccountDomain):
+		return accountVirtual
+	case strings.HasSuffix(name, "$"):
+		return accountManaged
+	}
+	return accountUser
+}
+
+// checkServiceAccount checks that the service can log on as user: virtual
+// and managed service accounts have no password, and the virtual account
+// of a service is the one named after it.
+func checkServiceAccount(service, user, password string) error {
+	kind := accountKind(user)
+	if kind == accountUser {
+		return nil
+	}
+	if password != "" {
+		return fmt.Errorf("account %s logs on without a password, remove the Password option", user)
+	}
+	if kind == accountVirtual && !strings.EqualFold(user[len(virtualAccountDomain):], service) {
+		return fmt.Errorf("virtual account %s is not the account of service %s, %s%s", user, service, virtualAccountDomain, service)
+	}
+	return nil
+}
+
+// Account is the identity a service runs as, the UserName as resolved by
+// Install and recorded in the install manifest.
+type Account struct {
+	Name string `json:"name"` // Name of the account at Install, DOMAIN\name on Windows.
+	ID   string `json:"id"`   // UID of the account, or its SID on Windows.
+}
+
+// resolveAccount looks up the UserName, an account name, a numeric UID or
+// on Windows a SID, and checks that it can run services. It returns nil
+// without a UserName, for a UserService, which runs as the user installing
+// it, and for a Windows virtual account, which the service manager creates
+// along with the service.
+func (c *Config) resolveAccount() (*Account, error) {
+	if c.UserName == "" || accountKind(c.UserName) == accountVirtual || c.Option.bool(optionUserService, optionUserServiceDefault) {
+		return nil, nil
+	}
+	a, err := lookupAccount(c.UserName)
+	if err != nil {
+		return nil, fmt.Errorf("UserName %s: %v", c.UserName, err)
+	}
+	return a, nil
+}
+
+// accountApplier is implemented by the services of the service managers
+// whose configuration runs the service as the UserName. The others, such as
+// SysV and OpenRC scripts, run it as root whatever the UserName.
+type accountApplier interface {
+	appliesUserName() bool
+}
+
+// appliesUserName reports whether s runs as the UserName, see accountApplier.
+func appliesUserName(s interface{}) bool {
+	a, ok := s.(accountApplier)
+	return ok && a.appliesUserName()
+}
+
+// userName returns the UserName written to the service configuration, the
+// name of the account if the UserName is a UID or SID.
+func (c *Config) userName() string {
+	return accountName(c.UserName)
+}
+
+// checkAccount returns an error if the service s runs as another account
+// than the one recorded by Install, as when the account was renamed and
+// another one took its name, for the service not to run as it unnoticed.
+// Services that do not run as the UserName are not checked.
+func (c *Config) checkAccount(s Service) error {
+	if Interactive() || !appliesUserName(s) {
+		return nil
+	}
+	m, err := c.ReadInstallManifest()
+	if err != nil || m.Account == nil {
+		return nil
+	}
+	id, err := currentAccountID()
+	if err != nil || id == m.Account.ID {
+		return nil
+	}
+	return fmt.Errorf("service %s runs as account %s, but was installed for %s (%s), which was renamed or removed since; install the service again",
+		c.Name, id, m.Account.Name, m.Account.ID)
+}
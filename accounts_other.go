@@ -0,0 +1,50 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package service
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// isUID reports whether name is a numeric user id.
+func isUID(name string) bool {
+	_, err := strconv.ParseUint(name, 10, 32)
+	return err == nil
+}
+
+// lookupAccount returns the account of the user name or UID.
+func lookupAccount(name string) (*Account, error) {
+	lookup := user.Lookup
+	if isUID(name) {
+		lookup = user.LookupId
+	}
+	u, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{Name: u.Username, ID: u.Uid}, nil
+}
+
+// accountName returns the name of the user with the UID name, as not all
+// service managers accept a UID, and other names as they are.
+func accountName(name string) string {
+	if !isUID(name) {
+		return name
+	}
+	if u, err := user.LookupId(name); err == nil {
+		return u.Username
+	}
+	return name
+}
+
+// currentAccountID returns the UID of the process.
+func currentAccountID() (string, error) {
+	return strconv.Itoa(os.Getuid()), nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+func TestCheckServiceAccount(t *testing.T) {
+	tests := []struct {
+		user, password string
+		kind           int
+		wantErr        bool
+	}{
+		{"", "", accountUser, false},
+		{`EXAMPLE\builder`, "s3cr3t", accountUser, false},
+		{`NT SERVICE\agent`, "", accountVirtual, false},
+		{`nt service\Agent`, "", accountVirtual, false},
+		{`NT SERVICE\other`, "", accountVirtual, true},
+		{`NT SERVICE\agent`, "s3cr3t", accountVirtual, true},
+		{`EXAMPLE\agent-gmsa$`, "", accountManaged, false},
+		{`EXAMPLE\agent-gmsa$`, "s3cr3t", accountManaged, true},
+	}
+	for _, tt := range tests {
+		if kind := accountKind(tt.user); kind != tt.kind {
+			t.Errorf("accountKind(%q) = %d, want %d", tt.user, kind, tt.kind)
+		}
+		if err := checkServiceAccount("agent", tt.user, tt.password); (err != nil) != tt.wantErr {
+			t.Errorf("checkServiceAccount(%q, %q) = %v, wantErr %v", tt.user, tt.password, err, tt.wantErr)
+		}
+	}
+}
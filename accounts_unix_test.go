@@ -0,0 +1,56 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"testing"
+)
+
+// accountService is a Service running as the UserName.
+type accountService struct {
+	Service
+}
+
+func (accountService) appliesUserName() bool { return true }
+
+func TestResolveAccount(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	dir, err := ioutil.TempDir("", "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{u.Username, u.Uid} {
+		c := &Config{Name: "agent", UserName: name, Option: KeyValue{optionStateDirectory: dir}}
+		if got := c.userName(); got != u.Username {
+			t.Errorf("userName() of %s = %q, want %q", name, got, u.Username)
+		}
+		if err := c.beginInstall(accountService{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		m, err := c.ReadInstallManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Account == nil || *m.Account != (Account{Name: u.Username, ID: u.Uid}) {
+			t.Errorf("manifest records account %+v for UserName %s", m.Account, name)
+		}
+	}
+
+	c := &Config{Name: "agent", UserName: "no-such-user-here", Option: KeyValue{optionStateDirectory: dir}}
+	if err := c.beginInstall(accountService{}, nil); err == nil {
+		t.Error("Install accepted an account that does not exist")
+	}
+}
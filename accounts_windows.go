@@ -0,0 +1,83 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// isSID reports whether name is a SID in its string form, "S-1-5-...".
+func isSID(name string) bool {
+	return strings.HasPrefix(strings.ToUpper(name), "S-1-")
+}
+
+// serviceAccountSIDs are the well-known accounts services run as:
+// LocalSystem, LocalService and NetworkService.
+var serviceAccountSIDs = map[string]bool{"S-1-5-18": true, "S-1-5-19": true, "S-1-5-20": true}
+
+// lookupAccount returns the account of the account name or SID. It has to
+// be a user account, a group managed service account or one of the
+// well-known accounts of services, not a group.
+func lookupAccount(name string) (*Account, error) {
+	// The service manager takes these names, which are not those of the
+	// accounts.
+	if strings.EqualFold(name, "LocalSystem") {
+		name = "S-1-5-18"
+	}
+	if strings.HasPrefix(name, `.\`) {
+		name = name[2:]
+	}
+	var sid *windows.SID
+	var err error
+	if isSID(name) {
+		sid, err = windows.StringToSid(name)
+	} else {
+		sid, _, _, err = windows.LookupSID("", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	account, domain, use, err := sid.LookupAccount("")
+	if err != nil {
+		return nil, err
+	}
+	id := sid.String()
+	switch {
+	case use == windows.SidTypeUser:
+	case use == windows.SidTypeWellKnownGroup && serviceAccountSIDs[id]:
+	default:
+		return nil, fmt.Errorf("%s\\%s is not an account services can run as", domain, account)
+	}
+	return &Account{Name: domain + `\` + account, ID: id}, nil
+}
+
+// accountName returns the DOMAIN\name of the account with the SID name, as
+// the service manager does not accept a SID, and other names as they are.
+func accountName(name string) string {
+	if !isSID(name) {
+		return name
+	}
+	sid, err := windows.StringToSid(name)
+	if err != nil {
+		return name
+	}
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		return name
+	}
+	return domain + `\` + account
+}
+
+// currentAccountID returns the SID of the user of the process.
+func currentAccountID() (string, error) {
+	u, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	return u.User.Sid.String(), nil
+}
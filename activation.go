@@ -0,0 +1,100 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenFdsStart is the first file descriptor passed by socket activation.
+var listenFdsStart = 3
+
+var (
+	activationOnce      sync.Once
+	activationNames     []string
+	activationListeners []net.Listener
+	activationErr       error
+)
+
+// ActivationListeners returns the listening sockets passed to the process by
+// systemd socket activation, see the ListenStream option, or by a Supervisor
+// with Listen, in the order they are configured. It returns nil if the process
+// was not socket activated.
+//
+// The sockets are taken over by the first call: the LISTEN_ variables are
+// removed from the environment so programs started by the process do not
+// take them for their own.
+func ActivationListeners() ([]net.Listener, error) {
+	activationOnce.Do(func() {
+		activationNames, activationListeners, activationErr = activationSockets()
+	})
+	return activationListeners, activationErr
+}
+
+// ActivationListenersByName returns the ActivationListeners by their name in
+// LISTEN_FDNAMES, which is the FileDescriptorName of the socket unit.
+func ActivationListenersByName() (map[string][]net.Listener, error) {
+	list, err := ActivationListeners()
+	if err != nil {
+		return nil, err
+	}
+	named := make(map[string][]net.Listener, len(list))
+	for i, l := range list {
+		named[activationNames[i]] = append(named[activationNames[i]], l)
+	}
+	return named, nil
+}
+
+// activationSockets takes over the sockets described by the LISTEN_
+// variables.
+func activationSockets() (names []string, list []net.Listener, err error) {
+	pid := os.Getenv("LISTEN_PID")
+	fds := os.Getenv("LISTEN_FDS")
+	fdNames := os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// A Supervisor cannot set LISTEN_PID, the sockets are ours if it is
+	// missing.
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	given := strings.Split(fdNames, ":")
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		unix.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(given) && given[i] != "" {
+			name = given[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range list {
+				l.Close()
+			}
+			return nil, nil, fmt.Errorf("activation socket %s: %v", name, err)
+		}
+		names = append(names, name)
+		list = append(list, l)
+	}
+	return names, list, nil
+}
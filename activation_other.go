@@ -0,0 +1,21 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !solaris && !aix && !freebsd
+// +build !linux,!darwin,!solaris,!aix,!freebsd
+
+package service
+
+import "net"
+
+// ActivationListeners returns the listening sockets passed to the process by
+// socket activation, which is not available on this system.
+func ActivationListeners() ([]net.Listener, error) {
+	return nil, nil
+}
+
+// ActivationListenersByName returns the ActivationListeners by name.
+func ActivationListenersByName() (map[string][]net.Listener, error) {
+	return nil, nil
+}
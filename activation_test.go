@@ -0,0 +1,89 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux || darwin || solaris || aix || freebsd) && !service_minimal
+// +build linux darwin solaris aix freebsd
+// +build !service_minimal
+
+package service
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestActivationSockets(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// activationSockets takes over the descriptor, which f must not close
+	// again once its number is reused.
+	fd, err := unix.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(fd int) { listenFdsStart = fd }(listenFdsStart)
+	listenFdsStart = fd
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	if _, list, _ := activationSockets(); list != nil {
+		t.Error("took over the sockets of another process")
+	}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", "web")
+	names, list, err := activationSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || names[0] != "web" {
+		t.Fatalf("activation sockets %q, want [web]", names)
+	}
+	defer list[0].Close()
+	if list[0].Addr().String() != l.Addr().String() {
+		t.Errorf("activation socket listens on %s, want %s", list[0].Addr(), l.Addr())
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("LISTEN_FDS left in the environment")
+	}
+}
+
+func TestHTTPAgentActivationRestart(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	a := &httpAgent{activated: l, drain: time.Second, handler: http.NotFoundHandler()}
+	s := quietService{}
+	for i := 0; i < 2; i++ {
+		if err := a.Start(s); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		resp, err := http.Get("http://" + l.Addr().String() + healthPath)
+		if err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if err := a.Stop(s); err != nil {
+			t.Fatalf("stop %d: %v", i, err)
+		}
+	}
+}
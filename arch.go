@@ -0,0 +1,79 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"strings"
+)
+
+// ArchError is returned by Install when the executable is not built for an
+// architecture the host can run, such as an arm64 program on an Intel Mac.
+type ArchError struct {
+	Path  string
+	Archs []string // Architectures of the executable, GOARCH names.
+	Host  []string // Architectures the host runs.
+}
+
+func (e *ArchError) Error() string {
+	return fmt.Sprintf("%s is built for %s, the host runs %s", e.Path, strings.Join(e.Archs, ", "), strings.Join(e.Host, ", "))
+}
+
+var machoArchs = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+var peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+}
+
+// executableArchs returns the architectures of the Mach-O, universal or PE
+// executable at path. Files in other formats, such as scripts, have none.
+func executableArchs(path string) []string {
+	if f, err := macho.OpenFat(path); err == nil {
+		defer f.Close()
+		var archs []string
+		for _, a := range f.Arches {
+			archs = append(archs, machoArchs[a.Cpu])
+		}
+		return archs
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return []string{machoArchs[f.Cpu]}
+	}
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		return []string{peArchs[f.Machine]}
+	}
+	return nil
+}
+
+// checkArch returns an ArchError unless the executable at path is built for
+// one of the host architectures or in a format that is not checked.
+func checkArch(path string, host []string) error {
+	archs := executableArchs(path)
+	if len(archs) == 0 {
+		return nil
+	}
+	for _, a := range archs {
+		for _, h := range host {
+			if a == h {
+				return nil
+			}
+		}
+	}
+	return &ArchError{Path: path, Archs: archs, Host: host}
+}
@@ -0,0 +1,22 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// hostArchs returns the architectures the Mac runs, natively or with Rosetta.
+func hostArchs() []string {
+	if v, err := unix.SysctlUint32("hw.optional.arm64"); err != nil || v != 1 {
+		return []string{"amd64"}
+	}
+	if _, err := os.Stat("/Library/Apple/usr/share/rosetta/rosetta"); err == nil {
+		return []string{"arm64", "amd64"}
+	}
+	return []string{"arm64"}
+}
@@ -0,0 +1,26 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckArch(t *testing.T) {
+	if err := checkArch("arch_test.go", []string{"none"}); err != nil {
+		t.Errorf("checkArch of a file in no executable format = %v", err)
+	}
+	archs := executableArchs(os.Args[0])
+	if len(archs) == 0 {
+		t.Skip("the test binary is neither Mach-O nor PE")
+	}
+	if err := checkArch(os.Args[0], archs); err != nil {
+		t.Error(err)
+	}
+	if _, ok := checkArch(os.Args[0], []string{"none"}).(*ArchError); !ok {
+		t.Error("checkArch accepted an architecture the host does not run")
+	}
+}
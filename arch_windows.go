@@ -0,0 +1,25 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "os"
+
+// hostArchs returns the architectures Windows runs, natively or emulated.
+// The native architecture of a 32 bit process on 64 bit Windows is in
+// PROCESSOR_ARCHITEW6432.
+func hostArchs() []string {
+	native := os.Getenv("PROCESSOR_ARCHITEW6432")
+	if native == "" {
+		native = os.Getenv("PROCESSOR_ARCHITECTURE")
+	}
+	switch native {
+	case "ARM64":
+		return []string{"arm64", "amd64", "386", "arm"}
+	case "x86":
+		return []string{"386"}
+	default:
+		return []string{"amd64", "386"}
+	}
+}
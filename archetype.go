@@ -0,0 +1,366 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	optionDrainTimeout        = "DrainTimeout"
+	optionDrainTimeoutDefault = "10s"
+
+	healthPath = "/healthz"
+
+	optionDrainGrace        = "DrainGrace"
+	optionDrainGraceDefault = "5s"
+
+	minWorkerBackoff = time.Second
+	maxWorkerBackoff = time.Minute
+
+	optionCatchUp = "CatchUp"
+
+	// maxCronWait is the longest a cron job waits before checking the wall
+	// clock again, as timers do not count time spent suspended.
+	maxCronWait = time.Minute
+)
+
+// Values of the CatchUp option of NewCronJob, deciding what happens to runs
+// missed while the system was suspended or the clock jumped ahead.
+const (
+	CatchUpOnce = "once" // Run once for all missed runs.
+	CatchUpSkip = "skip" // Skip the missed runs, wait for the next one.
+	CatchUpAll  = "all"  // Run each missed run.
+)
+
+// archetypeConfig returns a copy of c with restart defaults suitable for long
+// running agents. Options already present in c are left untouched.
+func archetypeConfig(c *Config) *Config {
+	cc := *c
+	cc.Option = KeyValue{
+		optionRestart:            "always",
+		optionKeepAlive:          true,
+		"OnFailure":              "restart",
+		"OnFailureDelayDuration": "5s",
+		optionDrainTimeout:       optionDrainTimeoutDefault,
+	}
+	for k, v := range c.Option {
+		cc.Option[k] = v
+	}
+	return &cc
+}
+
+func (c *Config) drainTimeout() (time.Duration, error) {
+	d, err := time.ParseDuration(c.Option.string(optionDrainTimeout, optionDrainTimeoutDefault))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", optionDrainTimeout, err)
+	}
+	return d, nil
+}
+
+// NewWorker creates a service that runs work until the service is stopped.
+// The context passed to work is cancelled on stop and work is given
+// the DrainTimeout option (10s by default) to return. If work returns early
+// with an error it is logged and run again with an exponential backoff.
+func NewWorker(c *Config, work func(ctx context.Context) error) (Service, error) {
+	c = archetypeConfig(c)
+	drain, err := c.drainTimeout()
+	if err != nil {
+		return nil, err
+	}
+	w := &worker{
+		drain: drain,
+		run:   work,
+	}
+	return New(w, c)
+}
+
+// NewCronJob creates a service that calls job every interval until the
+// service is stopped. A job that is still running when the next run is due
+// delays that run rather than running concurrently. Runs are due by the wall
+// clock, so time the system spent suspended counts; the CatchUp option
+// (CatchUpOnce by default) decides what happens to runs missed meanwhile.
+// The interval has to be positive.
+func NewCronJob(c *Config, interval time.Duration, job func(ctx context.Context) error) (Service, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("cron job interval %v is not positive", interval)
+	}
+	c = archetypeConfig(c)
+	catchUp := c.Option.string(optionCatchUp, CatchUpOnce)
+	switch catchUp {
+	case CatchUpOnce, CatchUpSkip, CatchUpAll:
+	default:
+		return nil, fmt.Errorf("%s: unknown policy %q", optionCatchUp, catchUp)
+	}
+	drain, err := c.drainTimeout()
+	if err != nil {
+		return nil, err
+	}
+	w := &worker{
+		drain: drain,
+	}
+	w.run = func(ctx context.Context) error {
+		sched := &schedule{interval: interval, catchUp: catchUp, next: wallNow().Add(interval)}
+		for {
+			wait := sched.next.Sub(wallNow())
+			if wait > maxCronWait {
+				wait = maxCronWait
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+			for n := sched.due(wallNow()); n > 0 && ctx.Err() == nil; n-- {
+				if err := job(ctx); err != nil && ctx.Err() == nil {
+					w.logError(err)
+				}
+			}
+		}
+	}
+	return New(w, c)
+}
+
+// wallNow returns the current time without its monotonic clock reading, so
+// that durations computed from it include time spent suspended.
+func wallNow() time.Time {
+	return time.Now().Round(0)
+}
+
+// schedule keeps the wall clock time the next run of a cron job is due.
+type schedule struct {
+	interval time.Duration
+	catchUp  string
+	next     time.Time
+}
+
+// due returns the number of runs due at now and schedules the next run,
+// keeping the runs at multiples of the interval.
+func (s *schedule) due(now time.Time) int {
+	if now.Before(s.next) {
+		if s.next.Sub(now) > s.interval {
+			// The clock was set back, do not wait for it to catch up.
+			s.next = now.Add(s.interval)
+		}
+		return 0
+	}
+	missed := int(now.Sub(s.next) / s.interval)
+	s.next = s.next.Add(time.Duration(missed+1) * s.interval)
+	switch {
+	case missed == 0:
+		return 1
+	case s.catchUp == CatchUpSkip:
+		return 0
+	case s.catchUp == CatchUpAll:
+		return missed + 1
+	}
+	return 1
+}
+
+// NewHTTPAgent creates a service serving handler, or 404 Not Found if it is
+// nil, on addr, or on the first of the ActivationListeners if the service is
+// socket activated, closing the others. The path /healthz answers 200 while
+// the agent is serving and 503 once it starts draining. On stop the agent
+// keeps serving for the DrainGrace option (5s), so that health checks see it
+// draining, then stops accepting connections and waits up to the
+// DrainTimeout option for in-flight requests to complete.
+func NewHTTPAgent(c *Config, addr string, handler http.Handler) (Service, error) {
+	c = archetypeConfig(c)
+	if handler == nil {
+		handler = http.NotFoundHandler()
+	}
+	grace, err := time.ParseDuration(c.Option.string(optionDrainGrace, optionDrainGraceDefault))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", optionDrainGrace, err)
+	}
+	drain, err := c.drainTimeout()
+	if err != nil {
+		return nil, err
+	}
+	a := &httpAgent{
+		addr:    addr,
+		grace:   grace,
+		drain:   drain,
+		handler: handler,
+	}
+	return New(a, c)
+}
+
+type worker struct {
+	drain time.Duration
+	run   func(ctx context.Context) error
+
+	logger Logger
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (w *worker) Start(s Service) error {
+	w.logger, _ = s.Logger(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.loop(ctx)
+	return nil
+}
+
+func (w *worker) loop(ctx context.Context) {
+	defer close(w.done)
+	backoff := minWorkerBackoff
+	for {
+		start := time.Now()
+		err := w.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.logError(err)
+		}
+		if time.Since(start) > maxWorkerBackoff {
+			backoff = minWorkerBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxWorkerBackoff {
+			backoff = maxWorkerBackoff
+		}
+	}
+}
+
+func (w *worker) logError(err error) {
+	if w.logger != nil {
+		w.logger.Error(err)
+	}
+}
+
+func (w *worker) Stop(s Service) error {
+	if w.cancel == nil {
+		// Not started.
+		return nil
+	}
+	w.cancel()
+	w.cancel = nil
+	select {
+	case <-w.done:
+	case <-time.After(w.drain):
+		w.logError(context.DeadlineExceeded)
+	}
+	return nil
+}
+
+type httpAgent struct {
+	addr      string
+	activated net.Listener  // Passed by socket activation, see Start.
+	grace     time.Duration // Serving while draining before the shutdown.
+	drain     time.Duration
+	handler   http.Handler
+
+	mu       sync.Mutex
+	server   *http.Server // Created by Start, as a server cannot serve again once shut down.
+	draining bool
+}
+
+func (a *httpAgent) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != healthPath {
+		a.handler.ServeHTTP(w, r)
+		return
+	}
+	a.mu.Lock()
+	draining := a.draining
+	a.mu.Unlock()
+	if draining {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (a *httpAgent) Start(s Service) error {
+	// Listen before returning so an address in use fails the start. A
+	// socket passed by socket activation is used instead if there is one;
+	// it is kept open and each start serves a duplicate of it, which the
+	// shutdown of the server closes.
+	if a.activated == nil {
+		ls, err := ActivationListeners()
+		if err != nil {
+			return err
+		}
+		if len(ls) > 0 {
+			for _, unused := range ls[1:] {
+				unused.Close()
+			}
+			a.activated = ls[0]
+		}
+	}
+	var l net.Listener
+	var err error
+	if a.activated != nil {
+		l, err = dupListener(a.activated)
+	} else {
+		l, err = net.Listen("tcp", a.addr)
+	}
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: http.HandlerFunc(a.serveHTTP)}
+	a.mu.Lock()
+	a.server = server
+	a.draining = false
+	a.mu.Unlock()
+	logger, _ := s.Logger(nil)
+	go func() {
+		err := server.Serve(l)
+		if err != nil && err != http.ErrServerClosed && logger != nil {
+			logger.Error(err)
+		}
+	}()
+	return nil
+}
+
+// dupListener returns a listener on a duplicate of the socket of l, which
+// can be closed without closing l.
+func dupListener(l net.Listener) (net.Listener, error) {
+	fl, ok := l.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("cannot duplicate listener on %s", l.Addr())
+	}
+	f, err := fl.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+func (a *httpAgent) Stop(s Service) error {
+	a.mu.Lock()
+	server := a.server
+	a.server = nil
+	a.draining = true
+	a.mu.Unlock()
+	if server == nil {
+		// Not started.
+		return nil
+	}
+	time.Sleep(a.grace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.drain)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
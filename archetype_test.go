@@ -0,0 +1,163 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestArchetypeConfig(t *testing.T) {
+	c := &Config{
+		Name:   "agent",
+		Option: KeyValue{optionRestart: "on-failure"},
+	}
+	cc := archetypeConfig(c)
+	if got := cc.Option.string(optionRestart, ""); got != "on-failure" {
+		t.Errorf("caller option overwritten: Restart = %q", got)
+	}
+	if !cc.Option.bool(optionKeepAlive, false) {
+		t.Error("KeepAlive default not applied")
+	}
+	if _, found := c.Option[optionKeepAlive]; found {
+		t.Error("caller Config modified")
+	}
+	if got, err := cc.drainTimeout(); got != 10*time.Second || err != nil {
+		t.Errorf("drainTimeout() = %v, %v", got, err)
+	}
+
+	bad := &Config{Name: "agent", Option: KeyValue{optionDrainTimeout: "10"}}
+	if _, err := NewWorker(bad, func(ctx context.Context) error { return nil }); err == nil {
+		t.Error("NewWorker accepted a DrainTimeout without a unit")
+	}
+	if _, err := NewHTTPAgent(bad, ":0", nil); err == nil {
+		t.Error("NewHTTPAgent accepted a DrainTimeout without a unit")
+	}
+
+	job := func(ctx context.Context) error { return nil }
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		if _, err := NewCronJob(c, interval, job); err == nil {
+			t.Errorf("NewCronJob accepted the interval %v", interval)
+		}
+	}
+}
+
+func TestArchetypeStopUnstarted(t *testing.T) {
+	if err := (&worker{}).Stop(nil); err != nil {
+		t.Errorf("worker Stop = %v", err)
+	}
+	if err := (&httpAgent{}).Stop(nil); err != nil {
+		t.Errorf("httpAgent Stop = %v", err)
+	}
+}
+
+func TestHTTPAgentRestart(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	a := &httpAgent{addr: addr, drain: time.Second, handler: http.NotFoundHandler()}
+	s := quietService{}
+	for i := 0; i < 2; i++ {
+		if err := a.Start(s); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		resp, err := http.Get("http://" + addr + healthPath)
+		if err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("start %d: GET %s = %d", i, healthPath, resp.StatusCode)
+		}
+		if err := a.Stop(s); err != nil {
+			t.Fatalf("stop %d: %v", i, err)
+		}
+	}
+}
+
+func TestHTTPAgentHealth(t *testing.T) {
+	a := &httpAgent{
+		handler: http.NotFoundHandler(),
+	}
+	h := http.HandlerFunc(a.serveHTTP)
+
+	for _, tt := range []struct {
+		draining bool
+		path     string
+		want     int
+	}{
+		{false, healthPath, http.StatusOK},
+		{false, "/other", http.StatusNotFound},
+		{true, healthPath, http.StatusServiceUnavailable},
+	} {
+		a.draining = tt.draining
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("draining=%v GET %s = %d, want %d", tt.draining, tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestHTTPAgentDrainGrace(t *testing.T) {
+	a := &httpAgent{grace: 200 * time.Millisecond, server: &http.Server{}}
+	start := time.Now()
+	stopped := make(chan struct{})
+	go func() {
+		a.Stop(nil)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	w := httptest.NewRecorder()
+	a.serveHTTP(w, httptest.NewRequest("GET", healthPath, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET %s while draining = %d, want %d", healthPath, w.Code, http.StatusServiceUnavailable)
+	}
+	<-stopped
+	if d := time.Since(start); d < a.grace {
+		t.Errorf("shut down after %v, before the grace period", d)
+	}
+}
+
+func TestScheduleCatchUp(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		catchUp string
+		late    time.Duration
+		want    int
+	}{
+		{CatchUpOnce, 0, 1},
+		{CatchUpOnce, 3*time.Hour + time.Minute, 1},
+		{CatchUpSkip, 30 * time.Minute, 1},
+		{CatchUpSkip, 3*time.Hour + time.Minute, 0},
+		{CatchUpAll, 3*time.Hour + time.Minute, 4},
+	}
+	for _, tt := range tests {
+		s := &schedule{interval: time.Hour, catchUp: tt.catchUp, next: start}
+		if got := s.due(start.Add(tt.late)); got != tt.want {
+			t.Errorf("%s, %v late: due() = %d, want %d", tt.catchUp, tt.late, got, tt.want)
+		}
+		if want := start.Add(tt.late.Truncate(time.Hour) + time.Hour); !s.next.Equal(want) {
+			t.Errorf("%s, %v late: next run at %v, want %v", tt.catchUp, tt.late, s.next, want)
+		}
+	}
+
+	// The clock set back by a day does not delay the next run by a day.
+	s := &schedule{interval: time.Hour, next: start}
+	if got := s.due(start.Add(-24 * time.Hour)); got != 0 || !s.next.Equal(start.Add(-23*time.Hour)) {
+		t.Errorf("after setting the clock back: due() = %d, next run at %v", got, s.next)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	optionEULA       = "EULA"
+	optionAcceptEULA = "AcceptEULA"
+	optionConsent    = "Consent"
+
+	envAcceptEULA   = "ACCEPT_EULA"
+	installManifest = "install.json"
+)
+
+// InstallManifest is kept in the StateDirectory by Install.
+type InstallManifest struct {
+	Consent        *Consent        `json:"consent,omitempty"`
+	RebootRequired *RebootRequired `json:"rebootRequired,omitempty"`
+	Account        *Account        `json:"account,omitempty"`
+}
+
+// Consent records the acceptance of the agreement named by the EULA option.
+type Consent struct {
+	EULA     string    `json:"eula"`
+	Accepted time.Time `json:"accepted"`
+	User     string    `json:"user,omitempty"`
+	// Via is how the agreement was accepted: "option", "env" or "callback".
+	Via string `json:"via"`
+}
+
+// ReadInstallManifest returns the install manifest of the service c.
+func (c *Config) ReadInstallManifest() (*InstallManifest, error) {
+	dir, err := c.stateDir()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, installManifest))
+	if err != nil {
+		return nil, err
+	}
+	m := &InstallManifest{}
+	return m, json.Unmarshal(b, m)
+}
+
+// consent returns ErrConsentRequired unless the agreement named by the EULA
+// option was accepted, which it records in the install manifest, see
+// beginInstall.
+func (c *Config) consent() error {
+	eula := c.Option.string(optionEULA, "")
+	if eula == "" {
+		return nil
+	}
+	var via string
+	switch {
+	case c.Option.bool(optionAcceptEULA, false):
+		via = "option"
+	case acceptedEnv(os.Getenv(envAcceptEULA)):
+		via = "env"
+	default:
+		if f, ok := c.Option[optionConsent].(func(string) bool); ok && f(eula) {
+			via = "callback"
+		}
+	}
+	if via == "" {
+		return ErrConsentRequired
+	}
+
+	return c.updateInstallManifest(func(m *InstallManifest) {
+		m.Consent = &Consent{EULA: eula, Accepted: time.Now().UTC(), Via: via}
+		if u, err := user.Current(); err == nil {
+			m.Consent.User = u.Username
+		}
+	})
+}
+
+// updateInstallManifest changes the install manifest with update.
+func (c *Config) updateInstallManifest(update func(m *InstallManifest)) error {
+	dir, err := c.stateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	m, err := c.ReadInstallManifest()
+	if err != nil {
+		m = &InstallManifest{}
+	}
+	update(m)
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, installManifest)
+	if err := ioutil.WriteFile(path+".new", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".new", path)
+}
+
+func acceptedEnv(v string) bool {
+	switch strings.ToLower(v) {
+	case "y", "yes", "1", "true":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestConsent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv(envAcceptEULA, os.Getenv(envAcceptEULA))
+	os.Unsetenv(envAcceptEULA)
+
+	c := &Config{Name: "licensed", Option: KeyValue{optionStateDirectory: dir}}
+	if err := c.consent(); err != nil {
+		t.Fatalf("consent without an EULA: %v", err)
+	}
+	c.Option[optionEULA] = "eula-2024"
+	if err := c.consent(); err != ErrConsentRequired {
+		t.Fatalf("consent = %v, want ErrConsentRequired", err)
+	}
+	var asked string
+	c.Option[optionConsent] = func(eula string) bool { asked = eula; return true }
+	if err := c.consent(); err != nil {
+		t.Fatal(err)
+	}
+	if asked != "eula-2024" {
+		t.Errorf("Consent asked for %q", asked)
+	}
+	m, err := c.ReadInstallManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Consent == nil || m.Consent.EULA != "eula-2024" || m.Consent.Via != "callback" || m.Consent.Accepted.IsZero() {
+		t.Errorf("recorded consent %+v", m.Consent)
+	}
+
+	os.Setenv(envAcceptEULA, "Y")
+	if err := c.consent(); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = c.ReadInstallManifest(); err != nil || m.Consent.Via != "env" {
+		t.Errorf("recorded consent %+v, %v", m.Consent, err)
+	}
+}
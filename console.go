@@ -22,6 +22,16 @@ func init() {
 	ConsoleLogger.err = log.New(os.Stderr, "E: ", log.Ltime)
 }
 
+// newStderrLogger returns a logger writing to os.Stderr with every line
+// tagged by name, for use when no system logger is available.
+func newStderrLogger(name string) consoleLogger {
+	return consoleLogger{
+		info: log.New(os.Stderr, name+" I: ", log.Ltime),
+		warn: log.New(os.Stderr, name+" W: ", log.Ltime),
+		err:  log.New(os.Stderr, name+" E: ", log.Ltime),
+	}
+}
+
 func (c consoleLogger) Error(v ...interface{}) error {
 	c.err.Print(v...)
 	return nil
@@ -0,0 +1,177 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ContextInterface is a variant of Interface passing contexts, which saves
+// programs from wiring channels between Start and Stop. Use
+// FromContextInterface to create a service for it:
+//
+//	s, err := service.New(service.FromContextInterface(prg, 10*time.Second), c)
+type ContextInterface interface {
+	// Start starts the program. It must not block; ctx stays valid after it
+	// returns and is cancelled when the service is stopped, so work started
+	// with ctx can watch ctx.Done() to end.
+	Start(ctx context.Context, s Service) error
+
+	// Stop cleans up after the program. ctx carries the deadline for
+	// stopping. Stop should not call os.Exit.
+	Stop(ctx context.Context, s Service) error
+}
+
+// ContextShutdowner is a ContextInterface that differentiates between stop
+// and shutdown, see Shutdowner.
+type ContextShutdowner interface {
+	ContextInterface
+	Shutdown(ctx context.Context, s Service) error
+}
+
+// FromContextInterface returns an Interface running i. The context passed
+// to Stop or Shutdown has a deadline of stopTimeout, if not zero.
+func FromContextInterface(i ContextInterface, stopTimeout time.Duration) Interface {
+	return &contextInterface{i: i, timeout: stopTimeout}
+}
+
+type contextInterface struct {
+	i       ContextInterface
+	timeout time.Duration
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc // Cancels the context of Start.
+	stopCancel context.CancelFunc // Cancels the context of a running Stop.
+}
+
+func (c *contextInterface) Start(s Service) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	if err := c.i.Start(ctx, s); err != nil {
+		cancel()
+		return err
+	}
+	return nil
+}
+
+func (c *contextInterface) Stop(s Service) error {
+	ctx, cancel := c.stopContext()
+	defer cancel()
+	return c.i.Stop(ctx, s)
+}
+
+func (c *contextInterface) Shutdown(s Service) error {
+	sd, ok := c.i.(ContextShutdowner)
+	if !ok {
+		return c.Stop(s)
+	}
+	ctx, cancel := c.stopContext()
+	defer cancel()
+	return sd.Shutdown(ctx, s)
+}
+
+// stopContext cancels the context of Start and returns the context for
+// stopping.
+func (c *contextInterface) stopContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.timeout != 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), c.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stopCancel = cancel
+	return ctx, cancel
+}
+
+// cancelStop cancels the context of a running Stop or Shutdown.
+func (c *contextInterface) cancelStop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopCancel != nil {
+		c.stopCancel()
+	}
+}
+
+// ContextController is implemented by the services of the service managers
+// whose control operations can be cancelled, killing the commands of the
+// service manager they run or ending the wait for the service.
+type ContextController interface {
+	StartContext(ctx context.Context) error
+	StopContext(ctx context.Context) error
+	RestartContext(ctx context.Context) error
+}
+
+// ContextRunner is implemented by the services that can be run until a
+// context is done, see RunContext.
+type ContextRunner interface {
+	RunContext(ctx context.Context) error
+}
+
+// StartContext starts s like Start, returning the error of ctx once it is
+// done. Service managers that cannot cancel the operation, see
+// ContextController, are left to complete it in the background.
+func StartContext(ctx context.Context, s Service) error {
+	if c, ok := s.(ContextController); ok {
+		return c.StartContext(ctx)
+	}
+	return withContext(ctx, s.Start)
+}
+
+// StopContext stops s like Stop, see StartContext.
+func StopContext(ctx context.Context, s Service) error {
+	if c, ok := s.(ContextController); ok {
+		return c.StopContext(ctx)
+	}
+	return withContext(ctx, s.Stop)
+}
+
+// RestartContext restarts s like Restart, see StartContext.
+func RestartContext(ctx context.Context, s Service) error {
+	if c, ok := s.(ContextController); ok {
+		return c.RestartContext(ctx)
+	}
+	return withContext(ctx, s.Restart)
+}
+
+// RunContext runs s like Run, and also stops the program when ctx is done,
+// as if stopped by the service manager. It returns ErrNotSupported if s
+// does not implement ContextRunner.
+func RunContext(ctx context.Context, s Service) error {
+	if r, ok := s.(ContextRunner); ok {
+		return r.RunContext(ctx)
+	}
+	return ErrNotSupported
+}
+
+// withContext runs f, returning its error or the error of ctx if ctx is
+// done first. f keeps running in the background then.
+func withContext(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
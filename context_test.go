@@ -0,0 +1,69 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type contextProgram struct {
+	started  context.Context
+	deadline bool
+}
+
+func (p *contextProgram) Start(ctx context.Context, s Service) error {
+	p.started = ctx
+	return nil
+}
+
+func (p *contextProgram) Stop(ctx context.Context, s Service) error {
+	_, p.deadline = ctx.Deadline()
+	return nil
+}
+
+func TestFromContextInterface(t *testing.T) {
+	p := &contextProgram{}
+	i := FromContextInterface(p, time.Second)
+	if err := i.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.started.Err() != nil {
+		t.Fatal("context cancelled before Stop")
+	}
+	if err := i.(Shutdowner).Shutdown(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.started.Err() == nil {
+		t.Error("context not cancelled by Shutdown")
+	}
+	if !p.deadline {
+		t.Error("Stop context has no deadline")
+	}
+}
+
+type blockingService struct {
+	Service
+	release chan struct{}
+}
+
+func (s blockingService) Start() error {
+	<-s.release
+	return nil
+}
+
+func TestStartContext(t *testing.T) {
+	s := blockingService{release: make(chan struct{})}
+	defer close(s.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := StartContext(ctx, s); err != context.DeadlineExceeded {
+		t.Errorf("StartContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := RunContext(ctx, s); err != ErrNotSupported {
+		t.Errorf("RunContext = %v, want %v", err, ErrNotSupported)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+// LoadConfig reads a Config from the JSON file at path, for example:
+//
+//	{
+//		"Name": "agent",
+//		"Arguments": ["-config", "/etc/agent.conf"],
+//		"Dependencies": ["After=network-online.target"],
+//		"Option": {"Restart": "always", "LimitNOFILE": 65536}
+//	}
+//
+// Whole numbers in Option are read as int.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(path, b)
+}
+
+func parseConfig(path string, b []byte) (*Config, error) {
+	c := &Config{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Name == "" {
+		return nil, fmt.Errorf("%s: %v", path, ErrNameFieldRequired)
+	}
+	for k, v := range c.Option {
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			c.Option[k] = int(f)
+		}
+	}
+	return c, nil
+}
+
+// ConvergeOptions configures WatchAndConverge.
+type ConvergeOptions struct {
+	Interval  time.Duration // Between checks of the file (5s).
+	Probation time.Duration // The service has to stay healthy after a change (30s).
+
+	// Healthy checks the service during the Probation. By default the
+	// service has to be running if it was before the change.
+	Healthy func(s Service) error
+
+	// Diff, if set, is shown the change before it is applied, and refuses
+	// it by returning an error.
+	Diff func(d *ConfigDiff) error
+
+	// Result, if set, is called with the Config of each change of the file
+	// and the error converging to it, a *ConvergeError if the change was
+	// applied and rolled back.
+	Result func(c *Config, err error)
+}
+
+// ConvergeError is the error of a change that was applied and rolled back
+// as the service failed its health check.
+type ConvergeError struct {
+	Err         error // Failed health check.
+	RollbackErr error // Error rolling back, if any.
+}
+
+func (e *ConvergeError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("converge: %v; rollback failed: %v", e.Err, e.RollbackErr)
+	}
+	return fmt.Sprintf("converge: %v; rolled back", e.Err)
+}
+
+// configReloader is implemented by services whose service manager has to
+// reload their file after it changed, before restarting them.
+type configReloader interface {
+	reloadConfig() error
+}
+
+// WatchAndConverge keeps the installed service in line with the Config in
+// the JSON file at path, read by LoadConfig, until ctx is done. Whenever the
+// file changes, and once at the start, the Config is validated and the file
+// of the service, as compared by Diff, is rewritten and the service restarted
+// if it was running. If the service does not stay healthy for the Probation
+// the previous file is restored and the service restarted again. Only the
+// file compared by Diff is converged; changes needing other files, such as
+// socket units, require Install. The service has to be installed, under the
+// Name of the Config. WatchAndConverge returns ctx.Err().
+func WatchAndConverge(ctx context.Context, i Interface, path string, opt *ConvergeOptions) error {
+	if opt == nil {
+		opt = &ConvergeOptions{}
+	}
+	interval := opt.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	var last []byte
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		b, err := ioutil.ReadFile(path)
+		if err == nil && (last == nil || !bytes.Equal(b, last)) {
+			last = b
+			c, err := parseConfig(path, b)
+			if err == nil {
+				var s Service
+				if s, err = New(i, c); err == nil {
+					err = opt.converge(ctx, s)
+				}
+			}
+			if opt.Result != nil {
+				opt.Result(c, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// converge applies the current Config of s to its installed file.
+func (opt *ConvergeOptions) converge(ctx context.Context, s Service) error {
+	d, err := Diff(s)
+	if err != nil {
+		return err
+	}
+	if d.Unified == "" {
+		return nil
+	}
+	fi, err := os.Stat(d.Path)
+	if os.IsNotExist(err) {
+		return ErrNotInstalled
+	}
+	if err != nil {
+		return err
+	}
+	if c, ok := s.(interface {
+		checkSecrets(r renderer) error
+	}); ok {
+		if err := c.checkSecrets(s.(renderer)); err != nil {
+			return err
+		}
+	}
+	if opt.Diff != nil {
+		if err := opt.Diff(d); err != nil {
+			return err
+		}
+	}
+
+	old, err := ioutil.ReadFile(d.Path)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.(renderer).render(&b); err != nil {
+		return err
+	}
+	status, _ := s.Status()
+	running := status == StatusRunning
+	if err := applyConfig(s, d.Path, b.Bytes(), fi.Mode(), running); err != nil {
+		return err
+	}
+
+	healthy := opt.Healthy
+	if healthy == nil {
+		healthy = func(s Service) error {
+			if !running {
+				return nil
+			}
+			if status, err := s.Status(); err != nil || status != StatusRunning {
+				return fmt.Errorf("%s is not running after the change (%v)", s, err)
+			}
+			return nil
+		}
+	}
+	probation := opt.Probation
+	if probation <= 0 {
+		probation = 30 * time.Second
+	}
+	if err := probe(ctx, s, healthy, probation); err != nil {
+		return &ConvergeError{Err: err, RollbackErr: applyConfig(s, d.Path, old, fi.Mode(), running)}
+	}
+	return nil
+}
+
+// applyConfig writes the file of s and restarts it if it was running.
+func applyConfig(s Service, path string, data []byte, mode os.FileMode, running bool) error {
+	if err := ioutil.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	if r, ok := s.(configReloader); ok {
+		if err := r.reloadConfig(); err != nil {
+			return err
+		}
+	}
+	if !running {
+		return nil
+	}
+	return s.Restart()
+}
+
+// probe checks s with healthy once a second for probation, returning the
+// first error.
+func probe(ctx context.Context, s Service, healthy func(Service) error, probation time.Duration) error {
+	step := time.Second
+	if probation < step {
+		step = probation
+	}
+	for end := time.Now().Add(probation); ; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(step):
+		}
+		if err := healthy(s); err != nil {
+			return err
+		}
+		if !time.Now().Before(end) {
+			return nil
+		}
+	}
+}
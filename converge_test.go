@@ -0,0 +1,117 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fileService is a running Service configured by the file at path, which
+// fails to run with the content bad.
+type fileService struct {
+	Service
+	path     string
+	content  string
+	bad      string
+	restarts int
+}
+
+func (s *fileService) configPath() (string, error) { return s.path, nil }
+
+func (s *fileService) render(w io.Writer) error {
+	_, err := io.WriteString(w, s.content)
+	return err
+}
+
+func (s *fileService) String() string { return "agent" }
+
+func (s *fileService) Restart() error {
+	s.restarts++
+	return nil
+}
+
+func (s *fileService) Status() (Status, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if string(b) == s.bad {
+		return StatusStopped, nil
+	}
+	return StatusRunning, nil
+}
+
+func TestConverge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "converge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.conf")
+	if err := ioutil.WriteFile(path, []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt := &ConvergeOptions{Probation: time.Millisecond}
+	ctx := context.Background()
+
+	s := &fileService{path: path, content: "v2\n", bad: "v3\n"}
+	var shown *ConfigDiff
+	opt.Diff = func(d *ConfigDiff) error {
+		shown = d
+		return nil
+	}
+	if err := opt.converge(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "v2\n" || s.restarts != 1 {
+		t.Errorf("converged to %q with %d restarts, want v2 with 1", b, s.restarts)
+	}
+	if shown == nil || len(shown.Changes) != 1 {
+		t.Errorf("diff shown %+v, want one change", shown)
+	}
+
+	s.content, s.restarts = "v3\n", 0
+	err = opt.converge(ctx, s)
+	if ce, ok := err.(*ConvergeError); !ok || ce.RollbackErr != nil {
+		t.Fatalf("converge to a failing config = %v, want rolled back", err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "v2\n" || s.restarts != 2 {
+		t.Errorf("rolled back to %q with %d restarts, want v2 with 2", b, s.restarts)
+	}
+
+	refused := errors.New("refused")
+	opt.Diff = func(*ConfigDiff) error { return refused }
+	if err := opt.converge(ctx, s); err != refused {
+		t.Errorf("converge refused by Diff = %v", err)
+	}
+
+	s.path = filepath.Join(dir, "missing.conf")
+	if err := opt.converge(ctx, s); err != ErrNotInstalled {
+		t.Errorf("converge without the file = %v, want %v", err, ErrNotInstalled)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	c, err := parseConfig("agent.json", []byte(`{"Name": "agent", "Option": {"LimitNOFILE": 65536, "Restart": "always", "Weight": 0.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Option.int("LimitNOFILE", 0) != 65536 || c.Option.string("Restart", "") != "always" || c.Option.float64("Weight", 0) != 0.5 {
+		t.Errorf("options %v", c.Option)
+	}
+	if _, err := parseConfig("agent.json", []byte(`{"Arguments": ["-v"]}`)); err == nil {
+		t.Error("config without a Name accepted")
+	}
+}
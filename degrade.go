@@ -0,0 +1,49 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"sort"
+	"sync"
+)
+
+// Degradation describes a platform feature that was not available at runtime
+// and the fallback that is used in its place.
+type Degradation struct {
+	Feature  string // Feature that is not available, such as "syslog".
+	Fallback string // Replacement in use, such as "stderr".
+	Err      error  // Reason the feature is not available.
+}
+
+var (
+	degradeLock  sync.Mutex
+	degradations = map[string]Degradation{}
+)
+
+// Degradations returns the features that fell back to a less capable
+// implementation in this process, sorted by Feature. The list is empty when
+// every feature used so far is fully available.
+func Degradations() []Degradation {
+	degradeLock.Lock()
+	defer degradeLock.Unlock()
+
+	list := make([]Degradation, 0, len(degradations))
+	for _, d := range degradations {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Feature < list[j].Feature })
+	return list
+}
+
+func degrade(feature, fallback string, err error) {
+	degradeLock.Lock()
+	defer degradeLock.Unlock()
+
+	degradations[feature] = Degradation{
+		Feature:  feature,
+		Fallback: fallback,
+		Err:      err,
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"errors"
+	"log/syslog"
+	"reflect"
+	"testing"
+)
+
+// clearDegradations empties the degradations of the process, returning a
+// function restoring them.
+func clearDegradations() (restore func()) {
+	degradeLock.Lock()
+	saved := degradations
+	degradations = map[string]Degradation{}
+	degradeLock.Unlock()
+	return func() {
+		degradeLock.Lock()
+		degradations = saved
+		degradeLock.Unlock()
+	}
+}
+
+func TestDegradations(t *testing.T) {
+	defer clearDegradations()()
+	defer func(f func(syslog.Priority, string) (*syslog.Writer, error)) { syslogNew = f }(syslogNew)
+	errNoSyslog := errors.New("no syslog socket")
+	syslogNew = func(syslog.Priority, string) (*syslog.Writer, error) { return nil, errNoSyslog }
+
+	if _, err := newSysLogger("demo", nil); err != nil {
+		t.Fatalf("newSysLogger without syslog = %v, want the stderr fallback", err)
+	}
+	degrade("pidfd", "pid", nil)
+	want := []Degradation{
+		{Feature: "pidfd", Fallback: "pid"},
+		{Feature: "syslog", Fallback: "stderr", Err: errNoSyslog},
+	}
+	for i := 0; i < 3; i++ {
+		if got := Degradations(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Degradations() = %+v, want %+v", got, want)
+		}
+	}
+}
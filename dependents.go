@@ -0,0 +1,39 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+const optionForce = "Force"
+
+// DependentsError is returned by Uninstall when other services depend on the
+// service, unless the Force option is set.
+type DependentsError struct {
+	Name       string
+	Dependents []string
+}
+
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("service %s is required by %s", e.Name, strings.Join(e.Dependents, ", "))
+}
+
+// checkDependents returns a DependentsError if dependents lists services that
+// depend on the service, unless the Force option is set.
+func (c *Config) checkDependents(dependents func() ([]string, error)) error {
+	if c.Option.bool(optionForce, false) {
+		return nil
+	}
+	list, err := dependents()
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return &DependentsError{Name: c.Name, Dependents: list}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+func TestCheckDependents(t *testing.T) {
+	dependents := func() ([]string, error) { return []string{"backup.service"}, nil }
+	c := &Config{Name: "db"}
+	err := c.checkDependents(dependents)
+	if e, ok := err.(*DependentsError); !ok || len(e.Dependents) != 1 {
+		t.Fatalf("checkDependents = %v, want a DependentsError", err)
+	}
+	if got, want := err.Error(), "service db is required by backup.service"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	c.Option = KeyValue{optionForce: true}
+	if err := c.checkDependents(dependents); err != nil {
+		t.Errorf("checkDependents with Force = %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigDiff is how the file Install writes differs from the installed one,
+// as returned by Diff.
+type ConfigDiff struct {
+	Path string // Path of the file.
+
+	// Unified is the unified diff from the installed file to the file
+	// Install writes, empty if they are the same.
+	Unified string
+
+	// Changes lists the changed fields, "[Section] Key" of a systemd unit,
+	// or "line N" of the installed file of other formats.
+	Changes []Change
+}
+
+// Change is a changed field of a ConfigDiff. Old is empty for a field being
+// added, New for a field being removed. Fields set more than once, such as
+// Environment, have their values separated by newlines.
+type Change struct {
+	Field    string
+	Old, New string
+}
+
+// configFiler is implemented by the services of service managers configured
+// by a file.
+type configFiler interface {
+	renderer
+	// configPath returns the path of the file.
+	configPath() (string, error)
+}
+
+// Diff compares the file of s installed with the file Install would write
+// for its current Config, without changing anything, so that tooling can
+// check configuration changes before applying them. A service that is not
+// installed is compared with an empty file. Diff returns ErrNotSupported for
+// service managers not configured by a file, such as Windows.
+func Diff(s Service) (*ConfigDiff, error) {
+	f, ok := s.(configFiler)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	path, err := f.configPath()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := f.render(&b); err != nil {
+		return nil, err
+	}
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	d := &ConfigDiff{Path: path}
+	ops := diffLines(splitLines(string(old)), splitLines(b.String()))
+	d.Unified = unifiedDiff("a"+path, "b"+path, ops)
+	switch filepath.Ext(path) {
+	case ".service", ".socket":
+		d.Changes = unitChanges(string(old), b.String())
+	default:
+		d.Changes = lineChanges(ops)
+	}
+	return d, nil
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffOp is a line kept (' '), removed ('-') or added ('+') by a diff. a
+// and b are the indexes of the line in the old and new lines, or of the
+// line following it if the line is not in them.
+type diffOp struct {
+	kind byte
+	a, b int
+	line string
+}
+
+// diffLines returns the edit script turning the lines a into b, by their
+// longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', i, j, a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', i, j, a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', i, j, b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// diffContext is the number of unchanged lines around changes in a hunk.
+const diffContext = 3
+
+// unifiedDiff formats ops as a unified diff of the files named from and to.
+func unifiedDiff(from, to string, ops []diffOp) string {
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk, which takes in
+		// changes closer than twice the context.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for k := first; k < len(ops) && k-last <= 2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		lo, hi := first-diffContext, last+diffContext+1
+		if lo < start {
+			lo = start
+		}
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+		}
+		var aLen, bLen int
+		for _, op := range ops[lo:hi] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(ops[lo].a, aLen), hunkRange(ops[lo].b, bLen))
+		for _, op := range ops[lo:hi] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		start = hi
+	}
+	return out.String()
+}
+
+// hunkRange formats the lines of a hunk from index i, the line before them
+// if there are none.
+func hunkRange(i, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", i)
+	}
+	if n == 1 {
+		return fmt.Sprint(i + 1)
+	}
+	return fmt.Sprintf("%d,%d", i+1, n)
+}
+
+// lineChanges returns the runs of removed and added lines of ops.
+func lineChanges(ops []diffOp) []Change {
+	var changes []Change
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		c := Change{Field: fmt.Sprintf("line %d", ops[k].a+1)}
+		var old, new []string
+		for ; k < len(ops) && ops[k].kind != ' '; k++ {
+			if ops[k].kind == '-' {
+				old = append(old, ops[k].line)
+			} else {
+				new = append(new, ops[k].line)
+			}
+		}
+		c.Old, c.New = strings.Join(old, "\n"), strings.Join(new, "\n")
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// unitChanges returns the changed directives of the systemd units old and
+// new, sorted by field.
+func unitChanges(old, new string) []Change {
+	o, n := unitFields(old), unitFields(new)
+	var changes []Change
+	for f, v := range o {
+		if n[f] != v {
+			changes = append(changes, Change{Field: f, Old: v, New: n[f]})
+		}
+	}
+	for f, v := range n {
+		if _, found := o[f]; !found {
+			changes = append(changes, Change{Field: f, New: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// unitFields returns the directives of a systemd unit by "[Section] Key".
+func unitFields(unit string) map[string]string {
+	fields := map[string]string{}
+	section := ""
+	for _, line := range splitLines(unit) {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			section = line
+		default:
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			f := section + " " + strings.TrimSpace(kv[0])
+			if v, found := fields[f]; found {
+				fields[f] = v + "\n" + strings.TrimSpace(kv[1])
+			} else {
+				fields[f] = strings.TrimSpace(kv[1])
+			}
+		}
+	}
+	return fields
+}
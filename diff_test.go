@@ -0,0 +1,65 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	ops := diffLines(splitLines(old), splitLines(new))
+	want := strings.Join([]string{
+		"--- a/x",
+		"+++ b/x",
+		"@@ -1,6 +1,6 @@",
+		" 1",
+		" 2",
+		"-3",
+		"+three",
+		" 4",
+		" 5",
+		" 6",
+		"@@ -13,3 +13,4 @@",
+		" 13",
+		" 14",
+		" 15",
+		"+16",
+		"",
+	}, "\n")
+	if got := unifiedDiff("a/x", "b/x", ops); got != want {
+		t.Errorf("unified diff:\n%s\nwant:\n%s", got, want)
+	}
+	if got := unifiedDiff("a/x", "b/x", diffLines(splitLines(old), splitLines(old))); got != "" {
+		t.Errorf("diff of equal files:\n%s", got)
+	}
+	want = "--- a/x\n+++ b/x\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got := unifiedDiff("a/x", "b/x", diffLines(nil, []string{"a", "b"})); got != want {
+		t.Errorf("diff of a new file:\n%s\nwant:\n%s", got, want)
+	}
+
+	changes := lineChanges(ops)
+	wantChanges := []Change{{"line 3", "3", "three"}, {"line 16", "", "16"}}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("line changes %q, want %q", changes, wantChanges)
+	}
+}
+
+func TestUnitChanges(t *testing.T) {
+	old := "[Unit]\nDescription=agent\n\n[Service]\nExecStart=/bin/agent\nEnvironment=A=1\nRestartSec=120\n"
+	new := "[Unit]\nDescription=agent\n\n[Service]\nExecStart=/bin/agent -v\nEnvironment=A=1\nEnvironment=B=2\nPrivateTmp=true\n"
+	want := []Change{
+		{"[Service] Environment", "A=1", "A=1\nB=2"},
+		{"[Service] ExecStart", "/bin/agent", "/bin/agent -v"},
+		{"[Service] PrivateTmp", "", "true"},
+		{"[Service] RestartSec", "120", ""},
+	}
+	if got := unitChanges(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("unit changes %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// DisplayNameSetter is implemented by the services of service managers that
+// can change the display name of an installed service, such as Windows.
+type DisplayNameSetter interface {
+	SetDisplayName(name string) error
+}
+
+// SetDisplayName changes the display name of the installed service s without
+// reinstalling it. It returns ErrNotSupported if the service manager of s
+// cannot.
+func SetDisplayName(s Service, name string) error {
+	if d, ok := s.(DisplayNameSetter); ok {
+		return d.SetDisplayName(name)
+	}
+	return ErrNotSupported
+}
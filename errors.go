@@ -0,0 +1,34 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "os"
+
+// serviceError is an error of the condition kind, one of the Err variables
+// such as ErrAlreadyInstalled, with a message of its own naming the file or
+// service. errors.Is reports it to be kind. Control also uses it to wrap the
+// error of an action, which is then kind.
+type serviceError struct {
+	kind error
+	msg  string
+}
+
+func (e *serviceError) Error() string { return e.msg }
+func (e *serviceError) Unwrap() error { return e.kind }
+
+// newError returns an error of the condition kind with the message msg.
+func newError(kind error, msg string) error {
+	return &serviceError{kind: kind, msg: msg}
+}
+
+// permissionError returns err as an ErrPermission if it reports missing
+// permissions, such as a configuration file of the service manager the
+// caller may not write, and err otherwise.
+func permissionError(err error) error {
+	if err != nil && os.IsPermission(err) {
+		return newError(ErrPermission, err.Error())
+	}
+	return err
+}
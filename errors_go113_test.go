@@ -0,0 +1,35 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.13
+// +build go1.13
+
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// installFailingService is a Service whose Install fails with err.
+type installFailingService struct {
+	Service
+	err error
+}
+
+func (s installFailingService) String() string { return "agent" }
+func (s installFailingService) Install() error { return s.err }
+
+func TestControlErrorIs(t *testing.T) {
+	for _, kind := range []error{ErrAlreadyInstalled, ErrNotInstalled, ErrPermission} {
+		s := installFailingService{err: newError(kind, "agent: "+kind.Error())}
+		err := Control(s, "install")
+		if !errors.Is(err, kind) {
+			t.Errorf("Control(install) = %v, not %v", err, kind)
+		}
+		if want := Message(MsgControlFailed, "install", s, s.err); err.Error() != want {
+			t.Errorf("Control(install) = %q, want %q", err, want)
+		}
+	}
+}
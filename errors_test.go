@@ -0,0 +1,37 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestServiceError(t *testing.T) {
+	kind := func(err error) error {
+		if u, ok := err.(interface{ Unwrap() error }); ok {
+			return u.Unwrap()
+		}
+		return nil
+	}
+
+	err := newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, "/etc/init.d/agent"))
+	if kind(err) != ErrAlreadyInstalled || err.Error() != "Init already exists: /etc/init.d/agent" {
+		t.Errorf("newError = %q of %v, want the message of ErrAlreadyInstalled", err, kind(err))
+	}
+
+	denied := &os.PathError{Op: "open", Path: "/etc/systemd/system/agent.service", Err: os.ErrPermission}
+	if err := permissionError(denied); kind(err) != ErrPermission || err.Error() != denied.Error() {
+		t.Errorf("permissionError = %q of %v, want the message of ErrPermission", err, kind(err))
+	}
+	other := errors.New("disk full")
+	if err := permissionError(other); err != other {
+		t.Errorf("permissionError(%v) = %v, want it unchanged", other, err)
+	}
+	if permissionError(nil) != nil {
+		t.Error("permissionError(nil) != nil")
+	}
+}
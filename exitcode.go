@@ -0,0 +1,48 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// Exit codes for a program run as a service, so service managers and scripts
+// can tell failure classes apart. A program would usually end with:
+//
+//	os.Exit(service.ExitCode(s.Run()))
+const (
+	ExitOK          = 0  // Clean shutdown.
+	ExitFailure     = 1  // Unclassified failure, including Interface.Start failing.
+	ExitStopFailed  = 2  // Interface.Stop failed.
+	ExitStopTimeout = 3  // The workload did not stop in time.
+	ExitCrashed     = 4  // The workload crashed.
+	ExitLocked      = 75 // Another instance holds a lock; try again later (EX_TEMPFAIL).
+	ExitConfig      = 78 // The configuration is invalid (EX_CONFIG).
+)
+
+// ExitError attaches an exit code to an error. Interface implementations
+// return it to select the code the service exits with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// ExitCode returns the exit code for an error returned by Run.
+func ExitCode(err error) int {
+	return exitCode(err, ExitFailure)
+}
+
+func exitCode(err error, defaultCode int) int {
+	switch err := err.(type) {
+	case nil:
+		return ExitOK
+	case *ExitError:
+		return err.Code
+	}
+	if err == ErrNameFieldRequired {
+		return ExitConfig
+	}
+	return defaultCode
+}
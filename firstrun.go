@@ -0,0 +1,106 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const (
+	optionStateDirectory = "StateDirectory"
+
+	firstRunMarker     = "first-run"
+	maxFirstRunBackoff = 5 * time.Minute
+)
+
+var minFirstRunBackoff = time.Second
+
+// FirstRunner is an Interface for a program with one time setup, such as
+// enrolling with a fleet server, to do once it first started successfully.
+type FirstRunner interface {
+	Interface
+	// FirstRun is called after Start returned until it succeeds once for the
+	// installation, retried with an increasing delay while it fails. It
+	// runs concurrently with the program and is not retried after Stop.
+	FirstRun(s Service) error
+}
+
+// stateDir returns the directory state of the service is kept in, the
+// StateDirectory option.
+func (c *Config) stateDir() (string, error) {
+	if dir := c.Option.string(optionStateDirectory, ""); dir != "" {
+		return dir, nil
+	}
+	if c.Option.bool(optionUserService, optionUserServiceDefault) {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, c.Name), nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("ProgramData"), c.Name), nil
+	case "darwin":
+		return filepath.Join("/Library/Application Support", c.Name), nil
+	}
+	return filepath.Join("/var/lib", c.Name), nil
+}
+
+// startFirstRun calls FirstRun of i in the background if i is a FirstRunner
+// that did not complete it yet. The returned function ends the retries.
+func (c *Config) startFirstRun(i Interface, s Service) (stop func()) {
+	fr, ok := i.(FirstRunner)
+	if !ok {
+		return func() {}
+	}
+	logger, _ := s.Logger(nil)
+	logError := func(err error) {
+		if logger != nil {
+			logger.Error(err)
+		}
+	}
+	dir, err := c.stateDir()
+	if err != nil {
+		logError(err)
+		return func() {}
+	}
+	marker := filepath.Join(dir, firstRunMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		backoff := minFirstRunBackoff
+		for {
+			err := fr.FirstRun(s)
+			if err == nil {
+				err = os.MkdirAll(dir, 0755)
+				if err == nil {
+					err = ioutil.WriteFile(marker, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644)
+				}
+				if err != nil {
+					logError(err)
+				}
+				return
+			}
+			logError(err)
+			select {
+			case <-done:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxFirstRunBackoff {
+				backoff = maxFirstRunBackoff
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type enrollingProgram struct {
+	mu    sync.Mutex
+	calls int
+	fail  int
+	done  chan struct{}
+}
+
+func (p *enrollingProgram) Start(s Service) error { return nil }
+func (p *enrollingProgram) Stop(s Service) error  { return nil }
+
+func (p *enrollingProgram) FirstRun(s Service) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.calls <= p.fail {
+		return errors.New("enrollment failed")
+	}
+	close(p.done)
+	return nil
+}
+
+func TestFirstRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firstrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { minFirstRunBackoff = d }(minFirstRunBackoff)
+	minFirstRunBackoff = time.Millisecond
+
+	c := &Config{Name: "enrolled", Option: KeyValue{optionStateDirectory: filepath.Join(dir, "state")}}
+	s := &loggingService{Service: &countingService{}, logger: &recordingLogger{}}
+	p := &enrollingProgram{fail: 2, done: make(chan struct{})}
+	stop := c.startFirstRun(p, s)
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FirstRun was not retried until it succeeded")
+	}
+	stop()
+
+	marker := filepath.Join(dir, "state", firstRunMarker)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+
+	again := &enrollingProgram{done: make(chan struct{})}
+	c.startFirstRun(again, s)()
+	time.Sleep(10 * time.Millisecond)
+	again.mu.Lock()
+	defer again.mu.Unlock()
+	if again.calls != 0 {
+		t.Errorf("FirstRun called %d times after it completed", again.calls)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Component is a part of a program run by a Group, such as a queue, a
+// database connection or an API server.
+type Component struct {
+	Name string
+	Interface
+
+	// ShutdownPriority orders stopping: components of a higher priority
+	// stop first, those of the same priority in parallel. Components start
+	// in the reverse order.
+	ShutdownPriority int
+
+	// StopTimeout, if set, is how long the Stop or Shutdown of the
+	// component may take before the next priority is stopped regardless.
+	StopTimeout time.Duration
+}
+
+// Group is an Interface running several components in one service and
+// stopping them in the order of their ShutdownPriority, as init systems
+// order the shutdown of services, so that for example a queue is flushed
+// before the database is closed and the database before the API stops.
+type Group struct {
+	Components []Component
+
+	mu      sync.Mutex
+	started []Component
+}
+
+// tiers returns the components grouped by priority, highest first.
+func tiers(components []Component) [][]Component {
+	sorted := append([]Component(nil), components...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ShutdownPriority > sorted[j].ShutdownPriority
+	})
+	var tiers [][]Component
+	for i, c := range sorted {
+		if i == 0 || c.ShutdownPriority != sorted[i-1].ShutdownPriority {
+			tiers = append(tiers, nil)
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], c)
+	}
+	return tiers
+}
+
+// Start starts the components, lowest priority first. If a component fails
+// to start, those already started are stopped.
+func (g *Group) Start(s Service) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.started = nil
+	t := tiers(g.Components)
+	for k := len(t) - 1; k >= 0; k-- {
+		for _, c := range t[k] {
+			if err := c.Start(s); err != nil {
+				g.stop(s, false)
+				return fmt.Errorf("start %s: %v", c.Name, err)
+			}
+			g.started = append(g.started, c)
+		}
+	}
+	return nil
+}
+
+// Stop stops the started components by priority.
+func (g *Group) Stop(s Service) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stop(s, false)
+}
+
+// Shutdown is Stop calling the Shutdown of components that are a
+// Shutdowner, for the system shutting down.
+func (g *Group) Shutdown(s Service) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stop(s, true)
+}
+
+// stop stops the started components tier by tier, the components of a
+// tier in parallel, and returns their errors.
+func (g *Group) stop(s Service, shutdown bool) error {
+	var errs []string
+	for _, tier := range tiers(g.started) {
+		results := make([]error, len(tier))
+		var wg sync.WaitGroup
+		for k, c := range tier {
+			wg.Add(1)
+			go func(k int, c Component) {
+				defer wg.Done()
+				results[k] = stopComponent(c, s, shutdown)
+			}(k, c)
+		}
+		wg.Wait()
+		for k, err := range results {
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("stop %s: %v", tier[k].Name, err))
+			}
+		}
+	}
+	g.started = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// stopComponent stops c, giving up after its StopTimeout.
+func stopComponent(c Component, s Service, shutdown bool) error {
+	stop := c.Stop
+	if sd, ok := c.Interface.(Shutdowner); ok && shutdown {
+		stop = sd.Shutdown
+	}
+	if c.StopTimeout <= 0 {
+		return stop(s)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- stop(s)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(c.StopTimeout):
+		return fmt.Errorf("did not stop within %v", c.StopTimeout)
+	}
+}
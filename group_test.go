@@ -0,0 +1,87 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderedComponent records the order components start and stop in.
+type orderedComponent struct {
+	name     string
+	log      *[]string
+	mu       *sync.Mutex
+	startErr error
+	hang     bool
+}
+
+func (c *orderedComponent) record(event string) {
+	c.mu.Lock()
+	*c.log = append(*c.log, event+" "+c.name)
+	c.mu.Unlock()
+}
+
+func (c *orderedComponent) Start(s Service) error {
+	c.record("start")
+	return c.startErr
+}
+
+func (c *orderedComponent) Stop(s Service) error {
+	if c.hang {
+		select {}
+	}
+	c.record("stop")
+	return nil
+}
+
+func TestGroup(t *testing.T) {
+	var log []string
+	var mu sync.Mutex
+	component := func(name string, priority int) Component {
+		return Component{Name: name, Interface: &orderedComponent{name: name, log: &log, mu: &mu}, ShutdownPriority: priority}
+	}
+	g := &Group{Components: []Component{
+		component("api", 1),
+		component("queue", 3),
+		component("db", 2),
+	}}
+	if err := g.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Stop(nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start api", "start db", "start queue", "stop queue", "stop db", "stop api"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("order %q, want %q", log, want)
+	}
+
+	log = nil
+	g.Components[1].Interface.(*orderedComponent).startErr = errors.New("broken")
+	if err := g.Start(nil); err == nil || !strings.Contains(err.Error(), "queue") {
+		t.Errorf("start with a failing component = %v", err)
+	}
+	want = []string{"start api", "start db", "start queue", "stop db", "stop api"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("order after a failed start %q, want %q", log, want)
+	}
+
+	g.Components[1].Interface.(*orderedComponent).startErr = nil
+	g.Components[1].Interface.(*orderedComponent).hang = true
+	g.Components[1].StopTimeout = 10 * time.Millisecond
+	log = nil
+	g.Start(nil)
+	if err := g.Stop(nil); err == nil || !strings.Contains(err.Error(), "queue: did not stop") {
+		t.Errorf("stop with a hung component = %v", err)
+	}
+	if got := log[len(log)-2:]; !reflect.DeepEqual(got, []string{"stop db", "stop api"}) {
+		t.Errorf("components after a hung one: %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "context"
+
+const optionNotify = "Notify"
+
+// Health is the result of the health checks of a running service, see
+// HealthChecker.
+type Health byte
+
+const (
+	HealthUnknown   Health = iota // The service has no health checks or is not running.
+	HealthStarting                // No check passed since the program started.
+	HealthHealthy                 // The last check passed.
+	HealthUnhealthy               // The checks failed more often than allowed.
+)
+
+var healthNames = [...]string{"unknown", "starting", "healthy", "unhealthy"}
+
+func (h Health) String() string {
+	if int(h) < len(healthNames) {
+		return healthNames[h]
+	}
+	return healthNames[HealthUnknown]
+}
+
+// parseHealth returns the Health named s, HealthUnknown for other text.
+func parseHealth(s string) Health {
+	for h, name := range healthNames {
+		if s == name {
+			return Health(h)
+		}
+	}
+	return HealthUnknown
+}
+
+// HealthChecker checks whether a running program is healthy, returning an
+// error describing the problem if it is not. Check should return when ctx
+// is done.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthFunc is a HealthChecker calling the function.
+type HealthFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f HealthFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// readyNotifier is implemented by an Interface that tells the service
+// manager itself when it is ready, see the Notify option, rather than once
+// Start returned.
+type readyNotifier interface {
+	notifiesReady() bool
+}
+
+// notifyReady tells the service manager that i started, unless i does so
+// itself.
+func notifyReady(i Interface) error {
+	if rn, ok := i.(readyNotifier); ok && rn.notifiesReady() {
+		return nil
+	}
+	return sdNotify("READY=1")
+}
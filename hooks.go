@@ -0,0 +1,138 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// Hook is an action run around a transition of the service, a shell
+// command, a function of the program or both, the command first.
+type Hook struct {
+	// Command is a command line run by /bin/sh -c, or cmd /C on Windows.
+	Command string
+
+	// Func is called by Run of the program.
+	Func func(s Service) error
+}
+
+// Hooks are the actions run around the transitions of the service. Where
+// the service manager supports it, it runs the commands itself: systemd
+// runs PreStart as ExecStartPre, PostStart as ExecStartPost, PreStop as
+// ExecStop and PostStop as ExecStopPost, where the commands also run after
+// the program exited on its own or crashed, with EXIT_CODE and EXIT_STATUS
+// set. For a program run by a Supervisor, see the PostExit commands of its
+// SupervisorConfig. Other commands, such as those of launchd and Windows
+// services which have no such settings, and all functions are run by Run
+// of the program, before and after it calls Start and Stop of the
+// Interface.
+//
+// As ExecStop, a PreStop command under systemd runs before systemd sends
+// the stop signal, so before Run calls Stop, within TimeoutStopSec. It also
+// runs once the program exited on its own, when there is nothing left to
+// stop; check $MAINPID, which is empty then, in a command that must only
+// run around a stop. Run interactively, the program runs all commands
+// itself.
+//
+// A failing PreStart hook fails the start; the errors of the other hooks
+// are logged.
+type Hooks struct {
+	PreStart  []Hook
+	PostStart []Hook
+	PreStop   []Hook
+	PostStop  []Hook
+}
+
+// hookRunner is implemented by the services of the service managers that
+// run the commands of the Hooks.
+type hookRunner interface {
+	runsHookCommands() bool
+}
+
+// runHooks runs hooks of the transition stage, such as "pre-start", in
+// order and returns the first error. The commands are left to the service
+// manager if it runs them, unless the program runs interactively.
+func (c *Config) runHooks(s Service, stage string, hooks []Hook) error {
+	hr, ok := s.(hookRunner)
+	native := ok && hr.runsHookCommands() && !Interactive()
+	for _, h := range hooks {
+		if h.Command != "" && !native {
+			if err := c.hookCommand(h.Command).Run(); err != nil {
+				return fmt.Errorf("%s hook %q: %v", stage, h.Command, err)
+			}
+		}
+		if h.Func != nil {
+			if err := h.Func(s); err != nil {
+				return fmt.Errorf("%s hook: %v", stage, err)
+			}
+		}
+	}
+	return nil
+}
+
+// logHooks runs hooks like runHooks, logging the error.
+func (c *Config) logHooks(s Service, stage string, hooks []Hook) {
+	if err := c.runHooks(s, stage, hooks); err != nil {
+		if logger, _ := s.Logger(nil); logger != nil {
+			logger.Warning(err)
+		}
+	}
+}
+
+// startProgram calls Start of i between the PreStart and PostStart Hooks,
+// unless the service runs as another account than it was installed for.
+func (c *Config) startProgram(i Interface, s Service) error {
+	if err := c.checkAccount(s); err != nil {
+		return err
+	}
+	if err := c.runHooks(s, "pre-start", c.Hooks.PreStart); err != nil {
+		return err
+	}
+	begin := time.Now()
+	err := i.Start(s)
+	report(TelemetryLifecycle, s, "start", begin, err)
+	if err == nil {
+		c.logHooks(s, "post-start", c.Hooks.PostStart)
+	}
+	return err
+}
+
+// stopProgram stops i within the ShutdownTimeout, calling Shutdown rather
+// than Stop if the host is shutting down and i is a Shutdowner.
+func (c *Config) stopProgram(i Interface, s Service, shutdown bool) error {
+	op, stop := "stop", i.Stop
+	if sd, ok := i.(Shutdowner); ok && shutdown {
+		op, stop = "shutdown", sd.Shutdown
+	}
+	c.logHooks(s, "pre-stop", c.Hooks.PreStop)
+	begin := time.Now()
+	err := c.stopWithin(i, s, stop)
+	report(TelemetryLifecycle, s, op, begin, err)
+	c.logHooks(s, "post-stop", c.Hooks.PostStop)
+	return err
+}
+
+// hookCommand returns the command running the command line of a hook in
+// the WorkingDirectory, with the output of the program.
+func (c *Config) hookCommand(line string) *exec.Cmd {
+	cmd := shellCommand(line)
+	cmd.Dir = c.WorkingDirectory
+	return cmd
+}
+
+// shellCommand returns the command running line by /bin/sh -c, or cmd /C
+// on Windows, with the output of the program.
+func shellCommand(line string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", line)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", line)
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd
+}
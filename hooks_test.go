@@ -0,0 +1,54 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+// hookService logs to the console.
+type hookService struct {
+	Service
+}
+
+func (hookService) String() string                      { return "agent" }
+func (hookService) Logger(chan<- error) (Logger, error) { return ConsoleLogger, nil }
+
+func TestHooks(t *testing.T) {
+	var got []string
+	record := func(name string) Hook {
+		return Hook{Func: func(Service) error {
+			got = append(got, name)
+			return nil
+		}}
+	}
+	c := &Config{Hooks: Hooks{
+		PreStart:  []Hook{record("pre-start")},
+		PostStart: []Hook{record("post-start")},
+		PreStop:   []Hook{record("pre-stop"), {Command: "exit 3"}},
+		PostStop:  []Hook{record("post-stop")},
+	}}
+	s := hookService{}
+	if err := c.startProgram(stoppingProgram{}, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.stopProgram(stoppingProgram{}, s, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pre-start", "post-start", "pre-stop", "post-stop"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hooks ran %q, want %q", got, want)
+	}
+
+	got = nil
+	c.Hooks.PreStart = []Hook{{Command: "exit 3"}, record("pre-start")}
+	if err := c.startProgram(stoppingProgram{}, s); err == nil {
+		t.Error("start succeeded with a failing pre-start hook")
+	}
+	if len(got) != 0 {
+		t.Errorf("hooks ran %q after a failing pre-start hook", got)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Operations of the system an Inhibitor delays.
+const (
+	InhibitSleep    = "sleep"    // Suspend and hibernation.
+	InhibitShutdown = "shutdown" // Power off and reboot.
+)
+
+// Inhibitor is a lock delaying system sleep or shutdown, see TakeInhibitor.
+type Inhibitor struct {
+	once    sync.Once
+	release func() error
+	err     error
+}
+
+// TakeInhibitor takes a lock delaying what, InhibitSleep, InhibitShutdown or
+// both separated by a colon, for the reason why until it is released, so that
+// critical sections such as updates are not cut short. The lock is released
+// when the process exits as well.
+//
+// On Linux the lock is taken from systemd-logind or elogind. On Windows sleep
+// is prevented with SetThreadExecutionState and a service delays shutdown in
+// the preshutdown phase, for up to the preshutdown timeout of the system. On
+// macOS sleep is prevented with a power assertion, a lock on shutdown is
+// recorded as a Degradation. Other systems return ErrNotSupported.
+func TakeInhibitor(what, why string) (*Inhibitor, error) {
+	var sleep, shutdown bool
+	for _, w := range strings.Split(what, ":") {
+		switch w {
+		case InhibitSleep:
+			sleep = true
+		case InhibitShutdown:
+			shutdown = true
+		default:
+			return nil, fmt.Errorf("unknown inhibitor %q", w)
+		}
+	}
+	release, err := takeInhibitor(sleep, shutdown, why)
+	if err != nil {
+		return nil, err
+	}
+	return &Inhibitor{release: release}, nil
+}
+
+// Release releases the lock. Calls after the first have no effect.
+func (in *Inhibitor) Release() error {
+	in.once.Do(func() {
+		in.err = in.release()
+	})
+	return in.err
+}
+
+// holdCommand runs the command name, which holds a lock while the command
+// given as its last arguments runs, until the returned function is called.
+// It returns once the lock is taken.
+func holdCommand(name string, args ...string) (func() error, error) {
+	cmd, err := toolCommand(name, append(args, "sh", "-c", "echo; exec cat")...)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// The command only runs sh once the lock is taken.
+	if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+		stdin.Close()
+		cmd.Wait()
+		return nil, fmt.Errorf("%s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	return func() error {
+		stdin.Close()
+		return cmd.Wait()
+	}, nil
+}
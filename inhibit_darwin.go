@@ -0,0 +1,17 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// takeInhibitor holds a power assertion against system and idle sleep with
+// caffeinate. launchd has no way to delay a shutdown.
+func takeInhibitor(sleep, shutdown bool, why string) (func() error, error) {
+	if shutdown {
+		degrade("shutdown inhibitor", "none", ErrNotSupported)
+	}
+	if !sleep {
+		return func() error { return nil }, nil
+	}
+	return holdCommand("caffeinate", "-i", "-s")
+}
@@ -0,0 +1,31 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func takeInhibitor(sleep, shutdown bool, why string) (func() error, error) {
+	tool := "systemd-inhibit"
+	if loginManager() == loginElogind {
+		tool = "elogind-inhibit"
+	}
+	var what []string
+	if sleep {
+		what = append(what, InhibitSleep)
+	}
+	if shutdown {
+		what = append(what, InhibitShutdown)
+	}
+	return holdCommand(tool,
+		"--what="+strings.Join(what, ":"),
+		"--who="+filepath.Base(os.Args[0]),
+		"--why="+why,
+		"--mode=block",
+	)
+}
@@ -0,0 +1,12 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package service
+
+func takeInhibitor(sleep, shutdown bool, why string) (func() error, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,32 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestTakeInhibitorWhat(t *testing.T) {
+	if _, err := TakeInhibitor("idle", "testing"); err == nil {
+		t.Error("TakeInhibitor accepted an unknown lock")
+	}
+}
+
+func TestHoldCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+	release, err := holdCommand("env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := release(); err != nil {
+		t.Errorf("release: %v", err)
+	}
+	if _, err := holdCommand("false"); err == nil {
+		t.Error("holdCommand succeeded with a failing command")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+)
+
+const (
+	esSystemRequired = 0x00000001
+	esContinuous     = 0x80000000
+)
+
+var procSetThreadExecutionState = windows.NewLazySystemDLL("kernel32.dll").NewProc("SetThreadExecutionState")
+
+// shutdownInhibitors counts the inhibitors on shutdown being held.
+var shutdownInhibitors int32
+
+func takeInhibitor(sleep, shutdown bool, why string) (func() error, error) {
+	if err := procSetThreadExecutionState.Find(); sleep && err != nil {
+		return nil, err
+	}
+	var awake chan struct{}
+	if sleep {
+		// The execution state belongs to the thread setting it, so a
+		// locked thread keeps it until the release.
+		awake = make(chan struct{})
+		held := make(chan struct{})
+		go func() {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			procSetThreadExecutionState.Call(esContinuous | esSystemRequired)
+			close(held)
+			<-awake
+			procSetThreadExecutionState.Call(esContinuous)
+		}()
+		<-held
+	}
+	if shutdown {
+		atomic.AddInt32(&shutdownInhibitors, 1)
+	}
+	return func() error {
+		if awake != nil {
+			close(awake)
+		}
+		if shutdown {
+			atomic.AddInt32(&shutdownInhibitors, -1)
+		}
+		return nil
+	}, nil
+}
+
+// waitShutdownInhibitors waits in the preshutdown phase until the inhibitors
+// on shutdown are released, reporting progress to the service manager, which
+// gives up waiting after the preshutdown timeout.
+func waitShutdownInhibitors(changes chan<- svc.Status) {
+	for i := uint32(1); atomic.LoadInt32(&shutdownInhibitors) > 0; i++ {
+		changes <- svc.Status{State: svc.StopPending, CheckPoint: i, WaitHint: 2000}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const optionInterpreter = "Interpreter"
+
+// InterpreterShebang is the value of the Interpreter option running the
+// Executable with the interpreter named by its "#!" line.
+const InterpreterShebang = "shebang"
+
+// shebangMax is the length of the "#!" line read from a script. Linux
+// itself reads at most 255 bytes and truncates longer lines.
+const shebangMax = 4096
+
+// readShebang returns the interpreter and its argument from the "#!" line
+// of the script at path, or nil if it has none. Like Linux, the text after
+// the interpreter is passed as a single argument.
+func readShebang(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReaderSize(f, shebangMax).ReadSlice('\n')
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if !bytes.HasPrefix(line, []byte("#!")) {
+		return nil, nil
+	}
+	s := strings.TrimSpace(string(line[2:]))
+	if s == "" {
+		return nil, fmt.Errorf("%s: empty #! line", path)
+	}
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return []string{s}, nil
+	}
+	return []string{s[:i], strings.TrimSpace(s[i+1:])}, nil
+}
+
+// resolveInterpreter returns the interpreter command cmd with the program,
+// cmd[0], as an absolute path: a bare name is looked up in PATH, and env is
+// replaced by the program it would run, so that the command does not
+// depend on the PATH of the service manager.
+func resolveInterpreter(cmd []string) ([]string, error) {
+	if filepath.Base(cmd[0]) == "env" {
+		cmd = strings.Fields(strings.Join(cmd[1:], " "))
+		if len(cmd) > 0 && cmd[0] == "-S" {
+			cmd = cmd[1:]
+		}
+		if len(cmd) == 0 || strings.HasPrefix(cmd[0], "-") {
+			return nil, fmt.Errorf("unsupported env interpreter %q", strings.Join(cmd, " "))
+		}
+	}
+	p, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return nil, err
+	}
+	if p, err = filepath.Abs(p); err != nil {
+		return nil, err
+	}
+	return append([]string{p}, cmd[1:]...), nil
+}
+
+// interpreter returns the command running the Executable under the
+// Interpreter option: the interpreter, its arguments and the path of the
+// script. It returns nil if the option is not set.
+func (c *Config) interpreter() ([]string, error) {
+	option := c.Option.string(optionInterpreter, "")
+	if option == "" {
+		return nil, nil
+	}
+	path, err := c.programPath()
+	if err != nil {
+		return nil, err
+	}
+	cmd := strings.Fields(option)
+	if option == InterpreterShebang {
+		if cmd, err = readShebang(path); err != nil {
+			return nil, err
+		}
+		if cmd == nil {
+			return nil, fmt.Errorf("%s has no #! line for the %s option", path, optionInterpreter)
+		}
+	}
+	if cmd, err = resolveInterpreter(cmd); err != nil {
+		return nil, err
+	}
+	return append(cmd, path), nil
+}
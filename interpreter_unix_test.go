@@ -0,0 +1,90 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux || darwin || solaris || aix || freebsd) && !service_minimal
+// +build linux darwin solaris aix freebsd
+// +build !service_minimal
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpreter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "interpreter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	sh, _ = filepath.Abs(sh)
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"#!/bin/sh\n", []string{"/bin/sh"}},
+		{"#! /bin/sh -e -u\n", []string{"/bin/sh", "-e -u"}},
+		{"echo hi\n", nil},
+		{"", nil},
+	}
+	script := filepath.Join(dir, "worker")
+	for _, tt := range tests {
+		ioutil.WriteFile(script, []byte(tt.line), 0755)
+		if got, err := readShebang(script); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readShebang(%q) = %q, %v, want %q", tt.line, got, err, tt.want)
+		}
+	}
+
+	for _, cmd := range [][]string{{"/usr/bin/env", "sh"}, {"/usr/bin/env", "-S sh -e"}, {"sh", "-e"}} {
+		got, err := resolveInterpreter(cmd)
+		if err != nil || got[0] != sh {
+			t.Errorf("resolveInterpreter(%q) = %q, %v, want %s", cmd, got, err, sh)
+		}
+	}
+
+	ioutil.WriteFile(script, []byte("#!/usr/bin/env sh\necho \"$@\"\n"), 0644)
+	c := &Config{Name: "worker", Executable: script, Arguments: []string{"-v"},
+		Option: KeyValue{optionInterpreter: InterpreterShebang}}
+	if p, err := c.execPath(); err != nil || p != sh {
+		t.Errorf("execPath() = %q, %v, want %s", p, err, sh)
+	}
+	conf, err := c.installConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{script, "-v"}; !reflect.DeepEqual(conf.Arguments, want) {
+		t.Errorf("installed Arguments = %q, want %q", conf.Arguments, want)
+	}
+
+	// The supervisor runs the interpreter itself, so a "#!" line longer
+	// than the kernel reads still works.
+	long := filepath.Join(dir, strings.Repeat("d", 200), strings.Repeat("i", 100))
+	if err := os.MkdirAll(long, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(sh, filepath.Join(long, "sh")); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(script, []byte("#!"+filepath.Join(long, "sh")+"\necho \"$@\"\n"), 0755)
+	sv := NewSupervisor(&SupervisorConfig{Exec: script, Args: []string{"ok"}})
+	ch, err := sv.command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.cmd.Stderr = nil
+	if out, err := ch.cmd.Output(); err != nil || string(out) != "ok\n" {
+		t.Errorf("script run by the supervisor wrote %q, %v", out, err)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const optionJournal = "Journal"
+
+// journalSocket is the socket of the native protocol of systemd-journald.
+var journalSocket = "/run/systemd/journal/socket"
+
+// JournalLogger is a Logger writing to the systemd journal with its native
+// protocol, so entries carry structured fields: the priority, the
+// SYSLOG_IDENTIFIER of the service, the Fields of the logger and those
+// passed to Send, such as MESSAGE_ID.
+type JournalLogger struct {
+	// Fields are added to every entry. Names are made of upper case
+	// letters, digits and underscores, see Send.
+	Fields map[string]string
+
+	identifier string
+	conn       *net.UnixConn
+	errs       chan<- error
+}
+
+// NewJournalLogger returns a JournalLogger writing entries of identifier,
+// usually the Name of the service. Errors are sent to errs too, if not nil.
+// It returns an error if there is no journal.
+func NewJournalLogger(identifier string, errs chan<- error) (*JournalLogger, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalLogger{identifier: identifier, conn: conn, errs: errs}, nil
+}
+
+// newJournalLogger returns a JournalLogger, or the syslog logger if there
+// is no journal or the Journal option is off.
+func newJournalLogger(c *Config, errs chan<- error) (Logger, error) {
+	if c.Option.bool(optionJournal, true) {
+		if l, err := NewJournalLogger(c.Name, errs); err == nil {
+			return l, nil
+		}
+	}
+	return newSysLogger(c.Name, errs)
+}
+
+// Send writes an entry of msg with priority and fields, in addition to the
+// Fields of l. Field names are converted to upper case, other characters
+// than letters, digits and underscores are replaced by underscores and
+// leading underscores, which mark the fields journald adds itself, are
+// removed.
+func (l *JournalLogger) Send(priority syslog.Priority, msg string, fields map[string]string) error {
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", msg)
+	journalField(&b, "PRIORITY", strconv.Itoa(int(priority&7)))
+	journalField(&b, "SYSLOG_IDENTIFIER", l.identifier)
+	for _, m := range []map[string]string{l.Fields, fields} {
+		for k, v := range m {
+			if k = journalFieldName(k); k != "" {
+				journalField(&b, k, v)
+			}
+		}
+	}
+	return l.send(l.write(b.Bytes()))
+}
+
+// write sends the entry as a datagram, or in a file passed to journald if
+// it is too large for one.
+func (l *JournalLogger) write(entry []byte) error {
+	_, err := l.conn.Write(entry)
+	if err == nil || !isMsgSize(err) {
+		return err
+	}
+	f, err := ioutil.TempFile("/dev/shm", "journal")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+	if _, err := f.Write(entry); err != nil {
+		return err
+	}
+	// WriteMsgUnix refuses a connected socket, the message is sent to it
+	// directly.
+	rc, err := l.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Write(func(fd uintptr) bool {
+		serr = unix.Sendmsg(int(fd), nil, unix.UnixRights(int(f.Fd())), nil, 0)
+		return serr != unix.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+func isMsgSize(err error) bool {
+	if op, ok := err.(*net.OpError); ok {
+		if sc, ok := op.Err.(*os.SyscallError); ok {
+			return sc.Err == unix.EMSGSIZE
+		}
+	}
+	return false
+}
+
+// journalField appends a field to the entry b, with the binary form for
+// values spanning lines.
+func journalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName returns the field name journald accepts for name, see
+// Send, empty if there is none.
+func journalFieldName(name string) string {
+	n := []byte(strings.ToUpper(name))
+	for i, c := range n {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			n[i] = '_'
+		}
+	}
+	return strings.TrimLeft(string(n), "_")
+}
+
+func (l *JournalLogger) send(err error) error {
+	if err != nil && l.errs != nil {
+		l.errs <- err
+	}
+	return err
+}
+
+// Close closes the connection to the journal.
+func (l *JournalLogger) Close() error {
+	return l.conn.Close()
+}
+
+func (l *JournalLogger) Error(v ...interface{}) error {
+	return l.Send(syslog.LOG_ERR, fmt.Sprint(v...), nil)
+}
+func (l *JournalLogger) Warning(v ...interface{}) error {
+	return l.Send(syslog.LOG_WARNING, fmt.Sprint(v...), nil)
+}
+func (l *JournalLogger) Info(v ...interface{}) error {
+	return l.Send(syslog.LOG_INFO, fmt.Sprint(v...), nil)
+}
+func (l *JournalLogger) Errorf(format string, a ...interface{}) error {
+	return l.Send(syslog.LOG_ERR, fmt.Sprintf(format, a...), nil)
+}
+func (l *JournalLogger) Warningf(format string, a ...interface{}) error {
+	return l.Send(syslog.LOG_WARNING, fmt.Sprintf(format, a...), nil)
+}
+func (l *JournalLogger) Infof(format string, a ...interface{}) error {
+	return l.Send(syslog.LOG_INFO, fmt.Sprintf(format, a...), nil)
+}
+func (l *JournalLogger) Errorw(msg string, keysAndValues ...interface{}) error {
+	return l.Send(syslog.LOG_ERR, msg, journalFields(keysAndValues))
+}
+func (l *JournalLogger) Warningw(msg string, keysAndValues ...interface{}) error {
+	return l.Send(syslog.LOG_WARNING, msg, journalFields(keysAndValues))
+}
+func (l *JournalLogger) Infow(msg string, keysAndValues ...interface{}) error {
+	return l.Send(syslog.LOG_INFO, msg, journalFields(keysAndValues))
+}
+
+// journalFields returns the key/value pairs as the fields of an entry.
+func journalFields(keysAndValues []interface{}) map[string]string {
+	fields := make(map[string]string, len(keysAndValues)/2)
+	for _, kv := range keyValues(keysAndValues) {
+		fields[kv[0]] = kv[1]
+	}
+	return fields
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// parseJournalEntry returns the fields of an entry of the native protocol.
+func parseJournalEntry(t *testing.T, b []byte) map[string]string {
+	fields := map[string]string{}
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		line := string(b[:nl])
+		b = b[nl+1:]
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			fields[line[:i]] = line[i+1:]
+			continue
+		}
+		n := binary.LittleEndian.Uint64(b)
+		fields[line] = string(b[8 : 8+n])
+		b = b[8+n+1:]
+	}
+	return fields
+}
+
+func TestJournalLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(s string) { journalSocket = s }(journalSocket)
+	journalSocket = filepath.Join(dir, "socket")
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	l, err := NewJournalLogger("agent", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Fields = map[string]string{"request-id": "42", "_PID": "1"}
+
+	read := func() map[string]string {
+		buf, oob := make([]byte, 1<<16), make([]byte, 64)
+		n, oobn, _, _, err := journal.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oobn == 0 {
+			return parseJournalEntry(t, buf[:n])
+		}
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "entry")
+		defer f.Close()
+		f.Seek(0, 0)
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseJournalEntry(t, b)
+	}
+
+	if err := l.Send(syslog.LOG_WARNING, "disk\nfull", map[string]string{"MESSAGE_ID": "fc2e22bc6ee647b6b90729ab34a250b1"}); err != nil {
+		t.Fatal(err)
+	}
+	got := read()
+	for k, want := range map[string]string{
+		"MESSAGE":           "disk\nfull",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "agent",
+		"MESSAGE_ID":        "fc2e22bc6ee647b6b90729ab34a250b1",
+		"REQUEST_ID":        "42",
+		"PID":               "1",
+	} {
+		if got[k] != want {
+			t.Errorf("field %s = %q, want %q", k, got[k], want)
+		}
+	}
+	if _, ok := got["_PID"]; ok {
+		t.Error("trusted field _PID passed to the journal")
+	}
+
+	if err := l.Infow("started", "listen-addr", ":80", 3); err != nil {
+		t.Fatal(err)
+	}
+	got = read()
+	if got["MESSAGE"] != "started" || got["PRIORITY"] != "6" || got["LISTEN_ADDR"] != ":80" || got["BADKEY"] != "3" {
+		t.Errorf("structured entry = %q", got)
+	}
+
+	large := strings.Repeat("x", 4<<20)
+	if err := l.Info(large); err != nil {
+		t.Skipf("large entry: %v", err)
+	}
+	if got := read(); got["MESSAGE"] != large {
+		t.Errorf("large entry of %d bytes, want %d", len(got["MESSAGE"]), len(large))
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options of the launchd property list.
+const (
+	optionKeepAliveSuccessfulExit = "KeepAliveSuccessfulExit"
+	optionKeepAliveNetworkState   = "KeepAliveNetworkState"
+	optionKeepAlivePathState      = "KeepAlivePathState"
+	optionThrottleInterval        = "ThrottleInterval"
+	optionLimitLoadToSessionType  = "LimitLoadToSessionType"
+)
+
+const defaultDarwinLogDirectory = "/usr/local/var/log"
+
+// launchdSocketsName is the name of the Sockets entry, which the program
+// passes to launch_activate_socket.
+const launchdSocketsName = "Listeners"
+
+// launchdSocket is an entry of the Sockets of a launchd job.
+type launchdSocket struct {
+	NodeName, ServiceName, PathName string
+}
+
+// parseLaunchdSocket translates a ListenStream address, "443",
+// "127.0.0.1:443" or "/run/agent.sock", to a launchd socket.
+func parseLaunchdSocket(addr string) (launchdSocket, error) {
+	if strings.HasPrefix(addr, "/") {
+		return launchdSocket{PathName: addr}, nil
+	}
+	if !strings.Contains(addr, ":") {
+		return launchdSocket{ServiceName: addr}, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return launchdSocket{}, fmt.Errorf("%s: %v", optionListenStream, err)
+	}
+	return launchdSocket{NodeName: host, ServiceName: port}, nil
+}
+
+// launchdPathState is an entry of the PathState condition of KeepAlive,
+// keeping the job alive while Path exists, or while it does not unless
+// Exists.
+type launchdPathState struct {
+	Path   string
+	Exists bool
+}
+
+// parsePathState parses the KeepAlivePathState option, paths separated by
+// commas, those prefixed with "!" keeping the job alive while they do not
+// exist.
+func parsePathState(s string) []launchdPathState {
+	var states []launchdPathState
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		st := launchdPathState{Path: strings.TrimPrefix(p, "!"), Exists: !strings.HasPrefix(p, "!")}
+		states = append(states, st)
+	}
+	// launchd reads a dictionary, which has no order.
+	sort.Slice(states, func(i, j int) bool { return states[i].Path < states[j].Path })
+	return states
+}
+
+// launchdSessionTypes returns the LimitLoadToSessionType option as a list.
+func launchdSessionTypes(c *Config) []string {
+	var types []string
+	for _, t := range strings.Split(c.Option.string(optionLimitLoadToSessionType, ""), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// launchdDomain returns the launchd domain the service is bootstrapped in:
+// the system domain for a daemon, and for an agent of the user uid the
+// domain of the GUI login session of the user, or of its background session
+// if the agent is limited to the Background session type, which also exists
+// for users logged in over SSH only.
+func launchdDomain(c *Config, uid int) string {
+	if !c.Option.bool(optionUserService, optionUserServiceDefault) {
+		return "system"
+	}
+	if types := launchdSessionTypes(c); len(types) == 1 && types[0] == "Background" {
+		return "user/" + strconv.Itoa(uid)
+	}
+	return "gui/" + strconv.Itoa(uid)
+}
+
+// launchdLogDirectory returns the directory of the log files of the service,
+// ~/Library/Logs for an agent as the user cannot write to the default.
+func launchdLogDirectory(c *Config) string {
+	dir := defaultDarwinLogDirectory
+	if c.Option.bool(optionUserService, optionUserServiceDefault) {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, "Library", "Logs")
+		}
+	}
+	return c.Option.string(optionLogDirectory, dir)
+}
+
+// launchdLogOutput reports whether the output of the service goes to log
+// files, which launchd services have unless LogOutput is false.
+func launchdLogOutput(c *Config) bool {
+	return c.Option.bool(optionLogOutput, true)
+}
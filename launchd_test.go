@@ -0,0 +1,69 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLaunchdSocket(t *testing.T) {
+	tests := []struct {
+		addr string
+		want launchdSocket
+	}{
+		{"443", launchdSocket{ServiceName: "443"}},
+		{"127.0.0.1:8080", launchdSocket{NodeName: "127.0.0.1", ServiceName: "8080"}},
+		{"[::1]:8080", launchdSocket{NodeName: "::1", ServiceName: "8080"}},
+		{"/var/run/agent.sock", launchdSocket{PathName: "/var/run/agent.sock"}},
+	}
+	for _, tt := range tests {
+		got, err := parseLaunchdSocket(tt.addr)
+		if err != nil || got != tt.want {
+			t.Errorf("parseLaunchdSocket(%q) = %+v, %v, want %+v", tt.addr, got, err, tt.want)
+		}
+	}
+	if _, err := parseLaunchdSocket("::1:8080"); err == nil {
+		t.Error("ambiguous IPv6 address accepted")
+	}
+}
+
+func TestParsePathState(t *testing.T) {
+	got := parsePathState(" /var/run/online, !/etc/agent.disabled,")
+	want := []launchdPathState{{"/etc/agent.disabled", false}, {"/var/run/online", true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePathState = %+v, want %+v", got, want)
+	}
+}
+
+func TestLaunchdDomain(t *testing.T) {
+	tests := []struct {
+		option KeyValue
+		want   string
+	}{
+		{nil, "system"},
+		{KeyValue{optionUserService: true}, "gui/501"},
+		{KeyValue{optionUserService: true, optionLimitLoadToSessionType: "Aqua"}, "gui/501"},
+		{KeyValue{optionUserService: true, optionLimitLoadToSessionType: "Background"}, "user/501"},
+		{KeyValue{optionUserService: true, optionLimitLoadToSessionType: "Aqua, Background"}, "gui/501"},
+	}
+	for _, tt := range tests {
+		if got := launchdDomain(&Config{Option: tt.option}, 501); got != tt.want {
+			t.Errorf("launchdDomain(%v) = %s, want %s", tt.option, got, tt.want)
+		}
+	}
+}
+
+func TestLaunchdLogOutput(t *testing.T) {
+	for option, want := range map[interface{}]bool{nil: true, true: true, false: false} {
+		c := &Config{Option: KeyValue{}}
+		if option != nil {
+			c.Option[optionLogOutput] = option
+		}
+		if got := launchdLogOutput(c); got != want {
+			t.Errorf("launchdLogOutput with LogOutput %v = %v, want %v", option, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Locker is a lock held by at most one of the instances of a service, such
+// as a file lock on shared storage or a lease of a coordination service,
+// electing the instance that runs the program of a Supervisor.
+type Locker interface {
+	// Lock blocks until the lock is taken or ctx is done. The channel
+	// returned is closed when the lock is lost, such as when a lease
+	// could not be renewed.
+	Lock(ctx context.Context) (lost <-chan struct{}, err error)
+
+	// Unlock releases the lock.
+	Unlock() error
+}
+
+// lockPollInterval is how often a FileLocker tries to take the lock and
+// checks that it still holds it.
+var lockPollInterval = time.Second
+
+// FileLocker returns a Locker taking an exclusive lock on the file at path,
+// created if needed, on a filesystem shared by the instances. The lock is
+// lost when the file is removed or replaced, which takes the instance
+// holding it down if the lock of an unreachable host was broken.
+func FileLocker(path string) Locker {
+	return &fileLocker{path: path}
+}
+
+type fileLocker struct {
+	path string
+
+	mu   sync.Mutex
+	f    *os.File
+	done chan struct{}
+}
+
+func (l *fileLocker) Lock(ctx context.Context) (<-chan struct{}, error) {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	lost, done := make(chan struct{}), make(chan struct{})
+	l.mu.Lock()
+	l.f, l.done = f, done
+	l.mu.Unlock()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(lockPollInterval):
+			}
+			held, err := f.Stat()
+			if err == nil {
+				var fi os.FileInfo
+				if fi, err = os.Stat(l.path); err == nil && !os.SameFile(held, fi) {
+					err = os.ErrNotExist
+				}
+			}
+			if err != nil {
+				close(lost)
+				return
+			}
+		}
+	}()
+	return lost, nil
+}
+
+func (l *fileLocker) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	close(l.done)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// locker returns the Locker electing the instance running the program, if
+// any.
+func (sv *Supervisor) locker() Locker {
+	if sv.Locker != nil {
+		return sv.Locker
+	}
+	if sv.LeaderLock != "" {
+		return FileLocker(sv.LeaderLock)
+	}
+	return nil
+}
+
+// lead runs the program while the instance holds the lock l, standing by
+// while another instance does. It reports whether the program ended on its
+// own rather than being stopped.
+func (sv *Supervisor) lead(l Locker, stop <-chan struct{}) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		sv.logInfof("%s standing by for the leader lock", sv.Exec)
+		lost, err := l.Lock(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			sv.logf("leader lock: %v", err)
+			select {
+			case <-stop:
+				return false
+			case <-time.After(duration(sv.RestartDelay, time.Second)):
+			}
+			continue
+		}
+		sv.logInfof("%s took the leader lock", sv.Exec)
+
+		sv.mu.Lock()
+		if sv.stopping {
+			sv.mu.Unlock()
+			l.Unlock()
+			return false
+		}
+		sv.standby = false
+		ch, err := sv.startChild()
+		sv.mu.Unlock()
+		if err != nil {
+			sv.logf("start %s: %v", sv.Exec, err)
+			l.Unlock()
+			return true
+		}
+
+		// The program is stopped when the lock is lost, for the
+		// instance taking it over to run it, and killed if it does not
+		// exit within the StopTimeout.
+		leading, finished := make(chan struct{}), make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+			case <-finished:
+			case <-lost:
+				sv.logf("%s lost the leader lock, stopping", sv.Exec)
+				sv.mu.Lock()
+				sv.standby = true
+				ch := sv.child
+				sv.mu.Unlock()
+				if ch == nil {
+					break
+				}
+				if err := stopProcess(ch); err != nil {
+					sv.logf("stop %s: %v", sv.Exec, err)
+				}
+				timeout := duration(sv.StopTimeout, 10*time.Second)
+				select {
+				case <-finished:
+				case <-time.After(timeout):
+					sv.logf("%s did not stop within %v, killing it", sv.Exec, timeout)
+					if err := killProcess(ch); err != nil {
+						sv.logf("kill %s: %v", sv.Exec, err)
+					}
+				}
+			}
+			close(leading)
+		}()
+		ended := sv.supervise(ch, leading)
+		close(finished)
+		<-leading
+		l.Unlock()
+
+		sv.mu.Lock()
+		standby := sv.standby && !sv.stopping
+		sv.mu.Unlock()
+		if !standby {
+			return ended
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux || darwin || freebsd) && !service_minimal
+// +build linux darwin freebsd
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// grantedLocker is a Locker granting the lock when the test sends the
+// channel signalling its loss.
+type grantedLocker struct {
+	grant    chan chan struct{}
+	unlocked chan struct{}
+}
+
+func (l *grantedLocker) Lock(ctx context.Context) (<-chan struct{}, error) {
+	select {
+	case lost := <-l.grant:
+		return lost, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *grantedLocker) Unlock() error {
+	l.unlocked <- struct{}{}
+	return nil
+}
+
+// running waits for sv to run the program or not.
+func running(t *testing.T, sv *Supervisor, want bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		sv.mu.Lock()
+		got := sv.child != nil
+		sv.mu.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("program running %v, want %v", !want, want)
+}
+
+func TestSupervisorLeader(t *testing.T) {
+	l := &grantedLocker{grant: make(chan chan struct{}), unlocked: make(chan struct{}, 4)}
+	sv := NewSupervisor(&SupervisorConfig{Exec: "sleep", Args: []string{"60"}, Restart: RestartAlways})
+	sv.Locker = l
+	s := quietService{}
+	if err := sv.Start(s); err != nil {
+		t.Fatal(err)
+	}
+	running(t, sv, false)
+
+	lost := make(chan struct{})
+	l.grant <- lost
+	running(t, sv, true)
+	close(lost)
+	<-l.unlocked
+	running(t, sv, false)
+
+	l.grant <- make(chan struct{})
+	running(t, sv, true)
+	if err := sv.Stop(s); err != nil {
+		t.Fatal(err)
+	}
+	<-l.unlocked
+	running(t, sv, false)
+}
+
+func TestSupervisorLeaderKill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ready := filepath.Join(dir, "ready")
+
+	l := &grantedLocker{grant: make(chan chan struct{}), unlocked: make(chan struct{}, 4)}
+	sv := NewSupervisor(&SupervisorConfig{
+		Exec:        "sh",
+		Args:        []string{"-c", "trap '' TERM; touch " + ready + "; sleep 60 & wait"},
+		StopTimeout: "200ms",
+	})
+	sv.Locker = l
+	s := quietService{}
+	if err := sv.Start(s); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.Stop(s)
+
+	// The program ignores SIGTERM, so it is only stopped by being killed.
+	lost := make(chan struct{})
+	l.grant <- lost
+	for i := 0; i < 200; i++ {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(lost)
+	select {
+	case <-l.unlocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("program ignoring SIGTERM not killed after losing the lock")
+	}
+	running(t, sv, false)
+}
+
+func TestFileLocker(t *testing.T) {
+	defer func(d time.Duration) { lockPollInterval = d }(lockPollInterval)
+	lockPollInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.lock")
+	l := FileLocker(path)
+	lost, err := l.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lost:
+		t.Fatal("lock lost while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	os.Remove(path)
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Error("lock not lost after its file was removed")
+	}
+	if err := l.Unlock(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const optionLinger = "Linger"
+
+// Login managers tracking the sessions of users.
+const (
+	loginSystemd    = "systemd-logind"
+	loginElogind    = "elogind"
+	loginConsoleKit = "consolekit"
+)
+
+var (
+	// lingerDir and elogindLingerDir hold a file for each user whose
+	// processes outlive the sessions of the user.
+	lingerDir        = "/var/lib/systemd/linger"
+	elogindLingerDir = "/var/lib/elogind/linger"
+
+	elogindPIDFile    = "/run/elogind.pid"
+	elogindConfFile   = "/etc/elogind/logind.conf"
+	consoleKitRunDir  = "/run/ConsoleKit"
+	systemdLogindSeat = "/run/systemd/seats"
+)
+
+var (
+	errNoLinger        = errors.New("user manager stops when the last session of the user ends, set the Linger option")
+	errKillUser        = errors.New("elogind kills the processes of a session at logout, KillUserProcesses is set")
+	errNoLingerManager = errors.New("login manager does not support lingering")
+)
+
+// loginManager returns the login manager of the system, or "" if sessions
+// are not tracked. elogind is the logind of systemd without systemd, and
+// shares the runtime directories of logind.
+func loginManager() string {
+	if _, err := os.Stat(elogindPIDFile); err == nil {
+		return loginElogind
+	}
+	if _, err := os.Stat(systemdLogindSeat); err == nil {
+		if isSystemd() {
+			return loginSystemd
+		}
+		return loginElogind
+	}
+	if _, err := os.Stat(consoleKitRunDir); err == nil {
+		return loginConsoleKit
+	}
+	return ""
+}
+
+// lingering reports whether the processes of the user name outlive the
+// sessions of the user.
+func lingering(name string) bool {
+	dir := lingerDir
+	if loginManager() == loginElogind {
+		dir = elogindLingerDir
+	}
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+// sshSession reports whether the process runs in an SSH login session.
+func sshSession() bool {
+	return os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+}
+
+// enableLinger keeps the user manager, or with elogind the runtime
+// directory of the user, after logout if the Linger option is set, so user
+// services are not stopped with the session.
+func (c *Config) enableLinger() error {
+	if !c.Option.bool(optionLinger, false) {
+		return nil
+	}
+	switch loginManager() {
+	case loginSystemd, loginElogind:
+	default:
+		degrade("linger", "stopped at logout", errNoLingerManager)
+		return nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	if lingering(u.Username) {
+		return nil
+	}
+	return run("loginctl", "enable-linger", u.Username)
+}
+
+// checkLinger records a degradation when a user service is started from an
+// SSH session and the user manager, with the service, is going to be stopped
+// at logout.
+func (c *Config) checkLinger() {
+	if !sshSession() {
+		return
+	}
+	u, err := user.Current()
+	if err != nil || lingering(u.Username) {
+		return
+	}
+	degrade("systemd user manager", "stopped at logout", errNoLinger)
+}
+
+// keepSession prepares a service run from a login session on a system
+// without systemd, such as a user level agent started at login, to outlive
+// the session if the Linger option is set. elogind kills the processes of
+// the session regardless if KillUserProcesses is set, which is recorded as a
+// degradation.
+func (c *Config) keepSession() error {
+	if os.Getenv("XDG_SESSION_ID") == "" || loginManager() != loginElogind {
+		return nil
+	}
+	if !c.Option.bool(optionLinger, false) {
+		return nil
+	}
+	if killUserProcesses() {
+		degrade("elogind session", "stopped at logout", errKillUser)
+	}
+	return c.enableLinger()
+}
+
+// killUserProcesses reports whether elogind is configured to kill the
+// processes of sessions at logout.
+func killUserProcesses() bool {
+	f, err := os.Open(elogindConfFile)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	kill := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(sc.Text()), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "KillUserProcesses" {
+			switch strings.ToLower(strings.TrimSpace(kv[1])) {
+			case "yes", "true", "on", "1":
+				kill = true
+			default:
+				kill = false
+			}
+		}
+	}
+	return kill
+}
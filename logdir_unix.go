@@ -0,0 +1,59 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// prepareLogFiles creates the log directory dir and the log files named in
+// it, owned by the UserName of c if set, so a service running unprivileged
+// can write its output. Existing files keep their content.
+func (c *Config) prepareLogFiles(dir string, names ...string) error {
+	uid, gid := -1, -1
+	if c.UserName != "" {
+		u, err := user.Lookup(c.userName())
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if uid != -1 {
+			if err := os.Chown(dir, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		if uid != -1 {
+			if err := os.Chown(path, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	policyCreateAccount = 0x00000010
+	policyLookupNames   = 0x00000800
+
+	seServiceLogonRight = "SeServiceLogonRight"
+)
+
+var (
+	modadvapi32               = windows.NewLazySystemDLL("advapi32.dll")
+	procLsaOpenPolicy         = modadvapi32.NewProc("LsaOpenPolicy")
+	procLsaAddAccountRights   = modadvapi32.NewProc("LsaAddAccountRights")
+	procLsaClose              = modadvapi32.NewProc("LsaClose")
+	procLsaNtStatusToWinError = modadvapi32.NewProc("LsaNtStatusToWinError")
+)
+
+// lsaError returns the error of an NTSTATUS returned by an LSA function.
+func lsaError(status uintptr) error {
+	if status == 0 {
+		return nil
+	}
+	code, _, _ := procLsaNtStatusToWinError.Call(status)
+	return windows.Errno(code)
+}
+
+// grantServiceLogon grants account the "Log on as a service" right in the
+// local security policy, which it needs to run services. Granting a right
+// held already is not an error.
+func grantServiceLogon(account string) error {
+	sid, _, _, err := windows.LookupSID("", account)
+	if err != nil {
+		return err
+	}
+	if err := procLsaOpenPolicy.Find(); err != nil {
+		return err
+	}
+	var attrs windows.OBJECT_ATTRIBUTES
+	attrs.Length = uint32(unsafe.Sizeof(attrs))
+	var policy windows.Handle
+	status, _, _ := procLsaOpenPolicy.Call(0, uintptr(unsafe.Pointer(&attrs)), policyCreateAccount|policyLookupNames, uintptr(unsafe.Pointer(&policy)))
+	if err := lsaError(status); err != nil {
+		return err
+	}
+	defer procLsaClose.Call(uintptr(policy))
+
+	right, err := windows.NewNTUnicodeString(seServiceLogonRight)
+	if err != nil {
+		return err
+	}
+	status, _, _ = procLsaAddAccountRights.Call(uintptr(policy), uintptr(unsafe.Pointer(sid)), uintptr(unsafe.Pointer(right)), 1)
+	return lsaError(status)
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"text/template"
+)
+
+var logrotateDir = "/etc/logrotate.d"
+
+// installLogFiles prepares the log files named in dir for the service and,
+// with the LogRotate option, installs a logrotate configuration for them.
+func (c *Config) installLogFiles(dir string, names ...string) error {
+	if err := c.prepareLogFiles(dir, names...); err != nil {
+		return err
+	}
+	if !c.Option.bool(optionLogRotate, optionLogRotateDefault) {
+		return nil
+	}
+
+	var to = &struct {
+		Files       []string
+		User, Group string
+	}{}
+	for _, name := range names {
+		to.Files = append(to.Files, filepath.Join(dir, name))
+	}
+	if c.UserName != "" {
+		u, err := user.Lookup(c.userName())
+		if err != nil {
+			return err
+		}
+		to.User, to.Group = u.Username, u.Gid
+		if g, err := user.LookupGroupId(u.Gid); err == nil {
+			to.Group = g.Name
+		}
+	}
+
+	f, err := os.Create(filepath.Join(logrotateDir, c.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return template.Must(template.New("").Funcs(tf).Parse(logrotateConfig)).Execute(f, to)
+}
+
+// removeLogrotate removes the logrotate configuration of the service, if any.
+func (c *Config) removeLogrotate() error {
+	err := os.Remove(filepath.Join(logrotateDir, c.Name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Output is copied and truncated as the service keeps its log files open.
+const logrotateConfig = `{{range .Files}}"{{.}}" {{end}}{
+	weekly
+	rotate 4
+	compress
+	delaycompress
+	missingok
+	notifempty
+	copytruncate
+{{- if .User}}
+	su {{.User}} {{.Group}}
+{{- end}}
+}
+`
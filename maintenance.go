@@ -0,0 +1,150 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MaintenanceCalendar lists when automatic restarts and updates may
+// happen. It is usually loaded from a JSON file with
+// LoadMaintenanceCalendar, for example:
+//
+//	{
+//		"Weekly": [{"Days": ["Sat", "Sun"], "From": "02:00", "To": "05:00"}],
+//		"Blackouts": [{"Start": "2026-12-24T00:00:00Z", "End": "2026-12-27T00:00:00Z"}]
+//	}
+//
+// Explicit operator commands are not subject to the calendar.
+type MaintenanceCalendar struct {
+	// Weekly and Windows are the periods maintenance may happen in. If both
+	// are empty maintenance may happen at any time outside the Blackouts.
+	Weekly  []WeeklyWindow
+	Windows []TimeWindow
+
+	// Blackouts are periods, such as holidays, maintenance must not
+	// happen in even within a maintenance window.
+	Blackouts []TimeWindow
+}
+
+// WeeklyWindow is a period recurring on some days of each week, in local
+// time. A window ending before it starts ends on the next day.
+type WeeklyWindow struct {
+	Days     []string // Days of the week the window starts on, such as "Mon".
+	From, To string   // Time of day in 24 hour "15:04" form.
+}
+
+// TimeWindow is a single period.
+type TimeWindow struct {
+	Start, End time.Time
+}
+
+// LoadMaintenanceCalendar reads a MaintenanceCalendar from the JSON file at
+// path.
+func LoadMaintenanceCalendar(path string) (*MaintenanceCalendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &MaintenanceCalendar{}
+	if err := json.NewDecoder(f).Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, c.validate()
+}
+
+func (c *MaintenanceCalendar) validate() error {
+	for _, w := range c.Weekly {
+		for _, d := range w.Days {
+			if _, ok := weekday(d); !ok {
+				return fmt.Errorf("maintenance: unknown day %q", d)
+			}
+		}
+		for _, t := range []string{w.From, w.To} {
+			if _, err := time.Parse("15:04", t); err != nil {
+				return fmt.Errorf("maintenance: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether maintenance may happen at t. A nil calendar
+// allows maintenance at any time.
+func (c *MaintenanceCalendar) Allowed(t time.Time) bool {
+	if c == nil {
+		return true
+	}
+	for _, w := range c.Blackouts {
+		if w.contains(t) {
+			return false
+		}
+	}
+	if len(c.Weekly) == 0 && len(c.Windows) == 0 {
+		return true
+	}
+	for _, w := range c.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	for _, w := range c.Weekly {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w TimeWindow) contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+func (w WeeklyWindow) contains(t time.Time) bool {
+	t = t.Local()
+	from, _ := time.Parse("15:04", w.From)
+	to, _ := time.Parse("15:04", w.To)
+	// Check the windows starting on the day of t and the day before, which
+	// may extend past midnight.
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		if !w.on(day.Weekday()) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), from.Hour(), from.Minute(), 0, 0, time.Local)
+		end := time.Date(day.Year(), day.Month(), day.Day(), to.Hour(), to.Minute(), 0, 0, time.Local)
+		if !end.After(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w WeeklyWindow) on(d time.Weekday) bool {
+	for _, name := range w.Days {
+		if wd, _ := weekday(name); wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// weekday parses the name of a day of the week, such as "Mon" or "monday".
+func weekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if len(name) >= 3 && strings.HasPrefix(strings.ToLower(d.String()), strings.ToLower(name)) {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceCalendar(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		// 2026-03-02 is a Monday.
+		return time.Date(2026, 3, 1+day, hour, 30, 0, 0, time.Local)
+	}
+	c := &MaintenanceCalendar{
+		Weekly:    []WeeklyWindow{{Days: []string{"Sat"}, From: "22:00", To: "02:00"}},
+		Windows:   []TimeWindow{{Start: at(3, 9), End: at(3, 11)}},
+		Blackouts: []TimeWindow{{Start: at(13, 0), End: at(15, 0)}},
+	}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(6, 21), false}, // Saturday before the window.
+		{at(6, 22), true},
+		{at(7, 1), true}, // Past midnight into Sunday.
+		{at(7, 2), false},
+		{at(3, 10), true},   // One-off window.
+		{at(13, 23), false}, // Saturday in a blackout.
+	}
+	for _, tt := range tests {
+		if got := c.Allowed(tt.t); got != tt.want {
+			t.Errorf("Allowed(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+
+	var none *MaintenanceCalendar
+	if !none.Allowed(at(0, 0)) {
+		t.Error("nil calendar does not allow maintenance")
+	}
+	c = &MaintenanceCalendar{Weekly: []WeeklyWindow{{Days: []string{"Caturday"}, From: "1:00", To: "2:00"}}}
+	if err := c.validate(); err == nil {
+		t.Error("unknown day accepted")
+	}
+}
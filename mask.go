@@ -0,0 +1,33 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// Masker is implemented by the services of the service managers that support
+// CapMask.
+type Masker interface {
+	// Mask prevents the service from being started, by this package or any
+	// other tooling, until Unmask is called. It does not stop the service.
+	// Status reports StatusMasked for a stopped, masked service.
+	Mask() error
+	// Unmask allows the service to be started again.
+	Unmask() error
+}
+
+// Mask prevents s from being started, see Masker. It returns
+// ErrNotSupported if the service manager of s cannot mask services.
+func Mask(s Service) error {
+	if m, ok := s.(Masker); ok {
+		return m.Mask()
+	}
+	return ErrNotSupported
+}
+
+// Unmask allows s to be started again after Mask.
+func Unmask(s Service) error {
+	if m, ok := s.(Masker); ok {
+		return m.Unmask()
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// MessageID identifies an operator facing message that may be translated.
+type MessageID string
+
+// Messages shown to operators. The English text of each message is a fmt
+// format string; translations must accept the same arguments in the same order.
+const (
+	MsgStatusUnknown  MessageID = "status.unknown"          // Status text.
+	MsgStatusRunning  MessageID = "status.running"          // Status text.
+	MsgStatusStopped  MessageID = "status.stopped"          // Status text.
+	MsgStatusMasked   MessageID = "status.masked"           // Status text.
+	MsgUnknownAction  MessageID = "control.unknown"         // action
+	MsgControlFailed  MessageID = "control.failed"          // action, service, error
+	MsgAlreadyExists  MessageID = "install.exists"          // path
+	MsgManifestExists MessageID = "install.exists.manifest" // path
+	MsgServiceExists  MessageID = "install.exists.service"  // name
+	MsgNotInstalledAs MessageID = "install.missing"         // name
+)
+
+// Catalog maps message IDs to format strings for a single locale.
+type Catalog map[MessageID]string
+
+var defaultCatalog = Catalog{
+	MsgStatusUnknown:  "unknown",
+	MsgStatusRunning:  "running",
+	MsgStatusStopped:  "stopped",
+	MsgStatusMasked:   "masked",
+	MsgUnknownAction:  "Unknown action %s",
+	MsgControlFailed:  "Failed to %s %v: %v",
+	MsgAlreadyExists:  "Init already exists: %s",
+	MsgManifestExists: "Manifest already exists: %s",
+	MsgServiceExists:  "service %s already exists",
+	MsgNotInstalledAs: "service %s is not installed",
+}
+
+var (
+	catalogLock sync.RWMutex
+	catalogs    = map[string]Catalog{"en": defaultCatalog}
+	locale      = localeFromEnv()
+)
+
+// RegisterCatalog adds or replaces the messages for the given locale, such as
+// "de" or "pt-BR". Messages missing from the catalog fall back to the parent
+// locale and then to English.
+func RegisterCatalog(locale string, c Catalog) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+
+	catalogs[normalizeLocale(locale)] = c
+}
+
+// SetLocale selects the locale used for operator facing messages.
+// By default the locale is taken from LC_ALL, LC_MESSAGES or LANG.
+func SetLocale(l string) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+
+	locale = normalizeLocale(l)
+}
+
+// Locale returns the locale used for operator facing messages.
+func Locale() string {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+
+	return locale
+}
+
+// Message returns the translated text for id formatted with a.
+func Message(id MessageID, a ...interface{}) string {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+
+	format := lookupMessage(locale, id)
+	if len(a) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, a...)
+}
+
+// lookupMessage walks from the most to the least specific locale.
+// catalogLock must be held.
+func lookupMessage(l string, id MessageID) string {
+	for l != "" {
+		if format, found := catalogs[l][id]; found {
+			return format
+		}
+		i := strings.LastIndexByte(l, '-')
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	if format, found := defaultCatalog[id]; found {
+		return format
+	}
+	return string(id)
+}
+
+func localeFromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return normalizeLocale(v)
+		}
+	}
+	return "en"
+}
+
+// normalizeLocale turns POSIX style locales such as "pt_BR.UTF-8@euro" into
+// the "pt-BR" form used as catalog keys.
+func normalizeLocale(l string) string {
+	if i := strings.IndexAny(l, ".@"); i >= 0 {
+		l = l[:i]
+	}
+	l = strings.Replace(l, "_", "-", -1)
+	if l == "" || l == "C" || l == "POSIX" {
+		return "en"
+	}
+	parts := strings.Split(l, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i])
+	}
+	return strings.Join(parts, "-")
+}
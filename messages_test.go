@@ -0,0 +1,53 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+func Test_normalizeLocale(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "en"},
+		{"C", "en"},
+		{"POSIX", "en"},
+		{"de", "de"},
+		{"pt_BR.UTF-8", "pt-BR"},
+		{"de_DE@euro", "de-DE"},
+		{"zh-hant-tw", "zh-HANT-TW"},
+	}
+	for _, tt := range tests {
+		if got := normalizeLocale(tt.in); got != tt.want {
+			t.Errorf("normalizeLocale(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMessageFallback(t *testing.T) {
+	old := Locale()
+	defer SetLocale(old)
+
+	RegisterCatalog("xx", Catalog{
+		MsgStatusRunning: "xx-running",
+		MsgUnknownAction: "xx %s",
+	})
+	RegisterCatalog("xx_YY", Catalog{
+		MsgStatusRunning: "xx-YY-running",
+	})
+
+	SetLocale("xx_YY.UTF-8")
+	if got := Message(StatusRunning.MessageID()); got != "xx-YY-running" {
+		t.Errorf("region message = %q", got)
+	}
+	if got := Message(MsgUnknownAction, "jump"); got != "xx jump" {
+		t.Errorf("language fallback = %q", got)
+	}
+	if got := Message(StatusStopped.MessageID()); got != "stopped" {
+		t.Errorf("english fallback = %q", got)
+	}
+	if got := StatusRunning.String(); got != "running" {
+		t.Errorf("String() = %q, want it in English", got)
+	}
+}
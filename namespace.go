@@ -0,0 +1,72 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+const optionNamespace = "Namespace"
+
+// namespacePattern restricts namespaces to names valid in units, launchd
+// labels, SMF FMRIs and Windows service names alike.
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.]*$`)
+
+// namespacedOptions are the options holding paths of the service, whose
+// file names are put in the namespace.
+var namespacedOptions = []string{optionPIDFile, optionStateDirectory}
+
+// Namespaced returns name in namespace, "<namespace>-<name>", or name if
+// namespace is empty.
+func Namespaced(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "-" + name
+}
+
+// NamespacedPath returns path with its file name in namespace, such as
+// /run/tenant-agent.pid for /run/agent.pid.
+func NamespacedPath(namespace, path string) string {
+	if namespace == "" || path == "" {
+		return path
+	}
+	dir, file := filepath.Split(path)
+	return dir + Namespaced(namespace, file)
+}
+
+// namespaced returns the Config c stands for in the namespace of its
+// Namespace option, c itself without one. The name and display name of the
+// service and the paths of its PID file and state directory are put in the
+// namespace, and with them the unit, manifest and log file names and the
+// log identifier derived from the name.
+func (c *Config) namespaced() (*Config, error) {
+	ns := c.Option.string(optionNamespace, "")
+	if ns == "" {
+		return c, nil
+	}
+	if !namespacePattern.MatchString(ns) {
+		return nil, fmt.Errorf("invalid %s option %q", optionNamespace, ns)
+	}
+	nc := *c
+	nc.Name = Namespaced(ns, c.Name)
+	if c.DisplayName != "" {
+		nc.DisplayName = c.DisplayName + " (" + ns + ")"
+	}
+	nc.Option = make(KeyValue, len(c.Option))
+	for k, v := range c.Option {
+		nc.Option[k] = v
+	}
+	// The namespace is applied once.
+	delete(nc.Option, optionNamespace)
+	for _, name := range namespacedOptions {
+		if p := nc.Option.string(name, ""); p != "" {
+			nc.Option[name] = NamespacedPath(ns, p)
+		}
+	}
+	return &nc, nil
+}
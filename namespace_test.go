@@ -0,0 +1,50 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+func TestNamespaced(t *testing.T) {
+	c := &Config{
+		Name:        "agent",
+		DisplayName: "Agent",
+		Option: KeyValue{
+			optionNamespace:      "tenant1",
+			optionPIDFile:        "/run/agent.pid",
+			optionStateDirectory: "/var/lib/agent",
+			optionRestart:        RestartAlways,
+		},
+	}
+	nc, err := c.namespaced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc.Name != "tenant1-agent" || nc.DisplayName != "Agent (tenant1)" {
+		t.Errorf("namespaced name %q, display name %q", nc.Name, nc.DisplayName)
+	}
+	if p := nc.Option.string(optionPIDFile, ""); p != "/run/tenant1-agent.pid" {
+		t.Errorf("namespaced PIDFile %q", p)
+	}
+	if p := nc.Option.string(optionStateDirectory, ""); p != "/var/lib/tenant1-agent" {
+		t.Errorf("namespaced StateDirectory %q", p)
+	}
+	if nc.Option.string(optionRestart, "") != RestartAlways {
+		t.Error("other options not kept")
+	}
+	if c.Name != "agent" || c.Option.string(optionPIDFile, "") != "/run/agent.pid" {
+		t.Error("Config changed by namespaced")
+	}
+	if again, _ := nc.namespaced(); again.Name != nc.Name {
+		t.Errorf("namespace applied twice: %q", again.Name)
+	}
+
+	c.Option[optionNamespace] = "../x"
+	if _, err := c.namespaced(); err == nil {
+		t.Error("invalid namespace accepted")
+	}
+	if got := NamespacedPath("", "/run/agent.sock"); got != "/run/agent.sock" {
+		t.Errorf("path without namespace %q", got)
+	}
+}
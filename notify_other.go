@@ -0,0 +1,14 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !solaris && !aix && !freebsd
+// +build !linux,!darwin,!solaris,!aix,!freebsd
+
+package service
+
+// sdNotify does nothing, the service managers here have no notification
+// socket.
+func sdNotify(state string) error {
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OperationStep is an internal step of a traced control operation, such as
+// an external command run or a call to the service control manager.
+type OperationStep struct {
+	Step     string        // Such as "exec systemctl start agent.service".
+	Begin    time.Time     // Start of the step.
+	Duration time.Duration // Time the step took.
+	Err      error         // Error of the step, nil if it succeeded.
+}
+
+// OperationTrace records the steps of a control operation, see
+// TraceControl.
+type OperationTrace struct {
+	Action   string
+	Begin    time.Time
+	Duration time.Duration
+	Steps    []OperationStep
+
+	done bool // Steps still running at the end are left as they are.
+}
+
+// String formats the trace one step per line, with the offset of the step
+// from the beginning of the operation and its duration.
+func (t *OperationTrace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s took %v\n", t.Action, t.Duration.Round(time.Millisecond))
+	for _, st := range t.Steps {
+		fmt.Fprintf(&b, "  +%-8v %-8v %s", st.Begin.Sub(t.Begin).Round(time.Millisecond), st.Duration.Round(time.Millisecond), st.Step)
+		if st.Err != nil {
+			fmt.Fprintf(&b, ": %v", st.Err)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+var (
+	// traceControlLock serializes the traced operations.
+	traceControlLock sync.Mutex
+
+	operationTraceLock sync.Mutex
+	operationTrace     *OperationTrace
+)
+
+// TraceControl is Control recording the steps the action takes, such as
+// the exact commands run with their exit status and how long each took,
+// to diagnose actions that fail or hang. The trace is returned with the
+// error of the action. Traced operations run one at a time, and steps taken
+// meanwhile by other goroutines of the process are recorded as well.
+func TraceControl(s Service, action string) (*OperationTrace, error) {
+	traceControlLock.Lock()
+	defer traceControlLock.Unlock()
+
+	t := &OperationTrace{Action: action, Begin: time.Now()}
+	operationTraceLock.Lock()
+	operationTrace = t
+	operationTraceLock.Unlock()
+
+	err := Control(s, action)
+
+	operationTraceLock.Lock()
+	operationTrace = nil
+	t.Duration, t.done = time.Since(t.Begin), true
+	operationTraceLock.Unlock()
+	return t, err
+}
+
+// commandLine formats a command for a trace, quoting the arguments that
+// need it.
+func commandLine(command string, arguments ...string) string {
+	line := []string{command}
+	for _, a := range arguments {
+		if a == "" || strings.ContainsAny(a, " \t\"'") {
+			a = strconv.Quote(a)
+		}
+		line = append(line, a)
+	}
+	return strings.Join(line, " ")
+}
+
+// traceCall runs f as the step of the traced operation, if any.
+func traceCall(step string, f func() error) error {
+	end := traceStep("%s", step)
+	err := f()
+	end(err)
+	return err
+}
+
+// traceStep records a step of the traced operation, if any, returning the
+// function to call with its result when it ends.
+func traceStep(format string, a ...interface{}) func(err error) {
+	operationTraceLock.Lock()
+	defer operationTraceLock.Unlock()
+
+	t := operationTrace
+	if t == nil {
+		return func(error) {}
+	}
+	k := len(t.Steps)
+	t.Steps = append(t.Steps, OperationStep{Step: fmt.Sprintf(format, a...), Begin: time.Now()})
+	return func(err error) {
+		operationTraceLock.Lock()
+		defer operationTraceLock.Unlock()
+		if !t.done {
+			st := &t.Steps[k]
+			st.Duration, st.Err = time.Since(st.Begin), err
+		}
+	}
+}
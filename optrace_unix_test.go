@@ -0,0 +1,54 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+// commandService is a Service starting by running commands.
+type commandService struct {
+	Service
+	commands [][]string
+}
+
+func (s commandService) String() string { return "agent" }
+
+func (s commandService) Start() error {
+	for _, c := range s.commands {
+		if err := run(c[0], c[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTraceControl(t *testing.T) {
+	s := commandService{commands: [][]string{{"true"}, {"sh", "-c", "exit 3"}}}
+	trace, err := TraceControl(s, "start")
+	if err == nil {
+		t.Fatal("start succeeded")
+	}
+	if len(trace.Steps) != 2 {
+		t.Fatalf("steps %+v, want 2", trace.Steps)
+	}
+	if st := trace.Steps[0]; st.Step != "exec true" || st.Err != nil {
+		t.Errorf("first step %+v", st)
+	}
+	if st := trace.Steps[1]; st.Step != `exec sh -c "exit 3"` || st.Err == nil || st.Begin.Before(trace.Steps[0].Begin) {
+		t.Errorf("second step %+v", st)
+	}
+	if out := trace.String(); !strings.Contains(out, `exec sh -c "exit 3": exit status 3`) {
+		t.Errorf("trace:\n%s", out)
+	}
+
+	if err := Control(s, "start"); err == nil || len(trace.Steps) != 2 {
+		t.Error("steps recorded outside of TraceControl")
+	}
+}
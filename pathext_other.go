@@ -0,0 +1,20 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package service
+
+import "os/exec"
+
+// completeExt returns path, programs have no extensions here.
+func completeExt(path string) string {
+	return path
+}
+
+// lookExecutable looks up the program name in PATH.
+func lookExecutable(name string) (string, error) {
+	return exec.LookPath(name)
+}
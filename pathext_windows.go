@@ -0,0 +1,94 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// pathExt returns the extensions of executable files in PATHEXT, or those
+// of cmd.exe if it is not set.
+func pathExt() []string {
+	var exts []string
+	for _, e := range strings.Split(strings.ToLower(os.Getenv("PATHEXT")), ";") {
+		if e == "" {
+			continue
+		}
+		if e[0] != '.' {
+			e = "." + e
+		}
+		exts = append(exts, e)
+	}
+	if len(exts) == 0 {
+		exts = []string{".com", ".exe", ".bat", ".cmd"}
+	}
+	return exts
+}
+
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// completeExt returns the file the command interpreter runs for path: path
+// itself if it exists, otherwise path with the first extension of PATHEXT
+// that exists. The service manager does not add an extension, a service
+// whose image path has none fails to start with ERROR_FILE_NOT_FOUND.
+func completeExt(path string) string {
+	if isFile(path) {
+		return path
+	}
+	for _, ext := range pathExt() {
+		if isFile(path + ext) {
+			return path + ext
+		}
+	}
+	return path
+}
+
+// lookExecutable looks up the program name in PATH, with the extensions of
+// PATHEXT, and then under the App Paths of the system and the user, where
+// installers register programs such as "chrome.exe" not put in PATH.
+func lookExecutable(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err == nil {
+		return path, nil
+	}
+	exe := name
+	if filepath.Ext(exe) == "" {
+		exe += ".exe"
+	}
+	for _, root := range []registry.Key{registry.LOCAL_MACHINE, registry.CURRENT_USER} {
+		if p := appPath(root, exe); p != "" {
+			return p, nil
+		}
+	}
+	return "", err
+}
+
+// appPath returns the path of the program exe registered under the App
+// Paths of root, empty if there is none.
+func appPath(root registry.Key, exe string) string {
+	key, err := registry.OpenKey(root, `SOFTWARE\Microsoft\Windows\CurrentVersion\App Paths\`+exe, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	p, _, err := key.GetStringValue("")
+	if err != nil {
+		return ""
+	}
+	// The path may be quoted and contain variables such as %ProgramFiles%.
+	p, err = registry.ExpandString(strings.Trim(p, `"`))
+	if err != nil || !isFile(p) {
+		return ""
+	}
+	return p
+}
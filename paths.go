@@ -0,0 +1,127 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const optionRelativePaths = "RelativePaths"
+
+// Values of the RelativePaths option. Service managers start services in
+// the root or system directory rather than in the directory Install was run
+// from, so relative paths have to be resolved against a known directory.
+const (
+	// PathsAsGiven, the default, passes the WorkingDirectory and the
+	// arguments to the service manager as they are. A relative Executable
+	// is resolved against the current directory at Install.
+	PathsAsGiven = "given"
+
+	// PathsAtInstall resolves a relative Executable and WorkingDirectory
+	// against the current directory at Install and relative path arguments
+	// against the WorkingDirectory, or the current directory if there is
+	// none. The generated configuration only holds absolute paths.
+	PathsAtInstall = "install"
+
+	// PathsAtRuntime leaves relative path arguments for the program to
+	// resolve against the WorkingDirectory, which must then be absolute.
+	// A relative Executable is resolved against the WorkingDirectory too.
+	PathsAtRuntime = "runtime"
+)
+
+// relativePaths returns the RelativePaths option of c, validated.
+func (c *Config) relativePaths() (string, error) {
+	switch p := c.Option.string(optionRelativePaths, PathsAsGiven); p {
+	case PathsAsGiven, PathsAtInstall, PathsAtRuntime:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown %s option %q", optionRelativePaths, p)
+	}
+}
+
+// isRelativePath reports whether the argument a is a path relative to the
+// working directory, that is one starting with "./" or "../". Other
+// arguments are not taken to be paths.
+func isRelativePath(a string) bool {
+	a = filepath.ToSlash(a)
+	return a == "." || a == ".." || strings.HasPrefix(a, "./") || strings.HasPrefix(a, "../")
+}
+
+// relativeExecutable reports whether the Executable is a relative path rather
+// than absolute or a bare name looked up in PATH.
+func (c *Config) relativeExecutable() bool {
+	return strings.ContainsAny(c.Executable, `/\`) && !filepath.IsAbs(c.Executable)
+}
+
+// installConfig returns a copy of c with the WorkingDirectory and arguments
+// resolved according to the RelativePaths option and the EnvVars named by
+// the ScrubEnv option left out, as written by Install. With the Interpreter
+// option the arguments start with those of the interpreter and the script.
+func (c *Config) installConfig() (*Config, error) {
+	cc, err := c.resolvedConfig()
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := c.interpreter()
+	if err != nil {
+		return nil, err
+	}
+	if cmd == nil {
+		return cc, nil
+	}
+	cc.Arguments = append(cmd[1:len(cmd):len(cmd)], cc.Arguments...)
+	return cc, nil
+}
+
+// resolvedConfig is installConfig without the Interpreter option.
+func (c *Config) resolvedConfig() (*Config, error) {
+	policy, err := c.relativePaths()
+	if err != nil {
+		return nil, err
+	}
+	cc := *c
+	cc.EnvVars = c.scrubEnvVars()
+	cc.UserName = c.userName()
+	hasRelative := false
+	for _, a := range c.Arguments {
+		hasRelative = hasRelative || isRelativePath(a)
+	}
+
+	if policy == PathsAsGiven {
+		return &cc, nil
+	}
+	if policy == PathsAtRuntime {
+		if (hasRelative || c.relativeExecutable()) && !filepath.IsAbs(c.WorkingDirectory) {
+			return nil, fmt.Errorf("%s %q requires an absolute WorkingDirectory, got %q", optionRelativePaths, policy, c.WorkingDirectory)
+		}
+		return &cc, nil
+	}
+
+	if c.WorkingDirectory != "" {
+		if cc.WorkingDirectory, err = filepath.Abs(c.WorkingDirectory); err != nil {
+			return nil, err
+		}
+	}
+	if !hasRelative {
+		return &cc, nil
+	}
+	dir := cc.WorkingDirectory
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	cc.Arguments = make([]string, len(c.Arguments))
+	for i, a := range c.Arguments {
+		if isRelativePath(a) {
+			a = filepath.Join(dir, a)
+		}
+		cc.Arguments[i] = a
+	}
+	return &cc, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecPathLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	c := &Config{Executable: "sh"}
+	if p, _ := c.execPath(); p != sh {
+		t.Errorf("execPath() = %q, want %q from PATH", p, sh)
+	}
+
+	// A name existing in the directory it is resolved against is not looked up.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+	local := filepath.Join(dir, "sh")
+	ioutil.WriteFile(local, nil, 0755)
+	if p, _ := c.execPath(); p != local {
+		t.Errorf("execPath() = %q, want %q", p, local)
+	}
+}
+
+func TestInstallConfigPaths(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		WorkingDirectory: "data",
+		Arguments:        []string{"-config", "./app.conf", "-v", "../shared"},
+	}
+	ic, err := c.installConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ic.WorkingDirectory != "data" || ic.Arguments[1] != "./app.conf" || ic.Arguments[3] != "../shared" {
+		t.Errorf("paths resolved without the RelativePaths option: %q in %q", ic.Arguments, ic.WorkingDirectory)
+	}
+
+	c.Option = KeyValue{optionRelativePaths: PathsAtInstall}
+	if ic, err = c.installConfig(); err != nil {
+		t.Fatal(err)
+	}
+	wd := filepath.Join(cwd, "data")
+	if ic.WorkingDirectory != wd {
+		t.Errorf("WorkingDirectory = %q, want %q", ic.WorkingDirectory, wd)
+	}
+	want := []string{"-config", filepath.Join(wd, "app.conf"), "-v", filepath.Join(cwd, "shared")}
+	for i := range want {
+		if ic.Arguments[i] != want[i] {
+			t.Errorf("Arguments[%d] = %q, want %q", i, ic.Arguments[i], want[i])
+		}
+	}
+	if c.Arguments[1] != "./app.conf" {
+		t.Error("installConfig modified the Config")
+	}
+
+	c.Option = KeyValue{optionRelativePaths: PathsAtRuntime}
+	if _, err := c.installConfig(); err == nil {
+		t.Error("runtime paths with a relative WorkingDirectory succeeded")
+	}
+	c.WorkingDirectory = wd
+	c.Executable = "bin/app"
+	ic, err = c.installConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ic.Arguments[1] != "./app.conf" {
+		t.Errorf("Arguments[1] = %q, want it unchanged", ic.Arguments[1])
+	}
+	if p, _ := c.execPath(); p != filepath.Join(wd, "bin", "app") {
+		t.Errorf("execPath() = %q, want it in the WorkingDirectory", p)
+	}
+
+	c.Option = KeyValue{optionRelativePaths: "later"}
+	if _, err := c.installConfig(); err == nil {
+		t.Error("unknown RelativePaths option accepted")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build (darwin || freebsd) && !service_minimal
+// +build darwin freebsd
+// +build !service_minimal
+
+package service
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the user and groups of the process at the other end of
+// the unix socket connection conn.
+func peerCred(conn net.Conn) (peer, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return peer{}, errNoPeerCred
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return peer{}, err
+	}
+	var cred *unix.Xucred
+	cerr := rc.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if cerr != nil {
+		return peer{}, cerr
+	}
+	if err != nil {
+		return peer{}, err
+	}
+	p := peer{uid: int(cred.Uid)}
+	for _, g := range cred.Groups[:cred.Ngroups] {
+		p.gids = append(p.gids, int(g))
+	}
+	return p, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the credentials of the process at the other end of the
+// unix socket connection conn. The supplementary groups are taken from
+// SO_PEERGROUPS, as SO_PEERCRED carries the primary group only, or read from
+// /proc on kernels without it, which races with the process changing them.
+func peerCred(conn net.Conn) (peer, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return peer{}, errNoPeerCred
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return peer{}, err
+	}
+	var cred *unix.Ucred
+	var groups []int
+	var gerr error
+	cerr := rc.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+		groups, gerr = peerGroups(int(fd))
+	})
+	if cerr != nil {
+		return peer{}, cerr
+	}
+	if err != nil {
+		return peer{}, err
+	}
+	p := peer{uid: int(cred.Uid), pid: int(cred.Pid), gids: []int{int(cred.Gid)}}
+	switch gerr {
+	case nil:
+		p.gids = append(p.gids, groups...)
+		return p, nil
+	case unix.ENOPROTOOPT, unix.ENOSYS:
+		// Linux before 4.13, or a 32-bit x86 kernel before 4.3 without
+		// the getsockopt system call.
+	default:
+		return peer{}, gerr
+	}
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", cred.Pid))
+	if err != nil {
+		return p, nil
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if !strings.HasPrefix(s.Text(), "Groups:") {
+			continue
+		}
+		for _, g := range strings.Fields(strings.TrimPrefix(s.Text(), "Groups:")) {
+			if gid, err := strconv.Atoi(g); err == nil {
+				p.gids = append(p.gids, gid)
+			}
+		}
+	}
+	return p, nil
+}
+
+// peerGroups returns the supplementary groups of the peer of the unix
+// socket fd by SO_PEERGROUPS. The option is an array of group ids, which
+// unix.GetsockoptString would truncate.
+func peerGroups(fd int) ([]int, error) {
+	buf := make([]uint32, 32)
+	for {
+		n := uint32(len(buf) * 4)
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_SOCKET, unix.SO_PEERGROUPS,
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)), 0)
+		if errno == unix.ERANGE {
+			// n is the size needed.
+			buf = make([]uint32, n/4)
+			continue
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		gids := make([]int, 0, n/4)
+		for _, g := range buf[:n/4] {
+			gids = append(gids, int(g))
+		}
+		return gids, nil
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd && !service_minimal
+// +build !linux,!darwin,!freebsd,!service_minimal
+
+package service
+
+import "net"
+
+// peerCred is not supported on the remaining systems.
+func peerCred(conn net.Conn) (peer, error) {
+	return peer{}, errNoPeerCred
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Finding is a problem found by Preflight that likely keeps the service from
+// running, with what to do about it.
+type Finding struct {
+	Check   string // Check that found the problem, such as "quarantine".
+	Problem string
+	Fix     string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s; %s", f.Check, f.Problem, f.Fix)
+}
+
+// Preflighter is implemented by the services of service managers that can
+// check the system for problems before installing or starting a service.
+type Preflighter interface {
+	Preflight() ([]Finding, error)
+}
+
+// Preflight returns the problems likely to keep s from running, such as
+// macOS refusing to run a quarantined or unnotarized executable, and the
+// secrets Install would write where every user can read them, see
+// SecretError. Services of service managers without checks report only
+// the secrets.
+func Preflight(s Service) ([]Finding, error) {
+	var findings []Finding
+	if p, ok := s.(Preflighter); ok {
+		f, err := p.Preflight()
+		if err != nil {
+			return nil, err
+		}
+		findings = f
+	}
+	if c, ok := s.(interface {
+		secrets(r renderer) ([]Finding, error)
+	}); ok {
+		r, _ := s.(renderer)
+		f, err := c.secrets(r)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f...)
+	}
+	return findings, nil
+}
+
+// PreflightError is returned when starting a service failed and Preflight
+// found likely reasons.
+type PreflightError struct {
+	Err      error
+	Findings []Finding
+}
+
+func (e *PreflightError) Error() string {
+	list := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		list[i] = f.String()
+	}
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(list, "; "))
+}
+
+func (e *PreflightError) Unwrap() error {
+	return e.Err
+}
+
+// withFindings adds the findings of the preflight checks p to the error err
+// of starting a service.
+func withFindings(p Preflighter, err error) error {
+	if err == nil {
+		return nil
+	}
+	if findings, _ := p.Preflight(); len(findings) > 0 {
+		return &PreflightError{Err: err, Findings: findings}
+	}
+	return err
+}
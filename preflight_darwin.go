@@ -0,0 +1,87 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	quarantineAttr = "com.apple.quarantine"
+
+	optionClearQuarantine = "ClearQuarantine"
+)
+
+// Preflight checks the executable for problems that make launchd fail to
+// start it, commonly with only exit status 78 to show for it.
+func (s *darwinLaunchdService) Preflight() ([]Finding, error) {
+	path, err := s.execPath()
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return []Finding{{"executable", err.Error(), "install the program before the service"}}, nil
+	}
+	var findings []Finding
+	if fi.Mode()&0111 == 0 {
+		findings = append(findings, Finding{"executable", path + " is not executable", "chmod +x " + path})
+	}
+	if err := checkArch(path, hostArchs()); err != nil {
+		findings = append(findings, Finding{"architecture", err.Error(), "install the build of the program for this Mac"})
+	}
+	if quarantined(path) {
+		findings = append(findings, Finding{"quarantine", path + " is quarantined by Gatekeeper",
+			"xattr -d " + quarantineAttr + " " + path + ", or set the ClearQuarantine option"})
+	}
+	if cmd, err := toolCommand("spctl", "--assess", "--type", "execute", path); err == nil {
+		if out, err := cmd.CombinedOutput(); err != nil {
+			findings = append(findings, Finding{"notarization", strings.TrimSpace(string(out)),
+				"sign and notarize the program, or run it from outside a quarantined location"})
+		}
+	}
+	for _, dir := range []string{path, s.WorkingDirectory} {
+		if dir != "" && !s.userService && tccProtected(dir) {
+			findings = append(findings, Finding{"full-disk-access", dir + " is in a folder protected by privacy controls",
+				"move the program out of the user's folders, or grant it Full Disk Access in System Settings"})
+			break
+		}
+	}
+	return findings, nil
+}
+
+// quarantined reports whether the file at path has the quarantine attribute
+// Gatekeeper sets on downloaded files.
+func quarantined(path string) bool {
+	_, err := unix.Getxattr(path, quarantineAttr, nil)
+	return err == nil
+}
+
+// clearQuarantine removes the quarantine attribute from the executable if
+// the ClearQuarantine option is set.
+func (s *darwinLaunchdService) clearQuarantine(path string) error {
+	if !s.Option.bool(optionClearQuarantine, false) || !quarantined(path) {
+		return nil
+	}
+	return unix.Removexattr(path, quarantineAttr)
+}
+
+// tccProtected reports whether path is in a user folder that daemons may only
+// access with Full Disk Access.
+func tccProtected(path string) bool {
+	parts := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	if len(parts) < 4 || parts[1] != "Users" {
+		return false
+	}
+	switch parts[3] {
+	case "Desktop", "Documents", "Downloads":
+		return true
+	}
+	return false
+}
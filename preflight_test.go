@@ -0,0 +1,36 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+type findingService struct {
+	Service
+	findings []Finding
+}
+
+func (s findingService) Preflight() ([]Finding, error) { return s.findings, nil }
+
+func TestWithFindings(t *testing.T) {
+	startErr := errors.New("exit status 78")
+	if err := withFindings(findingService{}, startErr); err != startErr {
+		t.Errorf("without findings: %v", err)
+	}
+	s := findingService{findings: []Finding{{"quarantine", "/opt/agent is quarantined by Gatekeeper", "xattr -d com.apple.quarantine /opt/agent"}}}
+	err := withFindings(s, startErr)
+	want := "exit status 78 (quarantine: /opt/agent is quarantined by Gatekeeper; xattr -d com.apple.quarantine /opt/agent)"
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+	if !errors.Is(err, startErr) {
+		t.Error("PreflightError does not wrap the start error")
+	}
+	if findings, err := Preflight(s); err != nil || len(findings) != 1 {
+		t.Errorf("Preflight = %v, %v", findings, err)
+	}
+}
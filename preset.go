@@ -0,0 +1,23 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+const optionPreset = "Preset"
+
+// Values of the Preset option of systemd services. Without the option Install
+// enables the service. With it Install leaves the decision to the preset
+// policy of the system ("systemctl preset"), so distributions and image
+// builders keep control of which services are enabled by default.
+const (
+	// PresetPolicy applies the preset policy already on the system.
+	PresetPolicy = "policy"
+
+	// PresetEnable ships a preset file enabling the service by default,
+	// which a preset file of the system with a lower number overrides.
+	PresetEnable = "enable"
+
+	// PresetDisable ships a preset file disabling the service by default.
+	PresetDisable = "disable"
+)
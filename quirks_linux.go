@@ -0,0 +1,107 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const optionQuirks = "Quirks"
+
+// Quirks of distributions applied by Install.
+const (
+	// quirkRestorecon labels installed files with their SELinux context,
+	// which files written by a program not run by rpm lack.
+	quirkRestorecon = "restorecon"
+	// quirkUpdateRcD enables SystemV init scripts with update-rc.d, which
+	// orders them by their LSB headers and honors local policy.
+	quirkUpdateRcD = "update-rc.d"
+	// quirkInvokeRcD starts and stops SystemV init scripts with invoke-rc.d,
+	// which honors policy-rc.d, used to keep services from starting in
+	// chroots and images being built.
+	quirkInvokeRcD = "invoke-rc.d"
+	// quirkChkconfig enables SystemV init scripts with chkconfig, which
+	// knows the rc.d layout of Red Hat and Amazon Linux.
+	quirkChkconfig = "chkconfig"
+)
+
+// distroQuirks lists the quirks by the os-release ID of the distributions
+// they apply to, matched against ID and ID_LIKE. A quirk only applies if its
+// tool is installed.
+var distroQuirks = []struct {
+	quirk string
+	ids   []string
+	tool  string
+}{
+	{quirkRestorecon, []string{"rhel", "fedora", "centos", "amzn"}, "restorecon"},
+	{quirkUpdateRcD, []string{"debian"}, "update-rc.d"},
+	{quirkInvokeRcD, []string{"debian"}, "invoke-rc.d"},
+	{quirkChkconfig, []string{"rhel", "fedora", "centos", "amzn"}, "chkconfig"},
+}
+
+var (
+	osReleaseFile = "/etc/os-release"
+	selinuxDir    = "/sys/fs/selinux"
+)
+
+// osRelease returns the ID and ID_LIKE values of os-release, the ids of the
+// distribution and those it derives from.
+func osRelease() []string {
+	f, err := os.Open(osReleaseFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		kv := strings.SplitN(sc.Text(), "=", 2)
+		if len(kv) == 2 && (kv[0] == "ID" || kv[0] == "ID_LIKE") {
+			ids = append(ids, strings.Fields(strings.Trim(kv[1], `"'`))...)
+		}
+	}
+	return ids
+}
+
+// quirk reports whether the quirk applies to this distribution, unless the
+// Quirks option is false.
+func (c *Config) quirk(name string) bool {
+	if !c.Option.bool(optionQuirks, true) {
+		return false
+	}
+	if name == quirkRestorecon {
+		if _, err := os.Stat(selinuxDir + "/enforce"); err != nil {
+			return false
+		}
+	}
+	ids := osRelease()
+	for _, q := range distroQuirks {
+		if q.quirk != name {
+			continue
+		}
+		for _, id := range ids {
+			for _, qid := range q.ids {
+				if id == qid {
+					_, err := exec.LookPath(q.tool)
+					return err == nil
+				}
+			}
+		}
+	}
+	return false
+}
+
+// labelFile restores the SELinux context of the installed file at path on
+// distributions that need it.
+func (c *Config) labelFile(path string) error {
+	if !c.quirk(quirkRestorecon) {
+		return nil
+	}
+	return run("restorecon", path)
+}
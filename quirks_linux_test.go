@@ -0,0 +1,49 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQuirks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quirks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(f, d string) { osReleaseFile, selinuxDir = f, d }(osReleaseFile, selinuxDir)
+	osReleaseFile = filepath.Join(dir, "os-release")
+	selinuxDir = filepath.Join(dir, "selinux")
+
+	err = ioutil.WriteFile(osReleaseFile, []byte("NAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := osRelease(); !reflect.DeepEqual(ids, []string{"ubuntu", "debian"}) {
+		t.Errorf("osRelease = %q", ids)
+	}
+
+	c := &Config{Name: "agent"}
+	if c.quirk(quirkRestorecon) {
+		t.Error("restorecon applies without SELinux")
+	}
+	if c.quirk(quirkChkconfig) {
+		t.Error("chkconfig applies to Ubuntu")
+	}
+	_, err = exec.LookPath("update-rc.d")
+	if got := c.quirk(quirkUpdateRcD); got != (err == nil) {
+		t.Errorf("update-rc.d quirk = %v with the tool installed %v", got, err == nil)
+	}
+	c.Option = KeyValue{optionQuirks: false}
+	if c.quirk(quirkUpdateRcD) {
+		t.Error("quirk applies with the Quirks option false")
+	}
+}
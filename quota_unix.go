@@ -0,0 +1,135 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const optionDiskQuota = "DiskQuota"
+
+var quotaInterval = time.Minute
+
+// parseSize parses a size in bytes with an optional K, M, G or T suffix for
+// powers of 1024, such as "512M".
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			mult = 1 << (10 * uint(i+1))
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid %s option %q", optionDiskQuota, s)
+	}
+	return v * mult, nil
+}
+
+type quotaFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	rotated bool
+}
+
+// quotaFiles returns the files counted against the DiskQuota option: those
+// in the StateDirectory and the log files of the service.
+func (c *Config) quotaFiles() []quotaFile {
+	var files []quotaFile
+	if dir, err := c.stateDir(); err == nil {
+		filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				files = append(files, quotaFile{path, fi.Size(), fi.ModTime(), false})
+			}
+			return nil
+		})
+	}
+	logDir := c.Option.string(optionLogDirectory, defaultLogDirectory)
+	if runtime.GOOS == "darwin" {
+		logDir = launchdLogDirectory(c)
+	}
+	list, _ := ioutil.ReadDir(logDir)
+	for _, fi := range list {
+		if fi.Mode().IsRegular() && strings.HasPrefix(fi.Name(), c.Name+".") {
+			files = append(files, quotaFile{filepath.Join(logDir, fi.Name()), fi.Size(), fi.ModTime(), isRotatedLog(fi.Name())})
+		}
+	}
+	return files
+}
+
+// isRotatedLog reports whether name is that of a rotated log file, numbered
+// or compressed, which is no longer written.
+func isRotatedLog(name string) bool {
+	ext := filepath.Ext(name)
+	if ext == ".gz" {
+		return true
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(ext, "."))
+	return len(ext) > 1 && err == nil
+}
+
+// enforceQuota removes the oldest rotated log files while the files of the
+// service use more than quota bytes and returns the usage left.
+func (c *Config) enforceQuota(quota int64) int64 {
+	files := c.quotaFiles()
+	var used int64
+	for _, f := range files {
+		used += f.size
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if used <= quota {
+			break
+		}
+		if f.rotated && os.Remove(f.path) == nil {
+			used -= f.size
+		}
+	}
+	return used
+}
+
+// startQuota checks the DiskQuota option every quotaInterval in the
+// background, pruning rotated log files and logging an error while the
+// service is still over its quota. The returned function ends the checks.
+func (c *Config) startQuota(s Service) (stop func(), err error) {
+	size := c.Option.string(optionDiskQuota, "")
+	if size == "" {
+		return func() {}, nil
+	}
+	quota, err := parseSize(size)
+	if err != nil {
+		return nil, err
+	}
+	logger, _ := s.Logger(nil)
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(quotaInterval)
+		defer t.Stop()
+		for {
+			if used := c.enforceQuota(quota); used > quota && logger != nil {
+				logger.Errorf("%s uses %d bytes of disk, over its quota of %d", c.Name, used, quota)
+			}
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return func() { close(done) }, nil
+}
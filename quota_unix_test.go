@@ -0,0 +1,66 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"100": 100, "2K": 2048, "512M": 512 << 20, "1G": 1 << 30} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "1.5G"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) succeeded", in)
+		}
+	}
+}
+
+func TestEnforceQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logDir := filepath.Join(dir, "log")
+	os.Mkdir(logDir, 0755)
+	c := &Config{Name: "agent", Option: KeyValue{
+		optionStateDirectory: filepath.Join(dir, "state"),
+		optionLogDirectory:   logDir,
+	}}
+
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"agent.out.2.gz", "agent.out.1", "agent.out", "other.out.1"} {
+		path := filepath.Join(logDir, name)
+		if err := ioutil.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	if used := c.enforceQuota(250); used != 200 {
+		t.Errorf("usage after pruning = %d, want 200", used)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "agent.out.2.gz")); !os.IsNotExist(err) {
+		t.Error("the oldest rotated log file was kept")
+	}
+	if used := c.enforceQuota(50); used != 100 {
+		t.Errorf("usage = %d, want the active log file kept", used)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "other.out.1")); err != nil {
+		t.Error("a log file of another service was removed")
+	}
+}
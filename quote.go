@@ -0,0 +1,74 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"strings"
+)
+
+// Quoting for the files generated by the backends. Paths under
+// "/opt/My App" or with quotes and non-ASCII characters must reach the
+// program unchanged.
+
+// shQuote quotes s as a single POSIX shell word. Words without special
+// characters are returned as is.
+func shQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shArgs quotes each of args as a shell word and joins them with spaces.
+func shArgs(args []string) string {
+	q := make([]string, len(args))
+	for i, a := range args {
+		q[i] = shQuote(a)
+	}
+	return strings.Join(q, " ")
+}
+
+var (
+	dqEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	systemdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "%", "%%", "$", "$$")
+	envEscaper     = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "%", "%%")
+	commandEscaper = strings.NewReplacer(`\`, `\\`, " ", `\x20`, `"`, `\x22`, "'", `\x27`, "%", "%%")
+)
+
+// dqEscape escapes s for use inside a double quoted shell string.
+func dqEscape(s string) string {
+	return dqEscaper.Replace(s)
+}
+
+// systemdQuote quotes s as a single word of a systemd command line such as
+// ExecStart, escaping specifiers and variable references.
+func systemdQuote(s string) string {
+	return `"` + systemdEscaper.Replace(s) + `"`
+}
+
+// systemdEnv quotes the assignment of value to the variable key for the
+// Environment setting of systemd, which splits its assignments at spaces
+// and does not expand variable references.
+func systemdEnv(key, value string) string {
+	return `"` + envEscaper.Replace(key+"="+value) + `"`
+}
+
+// systemdEscapeCommand escapes the executable of a systemd command line. It is
+// left unquoted as older systemd versions do not accept a quoted executable.
+func systemdEscapeCommand(s string) string {
+	return commandEscaper.Replace(s)
+}
+
+// systemdPath escapes specifiers in a path valued systemd setting such as
+// WorkingDirectory. These settings are not split into words, so spaces and
+// quotes are taken literally.
+func systemdPath(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
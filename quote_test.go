@@ -0,0 +1,64 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var quoteTests = []string{
+	"/usr/bin/agent",
+	"/opt/My App/agent",
+	`it's "quoted"`,
+	"Zürich/日本",
+	"$HOME `id` \\ 100%",
+	"",
+}
+
+func TestShQuote(t *testing.T) {
+	if got := shQuote("/usr/bin/agent"); got != "/usr/bin/agent" {
+		t.Errorf("shQuote() = %s, safe words should not be quoted", got)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// Let the shell parse the words back.
+	for _, dq := range []bool{false, true} {
+		script := `printf '%s\n' ` + shArgs(quoteTests)
+		if dq {
+			script = `eval "printf '%s\n' ` + dqEscape(shArgs(quoteTests)) + `"`
+		}
+		out, err := exec.Command("sh", "-c", script).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(out), strings.Join(quoteTests, "\n")+"\n"; got != want {
+			t.Errorf("shell parsed %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		in, quoted, command string
+	}{
+		{"/usr/bin/agent", `"/usr/bin/agent"`, `/usr/bin/agent`},
+		{"/opt/My App/agent", `"/opt/My App/agent"`, `/opt/My\x20App/agent`},
+		{`it's "quoted"`, `"it's \"quoted\""`, `it\x27s\x20\x22quoted\x22`},
+		{"Zürich", `"Zürich"`, `Zürich`},
+		{`$HOME \ 100%`, `"$$HOME \\ 100%%"`, `$HOME\x20\\\x20100%%`},
+	}
+	for _, tt := range tests {
+		if got := systemdQuote(tt.in); got != tt.quoted {
+			t.Errorf("systemdQuote(%q) = %s, want %s", tt.in, got, tt.quoted)
+		}
+		if got := systemdEscapeCommand(tt.in); got != tt.command {
+			t.Errorf("systemdEscapeCommand(%q) = %s, want %s", tt.in, got, tt.command)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"strings"
+	"time"
+)
+
+// RebootRequired records in the install manifest why the installation is
+// only complete once the system restarts. It is cleared by the next Install.
+type RebootRequired struct {
+	Reasons []string  `json:"reasons"`
+	Since   time.Time `json:"since"`
+}
+
+// RebootRequiredError is returned by Install when the service can only be
+// installed completely after the system restarts. The reasons are recorded
+// in the install manifest as well, see InstallManifest.
+type RebootRequiredError struct {
+	Reasons []string
+}
+
+func (e *RebootRequiredError) Error() string {
+	return "reboot required: " + strings.Join(e.Reasons, "; ")
+}
+
+// beginInstall is called by Install of s before the system is changed, with
+// the renderer of the file Install writes, if any. It refuses to install
+// secrets, asks for consent, checks the UserName and records its Account if
+// s runs as it, and forgets about a reboot required by an earlier Install.
+func (c *Config) beginInstall(s Service, r renderer) error {
+	if err := c.checkSecrets(r); err != nil {
+		return err
+	}
+	if err := c.consent(); err != nil {
+		return err
+	}
+	var account *Account
+	if appliesUserName(s) {
+		var err error
+		if account, err = c.resolveAccount(); err != nil {
+			return err
+		}
+	}
+	m, err := c.ReadInstallManifest()
+	if account == nil && (err != nil || m.RebootRequired == nil && m.Account == nil) {
+		return nil
+	}
+	return c.updateInstallManifest(func(m *InstallManifest) {
+		m.RebootRequired = nil
+		m.Account = account
+	})
+}
+
+// requireReboot records that a reboot is required for reason and returns
+// the RebootRequiredError for Install to return.
+func (c *Config) requireReboot(reason string) error {
+	var reasons []string
+	err := c.updateInstallManifest(func(m *InstallManifest) {
+		if m.RebootRequired == nil {
+			m.RebootRequired = &RebootRequired{Since: time.Now().UTC()}
+		}
+		m.RebootRequired.Reasons = append(m.RebootRequired.Reasons, reason)
+		reasons = m.RebootRequired.Reasons
+	})
+	if err != nil {
+		return err
+	}
+	return &RebootRequiredError{Reasons: reasons}
+}
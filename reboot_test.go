@@ -0,0 +1,46 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRequireReboot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reboot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{Name: "driver", Option: KeyValue{optionStateDirectory: dir}}
+	c.requireReboot("file in use")
+	err = c.requireReboot("service marked for deletion")
+	rerr, ok := err.(*RebootRequiredError)
+	if !ok {
+		t.Fatalf("requireReboot = %v, want a RebootRequiredError", err)
+	}
+	want := []string{"file in use", "service marked for deletion"}
+	if !reflect.DeepEqual(rerr.Reasons, want) {
+		t.Errorf("reasons %q, want %q", rerr.Reasons, want)
+	}
+	m, err := c.ReadInstallManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.RebootRequired == nil || !reflect.DeepEqual(m.RebootRequired.Reasons, want) {
+		t.Errorf("manifest records %+v", m.RebootRequired)
+	}
+
+	if err := c.beginInstall(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = c.ReadInstallManifest(); err != nil || m.RebootRequired != nil {
+		t.Errorf("reboot still required after the next Install: %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Actions of the OnFailureActions option of Windows services.
+const (
+	recoveryRestart  = "restart"
+	recoveryRun      = "run"
+	recoveryReboot   = "reboot"
+	recoveryNoAction = "noaction"
+)
+
+// recoveryAction is an action the service control manager takes when the
+// service fails, after delay.
+type recoveryAction struct {
+	action string
+	delay  time.Duration
+}
+
+// parseRecoveryActions parses the OnFailureActions option, actions
+// separated by commas, each with an optional delay, such as
+// "restart/5s,restart/1m,run/1m,reboot/10m". Actions without a delay take
+// defaultDelay.
+func parseRecoveryActions(s string, defaultDelay time.Duration) ([]recoveryAction, error) {
+	var actions []recoveryAction
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, "/", 2)
+		a := recoveryAction{action: strings.ToLower(parts[0]), delay: defaultDelay}
+		switch a.action {
+		case recoveryRestart, recoveryRun, recoveryReboot, recoveryNoAction:
+		default:
+			return nil, fmt.Errorf("unknown recovery action %q", parts[0])
+		}
+		if len(parts) == 2 {
+			d, err := time.ParseDuration(parts[1])
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid delay of recovery action %q", field)
+			}
+			a.delay = d
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRecoveryActions(t *testing.T) {
+	got, err := parseRecoveryActions("restart/5s, Restart/1m,run,reboot/10m", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []recoveryAction{
+		{recoveryRestart, 5 * time.Second},
+		{recoveryRestart, time.Minute},
+		{recoveryRun, time.Second},
+		{recoveryReboot, 10 * time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("actions %v, want %v", got, want)
+	}
+	for _, bad := range []string{"respawn/5s", "restart/soon", "restart/-1s"} {
+		if _, err := parseRecoveryActions(bad, time.Second); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// Factory is a third party service manager, registered with
+// RegisterPlatform. It is a System without the name.
+type Factory interface {
+	// Detect returns true if the service manager is available to use.
+	Detect() bool
+
+	// Interactive returns false if running under the service manager and
+	// true otherwise.
+	Interactive() bool
+
+	// New creates a new service for this service manager.
+	New(i Interface, c *Config) (Service, error)
+}
+
+// registeredSystem is a System registered with RegisterPlatform.
+type registeredSystem struct {
+	name string
+	Factory
+}
+
+func (r registeredSystem) String() string {
+	return r.name
+}
+
+// RegisterPlatform adds the service manager factory as the platform name,
+// which Platform returns when it is chosen. Registered platforms are
+// considered before the built-in systems, the last registered first, and
+// one registered again under the same name is replaced. As ChooseSystem,
+// calling this may change what Interactive and Platform return, so it is
+// best called from init.
+func RegisterPlatform(name string, factory Factory) {
+	registry := []System{registeredSystem{name, factory}}
+	for _, s := range systemRegistry {
+		if r, ok := s.(registeredSystem); ok && r.name == name {
+			continue
+		}
+		registry = append(registry, s)
+	}
+	ChooseSystem(registry...)
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/service"
+)
+
+type inHouseFactory struct {
+	detect bool
+}
+
+func (f inHouseFactory) Detect() bool      { return f.detect }
+func (f inHouseFactory) Interactive() bool { return true }
+func (f inHouseFactory) New(i service.Interface, c *service.Config) (service.Service, error) {
+	return nil, service.ErrNotSupported
+}
+
+func TestRegisterPlatform(t *testing.T) {
+	builtin := service.AvailableSystems()
+	defer service.ChooseSystem(builtin...)
+	platform := service.Platform()
+
+	service.RegisterPlatform("corp-supervisor", inHouseFactory{detect: false})
+	if got := service.Platform(); got != platform {
+		t.Errorf("Platform = %q with an undetected registered platform, want %q", got, platform)
+	}
+	service.RegisterPlatform("corp-supervisor", inHouseFactory{detect: true})
+	if got := service.Platform(); got != "corp-supervisor" {
+		t.Errorf("Platform = %q, want corp-supervisor", got)
+	}
+	if n := len(service.AvailableSystems()); n != len(builtin)+1 {
+		t.Errorf("%d systems after registering twice, want %d", n, len(builtin)+1)
+	}
+	if _, err := service.New(&program{}, &service.Config{Name: "agent"}); err != service.ErrNotSupported {
+		t.Errorf("New did not use the registered platform: %v", err)
+	}
+}
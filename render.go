@@ -0,0 +1,49 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// renderer is implemented by the services of service managers configured by
+// a file, such as a systemd unit or a launchd property list.
+type renderer interface {
+	// render writes the file Install installs.
+	render(w io.Writer) error
+}
+
+// RenderFor returns the file Install writes for c with the service manager
+// platform, such as "linux-systemd" or "darwin-launchd", so the output can be
+// compared with a golden file in tests. Only the service managers of the
+// operating system the program is built for are available, see
+// AvailableSystems. Windows services are not configured by a file; RenderFor
+// returns ErrNotSupported for them.
+func RenderFor(platform string, c *Config) ([]byte, error) {
+	if len(c.Name) == 0 {
+		return nil, ErrNameFieldRequired
+	}
+	for _, sys := range AvailableSystems() {
+		if sys.String() != platform {
+			continue
+		}
+		s, err := sys.New(nil, c)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := s.(renderer)
+		if !ok {
+			return nil, ErrNotSupported
+		}
+		var b bytes.Buffer
+		if err := r.render(&b); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown platform %q", platform)
+}
@@ -0,0 +1,44 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// Restart policies of the Restart option and of a supervised program.
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+const (
+	optionRestartSec          = "RestartSec"
+	optionRestartSecDefault   = "2m"
+	optionRestartMaxDelay     = "RestartMaxDelay"
+	optionRestartSteps        = "RestartSteps"
+	optionRestartStepsDefault = 5
+)
+
+// restartDelays returns the delay before the first restart of the service,
+// the RestartSec option, and the delay the restarts back off to, the
+// RestartMaxDelay option, or zero if restarts do not back off.
+func (c *Config) restartDelays() (delay, maxDelay time.Duration, err error) {
+	delay, err = time.ParseDuration(c.Option.string(optionRestartSec, optionRestartSecDefault))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %v", optionRestartSec, err)
+	}
+	if v := c.Option.string(optionRestartMaxDelay, ""); v != "" {
+		if maxDelay, err = time.ParseDuration(v); err != nil {
+			return 0, 0, fmt.Errorf("%s: %v", optionRestartMaxDelay, err)
+		}
+		if maxDelay < delay {
+			return 0, 0, fmt.Errorf("%s is shorter than %s", optionRestartMaxDelay, optionRestartSec)
+		}
+	}
+	return delay, maxDelay, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// rootInstaller is implemented by the services of the service managers that
+// can be installed into another root, see InstallTo.
+type rootInstaller interface {
+	installTo(root string) error
+}
+
+// InstallTo installs s into the file system tree at root rather than the
+// running system, for building OS images and chroots. The files are placed
+// below root at the paths they have in the installed system and the service
+// is enabled the way the service manager would, with symbolic links or
+// preset files pointing to the paths within root. The service manager is not
+// contacted and nothing is started; the installed service manager is taken
+// to support all features. Set the Executable of the Config to the path of
+// the program within root.
+//
+// InstallTo returns ErrNotSupported for service managers configured by
+// commands rather than files, such as Windows, and for user services.
+func InstallTo(s Service, root string) error {
+	ri, ok := s.(rootInstaller)
+	if !ok {
+		return ErrNotSupported
+	}
+	return ri.installTo(root)
+}
+
+// writeRootFile writes the file path of the installed system below root.
+func writeRootFile(root, path string, data []byte, perm os.FileMode) error {
+	p := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(p, perm)
+}
+
+// linkRoot creates the symbolic link path of the installed system below
+// root, pointing to target, a path of the installed system. A link left by
+// an earlier install is replaced.
+func linkRoot(root, path, target string) error {
+	p := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(target, p)
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"path"
+	"strings"
+)
+
+const optionScrubEnv = "ScrubEnv"
+
+// scrubbed reports whether the environment variable name matches one of
+// patterns, names or shell patterns such as "*_TOKEN", compared without
+// regard to case.
+func scrubbed(patterns []string, name string) bool {
+	name = strings.ToUpper(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubEnv returns env, variables in KEY=VALUE form, without those whose
+// name matches one of patterns.
+func scrubEnv(patterns []string, env []string) []string {
+	if len(patterns) == 0 {
+		return env
+	}
+	kept := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !scrubbed(patterns, strings.SplitN(kv, "=", 2)[0]) {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// patterns returns the patterns of the option name, such as ScrubEnv,
+// separated by commas or spaces.
+func (c *Config) patterns(name string) []string {
+	return strings.FieldsFunc(c.Option.string(name, ""), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// scrubEnvVars returns the EnvVars without those named by the ScrubEnv
+// option.
+func (c *Config) scrubEnvVars() map[string]string {
+	patterns := c.patterns(optionScrubEnv)
+	if len(patterns) == 0 {
+		return c.EnvVars
+	}
+	vars := make(map[string]string, len(c.EnvVars))
+	for k, v := range c.EnvVars {
+		if !scrubbed(patterns, k) {
+			vars[k] = v
+		}
+	}
+	return vars
+}
@@ -0,0 +1,34 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScrubEnv(t *testing.T) {
+	patterns := []string{"*_TOKEN", "aws_secret_access_key"}
+	env := []string{"HOME=/root", "GITHUB_TOKEN=ghp_x", "github_token=ghp_y", "AWS_SECRET_ACCESS_KEY=k", "TOKEN=kept", "EMPTY"}
+	want := []string{"HOME=/root", "TOKEN=kept", "EMPTY"}
+	if got := scrubEnv(patterns, env); !reflect.DeepEqual(got, want) {
+		t.Errorf("scrubEnv = %q, want %q", got, want)
+	}
+
+	c := &Config{
+		Option:  KeyValue{optionScrubEnv: "*_TOKEN, AWS_SECRET_ACCESS_KEY"},
+		EnvVars: map[string]string{"GITHUB_TOKEN": "ghp_x", "AWS_SECRET_ACCESS_KEY": "k", "LANG": "C"},
+	}
+	conf, err := c.installConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"LANG": "C"}; !reflect.DeepEqual(conf.EnvVars, want) {
+		t.Errorf("installed EnvVars = %v, want %v", conf.EnvVars, want)
+	}
+	if len(c.EnvVars) != 3 {
+		t.Errorf("installConfig changed the EnvVars of the Config: %v", c.EnvVars)
+	}
+}
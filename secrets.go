@@ -0,0 +1,125 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	optionSecrets      = "Secrets"
+	optionSensitiveEnv = "SensitiveEnv"
+)
+
+// Values of the Secrets option.
+const (
+	SecretsRefuse = "refuse" // Install fails with a SecretError.
+	SecretsWarn   = "warn"   // Install succeeds; Preflight reports the secrets.
+)
+
+// SecretError is returned by Install when the file it would write, which
+// every user of the system can read, or the environment of a Windows
+// service, seems to contain secrets such as tokens or passwords.
+type SecretError struct {
+	Findings []Finding
+}
+
+func (e *SecretError) Error() string {
+	list := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		list[i] = f.Problem
+	}
+	return "secrets in the service configuration: " + strings.Join(list, "; ")
+}
+
+// secretEnvNames are the names of environment variables taken to hold
+// secrets, in addition to the SensitiveEnv option.
+var secretEnvNames = []string{"*TOKEN*", "*SECRET*", "*PASSWORD*", "*PASSWD*", "*API_KEY*", "*APIKEY*", "*PRIVATE_KEY*", "*CREDENTIAL*"}
+
+// secretValues are the patterns of well known kinds of secrets.
+var secretValues = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"an AWS access key", regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`)},
+	{"a GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"a Stripe key", regexp.MustCompile(`\b[sr]k_live_[A-Za-z0-9]{16,}`)},
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"a JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+}
+
+const secretFix = "keep it in a file only the service can read, such as /etc/sysconfig/<Name> for systemd, " +
+	"and leave it out of EnvVars or with the ScrubEnv option"
+
+// secrets returns the secrets found in the file r renders for Install, or
+// in the EnvVars and Arguments of the service if r is nil. EnvVars named by
+// the SensitiveEnv option, or with names such as API_TOKEN, are taken to be
+// secrets unless they refer to a file or another variable.
+func (c *Config) secrets(r renderer) ([]Finding, error) {
+	conf, err := c.installConfig()
+	if err != nil {
+		return nil, err
+	}
+	patterns := append(c.patterns(optionSensitiveEnv), secretEnvNames...)
+
+	var findings []Finding
+	names := make([]string, 0, len(conf.EnvVars))
+	for k := range conf.EnvVars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := conf.EnvVars[k]
+		if v == "" || strings.HasPrefix(v, "/") || strings.HasPrefix(v, "$") || !scrubbed(patterns, k) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:   "secrets",
+			Problem: fmt.Sprintf("environment variable %s looks like a secret", k),
+			Fix:     secretFix,
+		})
+	}
+
+	var text bytes.Buffer
+	if r != nil {
+		if err := r.render(&text); err != nil {
+			return nil, err
+		}
+	} else {
+		text.WriteString(strings.Join(conf.Arguments, " "))
+		for _, v := range conf.EnvVars {
+			text.WriteString(" " + v)
+		}
+	}
+	for _, s := range secretValues {
+		if s.pattern.Match(text.Bytes()) {
+			findings = append(findings, Finding{
+				Check:   "secrets",
+				Problem: "the service configuration contains what looks like " + s.kind,
+				Fix:     secretFix,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// checkSecrets returns a SecretError for the secrets found by secrets,
+// unless the Secrets option is SecretsWarn.
+func (c *Config) checkSecrets(r renderer) error {
+	policy := c.Option.string(optionSecrets, SecretsRefuse)
+	if policy != SecretsRefuse && policy != SecretsWarn {
+		return fmt.Errorf("unknown %s option %q", optionSecrets, policy)
+	}
+	findings, err := c.secrets(r)
+	if err != nil || len(findings) == 0 || policy == SecretsWarn {
+		return err
+	}
+	return &SecretError{Findings: findings}
+}
@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 
 // Package service provides a simple way to create a system service.
-// Currently supports Windows, Linux/(systemd | Upstart | SysV | OpenRC), and OSX/Launchd.
+// Currently supports Windows, Linux/(systemd | Upstart | SysV | OpenRC | runit | s6), and OSX/Launchd.
 //
 // Windows controls services by setting up callbacks that is non-trivial. This
 // is very different then other systems. This package provides the same API
@@ -11,6 +11,11 @@
 // It also can be used to detect how a program is called, from an interactive
 // terminal or from a service manager.
 //
+// Building with the service_minimal tag leaves out the Supervisor, the
+// Updater and the NewWorker, NewCronJob and NewHTTPAgent constructors along
+// with their net/http and control socket code, for small agents where binary
+// size matters.
+//
 // Examples in the example/ folder.
 //
 //	package main
@@ -63,7 +68,8 @@ package service // import "github.com/kardianos/service"
 
 import (
 	"errors"
-	"fmt"
+	"strings"
+	"time"
 )
 
 const (
@@ -86,6 +92,7 @@ const (
 	optionLimitNOFILE        = "LimitNOFILE"
 	optionLimitNOFILEDefault = -1 // -1 = don't set in configuration
 	optionRestart            = "Restart"
+	optionListenStream       = "ListenStream"
 
 	optionSuccessExitStatus = "SuccessExitStatus"
 
@@ -94,8 +101,12 @@ const (
 	optionUpstartScript = "UpstartScript"
 	optionLaunchdConfig = "LaunchdConfig"
 	optionOpenRCScript  = "OpenRCScript"
+	optionShebang       = "Shebang"
 
 	optionLogDirectory = "LogDirectory"
+
+	optionLogRotate        = "LogRotate"
+	optionLogRotateDefault = false
 )
 
 // Status represents service status as an byte value
@@ -106,18 +117,92 @@ const (
 	StatusUnknown Status = iota // Status is unable to be determined due to an error or it was not installed.
 	StatusRunning
 	StatusStopped
+	StatusMasked // Stopped and prevented from starting, see Mask.
+)
+
+// String returns the status text in English; see MessageID for the text in
+// the current locale.
+func (s Status) String() string {
+	return defaultCatalog[s.MessageID()]
+}
+
+// MessageID returns the message of s, shown to operators in their locale
+// with Message(s.MessageID()).
+func (s Status) MessageID() MessageID {
+	switch s {
+	case StatusRunning:
+		return MsgStatusRunning
+	case StatusStopped:
+		return MsgStatusStopped
+	case StatusMasked:
+		return MsgStatusMasked
+	default:
+		return MsgStatusUnknown
+	}
+}
+
+// Capability is a set of features the service manager of a Service supports,
+// as reported by Capabilities.
+type Capability uint
+
+// Capabilities of service managers.
+const (
+	CapSocketActivation Capability = 1 << iota // Start the service when a connection arrives.
+	CapUserMode                                // Run as a per user service, see the UserService option.
+	CapEnable                                  // Enable or disable starting at boot apart from installing.
+	CapMask                                    // Prevent starting the service, see Mask.
+	CapStopFor                                 // Stop the service for a while, see StopFor.
+	CapSignal                                  // Signal all processes of the service, see Signal.
 )
 
+var capabilityNames = []string{"socket-activation", "user-mode", "enable", "mask", "stop-for", "signal"}
+
+// Capabler is implemented by the services of the service managers that
+// support some of the Capability features.
+type Capabler interface {
+	Capabilities() Capability
+}
+
+// Capabilities returns the features supported by the service manager of s,
+// so callers can adapt rather than interpret "not supported" errors.
+// Services that do not implement Capabler support none.
+func Capabilities(s Service) Capability {
+	if c, ok := s.(Capabler); ok {
+		return c.Capabilities()
+	}
+	return 0
+}
+
+// Has reports whether all capabilities in o are in c.
+func (c Capability) Has(o Capability) bool {
+	return c&o == o
+}
+
+// String returns the names of the capabilities in c separated by commas.
+func (c Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
 // Config provides the setup for a Service. The Name field is required.
 type Config struct {
 	Name        string   // Required name of the service. No spaces suggested.
 	DisplayName string   // Display name, spaces allowed.
 	Description string   // Long description of service.
-	UserName    string   // Run as username.
+	UserName    string   // Run as username, or UID, or SID on Windows; see Account.
 	Arguments   []string // Run with arguments.
 
 	// Optional field to specify the executable for service.
-	// If empty the current executable is used.
+	// If empty the current executable is used. Any program may be used,
+	// a bare name is looked up in PATH. On Windows programs that do not
+	// implement the Windows service protocol must be run under a wrapper
+	// such as a Supervisor, which runs batch (.bat, .cmd) and PowerShell
+	// (.ps1) scripts through their interpreter; Install refuses scripts.
 	Executable string
 
 	// Array of service dependencies.
@@ -128,6 +213,9 @@ type Config struct {
 	//     "Requires=syslog.target"
 	//     Note, such lines will be directly appended into the [Unit] of
 	//     the generated service config file, will not check their correctness.
+	//  2. Support linux-openrc dependencies, the statements of the depend
+	//     function such as "need net" or "after firewall". Other elements,
+	//     such as systemd lines, are left out of the OpenRC script.
 	Dependencies []string
 
 	// The following fields are not supported on Windows.
@@ -138,6 +226,9 @@ type Config struct {
 	Option KeyValue
 
 	EnvVars map[string]string
+
+	// Hooks run around the start and stop of the service, see Hooks.
+	Hooks Hooks
 }
 
 var (
@@ -152,6 +243,27 @@ var (
 	ErrNoServiceSystemDetected = errors.New("No service system detected.")
 	// ErrNotInstalled is returned when the service is not installed.
 	ErrNotInstalled = errors.New("the service is not installed")
+	// ErrAlreadyInstalled is returned by Install when the service, or the
+	// configuration file it would write, already exists.
+	ErrAlreadyInstalled = errors.New("the service is already installed")
+	// ErrNotRunning is returned for operations requiring a running service,
+	// such as Signal.
+	ErrNotRunning = errors.New("the service is not running")
+	// ErrAlreadyRunning is returned by Start when the service manager
+	// refuses to start a running service.
+	ErrAlreadyRunning = errors.New("the service is already running")
+	// ErrPermission is returned when the caller lacks the permissions for
+	// an operation, usually because it is not run as root or administrator.
+	//
+	// The errors returned for these conditions carry a message of their own,
+	// naming the file or service; test for them with errors.Is.
+	ErrPermission = errors.New("permission denied")
+	// ErrConsentRequired is returned by Install when the EULA option is set
+	// and the agreement was not accepted.
+	ErrConsentRequired = errors.New("the license agreement was not accepted")
+	// ErrNotSupported is returned for operations the service manager does
+	// not support, see Capabilities.
+	ErrNotSupported = errors.New("not supported by the service manager")
 )
 
 // New creates a new service based on a service interface and configuration.
@@ -162,6 +274,10 @@ func New(i Interface, c *Config) (Service, error) {
 	if system == nil {
 		return nil, ErrNoServiceSystemDetected
 	}
+	c, err := c.namespaced()
+	if err != nil {
+		return nil, err
+	}
 	return system.New(i, c)
 }
 
@@ -171,37 +287,182 @@ func New(i Interface, c *Config) (Service, error) {
 //    - KeepAlive     bool   (true)             - Prevent the system from stopping the service automatically.
 //    - RunAtLoad     bool   (false)            - Run the service after its job has been loaded.
 //    - SessionCreate bool   (false)            - Create a full user session.
+//    - ClearQuarantine bool (false)            - Remove the Gatekeeper quarantine attribute from the executable
+//                                                at install. Preflight reports it otherwise.
+//    - KeepAliveSuccessfulExit bool ()         - Keep the service alive only after it exited successfully (true) or
+//                                                with an error (false), replacing KeepAlive.
+//    - KeepAliveNetworkState bool (false)      - Keep the service alive while the network is up, replacing KeepAlive.
+//    - KeepAlivePathState string ()            - Paths, separated by commas, keeping the service alive while they
+//                                                exist, or while they do not if prefixed with "!", replacing
+//                                                KeepAlive.
+//    - ThrottleInterval int ()                 - Seconds launchd waits between starts of the service, RestartSec
+//                                                if not set.
+//    - LimitLoadToSessionType string ()        - Session types, separated by commas, the agent is loaded in, such
+//                                                as "Aqua" or "Background,LoginWindow". An agent limited to
+//                                                "Background" is bootstrapped in the user/<uid> domain, which
+//                                                exists for users logged in over SSH only, others in gui/<uid>.
+//    - UserService   bool   (false)            - Install a launch agent of the current user in
+//                                                ~/Library/LaunchAgents, bootstrapped in the login session of the
+//                                                user, with its logs in ~/Library/Logs. Installing a launch daemon
+//                                                requires root.
+//    - ListenStream  string ()                 - As for systemd: launchd listens on the addresses and starts the
+//                                                service on demand. The service takes them over by passing
+//                                                "Listeners" to launch_activate_socket; ActivationListeners does
+//                                                not support launchd.
+//
+//  * AIX
+//    - SRCGroup      string ()                 - Subsystem group of the service, to start and stop it with
+//                                                startsrc -g and stopsrc -g.
 //
 //  * Solaris
 //    - Prefix        string ("application")    - Service FMRI prefix.
+//    - SMFManifest   string ()                 - Use custom SMF manifest.
+//    - SMFManifestDir string ("/lib/svc/manifest") - Directory of the manifest, which is imported with
+//                                                svccfg. /opt/custom/smf in the global zone of SmartOS.
+//
+//  * All
+//    - Namespace     string () [tenant1, ...]  - Namespace of the service, so that installations of the same program
+//                                                for different tenants coexist: the Name becomes "<Namespace>-<Name>",
+//                                                which the unit, manifest and log file names and log identifiers are
+//                                                derived from, and the file names of PIDFile and StateDirectory are
+//                                                prefixed likewise. See Namespaced.
 //
 //  * POSIX
-//    - UserService   bool   (false)            - Install as a current user service.
+//    - UserService   bool   (false)            - Install as a current user service. With systemd the units of the
+//                                                "linux-systemd-user" platform, which can be chosen with ChooseSystem
+//                                                from AvailableSystems, are always user services; see Linger.
 //    - SystemdScript string ()                 - Use custom systemd script.
 //    - UpstartScript string ()                 - Use custom upstart script.
 //    - SysvScript    string ()                 - Use custom sysv script.
 //    - OpenRCScript  string ()                 - Use custom OpenRC script.
+//    - Interpreter   string () [shebang, python3 -u, ...] - Run the Executable, a script, with this interpreter,
+//                                                or with the one of its "#!" line for "shebang". The interpreter is
+//                                                resolved to an absolute path at install, also when run through
+//                                                env, and the service manager runs it with the script as its
+//                                                first argument.
+//    - Shebang       string ()                 - Interpreter line of the generated SysV and OpenRC scripts, such as
+//                                                "#!/bin/busybox sh", instead of "#!/bin/sh" and
+//                                                "#!/sbin/openrc-run". The scripts are POSIX sh.
+//    - RunitScript   string ()                 - Use custom runit run script.
+//    - S6Script      string ()                 - Use custom s6 run script.
 //    - RunWait       func() (wait for SIGNAL)  - Do not install signal but wait for this function to return.
-//    - ReloadSignal  string () [USR1, ...]     - Signal to send on reload.
+//    - ReloadSignal  string () [USR1, ...]     - Signal to send on reload, calls Reload of a Reloader.
+//    - PrivateTmp    bool   (false)            - Give the service a private temporary directory in TMPDIR (TMP and
+//                                                TEMP on Windows), removed when it stops. Systemd units also get
+//                                                PrivateTmp=true.
+//    - DiskQuota     string () [512M, ...]     - Cap on the disk used by the StateDirectory and the log files of
+//                                                the service. Run prunes the oldest rotated log files and logs
+//                                                errors while the service is over it.
+//    - StopSignals   string (TERM,INT)         - Signals ending Run. On Windows only INT (Ctrl-C) and
+//                                                TERM (console closed) apply, to interactive runs.
+//    - IgnoreSignals string () [HUP, ...]      - Signals ignored while running.
 //    - PIDFile       string () [/run/prog.pid] - Location of the PID file.
-//    - LogOutput     bool   (false)            - Redirect StdErr & StandardOutPath to files.
-//    - Restart       string (always)           - How shall service be restarted.
+//    - LogOutput     bool   (false)            - Redirect StdErr & StandardOutPath to files. True by default on
+//                                                OS X, where false leaves the output of launchd services unset.
+//    - Restart       string (always)           - How shall service be restarted: RestartAlways, RestartOnFailure,
+//                                                RestartNever or another Restart= of systemd. On OS X it replaces
+//                                                KeepAlive if set.
+//    - RestartSec    string ("2m")             - Delay before a restart, time.Duration string. On OS X the
+//                                                ThrottleInterval, if set.
+//    - RestartMaxDelay string ()               - Back off restarts exponentially from RestartSec up to this
+//                                                delay, time.Duration string (systemd 254 and later).
+//    - RestartSteps  int    (5)                - Restarts to reach RestartMaxDelay in.
 //    - SuccessExitStatus string ()             - The list of exit status that shall be considered as successful,
 //                                                in addition to the default ones.
-//    - LogDirectory string(/var/log)           - The path to the log files directory
+//    - LogDirectory string(/var/log)           - The path to the log files directory, created at install
+//                                                and owned by UserName along with the log files.
+//
+//  * All
+//    - RelativePaths string (given)            - Resolve relative paths at install or runtime, see PathsAtInstall.
+//                                                By default they are passed to the service manager as given.
+//    - ShutdownTimeout string ()               - Time given to Interface.Stop before the goroutine stacks are
+//                                                logged and the program exits with ExitStopTimeout,
+//                                                time.Duration string.
+//    - StateDirectory string ()                - Directory of state kept for the service, such as whether
+//                                                FirstRun completed. Defaults to /var/lib/<Name>, or the
+//                                                platform's equivalent.
+//    - EULA          string ()                 - Agreement Install requires to be accepted, by AcceptEULA,
+//                                                ACCEPT_EULA=Y in the environment or Consent. Acceptance
+//                                                is recorded in the install manifest, see InstallManifest.
+//    - AcceptEULA    bool   (false)            - The agreement named by EULA was accepted.
+//    - Consent       func(eula string) bool    - Asks to accept the agreement named by EULA.
+//    - Force         bool   (false)            - Uninstall even if other services depend on the service
+//                                                (systemd and Windows), see DependentsError.
+//    - ScrubEnv      string ()                 - EnvVars left out of the installed service, names or shell
+//                                                patterns such as "*_TOKEN" separated by commas or spaces,
+//                                                compared without regard to case.
+//    - Secrets       string (refuse)           - What Install does about secrets in the service configuration,
+//                                                which every user can read: SecretsRefuse or SecretsWarn,
+//                                                reporting them by Preflight only. See SecretError.
+//    - SensitiveEnv  string ()                 - EnvVars taken to be secrets, in addition to names such as
+//                                                API_TOKEN, in the form of ScrubEnv.
 //
 //  * Linux (systemd)
 //    - LimitNOFILE   int    (-1)               - Maximum open files (ulimit -n)
 //                                                (https://serverfault.com/questions/628610/increasing-nproc-for-processes-launched-by-systemd-on-centos-7)
+//    - Preset        string ()                 - Enable the service by the preset policy rather than
+//                                                unconditionally, see PresetPolicy.
+//    - WatchdogSec   string ()                 - Restart the service if it does not send keep-alive notifications
+//                                                for this long, time.Duration string. Run sends them while a
+//                                                Watchdog reports the service healthy.
+//    - ListenStream  string ()                 - Addresses, separated by spaces, systemd listens on for the
+//                                                service in a socket unit, such as "443 /run/agent.sock". The
+//                                                service takes them over with ActivationListeners.
+//    - PropagateTrace bool  (false)            - ControlTraced starts the program with the trace context of the
+//                                                request in TRACEPARENT.
+//    - Journal       bool   (true)             - SystemLogger writes to the journal with its native protocol, see
+//                                                JournalLogger, rather than to syslog.
+//    - Notify        bool   (false)            - The service is started once it reports ready: Run does after
+//                                                Start, a Supervisor with a HealthCheck once its program is
+//                                                healthy. StatusEx reports the health of the program.
+//  * Linux
+//    - LogRotate     bool   (false)            - Install a logrotate.d configuration for the log files.
+//    - Linger        bool   (false)            - Keep the processes of the user running after the user logs out:
+//                                                the user manager of a systemd UserService, whose Start from an SSH
+//                                                session records a Degradation without it, or the runtime directory
+//                                                of an agent Run from an elogind session.
+//    - Quirks        bool   (true)             - Adapt Install to the distribution named in os-release: label
+//                                                files for SELinux with restorecon on Red Hat and cousins and
+//                                                enable SystemV scripts with update-rc.d on Debian and cousins,
+//                                                start them with invoke-rc.d to honor policy-rc.d there, or
+//                                                enable them with chkconfig on Red Hat and Amazon Linux.
+//  * Linux (runit)
+//    - SVDIR         string ()                 - Directory runsvdir runs the services of, defaults to SVDIR of
+//                                                the environment, /var/service if it exists or /etc/service.
+//  * Linux (s6)
+//    - S6ScanDir     string ()                 - Scan directory of s6-svscan, defaults to /run/service or
+//                                                /service, where s6-svscan runs.
+//  * NewWorker, NewCronJob, NewHTTPAgent
+//    - DrainTimeout  string ("10s")            - Time given to in-flight work to finish on stop, time.Duration string.
+//    - DrainGrace    string ("5s")             - NewHTTPAgent: time /healthz answers 503 on stop before the server stops
+//                                                accepting connections, time.Duration string.
+//    - CatchUp       string ("once")           - NewCronJob: what to do about runs missed while suspended, see CatchUpOnce.
+//
 //  * Windows
 //    - DelayedAutoStart  bool (false)                - After booting, start this service after some delay.
 //    - Password  string ()                           - Password to use when interfacing with the system service manager.
+//                                                      Not used by the virtual account of the service, "NT SERVICE\<Name>",
+//                                                      and group managed service accounts, "DOMAIN\name$", as UserName;
+//                                                      those are granted the right to log on as a service at Install.
 //    - Interactive       bool (false)                - The service can interact with the desktop. (more information https://docs.microsoft.com/en-us/windows/win32/services/interactive-services)
 //    - DelayedAutoStart        bool (false)          - after booting start this service after some delay.
 //    - StartType               string ("automatic")  - Start service type. (automatic | manual | disabled)
 //    - OnFailure               string ("restart" )   - Action to perform on service failure. (restart | reboot | noaction)
 //    - OnFailureDelayDuration  string ( "1s" )       - Delay before restarting the service, time.Duration string.
 //    - OnFailureResetPeriod    int ( 10 )            - Reset period for errors, seconds.
+//    - OnFailureActions        string ()             - Actions on the first, second and later failures with their
+//                                                      delays, replacing OnFailure, such as
+//                                                      "restart/5s,run/1m,reboot/10m". Set during Install.
+//    - OnFailureCommand        string ()             - Command line run by the run action.
+//    - OnFailureRebootMessage  string ()             - Message broadcast to users before the reboot action.
+//    - OnFailureNonCrash       bool (false)          - Also take the actions when the service stops with an error
+//                                                      exit code rather than crashing.
+//    - StartTriggers           string ()             - Events starting the service, separated by commas: "network" when
+//                                                      an IP address becomes available, "device:<interface class
+//                                                      GUID>[/<hardware ID>]" on device arrival and "etw:<provider
+//                                                      GUID>" on an ETW event. Usually with the manual StartType.
+//    - LoadOrderGroup          string ()             - Load ordering group the service starts in. Tags
+//                                                      ordering within a group only apply to drivers.
 type KeyValue map[string]interface{}
 
 // bool returns the value of the given name, assuming the value is a boolean.
@@ -334,6 +595,8 @@ type System interface {
 //      - For a successful exit, os.Exit should not be called in Interface.Stop().
 //   8. Service.Run returns.
 //   9. User program should quickly exit.
+//
+// See ContextInterface for a variant passing a context cancelled on stop.
 type Interface interface {
 	// Start provides a place to initiate the service. The service doesn't
 	// signal a completed start until after this function returns, so the
@@ -348,6 +611,8 @@ type Interface interface {
 
 // Shutdowner represents a service interface for a program that differentiates between "stop" and
 // "shutdown". A shutdown is triggered when the whole box (not just the service) is stopped.
+// It is detected on Windows and on Linux, where systemd is stopping or the runlevel is 0 or 6;
+// on other systems Stop is called either way.
 type Shutdowner interface {
 	Interface
 	// Shutdown provides a place to clean up program execution when the system is being shutdown.
@@ -356,6 +621,17 @@ type Shutdowner interface {
 	Shutdown(s Service) error
 }
 
+// Reloader represents a service interface for a program that can reload its
+// configuration while running. Reload is called when the ReloadSignal option
+// signal arrives, or on Windows when the service manager signals a parameter
+// change.
+type Reloader interface {
+	Interface
+	// Reload provides a place to reload the configuration. Errors are logged
+	// and the service keeps running.
+	Reload(s Service) error
+}
+
 // TODO: Add Configure to Service interface.
 
 // Service represents a service that can be run or controlled.
@@ -408,7 +684,11 @@ type Service interface {
 var ControlAction = [5]string{"start", "stop", "restart", "install", "uninstall"}
 
 // Control issues control functions to the service from a given action string.
+// The outcome is reported to the Telemetry set with SetTelemetry. The error
+// wraps the error of the action, so errors.Is reports its kind, such as
+// ErrAlreadyInstalled.
 func Control(s Service, action string) error {
+	begin := time.Now()
 	var err error
 	switch action {
 	case ControlAction[0]:
@@ -422,10 +702,11 @@ func Control(s Service, action string) error {
 	case ControlAction[4]:
 		err = s.Uninstall()
 	default:
-		err = fmt.Errorf("Unknown action %s", action)
+		err = errors.New(Message(MsgUnknownAction, action))
 	}
+	report(TelemetryControl, s, action, begin, err)
 	if err != nil {
-		return fmt.Errorf("Failed to %s %v: %v", action, s, err)
+		return newError(err, Message(MsgControlFailed, action, s, err))
 	}
 	return nil
 }
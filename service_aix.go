@@ -1,4 +1,5 @@
-//+build aix
+//go:build aix
+// +build aix
 
 // Copyright 2015 Daniel Theophanes.
 // Use of this source code is governed by a zlib-style
@@ -8,14 +9,16 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"os/signal"
+	"os/user"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
@@ -24,6 +27,8 @@ const maxPathSize = 32 * 1024
 
 const version = "aix-ssrc"
 
+const optionSRCGroup = "SRCGroup"
+
 type aixSystem struct{}
 
 func (aixSystem) String() string {
@@ -45,7 +50,10 @@ func (aixSystem) New(i Interface, c *Config) (Service, error) {
 }
 
 func getArgsFromPid(pid int) string {
-	cmd := exec.Command("ps", "-o", "args", "-p", strconv.Itoa(pid))
+	cmd, err := toolCommand("ps", "-o", "args", "-p", strconv.Itoa(pid))
+	if err != nil {
+		return ""
+	}
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	if err := cmd.Run(); err == nil {
@@ -92,6 +100,11 @@ func (s *aixService) Platform() string {
 	return version
 }
 
+// appliesUserName reports that the service runs as the UserName, with the uid of mkssys.
+func (s *aixService) appliesUserName() bool {
+	return true
+}
+
 func (s *aixService) template() *template.Template {
 	functions := template.FuncMap{
 		"bool": func(v bool) string {
@@ -116,13 +129,113 @@ func (s *aixService) configPath() (cp string, err error) {
 	return
 }
 
+// render writes the rc script Install installs.
+func (s *aixService) render(w io.Writer) error {
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Path     string
+		StartSRC string
+	}{
+		conf,
+		path,
+		shArgs(s.startsrc(conf)),
+	}
+
+	return s.template().Execute(w, to)
+}
+
+// srcArgs quotes the arguments for SRC, which splits them at blanks outside
+// double quotes.
+func srcArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\"") {
+			a = `"` + strings.Replace(a, `"`, `\"`, -1) + `"`
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
+
+// startsrc returns the arguments of startsrc starting the subsystem with
+// the EnvVars of c, which SRC sets per start rather than in the subsystem.
+func (s *aixService) startsrc(c *Config) []string {
+	args := []string{"-s", s.Name}
+	if len(c.EnvVars) > 0 {
+		env := make([]string, 0, len(c.EnvVars))
+		for k, v := range c.EnvVars {
+			env = append(env, k+"="+v)
+		}
+		sort.Strings(env)
+		args = append(args, "-e", srcArgs(env))
+	}
+	return args
+}
+
+// mkssys returns the arguments of mkssys defining the subsystem: the
+// program is signalled to stop, with SIGTERM and SIGKILL after 30 seconds,
+// respawned by srcmstr unless the Restart option is never, and in the
+// subsystem group of the SRCGroup option, if set, to be started and stopped
+// with its group by startsrc -g and stopsrc -g.
+func (s *aixService) mkssys() ([]string, error) {
+	path, err := s.execPath()
+	if err != nil {
+		return nil, err
+	}
+	conf, err := s.installConfig()
+	if err != nil {
+		return nil, err
+	}
+	uid := "0"
+	if conf.UserName != "" {
+		u, err := user.Lookup(conf.UserName)
+		if err != nil {
+			return nil, err
+		}
+		uid = u.Uid
+	}
+	args := []string{"-s", s.Name, "-p", path, "-u", uid}
+	if len(conf.Arguments) > 0 {
+		args = append(args, "-a", srcArgs(conf.Arguments))
+	}
+	if group := s.Option.string(optionSRCGroup, ""); group != "" {
+		args = append(args, "-G", group)
+	}
+	if s.Option.string(optionRestart, RestartAlways) == RestartNever {
+		args = append(args, "-O")
+	} else {
+		args = append(args, "-R")
+	}
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		dir := s.Option.string(optionLogDirectory, defaultLogDirectory)
+		args = append(args, "-i", "/dev/null",
+			"-o", filepath.Join(dir, s.Name+".out"),
+			"-e", filepath.Join(dir, s.Name+".err"))
+	}
+	return append(args, "-Q", "-S", "-n", "15", "-f", "9", "-d", "-w", "30"), nil
+}
+
 func (s *aixService) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
 	// install service
-	path, err := s.execPath()
+	args, err := s.mkssys()
 	if err != nil {
 		return err
 	}
-	err = run("mkssys", "-s", s.Name, "-p", path, "-u", "0", "-R", "-Q", "-S", "-n", "15", "-f", "9", "-d", "-w", "30")
+
+	err = run("mkssys", args...)
 	if err != nil {
 		return err
 	}
@@ -134,24 +247,16 @@ func (s *aixService) Install() error {
 	}
 	_, err = os.Stat(confPath)
 	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
 	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
-		return err
+		return permissionError(err)
 	}
 	defer f.Close()
 
-	var to = &struct {
-		*Config
-		Path string
-	}{
-		s.Config,
-		path,
-	}
-
-	err = s.template().Execute(f, to)
+	err = s.render(f)
 	if err != nil {
 		return err
 	}
@@ -183,6 +288,11 @@ func (s *aixService) Uninstall() error {
 	if err != nil {
 		return err
 	}
+	for _, i := range [...]string{"2", "3"} {
+		os.Remove("/etc/rc" + i + ".d/S50" + s.Name)
+		os.Remove("/etc/rc" + i + ".d/K02" + s.Name)
+	}
+	s.removePrivateTmp()
 	return os.Remove(confPath)
 }
 
@@ -221,35 +331,35 @@ func (s *aixService) Status() (Status, error) {
 }
 
 func (s *aixService) Start() error {
-	return run("startsrc", "-s", s.Name)
+	return run("startsrc", s.startsrc(s.Config)...)
 }
 func (s *aixService) Stop() error {
 	return run("stopsrc", "-s", s.Name)
 }
+
+// Restart stops the subsystem and starts it once srcmstr reports it
+// inoperative, which takes until the program exited.
 func (s *aixService) Restart() error {
 	err := s.Stop()
 	if err != nil {
 		return err
 	}
-	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 350; i++ {
+		if status, _ := s.Status(); status != StatusRunning {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 	return s.Start()
 }
 
 func (s *aixService) Run() error {
-	var err error
-
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *aixService) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *aixService) Logger(errs chan<- error) (Logger, error) {
@@ -265,7 +375,7 @@ func (s *aixService) SystemLogger(errs chan<- error) (Logger, error) {
 var svcConfig = `#!/bin/ksh
 case "$1" in
 start )
-        startsrc -s {{.Name}}
+        startsrc {{.StartSRC}}
         ;;
 stop )
         stopsrc -s {{.Name}}
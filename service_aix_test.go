@@ -0,0 +1,40 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build aix
+// +build aix
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAIXSubsystemArgs(t *testing.T) {
+	s := &aixService{Config: &Config{
+		Name:       "agent",
+		Executable: "/bin/sh",
+		Arguments:  []string{"-c", "exec agent"},
+		EnvVars:    map[string]string{"MODE": "a b", "HOME": "/home/agent"},
+		Option:     KeyValue{optionLogOutput: true, optionSRCGroup: "agents"},
+	}}
+	args, err := s.mkssys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-s", "agent", "-p", "/bin/sh", "-u", "0",
+		"-a", `-c "exec agent"`,
+		"-G", "agents", "-R",
+		"-i", "/dev/null", "-o", "/var/log/agent.out", "-e", "/var/log/agent.err",
+		"-Q", "-S", "-n", "15", "-f", "9", "-d", "-w", "30",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("mkssys %q, want %q", args, want)
+	}
+	if got, want := s.startsrc(s.Config), []string{"-s", "agent", "-e", `HOME=/home/agent "MODE=a b"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("startsrc %q, want %q", got, want)
+	}
+}
@@ -5,25 +5,23 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
 
 const maxPathSize = 32 * 1024
 
-const (
-	version                   = "darwin-launchd"
-	defaultDarwinLogDirectory = "/usr/local/var/log"
-)
+const version = "darwin-launchd"
 
 type darwinSystem struct{}
 
@@ -84,6 +82,20 @@ func (s *darwinLaunchdService) Platform() string {
 	return version
 }
 
+// appliesUserName reports that the service runs as the UserName, with the UserName key.
+func (s *darwinLaunchdService) appliesUserName() bool {
+	return true
+}
+
+func (s *darwinLaunchdService) Capabilities() Capability {
+	return CapSocketActivation | CapUserMode | CapEnable | CapMask | CapSignal
+}
+
+// domain returns the launchd domain of the service, see launchdDomain.
+func (s *darwinLaunchdService) domain() string {
+	return launchdDomain(s.Config, os.Getuid())
+}
+
 func (s *darwinLaunchdService) getHomeDir() (string, error) {
 	u, err := user.Current()
 	if err == nil {
@@ -109,6 +121,10 @@ func (s *darwinLaunchdService) getServiceFilePath() (string, error) {
 	return "/Library/LaunchDaemons/" + s.Name + ".plist", nil
 }
 
+func (s *darwinLaunchdService) configPath() (string, error) {
+	return s.getServiceFilePath()
+}
+
 func (s *darwinLaunchdService) template() *template.Template {
 	functions := template.FuncMap{
 		"bool": func(v bool) string {
@@ -127,16 +143,125 @@ func (s *darwinLaunchdService) template() *template.Template {
 	return template.Must(template.New("").Funcs(functions).Parse(launchdConfig))
 }
 
+// restart translates the Restart option, if set, to KeepAlive and the
+// RestartSec option, if set, to the ThrottleInterval of launchd, which does
+// not back off.
+func (s *darwinLaunchdService) restart() (keepAlive, onFailure bool, throttle int, err error) {
+	keepAlive = s.Option.bool(optionKeepAlive, optionKeepAliveDefault)
+	switch s.Option.string(optionRestart, "") {
+	case RestartAlways:
+		keepAlive = true
+	case RestartNever:
+		keepAlive = false
+	case RestartOnFailure:
+		keepAlive, onFailure = false, true
+	}
+	delay, maxDelay, err := s.restartDelays()
+	if err != nil {
+		return false, false, 0, err
+	}
+	if _, ok := s.Option[optionRestartSec]; ok {
+		throttle = int(delay / time.Second)
+	}
+	throttle = s.Option.int(optionThrottleInterval, throttle)
+	if maxDelay > 0 {
+		degrade("launchd restart backoff", "ThrottleInterval", ErrNotSupported)
+	}
+	return keepAlive, onFailure, throttle, nil
+}
+
+// render writes the property list Install installs.
+func (s *darwinLaunchdService) render(w io.Writer) error {
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	keepAlive, onFailure, throttle, err := s.restart()
+	if err != nil {
+		return err
+	}
+	successfulExit := ""
+	if onFailure {
+		successfulExit = "false"
+	}
+	if _, ok := s.Option[optionKeepAliveSuccessfulExit]; ok {
+		successfulExit = strconv.FormatBool(s.Option.bool(optionKeepAliveSuccessfulExit, false))
+	}
+	var sockets []launchdSocket
+	for _, addr := range strings.Fields(s.Option.string(optionListenStream, "")) {
+		socket, err := parseLaunchdSocket(addr)
+		if err != nil {
+			return err
+		}
+		sockets = append(sockets, socket)
+	}
+
+	var to = &struct {
+		*Config
+		Path string
+
+		KeepAlive, RunAtLoad bool
+		RestartOnFailure     bool
+		ThrottleInterval     int
+
+		// Conditions of KeepAlive, which replace it if any is set.
+		SuccessfulExit string // "true", "false" or unset.
+		NetworkState   bool
+		PathState      []launchdPathState
+
+		Sockets                []launchdSocket
+		SocketsName            string
+		LimitLoadToSessionType []string
+
+		SessionCreate bool
+		StandardOut   bool
+		StandardError bool
+		LogDirectory  string
+	}{
+		Config:           conf,
+		Path:             path,
+		KeepAlive:        keepAlive,
+		RunAtLoad:        s.Option.bool(optionRunAtLoad, optionRunAtLoadDefault),
+		RestartOnFailure: onFailure,
+		ThrottleInterval: throttle,
+		SuccessfulExit:   successfulExit,
+		NetworkState:     s.Option.bool(optionKeepAliveNetworkState, false),
+		PathState:        parsePathState(s.Option.string(optionKeepAlivePathState, "")),
+		Sockets:          sockets,
+		SocketsName:      launchdSocketsName,
+		SessionCreate:    s.Option.bool(optionSessionCreate, optionSessionCreateDefault),
+		StandardOut:      launchdLogOutput(s.Config),
+		StandardError:    launchdLogOutput(s.Config),
+		LogDirectory:     launchdLogDirectory(s.Config),
+
+		LimitLoadToSessionType: launchdSessionTypes(s.Config),
+	}
+
+	return s.template().Execute(w, to)
+}
+
 func (s *darwinLaunchdService) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
 	confPath, err := s.getServiceFilePath()
 	if err != nil {
 		return err
 	}
 	_, err = os.Stat(confPath)
 	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
 	}
 
+	if !s.userService && os.Geteuid() != 0 {
+		return newError(ErrPermission, "installing a launch daemon requires root, set the UserService option to install a launch agent of the user")
+	}
 	if s.userService {
 		// Ensure that ~/Library/LaunchAgents exists.
 		err = os.MkdirAll(filepath.Dir(confPath), 0700)
@@ -147,7 +272,7 @@ func (s *darwinLaunchdService) Install() error {
 
 	f, err := os.Create(confPath)
 	if err != nil {
-		return err
+		return permissionError(err)
 	}
 	defer f.Close()
 
@@ -155,26 +280,37 @@ func (s *darwinLaunchdService) Install() error {
 	if err != nil {
 		return err
 	}
+	if err := checkArch(path, hostArchs()); err != nil {
+		return err
+	}
+	if err := s.clearQuarantine(path); err != nil {
+		return err
+	}
 
-	var to = &struct {
-		*Config
-		Path string
-
-		KeepAlive, RunAtLoad bool
-		SessionCreate        bool
-		StandardOut          bool
-		StandardError        bool
-		LogDirectory         string
-	}{
-		Config:        s.Config,
-		Path:          path,
-		KeepAlive:     s.Option.bool(optionKeepAlive, optionKeepAliveDefault),
-		RunAtLoad:     s.Option.bool(optionRunAtLoad, optionRunAtLoadDefault),
-		SessionCreate: s.Option.bool(optionSessionCreate, optionSessionCreateDefault),
-		LogDirectory:  s.Option.string(optionLogDirectory, defaultDarwinLogDirectory),
+	if launchdLogOutput(s.Config) {
+		logDir := launchdLogDirectory(s.Config)
+		err = s.prepareLogFiles(logDir, s.Name+".out.log", s.Name+".err.log")
+		if err != nil {
+			return err
+		}
 	}
 
-	return s.template().Execute(f, to)
+	return s.render(f)
+}
+
+func (s *darwinLaunchdService) installTo(root string) error {
+	if s.userService {
+		return ErrNotSupported
+	}
+	confPath, err := s.getServiceFilePath()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	return writeRootFile(root, confPath, b.Bytes(), 0644)
 }
 
 func (s *darwinLaunchdService) Uninstall() error {
@@ -184,6 +320,7 @@ func (s *darwinLaunchdService) Uninstall() error {
 	if err != nil {
 		return err
 	}
+	s.removePrivateTmp()
 	return os.Remove(confPath)
 }
 
@@ -207,50 +344,184 @@ func (s *darwinLaunchdService) Status() (Status, error) {
 	}
 
 	if _, err = os.Stat(confPath); err == nil {
+		if s.masked() {
+			return StatusMasked, nil
+		}
 		return StatusStopped, nil
 	}
 
 	return StatusUnknown, ErrNotInstalled
 }
 
+var (
+	launchdPID      = regexp.MustCompile(`(?m)^\s*pid = ([0-9]+)$`)
+	launchdRuns     = regexp.MustCompile(`(?m)^\s*runs = ([0-9]+)$`)
+	launchdExitCode = regexp.MustCompile(`(?m)^\s*last exit code = (-?[0-9]+)`)
+)
+
+func (s *darwinLaunchdService) StatusEx() (StatusInfo, error) {
+	st, err := s.Status()
+	si := StatusInfo{Status: st}
+	if err != nil {
+		return si, err
+	}
+	_, out, err := runWithOutput("launchctl", "print", s.domain()+"/"+s.Name)
+	if err != nil {
+		// Not loaded.
+		return si, nil
+	}
+	parseLaunchdPrint(&si, out)
+	if si.PID != 0 {
+		if _, out, err := runWithOutput("ps", "-o", "etime=", "-p", strconv.Itoa(si.PID)); err == nil {
+			if d, ok := parseElapsed(strings.TrimSpace(out)); ok {
+				si.setStarted(time.Now().Add(-d))
+			}
+		}
+	}
+	return si, nil
+}
+
+// parseLaunchdPrint fills in the details launchctl print reports on the
+// job.
+func parseLaunchdPrint(si *StatusInfo, out string) {
+	if m := launchdPID.FindStringSubmatch(out); m != nil {
+		si.PID, _ = strconv.Atoi(m[1])
+	}
+	if m := launchdRuns.FindStringSubmatch(out); m != nil {
+		if runs, _ := strconv.Atoi(m[1]); runs > 1 {
+			si.Restarts = runs - 1
+		}
+	}
+	if m := launchdExitCode.FindStringSubmatch(out); m != nil {
+		si.ExitCode, _ = strconv.Atoi(m[1])
+	}
+}
+
+// parseElapsed parses the [[dd-]hh:]mm:ss elapsed time of ps.
+func parseElapsed(v string) (time.Duration, bool) {
+	var days int
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		var err error
+		if days, err = strconv.Atoi(v[:i]); err != nil {
+			return 0, false
+		}
+		v = v[i+1:]
+	}
+	var d time.Duration
+	for _, f := range strings.Split(v, ":") {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return 0, false
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return time.Duration(days)*24*time.Hour + d*time.Second, true
+}
+
 func (s *darwinLaunchdService) Start() error {
+	return s.StartContext(context.Background())
+}
+func (s *darwinLaunchdService) Stop() error {
+	return s.StopContext(context.Background())
+}
+
+// StartContext loads the job, killing launchctl when ctx is done.
+func (s *darwinLaunchdService) StartContext(ctx context.Context) error {
 	confPath, err := s.getServiceFilePath()
 	if err != nil {
 		return err
 	}
-	return run("launchctl", "load", confPath)
+	if !s.userService {
+		return withFindings(s, runContext(ctx, "launchctl", "load", confPath))
+	}
+	// An agent is bootstrapped in the session of the user, or started
+	// again if it is loaded already.
+	if s.loaded() {
+		return withFindings(s, runContext(ctx, "launchctl", "kickstart", s.domain()+"/"+s.Name))
+	}
+	return withFindings(s, runContext(ctx, "launchctl", "bootstrap", s.domain(), confPath))
 }
-func (s *darwinLaunchdService) Stop() error {
+
+// StopContext unloads the job, see StartContext.
+func (s *darwinLaunchdService) StopContext(ctx context.Context) error {
 	confPath, err := s.getServiceFilePath()
 	if err != nil {
 		return err
 	}
-	return run("launchctl", "unload", confPath)
+	if s.userService {
+		return runContext(ctx, "launchctl", "bootout", s.domain()+"/"+s.Name)
+	}
+	return runContext(ctx, "launchctl", "unload", confPath)
+}
+
+// loaded reports whether the job is loaded in its domain.
+func (s *darwinLaunchdService) loaded() bool {
+	_, _, err := runWithOutput("launchctl", "print", s.domain()+"/"+s.Name)
+	return err == nil
 }
 func (s *darwinLaunchdService) Restart() error {
-	err := s.Stop()
+	return s.RestartContext(context.Background())
+}
+
+// RestartContext unloads and loads the job, see StartContext.
+func (s *darwinLaunchdService) RestartContext(ctx context.Context) error {
+	err := s.StopContext(ctx)
 	if err != nil {
 		return err
 	}
-	time.Sleep(50 * time.Millisecond)
-	return s.Start()
+	select {
+	case <-time.After(50 * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.StartContext(ctx)
 }
 
-func (s *darwinLaunchdService) Run() error {
-	var err error
-
-	err = s.i.Start(s)
+// Signal sends sig to the process group of the job, which launchd starts in
+// a session of its own.
+func (s *darwinLaunchdService) Signal(sig os.Signal) error {
+	si, err := s.StatusEx()
 	if err != nil {
 		return err
 	}
+	if si.PID == 0 {
+		return ErrNotRunning
+	}
+	return signalGroup(si.PID, sig)
+}
+
+// Mask disables the service in launchd, which then refuses to load it.
+func (s *darwinLaunchdService) Mask() error {
+	return run("launchctl", "disable", s.domain()+"/"+s.Name)
+}
+
+func (s *darwinLaunchdService) Unmask() error {
+	return run("launchctl", "enable", s.domain()+"/"+s.Name)
+}
+
+// masked reports whether launchd lists the service as disabled, as
+// `"name" => true` or `"name" => disabled` depending on the macOS version.
+func (s *darwinLaunchdService) masked() bool {
+	_, out, err := runWithOutput("launchctl", "print-disabled", s.domain())
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == strconv.Quote(s.Name) && fields[1] == "=>" {
+			return fields[2] == "true" || fields[2] == "disabled"
+		}
+	}
+	return false
+}
 
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *darwinLaunchdService) Run() error {
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *darwinLaunchdService) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *darwinLaunchdService) Logger(errs chan<- error) (Logger, error) {
@@ -293,16 +564,46 @@ var launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
     <key>SessionCreate</key>
     <{{bool .SessionCreate}}/>
     <key>KeepAlive</key>
-    <{{bool .KeepAlive}}/>
+    {{if or .SuccessfulExit .NetworkState .PathState}}<dict>
+      {{if .SuccessfulExit}}<key>SuccessfulExit</key>
+      <{{.SuccessfulExit}}/>{{end}}
+      {{if .NetworkState}}<key>NetworkState</key>
+      <true/>{{end}}
+      {{if .PathState}}<key>PathState</key>
+      <dict>
+      {{range .PathState}}<key>{{html .Path}}</key>
+        <{{bool .Exists}}/>
+      {{end}}</dict>{{end}}
+    </dict>{{else}}<{{bool .KeepAlive}}/>{{end}}
+    {{if .ThrottleInterval}}<key>ThrottleInterval</key>
+    <integer>{{.ThrottleInterval}}</integer>{{end}}
     <key>RunAtLoad</key>
     <{{bool .RunAtLoad}}/>
+    {{if .Sockets}}<key>Sockets</key>
+    <dict>
+      <key>{{.SocketsName}}</key>
+      <array>
+      {{range .Sockets}}<dict>
+        {{if .PathName}}<key>SockPathName</key>
+        <string>{{html .PathName}}</string>{{end}}
+        {{if .NodeName}}<key>SockNodeName</key>
+        <string>{{html .NodeName}}</string>{{end}}
+        {{if .ServiceName}}<key>SockServiceName</key>
+        <string>{{html .ServiceName}}</string>{{end}}
+      </dict>
+      {{end}}</array>
+    </dict>{{end}}
+    {{if .LimitLoadToSessionType}}<key>LimitLoadToSessionType</key>
+    <array>
+    {{range .LimitLoadToSessionType}}  <string>{{html .}}</string>
+    {{end}}</array>{{end}}
     <key>Disabled</key>
     <false/>
     
-    <key>StandardOutPath</key>
-    <string>{{html .LogDirectory}}/{{html .Name}}.out.log</string>
-    <key>StandardErrorPath</key>
-    <string>{{html .LogDirectory}}/{{html .Name}}.err.log</string>
+    {{if .StandardOut}}<key>StandardOutPath</key>
+    <string>{{html .LogDirectory}}/{{html .Name}}.out.log</string>{{end}}
+    {{if .StandardError}}<key>StandardErrorPath</key>
+    <string>{{html .LogDirectory}}/{{html .Name}}.err.log</string>{{end}}
   
   </dict>
 </plist>
@@ -5,10 +5,13 @@
 package service
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
+	"strings"
 	"text/template"
 )
 
@@ -68,6 +71,10 @@ func (s *freebsdService) Platform() string {
 	return version
 }
 
+func (s *freebsdService) Capabilities() Capability {
+	return CapEnable
+}
+
 func (s *freebsdService) template() *template.Template {
 	functions := template.FuncMap{
 		"bool": func(v bool) string {
@@ -76,6 +83,8 @@ func (s *freebsdService) template() *template.Template {
 			}
 			return "false"
 		},
+		"sh": shQuote,
+		"dq": dqEscape,
 	}
 
 	customConfig := s.Option.string(optionSysvScript, "")
@@ -92,12 +101,59 @@ func (s *freebsdService) configPath() (cp string, err error) {
 	return
 }
 
-func (s *freebsdService) Install() error {
+// freebsdRcConfDir holds the rc.conf settings of each service.
+var freebsdRcConfDir = "/etc/rc.conf.d"
+
+// rcConfPath returns the path of the rc.conf settings of the service.
+func (s *freebsdService) rcConfPath() string {
+	return filepath.Join(freebsdRcConfDir, s.Name)
+}
+
+// rcVar returns the prefix of the rc.conf variables of the service, the name
+// with characters not allowed in shell variables replaced.
+func (s *freebsdService) rcVar() string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s.Name)
+}
+
+// rcConf returns the rc.conf settings enabling the service.
+func (s *freebsdService) rcConf() []byte {
+	return []byte(s.rcVar() + "_enable=\"YES\"\n")
+}
+
+// render writes the rc script Install installs.
+func (s *freebsdService) render(w io.Writer) error {
 	path, err := s.execPath()
 	if err != nil {
 		return err
 	}
 
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Path  string
+		RcVar string
+	}{
+		conf,
+		path,
+		s.rcVar(),
+	}
+
+	return s.template().Execute(w, to)
+}
+
+func (s *freebsdService) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
 	// write start script
 	confPath, err := s.configPath()
 	if err != nil {
@@ -105,24 +161,16 @@ func (s *freebsdService) Install() error {
 	}
 	_, err = os.Stat(confPath)
 	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
 	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
-		return err
+		return permissionError(err)
 	}
 	defer f.Close()
 
-	var to = &struct {
-		*Config
-		Path string
-	}{
-		s.Config,
-		path,
-	}
-
-	err = s.template().Execute(f, to)
+	err = s.render(f)
 	if err != nil {
 		return err
 	}
@@ -131,7 +179,25 @@ func (s *freebsdService) Install() error {
 		return err
 	}
 
-	return nil
+	if err = os.MkdirAll(freebsdRcConfDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.rcConfPath(), s.rcConf(), 0644)
+}
+
+func (s *freebsdService) installTo(root string) error {
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	if err := writeRootFile(root, confPath, b.Bytes(), 0755); err != nil {
+		return err
+	}
+	return writeRootFile(root, s.rcConfPath(), s.rcConf(), 0644)
 }
 
 func (s *freebsdService) Uninstall() error {
@@ -139,6 +205,10 @@ func (s *freebsdService) Uninstall() error {
 	if err != nil {
 		return err
 	}
+	s.removePrivateTmp()
+	if err := os.Remove(s.rcConfPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return os.Remove(cp)
 }
 
@@ -174,20 +244,12 @@ func (s *freebsdService) Restart() error {
 }
 
 func (s *freebsdService) Run() error {
-	var err error
-
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *freebsdService) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *freebsdService) Logger(errs chan<- error) (Logger, error) {
@@ -210,11 +272,16 @@ var rcScript = `#!/bin/sh
 . /etc/rc.subr
 
 name="{{.Name}}"
-{{.Name}}_env="IS_DAEMON=1"
+rcvar="{{.RcVar}}_enable"
+
+load_rc_config "$name"
+: ${{"{"}}{{.RcVar}}_enable:="NO"}
+
+{{.RcVar}}_env="IS_DAEMON=1"
 pidfile="/var/run/${name}.pid"
 command="/usr/sbin/daemon"
-daemon_args="-P ${pidfile} -r -t \"${name}: daemon\"{{if .WorkingDirectory}} -c {{.WorkingDirectory}}{{end}}"
-command_args="${daemon_args} {{.Path}}{{range .Arguments}} {{.}}{{end}}"
+daemon_args="-P ${pidfile} -r -t \"${name}: daemon\"{{if .WorkingDirectory}} -c {{.WorkingDirectory|sh|dq}}{{end}}"
+command_args="${daemon_args} {{.Path|sh|dq}}{{range .Arguments}} {{.|sh|dq}}{{end}}"
 
 run_rc_command "$1"
 `
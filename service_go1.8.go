@@ -5,11 +5,49 @@ package service
 import (
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// execPath returns the absolute path of the program run by the service.
+// A relative path is resolved against the current directory, or the
+// WorkingDirectory with the PathsAtRuntime RelativePaths option. A bare
+// program name such as "python3" that does not exist there is looked up in
+// PATH, and on Windows under App Paths too. On Windows a path that does not
+// exist is completed with the extensions of PATHEXT, as the command
+// interpreter does. With the Interpreter option it is the path of the
+// interpreter, which installConfig passes the script to.
 func (c *Config) execPath() (string, error) {
-	if len(c.Executable) != 0 {
-		return filepath.Abs(c.Executable)
+	cmd, err := c.interpreter()
+	if err != nil {
+		return "", err
 	}
-	return os.Executable()
+	if cmd != nil {
+		return cmd[0], nil
+	}
+	return c.programPath()
+}
+
+// programPath returns the absolute path of the Executable, see execPath.
+func (c *Config) programPath() (string, error) {
+	if len(c.Executable) == 0 {
+		return os.Executable()
+	}
+	if policy, err := c.relativePaths(); err != nil {
+		return "", err
+	} else if policy == PathsAtRuntime && c.relativeExecutable() {
+		return completeExt(filepath.Join(c.WorkingDirectory, c.Executable)), nil
+	}
+	path, err := filepath.Abs(c.Executable)
+	if err != nil {
+		return "", err
+	}
+	path = completeExt(path)
+	if !strings.ContainsAny(c.Executable, `/\`) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if p, err := lookExecutable(c.Executable); err == nil {
+				return filepath.Abs(p)
+			}
+		}
+	}
+	return path, nil
 }
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -44,6 +45,18 @@ func init() {
 		},
 		new: newSystemdService,
 	},
+		// Never chosen by detection, as the systemd system manager is
+		// detected first; callers choose it to manage services of the user
+		// without root, see ChooseSystem.
+		linuxSystemService{
+			name:   "linux-systemd-user",
+			detect: isSystemd,
+			interactive: func() bool {
+				is, _ := isInteractive()
+				return is
+			},
+			new: newSystemdUserService,
+		},
 		linuxSystemService{
 			name:   "linux-upstart",
 			detect: isUpstart,
@@ -62,6 +75,18 @@ func init() {
 			},
 			new: newOpenRCService,
 		},
+		linuxSystemService{
+			name:        "linux-runit",
+			detect:      isRunit,
+			interactive: isRunitInteractive,
+			new:         newRunitService,
+		},
+		linuxSystemService{
+			name:        "linux-s6",
+			detect:      isS6,
+			interactive: isS6Interactive,
+			new:         newS6Service,
+		},
 		linuxSystemService{
 			name:   "unix-systemv",
 			detect: func() bool { return true },
@@ -133,11 +158,32 @@ func isInContainer(cgroupPath string) (bool, error) {
 	return false, nil
 }
 
+// shebang returns the interpreter line of a generated script, the Shebang
+// option or else interpreter.
+func shebang(kv KeyValue, interpreter string) string {
+	return "#!" + strings.TrimPrefix(kv.string(optionShebang, interpreter), "#!")
+}
+
+// execName returns the name of the executable at path, after following
+// symbolic links, which scripts name their log files after.
+func execName(path string) string {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	return filepath.Base(path)
+}
+
+// tf holds the functions available to the init system templates: cmd quotes
+// an argument and cmdEscape the executable of a systemd command line, env
+// quotes an Environment assignment, path escapes other systemd settings, sh
+// and shArgs quote shell words and dq escapes text for a double quoted shell
+// string.
 var tf = map[string]interface{}{
-	"cmd": func(s string) string {
-		return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
-	},
-	"cmdEscape": func(s string) string {
-		return strings.Replace(s, " ", `\x20`, -1)
-	},
+	"cmd":       systemdQuote,
+	"cmdEscape": systemdEscapeCommand,
+	"env":       systemdEnv,
+	"path":      systemdPath,
+	"sh":        shQuote,
+	"shArgs":    shArgs,
+	"dq":        dqEscape,
 }
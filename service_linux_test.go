@@ -5,10 +5,19 @@
 package service
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 )
 
 // createTestCgroupFiles creates mock files for tests
@@ -171,3 +180,657 @@ const (
 1:name=systemd:/init.scope
 0::/init.scope`
 )
+
+func TestSystemdScriptQuoting(t *testing.T) {
+	var b strings.Builder
+	s := &systemd{Config: &Config{}, version: 245}
+	s.versionOnce.Do(func() {})
+	err := s.template().Execute(&b, &struct {
+		*Config
+		Path                 string
+		HasOutputFileSupport bool
+		ReloadSignal         string
+		PIDFile              string
+		LimitNOFILE          int
+		Restart              string
+		RestartSec           string
+		RestartSteps         int
+		RestartMaxDelaySec   string
+		SuccessExitStatus    string
+		LogOutput            bool
+		LogDirectory         string
+		PrivateTmp           bool
+		Sockets              []string
+		WatchdogSec          string
+		Notify               bool
+		PropagateTrace       bool
+		UserService          bool
+	}{
+		Config: &Config{
+			Name:             "agent",
+			Arguments:        []string{"-config", "/etc/My App/agent.json", "-greeting", `"Grüße"`},
+			WorkingDirectory: "/opt/My App",
+			EnvVars:          map[string]string{"GREETING": `hello "world" $HOME 100%`},
+			Hooks: Hooks{
+				PreStart: []Hook{{Command: `mkdir -p "$HOME/run"`}, {Func: func(Service) error { return nil }}},
+				PostStop: []Hook{{Command: "rm -rf /run/agent"}},
+			},
+		},
+		Path:                 "/opt/My App/agent",
+		HasOutputFileSupport: true,
+		LimitNOFILE:          -1,
+		LogOutput:            true,
+		LogDirectory:         "/var/log/my $app",
+		PrivateTmp:           true,
+		Sockets:              []string{"443"},
+		WatchdogSec:          "30s",
+		Notify:               true,
+		PropagateTrace:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"ConditionFileIsExecutable=/opt/My App/agent\n",
+		`ExecStart=/opt/My\x20App/agent "-config" "/etc/My App/agent.json" "-greeting" "\"Grüße\""` + "\n",
+		"WorkingDirectory=/opt/My App\n",
+		"Environment=\"GREETING=hello \\\"world\\\" $HOME 100%%\"\n",
+		"StandardOutput=file:/var/log/my $app/agent.out\n",
+		"PrivateTmp=true\n",
+		"Requires=agent.socket\nAfter=agent.socket\n",
+		"WatchdogSec=30s\nType=notify\nNotifyAccess=main\n",
+		"EnvironmentFile=-%t/agent.traceparent\n",
+		"ExecStartPre=/bin/sh -c \"mkdir -p \\\"$$HOME/run\\\"\"\nExecStopPost=/bin/sh -c \"rm -rf /run/agent\"\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("unit does not contain %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestOpenRCScriptQuoting(t *testing.T) {
+	// Let the shell read the variables of the script, as openrc-run does,
+	// and split the arguments of supervise-daemon, which it evaluates. The
+	// script names the log files after the executable, which must exist.
+	dir, err := ioutil.TempDir("", "openrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "demo")
+	if err := ioutil.WriteFile(path, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		Name:        "demo",
+		DisplayName: `Say "hi" $USER`,
+		Description: "Costs $5 `now`",
+	}
+	var b strings.Builder
+	err = template.Must(template.New("").Funcs(tf).Parse(openRCScript)).Execute(&b, &struct {
+		*Config
+		Shebang      string
+		Path         string
+		ExecName     string
+		LogDirectory string
+		Depend       []string
+	}{c, "#!/sbin/openrc-run", path, execName(path), "/var/log/my $app", openrcDepend(c.Dependencies)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "demo.openrc")
+	if err := ioutil.WriteFile(script, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("sh", "-c", `. "$0"; printf '%s\n' "$description"; eval "set -- $supervise_daemon_args"; printf '%s\n' "$@"`, script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	want := strings.Join([]string{c.Description, "--stdout", "/var/log/my $app/demo.log", "--stderr", "/var/log/my $app/demo.err"}, "\n") + "\n"
+	if string(out) != want {
+		t.Errorf("OpenRC script variables = %q, want %q", out, want)
+	}
+}
+
+func TestInitScriptsPOSIX(t *testing.T) {
+	dir, err := ioutil.TempDir("", "posix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Config{
+		Name:       "demo",
+		Executable: "/opt/demo/bin/demo",
+		Arguments:  []string{"-config", "/etc/demo conf"},
+		Option:     KeyValue{optionShebang: "/bin/busybox sh"},
+	}
+	scripts := map[string]interface{ render(io.Writer) error }{
+		"S99demo":     &sysv{Config: c},
+		"demo.openrc": &openrc{Config: c},
+	}
+	// Constructs of bash and other shells that POSIX sh lacks.
+	bashisms := []string{"[[", "echo -n", "$(seq", "function ", "==", "$'", "source ", "local ", "readlink -f", "${!"}
+	var shells [][]string
+	for _, sh := range [][]string{{"dash"}, {"busybox", "sh"}, {"bash", "--posix"}} {
+		if _, err := exec.LookPath(sh[0]); err == nil {
+			shells = append(shells, sh)
+		}
+	}
+	for name, s := range scripts {
+		var b bytes.Buffer
+		if err := s.render(&b); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(b.String(), "#!/bin/busybox sh\n") {
+			t.Errorf("%s does not start with the Shebang option: %.40q", name, b.String())
+		}
+		for _, bashism := range bashisms {
+			if strings.Contains(b.String(), bashism) {
+				t.Errorf("%s contains %q", name, bashism)
+			}
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, b.Bytes(), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, sh := range shells {
+			if out, err := exec.Command(sh[0], append(sh[1:], "-n", path)...).CombinedOutput(); err != nil {
+				t.Errorf("%s -n %s: %v: %s", sh, name, err, out)
+			}
+		}
+	}
+
+	for _, sh := range shells {
+		out, _ := exec.Command(sh[0], append(sh[1:], filepath.Join(dir, "S99demo"), "status")...).CombinedOutput()
+		if string(out) != "Stopped\n" {
+			t.Errorf("%s: sysv script status = %q, want %q", sh, out, "Stopped\n")
+		}
+	}
+}
+
+func TestInstallLogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { logrotateDir = d }(logrotateDir)
+	logrotateDir = dir
+
+	c := &Config{Name: "logged", Option: KeyValue{optionLogRotate: true}}
+	logDir := filepath.Join(dir, "log", "logged")
+	if err := c.installLogFiles(logDir, "logged.out", "logged.err"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"logged.out", "logged.err"} {
+		if _, err := os.Stat(filepath.Join(logDir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	conf, err := ioutil.ReadFile(filepath.Join(dir, "logged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"` + filepath.Join(logDir, "logged.out") + `" `; !strings.HasPrefix(string(conf), want) {
+		t.Errorf("logrotate configuration %q does not start with %q", conf, want)
+	}
+	if err := c.removeLogrotate(); err != nil {
+		t.Error(err)
+	}
+	if err := c.removeLogrotate(); err != nil {
+		t.Errorf("removing a missing configuration: %v", err)
+	}
+}
+
+func TestParseSystemdShow(t *testing.T) {
+	out := "Id=a.service\nLoadState=loaded\nActiveState=active\n\n" +
+		"ActiveState=inactive\nId=b.service\nLoadState=loaded\n\n" +
+		"Id=c.service\nLoadState=not-found\nActiveState=inactive\n\n" +
+		"Id=d.service\nLoadState=masked\nActiveState=inactive\n"
+	units := parseSystemdShow(out)
+	tests := []struct {
+		unit   string
+		status Status
+		err    error
+	}{
+		{"a.service", StatusRunning, nil},
+		{"b.service", StatusStopped, nil},
+		{"c.service", StatusUnknown, ErrNotInstalled},
+		{"d.service", StatusMasked, nil},
+	}
+	for _, tt := range tests {
+		u := units[tt.unit]
+		r := systemdUnitStatus(u["LoadState"], u["ActiveState"])
+		if r.Status != tt.status || r.Err != tt.err {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.unit, r.Status, r.Err, tt.status, tt.err)
+		}
+	}
+}
+
+func TestSystemdRuntimeUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "units")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(etc, run string) { systemdUnitDir, systemdRuntimeDir = etc, run }(systemdUnitDir, systemdRuntimeDir)
+	systemdUnitDir, systemdRuntimeDir = filepath.Join(dir, "etc"), filepath.Join(dir, "run")
+	for _, d := range []string{systemdUnitDir, systemdRuntimeDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &systemd{Config: &Config{Name: "volatile"}}
+	if cp, _ := s.configPath(); cp != filepath.Join(systemdUnitDir, "volatile.service") {
+		t.Errorf("configPath = %q, want the persistent directory", cp)
+	}
+	if err := ioutil.WriteFile(filepath.Join(systemdRuntimeDir, "volatile.service"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cp, _ := s.configPath(); cp != filepath.Join(systemdRuntimeDir, "volatile.service") {
+		t.Errorf("configPath = %q, want the runtime directory", cp)
+	}
+	if args := s.enableArgs(); len(args) != 2 || args[0] != "--runtime" {
+		t.Errorf("enableArgs = %q", args)
+	}
+}
+
+func TestRemoveUnitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "units")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cp := filepath.Join(dir, "agent.service")
+
+	// A masked unit: the unit file set aside and the mask in its place.
+	if err := ioutil.WriteFile(cp+".masked", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.DevNull, cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeUnitFile(cp); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{cp, cp + ".masked"} {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", p, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(cp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeUnitFile(cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeUnitFile(cp); !os.IsNotExist(err) {
+		t.Errorf("removing a missing unit = %v, want not exist", err)
+	}
+}
+
+func TestSystemdPresetPath(t *testing.T) {
+	s := &systemd{Config: &Config{Name: "agent"}}
+	if path, err := s.presetPath(); err != nil || path != filepath.Join(systemdPresetDir, "50-agent.preset") {
+		t.Errorf("presetPath = %q, %v", path, err)
+	}
+	s.Option = KeyValue{optionPreset: "sometimes"}
+	if err := s.enable(); err == nil {
+		t.Error("enable accepted an unknown Preset option")
+	}
+}
+
+func TestRenderFor(t *testing.T) {
+	c := &Config{Name: "agent", Executable: "/opt/agent/bin/agent", Arguments: []string{"run"}}
+	for platform, want := range map[string]string{
+		"linux-systemd":      "ExecStart=/opt/agent/bin/agent \"run\"\n",
+		"linux-systemd-user": "WantedBy=default.target\n",
+		"linux-upstart":      "/opt/agent/bin/agent",
+		"unix-systemv":       "/opt/agent/bin/agent",
+		"linux-openrc":       "/opt/agent/bin/agent",
+		"linux-runit":        "exec /opt/agent/bin/agent run\n",
+		"linux-s6":           "exec /opt/agent/bin/agent run\n",
+	} {
+		out, err := RenderFor(platform, c)
+		if err != nil {
+			t.Errorf("%s: %v", platform, err)
+			continue
+		}
+		if !strings.Contains(string(out), want) {
+			t.Errorf("%s: output does not contain %q:\n%s", platform, want, out)
+		}
+	}
+	if _, err := RenderFor("plan9-rc", c); err == nil {
+		t.Error("RenderFor accepted an unknown platform")
+	}
+}
+
+func TestSystemdFeatures(t *testing.T) {
+	s := &systemd{Config: &Config{Name: "old", Executable: "/bin/true", Option: KeyValue{optionLogOutput: true}}, version: 229}
+	s.versionOnce.Do(func() {})
+	var b strings.Builder
+	if err := s.render(&b); err != nil {
+		t.Fatal(err)
+	}
+	unit := b.String()
+	if !strings.Contains(unit, "[Service]\nStartLimitInterval=5\n") || strings.Contains(unit, "StartLimitIntervalSec") {
+		t.Errorf("unit for systemd 229 does not limit starts in [Service]:\n%s", unit)
+	}
+	if strings.Contains(unit, "StandardOutput=file") {
+		t.Errorf("unit for systemd 229 logs to files:\n%s", unit)
+	}
+	found := false
+	for _, d := range Degradations() {
+		found = found || d.Feature == "systemd StandardOutput=file"
+	}
+	if !found {
+		t.Error("omitted StandardOutput=file not reported in Degradations")
+	}
+}
+
+func TestCheckLinger(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	dir, err := ioutil.TempDir("", "linger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d, e string) { lingerDir, elogindLingerDir = d, e }(lingerDir, elogindLingerDir)
+	lingerDir, elogindLingerDir = dir, dir
+	defer os.Setenv("SSH_CONNECTION", os.Getenv("SSH_CONNECTION"))
+	os.Setenv("SSH_CONNECTION", "192.0.2.1 50000 192.0.2.2 22")
+	defer clearDegradations()()
+
+	found := func() bool {
+		for _, d := range Degradations() {
+			if d.Err == errNoLinger {
+				return true
+			}
+		}
+		return false
+	}
+	c := &Config{}
+	if err := ioutil.WriteFile(filepath.Join(dir, u.Username), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.checkLinger()
+	if found() {
+		t.Error("degraded while lingering")
+	}
+	os.Remove(filepath.Join(dir, u.Username))
+	c.checkLinger()
+	if !found() {
+		t.Error("no degradation starting from SSH without lingering")
+	}
+}
+
+func TestElogind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elogind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p, c string) { elogindPIDFile, elogindConfFile = p, c }(elogindPIDFile, elogindConfFile)
+	elogindPIDFile = filepath.Join(dir, "elogind.pid")
+	elogindConfFile = filepath.Join(dir, "logind.conf")
+
+	if err := ioutil.WriteFile(elogindPIDFile, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m := loginManager(); m != loginElogind {
+		t.Errorf("loginManager = %q, want %q", m, loginElogind)
+	}
+	for conf, want := range map[string]bool{
+		"[Login]\n#KillUserProcesses=yes\n":                      false,
+		"[Login]\nKillUserProcesses=yes\n":                       true,
+		"[Login]\nKillUserProcesses = no\nKillExcludeUsers=root": false,
+	} {
+		if err := ioutil.WriteFile(elogindConfFile, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := killUserProcesses(); got != want {
+			t.Errorf("killUserProcesses of %q = %v, want %v", conf, got, want)
+		}
+	}
+}
+
+func TestSystemdRestart(t *testing.T) {
+	for _, tt := range []struct {
+		version int64
+		option  KeyValue
+		want    []string
+		notWant string
+	}{
+		{245, KeyValue{}, []string{"Restart=always\n", "RestartSec=120s\n"}, "RestartSteps"},
+		{245, KeyValue{optionRestart: RestartNever}, []string{"Restart=no\n"}, ""},
+		{254, KeyValue{optionRestart: RestartOnFailure, optionRestartSec: "1.5s", optionRestartMaxDelay: "5m"},
+			[]string{"Restart=on-failure\n", "RestartSec=1500ms\n", "RestartSteps=5\nRestartMaxDelaySec=300s\n"}, ""},
+		{253, KeyValue{optionRestartMaxDelay: "5m"}, []string{"RestartSec=120s\n"}, "RestartSteps"},
+	} {
+		tt.option[optionLogOutput] = false
+		s := &systemd{Config: &Config{Name: "agent", Executable: "/bin/true", Option: tt.option}, version: tt.version}
+		s.versionOnce.Do(func() {})
+		var b strings.Builder
+		if err := s.render(&b); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("unit for %v does not contain %q:\n%s", tt.option, want, b.String())
+			}
+		}
+		if tt.notWant != "" && strings.Contains(b.String(), tt.notWant) {
+			t.Errorf("unit for systemd %d contains %s:\n%s", tt.version, tt.notWant, b.String())
+		}
+	}
+	s := &systemd{Config: &Config{Option: KeyValue{optionRestartMaxDelay: "1s"}}}
+	if _, _, _, _, err := s.restart(); err == nil {
+		t.Error("RestartMaxDelay shorter than RestartSec accepted")
+	}
+}
+
+func TestInstallTo(t *testing.T) {
+	root, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	c := &Config{Name: "agent", Executable: "/usr/bin/agent", Option: KeyValue{optionListenStream: "443"}}
+	s := &systemd{Config: c}
+	if err := InstallTo(s, root); err != nil {
+		t.Fatal(err)
+	}
+	unit, err := ioutil.ReadFile(filepath.Join(root, "etc/systemd/system/agent.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(unit), "ExecStart=/usr/bin/agent\n") {
+		t.Errorf("unit does not run the executable:\n%s", unit)
+	}
+	for link, want := range map[string]string{
+		"etc/systemd/system/multi-user.target.wants/agent.service": "/etc/systemd/system/agent.service",
+		"etc/systemd/system/sockets.target.wants/agent.socket":     "/etc/systemd/system/agent.socket",
+	} {
+		if got, err := os.Readlink(filepath.Join(root, link)); err != nil || got != want {
+			t.Errorf("%s links to %q (%v), want %q", link, got, err, want)
+		}
+	}
+
+	c.Option = KeyValue{optionPreset: PresetDisable}
+	os.RemoveAll(root)
+	if err := InstallTo(&systemd{Config: c}, root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "etc/systemd/system/multi-user.target.wants/agent.service")); err == nil {
+		t.Error("service disabled by preset enabled")
+	}
+	preset, err := ioutil.ReadFile(filepath.Join(root, "etc/systemd/system-preset/50-agent.preset"))
+	if err != nil || string(preset) != "disable agent.service\n" {
+		t.Errorf("preset file %q (%v)", preset, err)
+	}
+
+	if err := InstallTo(&sysv{Config: c}, root); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Readlink(filepath.Join(root, "etc/rc3.d/S50agent")); err != nil || got != "/etc/init.d/agent" {
+		t.Errorf("rc3.d link to %q (%v)", got, err)
+	}
+}
+
+func TestSystemdStatusInfo(t *testing.T) {
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	si, err := systemdStatusInfo(map[string]string{
+		"LoadState":              "loaded",
+		"ActiveState":            "active",
+		"MainPID":                "4242",
+		"ExecMainStartTimestamp": started.Format("Mon 2006-01-02 15:04:05 MST"),
+		"ExecMainStatus":         "0",
+		"NRestarts":              "3",
+		"StatusText":             "healthy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Status != StatusRunning || si.PID != 4242 || si.Restarts != 3 || si.Health != HealthHealthy {
+		t.Errorf("StatusInfo %+v", si)
+	}
+	if !si.Started.Equal(started) || si.Uptime < time.Hour {
+		t.Errorf("started %v, uptime %v, want %v", si.Started, si.Uptime, started)
+	}
+
+	si, err = systemdStatusInfo(map[string]string{
+		"LoadState":      "loaded",
+		"ActiveState":    "inactive",
+		"MainPID":        "0",
+		"ExecMainStatus": "2",
+	})
+	if err != nil || si.Status != StatusStopped || si.ExitCode != 2 || !si.Started.IsZero() {
+		t.Errorf("stopped StatusInfo %+v, %v", si, err)
+	}
+}
+
+func TestOpenRCDepend(t *testing.T) {
+	c := &Config{
+		Name: "demo",
+		Dependencies: []string{
+			"After=network.target",
+			"need  net",
+			"after firewall",
+			"use",
+		},
+	}
+	s := &openrc{Config: c}
+	var b strings.Builder
+	if err := s.render(&b); err != nil {
+		t.Fatal(err)
+	}
+	if want := "\ndepend() {\n\tneed net\n\tafter firewall\n}\n"; !strings.HasSuffix(b.String(), want) {
+		t.Errorf("script does not end with %q:\n%s", want, b.String())
+	}
+
+	if got := openrcDepend([]string{"Requires=syslog.target"}); !reflect.DeepEqual(got, []string{"use logger net"}) {
+		t.Errorf("openrcDepend without OpenRC statements = %q", got)
+	}
+}
+
+func TestRunitScripts(t *testing.T) {
+	s := &runit{Config: &Config{
+		Name:             "agent",
+		Executable:       "/opt/My App/agent",
+		Arguments:        []string{"-greeting", "hi $USER"},
+		UserName:         "agent",
+		WorkingDirectory: "/var/lib/agent",
+		EnvVars:          map[string]string{"GREETING": "it's"},
+		Option:           KeyValue{optionRestart: RestartOnFailure, optionRestartSec: "5s"},
+	}}
+	run, finish, err := s.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range [][]byte{run, finish} {
+		if out, err := exec.Command("sh", "-n", "-c", string(script)).CombinedOutput(); err != nil {
+			t.Errorf("%v: %s\n%s", err, out, script)
+		}
+	}
+	for _, want := range []string{
+		"cd /var/lib/agent || exit 1\n",
+		"export GREETING='it'\\''s'\n",
+		"exec chpst -u agent '/opt/My App/agent' -greeting 'hi $USER'\n",
+	} {
+		if !strings.Contains(string(run), want) {
+			t.Errorf("run script does not contain %q:\n%s", want, run)
+		}
+	}
+	if want := "[ \"$1\" = 0 ] && exec sv down .\nexec sleep 5\n"; !strings.HasSuffix(string(finish), want) {
+		t.Errorf("finish script does not end with %q:\n%s", want, finish)
+	}
+}
+
+func TestS6Files(t *testing.T) {
+	s := &s6{Config: &Config{
+		Name:       "agent",
+		Executable: "/opt/agent/bin/agent",
+		UserName:   "agent",
+		Option: KeyValue{
+			optionRestart:      RestartNever,
+			optionRestartSec:   "10s",
+			optionLogOutput:    true,
+			optionLogDirectory: "/var/log",
+		},
+	}}
+	files, err := s.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"run":            "exec s6-setuidgid agent /opt/agent/bin/agent\n",
+		"finish":         "exit 125\nexec sleep 10\n",
+		"timeout-finish": "15000\n",
+		"log/run":        "exec s6-log -b n10 s1000000 T /var/log/agent\n",
+	} {
+		if !strings.HasSuffix(string(files[name]), want) {
+			t.Errorf("%s does not end with %q:\n%s", name, want, files[name])
+		}
+		if strings.HasSuffix(name, "run") || name == "finish" {
+			if out, err := exec.Command("sh", "-n", "-c", string(files[name])).CombinedOutput(); err != nil {
+				t.Errorf("%s: %v: %s", name, err, out)
+			}
+		}
+	}
+	s.ChRoot = "/srv/jail"
+	if _, err := s.files(); err != errNoChRootS6 {
+		t.Errorf("files with a ChRoot = %v, want %v", err, errNoChRootS6)
+	}
+}
+
+func TestAccountBackends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// SysV and OpenRC scripts run the service as root, so the UserName is
+	// neither resolved nor recorded.
+	c := &Config{Name: "agent", UserName: "no-such-user-here", Option: KeyValue{optionStateDirectory: dir}}
+	for _, s := range []Service{&sysv{Config: c}, &openrc{Config: c}} {
+		if err := c.beginInstall(s, nil); err != nil {
+			t.Errorf("%T: Install with a UserName it does not apply = %v", s, err)
+		}
+		if m, err := c.ReadInstallManifest(); err == nil && m.Account != nil {
+			t.Errorf("%T: manifest records account %+v", s, m.Account)
+		}
+		if err := c.checkAccount(s); err != nil {
+			t.Errorf("%T: checkAccount = %v", s, err)
+		}
+	}
+	if err := c.beginInstall(&runit{Config: c}, nil); err == nil {
+		t.Error("runit: Install accepted an account that does not exist")
+	}
+}
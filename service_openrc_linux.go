@@ -2,21 +2,28 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"os/signal"
 	"regexp"
-	"syscall"
+	"strings"
 	"text/template"
-	"time"
 )
 
+// openrcRunDir is created by OpenRC when it has started the system, also
+// where it is not the init, such as in Alpine containers.
+var openrcRunDir = "/run/openrc"
+
 func isOpenRC() bool {
 	if _, err := exec.LookPath("openrc-init"); err == nil {
 		return true
 	}
+	if fi, err := os.Stat(openrcRunDir); err == nil && fi.IsDir() {
+		return true
+	}
 	if _, err := os.Stat("/etc/inittab"); err == nil {
 		filerc, err := os.Open("/etc/inittab")
 		if err != nil {
@@ -55,6 +62,10 @@ func (s *openrc) Platform() string {
 	return s.platform
 }
 
+func (s *openrc) Capabilities() Capability {
+	return CapEnable
+}
+
 func (s *openrc) template() *template.Template {
 	customScript := s.Option.string(optionOpenRCScript, "")
 
@@ -84,19 +95,87 @@ func (s *openrc) configPath() (cp string, err error) {
 	return
 }
 
+// render writes the init script Install installs.
+func (s *openrc) render(w io.Writer) error {
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+	// The log files are named after the program, not its interpreter.
+	program, err := s.programPath()
+	if err != nil {
+		return err
+	}
+
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Shebang      string
+		Path         string
+		ExecName     string
+		LogDirectory string
+		Depend       []string
+	}{
+		conf,
+		shebang(s.Option, "/sbin/openrc-run"),
+		path,
+		execName(program),
+		s.Option.string(optionLogDirectory, defaultLogDirectory),
+		openrcDepend(conf.Dependencies),
+	}
+
+	return s.template().Execute(w, to)
+}
+
+// openrcDependKeywords are the statements of an OpenRC depend function.
+var openrcDependKeywords = map[string]bool{
+	"need":    true,
+	"use":     true,
+	"want":    true,
+	"before":  true,
+	"after":   true,
+	"provide": true,
+	"keyword": true,
+}
+
+// openrcDepend returns the dependencies that are OpenRC depend statements,
+// such as "need net", leaving out those for other systems, such as systemd
+// unit lines. Without any, the service uses the logger and network when
+// they are available.
+func openrcDepend(dependencies []string) []string {
+	var depend []string
+	for _, d := range dependencies {
+		fields := strings.Fields(d)
+		if len(fields) > 1 && openrcDependKeywords[fields[0]] {
+			depend = append(depend, strings.Join(fields, " "))
+		}
+	}
+	if len(depend) == 0 {
+		depend = []string{"use logger net"}
+	}
+	return depend
+}
+
 func (s *openrc) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
 	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
 	_, err = os.Stat(confPath)
 	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
 	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
-		return err
+		return permissionError(err)
 	}
 	defer f.Close()
 
@@ -105,22 +184,17 @@ func (s *openrc) Install() error {
 		return err
 	}
 
-	path, err := s.execPath()
+	err = s.render(f)
 	if err != nil {
 		return err
 	}
-
-	var to = &struct {
-		*Config
-		Path         string
-		LogDirectory string
-	}{
-		s.Config,
-		path,
-		s.Option.string(optionLogDirectory, defaultLogDirectory),
+	// The script names the log files after the program, see render.
+	program, err := s.programPath()
+	if err != nil {
+		return err
 	}
-
-	err = s.template().Execute(f, to)
+	name := execName(program)
+	err = s.installLogFiles(s.Option.string(optionLogDirectory, defaultLogDirectory), name+".log", name+".err")
 	if err != nil {
 		return err
 	}
@@ -128,15 +202,35 @@ func (s *openrc) Install() error {
 	return s.runAction("add")
 }
 
+func (s *openrc) installTo(root string) error {
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	if err := writeRootFile(root, confPath, b.Bytes(), 0755); err != nil {
+		return err
+	}
+	return linkRoot(root, "/etc/runlevels/default/"+s.Name, confPath)
+}
+
 func (s *openrc) Uninstall() error {
 	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	// Remove the service from its runlevels while its script still exists.
+	if err := s.runAction("del"); err != nil {
+		return err
+	}
 	if err := os.Remove(confPath); err != nil {
 		return err
 	}
-	return s.runAction("delete")
+	s.removePrivateTmp()
+	return s.removeLogrotate()
 }
 
 func (s *openrc) Logger(errs chan<- error) (Logger, error) {
@@ -150,19 +244,16 @@ func (s *openrc) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *openrc) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
+func (s *openrc) Run() error {
+	return s.RunContext(context.Background())
+}
+
+// RunContext runs the program like Run until ctx is done.
+func (s *openrc) RunContext(ctx context.Context) error {
+	if err := s.keepSession(); err != nil {
 		return err
 	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
-
-	return s.i.Stop(s)
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *openrc) Status() (Status, error) {
@@ -203,12 +294,7 @@ func (s *openrc) Stop() error {
 }
 
 func (s *openrc) Restart() error {
-	err := s.Stop()
-	if err != nil {
-		return err
-	}
-	time.Sleep(50 * time.Millisecond)
-	return s.Start()
+	return run("rc-service", s.Name, "restart")
 }
 
 func (s *openrc) runAction(action string) error {
@@ -219,21 +305,21 @@ func (s *openrc) run(action string, args ...string) error {
 	return run("rc-update", append([]string{action}, args...)...)
 }
 
-const openRCScript = `#!/sbin/openrc-run
+// openRCScript is the service script, in POSIX sh like the scripts of
+// OpenRC itself.
+const openRCScript = `{{.Shebang}}
 supervisor=supervise-daemon
-name="{{.DisplayName}}"
-description="{{.Description}}"
-command={{.Path|cmdEscape}}
+name="{{.DisplayName|dq}}"
+description="{{.Description|dq}}"
+command={{.Path|sh}}
 {{- if .Arguments }}
-command_args="{{range .Arguments}}{{.}} {{end}}"
+command_args="{{.Arguments|shArgs|dq}}"
 {{- end }}
-name=$(basename $(readlink -f $command))
-supervise_daemon_args="--stdout {{.LogDirectory}}/${name}.log --stderr {{.LogDirectory}}/${name}.err"
+name={{.ExecName|sh}}
+supervise_daemon_args="--stdout {{.LogDirectory|sh|dq}}/${name}.log --stderr {{.LogDirectory|sh|dq}}/${name}.err"
 
-{{- if .Dependencies }}
 depend() {
-{{- range $i, $dep := .Dependencies}} 
-{{"\t"}}{{$dep}}{{end}}
+{{- range .Depend}}
+{{"\t"}}{{.}}{{end}}
 }
-{{- end}}
 `
@@ -0,0 +1,367 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	optionRunitScript = "RunitScript"
+	optionSVDIR       = "SVDIR"
+)
+
+// Directories of runit: the service directories are kept in runitSvDir and
+// linked into the directory runsvdir watches, SVDIR, to be run.
+var (
+	runitRunDir    = "/run/runit"
+	runitSvDir     = "/etc/sv"
+	runitVoidSVDIR = "/var/service"
+)
+
+// isRunit reports whether runit runs the system, as init as on Void Linux or
+// as the runsvdir of a container.
+func isRunit() bool {
+	if _, err := exec.LookPath("sv"); err != nil {
+		return false
+	}
+	if fi, err := os.Stat(runitRunDir); err == nil && fi.IsDir() {
+		return true
+	}
+	init, _ := binaryName(1)
+	return init == "runit" || init == "runsvdir"
+}
+
+// isRunitInteractive reports whether the program was not started by runsv.
+func isRunitInteractive() bool {
+	parent, _ := binaryName(os.Getppid())
+	return parent != "runsv"
+}
+
+type runit struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newRunitService(i Interface, platform string, c *Config) (Service, error) {
+	s := &runit{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+	return s, nil
+}
+
+func (s *runit) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *runit) Platform() string {
+	return s.platform
+}
+
+// appliesUserName reports that the service runs as the UserName, with chpst -u.
+func (s *runit) appliesUserName() bool {
+	return true
+}
+
+func (s *runit) Capabilities() Capability {
+	return CapEnable
+}
+
+var errNoUserServiceRunit = errors.New("user services are not supported on runit")
+
+// serviceDir returns the service directory holding the run and finish
+// scripts.
+func (s *runit) serviceDir() (string, error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		return "", errNoUserServiceRunit
+	}
+	return filepath.Join(runitSvDir, s.Name), nil
+}
+
+// link returns the link to the service directory in SVDIR, the SVDIR option
+// or environment variable, /var/service where it exists as on Void Linux
+// and /etc/service otherwise. sv is given the link rather than the name, so
+// it does not depend on SVDIR.
+func (s *runit) link() string {
+	dir := os.Getenv("SVDIR")
+	if dir == "" {
+		dir = "/etc/service"
+		if _, err := os.Stat(runitVoidSVDIR); err == nil {
+			dir = runitVoidSVDIR
+		}
+	}
+	return filepath.Join(s.Option.string(optionSVDIR, dir), s.Name)
+}
+
+func (s *runit) configPath() (string, error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "run"), nil
+}
+
+func (s *runit) template() *template.Template {
+	customScript := s.Option.string(optionRunitScript, "")
+
+	if customScript != "" {
+		return template.Must(template.New("").Funcs(tf).Parse(customScript))
+	}
+	return template.Must(template.New("").Funcs(tf).Parse(runitRunScript))
+}
+
+// render writes the run script Install installs.
+func (s *runit) render(w io.Writer) error {
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Path         string
+		LogOutput    bool
+		LogDirectory string
+	}{
+		conf,
+		path,
+		s.Option.bool(optionLogOutput, optionLogOutputDefault),
+		s.Option.string(optionLogDirectory, defaultLogDirectory),
+	}
+
+	return s.template().Execute(w, to)
+}
+
+// renderFinish writes the finish script, which runsv runs after the program
+// exited, applying the Restart and RestartSec options. runsv restarts the
+// program after finish unless the service is made down.
+func (s *runit) renderFinish(w io.Writer) error {
+	delay, _, err := s.restartDelays()
+	if err != nil {
+		return err
+	}
+	var to = &struct {
+		Restart    string
+		RestartSec int
+	}{
+		s.Option.string(optionRestart, RestartAlways),
+		int(delay / time.Second),
+	}
+	return template.Must(template.New("").Parse(runitFinishScript)).Execute(w, to)
+}
+
+// files returns the scripts of the service directory.
+func (s *runit) files() (run, finish []byte, err error) {
+	var r, f bytes.Buffer
+	if err := s.render(&r); err != nil {
+		return nil, nil, err
+	}
+	if err := s.renderFinish(&f); err != nil {
+		return nil, nil, err
+	}
+	return r.Bytes(), f.Bytes(), nil
+}
+
+// Install creates the service directory and links it into SVDIR, upon which
+// runsvdir starts the service within five seconds.
+func (s *runit) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(dir); err == nil {
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, dir))
+	}
+	run, finish, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return permissionError(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "run"), run, 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "finish"), finish, 0755); err != nil {
+		return err
+	}
+	if err = s.labelFile(dir); err != nil {
+		return err
+	}
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		err = s.installLogFiles(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name+".out", s.Name+".err")
+		if err != nil {
+			return err
+		}
+	}
+	return os.Symlink(dir, s.link())
+}
+
+func (s *runit) installTo(root string) error {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	run, finish, err := s.files()
+	if err != nil {
+		return err
+	}
+	if err := writeRootFile(root, filepath.Join(dir, "run"), run, 0755); err != nil {
+		return err
+	}
+	if err := writeRootFile(root, filepath.Join(dir, "finish"), finish, 0755); err != nil {
+		return err
+	}
+	return linkRoot(root, s.link(), dir)
+}
+
+// Uninstall stops the service and removes it from SVDIR, upon which runsv
+// exits, before removing the service directory.
+func (s *runit) Uninstall() error {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	s.sv("down")
+	if err := os.Remove(s.link()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	s.removePrivateTmp()
+	return s.removeLogrotate()
+}
+
+func (s *runit) Logger(errs chan<- error) (Logger, error) {
+	if system.Interactive() {
+		return ConsoleLogger, nil
+	}
+	return s.SystemLogger(errs)
+}
+
+func (s *runit) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *runit) Run() error {
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
+
+// RunContext runs the program like Run until ctx is done.
+func (s *runit) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
+}
+
+func (s *runit) Status() (Status, error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return StatusUnknown, ErrNotInstalled
+	}
+	// sv prints the state of the service, such as
+	// "run: /etc/service/agent: (pid 123) 42s" or
+	// "down: /etc/service/agent: 3s, normally up".
+	_, out, err := runWithOutput("sv", "status", s.link())
+	switch {
+	case strings.HasPrefix(out, "run:"):
+		return StatusRunning, nil
+	case strings.HasPrefix(out, "down:"), strings.HasPrefix(out, "finish:"):
+		return StatusStopped, nil
+	case err != nil:
+		return StatusUnknown, err
+	}
+	return StatusUnknown, errors.New(strings.TrimSpace(out))
+}
+
+// Start starts the service, only once if the Restart option is never. runsv
+// has to have picked up the service directory, which runsvdir does within
+// five seconds of Install.
+func (s *runit) Start() error {
+	if err := s.waitSupervise(); err != nil {
+		return err
+	}
+	if s.Option.string(optionRestart, RestartAlways) == RestartNever {
+		return s.sv("once")
+	}
+	return s.sv("up")
+}
+
+func (s *runit) Stop() error {
+	return s.sv("down")
+}
+
+func (s *runit) Restart() error {
+	return s.sv("restart")
+}
+
+// waitSupervise waits for runsv to supervise the service.
+func (s *runit) waitSupervise() error {
+	ok := filepath.Join(s.link(), "supervise", "ok")
+	for i := 0; ; i++ {
+		_, err := os.Stat(ok)
+		if err == nil || i == 60 {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (s *runit) sv(command string) error {
+	return run("sv", command, s.link())
+}
+
+const runitRunScript = `#!/bin/sh
+exec 2>&1
+{{- if .LogOutput}}
+exec >>{{.LogDirectory|sh}}/{{.Name}}.out 2>>{{.LogDirectory|sh}}/{{.Name}}.err
+{{- end}}
+{{- if .WorkingDirectory}}
+cd {{.WorkingDirectory|sh}} || exit 1
+{{- end}}
+{{- range $k, $v := .EnvVars}}
+export {{$k}}={{$v|sh}}
+{{- end}}
+exec {{if or .UserName .ChRoot}}chpst{{if .UserName}} -u {{.UserName|sh}}{{end}}{{if .ChRoot}} -/ {{.ChRoot|sh}}{{end}} {{end}}{{.Path|sh}}{{if .Arguments}} {{.Arguments|shArgs}}{{end}}
+`
+
+const runitFinishScript = `#!/bin/sh
+# $1 is the exit code of run, -1 if it did not exit normally.
+{{- if eq .Restart "never"}}
+exec sv down .
+{{- else if eq .Restart "on-failure"}}
+[ "$1" = 0 ] && exec sv down .
+{{- end}}
+{{- if .RestartSec}}
+exec sleep {{.RestartSec}}
+{{- end}}
+`
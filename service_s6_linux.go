@@ -0,0 +1,435 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	optionS6Script  = "S6Script"
+	optionS6ScanDir = "S6ScanDir"
+)
+
+// Directories of s6: the service directories are kept in s6SvDir and linked
+// into the scan directory of s6-svscan, the first of s6ScanDirs it runs in
+// unless the S6ScanDir option is set.
+var (
+	s6SvDir    = "/etc/s6/sv"
+	s6ScanDirs = []string{"/run/service", "/service"}
+)
+
+// s6ScanDir returns the scan directory of the running s6-svscan, which
+// keeps its control directory .s6-svscan in it.
+func s6ScanDir() string {
+	for _, dir := range s6ScanDirs {
+		if fi, err := os.Stat(filepath.Join(dir, ".s6-svscan")); err == nil && fi.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// isS6 reports whether s6-svscan supervises services on the system, as in
+// s6-overlay containers or with s6-linux-init.
+func isS6() bool {
+	if _, err := exec.LookPath("s6-svc"); err != nil {
+		return false
+	}
+	return s6ScanDir() != ""
+}
+
+// isS6Interactive reports whether the program was not started by
+// s6-supervise.
+func isS6Interactive() bool {
+	parent, _ := binaryName(os.Getppid())
+	return parent != "s6-supervise"
+}
+
+type s6 struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newS6Service(i Interface, platform string, c *Config) (Service, error) {
+	s := &s6{
+		i:        i,
+		platform: platform,
+		Config:   c,
+	}
+	return s, nil
+}
+
+func (s *s6) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *s6) Platform() string {
+	return s.platform
+}
+
+// appliesUserName reports that the service runs as the UserName, with s6-setuidgid.
+func (s *s6) appliesUserName() bool {
+	return true
+}
+
+func (s *s6) Capabilities() Capability {
+	return 0
+}
+
+var (
+	errNoUserServiceS6 = errors.New("user services are not supported on s6")
+	errNoChRootS6      = errors.New("ChRoot is not supported on s6")
+	errNoScanDirS6     = errors.New("s6-svscan is not running, set the S6ScanDir option")
+)
+
+// serviceDir returns the service directory holding the run and finish
+// scripts.
+func (s *s6) serviceDir() (string, error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		return "", errNoUserServiceS6
+	}
+	return filepath.Join(s6SvDir, s.Name), nil
+}
+
+// scanDir returns the scan directory the service is linked into.
+func (s *s6) scanDir() (string, error) {
+	dir := s.Option.string(optionS6ScanDir, s6ScanDir())
+	if dir == "" {
+		return "", errNoScanDirS6
+	}
+	return dir, nil
+}
+
+// link returns the link to the service directory in the scan directory,
+// which the s6 tools are given.
+func (s *s6) link() (string, error) {
+	dir, err := s.scanDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.Name), nil
+}
+
+func (s *s6) configPath() (string, error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "run"), nil
+}
+
+func (s *s6) template() *template.Template {
+	customScript := s.Option.string(optionS6Script, "")
+
+	if customScript != "" {
+		return template.Must(template.New("").Funcs(tf).Parse(customScript))
+	}
+	return template.Must(template.New("").Funcs(tf).Parse(s6RunScript))
+}
+
+// render writes the run script Install installs.
+func (s *s6) render(w io.Writer) error {
+	if s.ChRoot != "" {
+		return errNoChRootS6
+	}
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Path string
+	}{
+		conf,
+		path,
+	}
+
+	return s.template().Execute(w, to)
+}
+
+// files returns the files of the service directory by their relative path:
+// the run and finish scripts, the time allowed to finish, which covers the
+// restart delay finish sleeps, and the logger writing to the LogDirectory
+// with the LogOutput option.
+func (s *s6) files() (map[string][]byte, error) {
+	var run bytes.Buffer
+	if err := s.render(&run); err != nil {
+		return nil, err
+	}
+	delay, _, err := s.restartDelays()
+	if err != nil {
+		return nil, err
+	}
+	var finish bytes.Buffer
+	err = template.Must(template.New("").Parse(s6FinishScript)).Execute(&finish, &struct {
+		Restart    string
+		RestartSec int
+	}{
+		s.Option.string(optionRestart, RestartAlways),
+		int(delay / time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{
+		"run":            run.Bytes(),
+		"finish":         finish.Bytes(),
+		"timeout-finish": []byte(strconv.FormatInt(int64((delay+5*time.Second)/time.Millisecond), 10) + "\n"),
+	}
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		var log bytes.Buffer
+		err = template.Must(template.New("").Funcs(tf).Parse(s6LogScript)).Execute(&log, &struct {
+			LogDirectory string
+		}{
+			filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		files["log/run"] = log.Bytes()
+	}
+	return files, nil
+}
+
+// s6FileMode returns the mode of the file name of the service directory.
+func s6FileMode(name string) os.FileMode {
+	if strings.HasSuffix(name, "run") || name == "finish" {
+		return 0755
+	}
+	return 0644
+}
+
+// Install creates the service directory, links it into the scan directory
+// and has s6-svscan pick it up, upon which the service starts.
+func (s *s6) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(dir); err == nil {
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, dir))
+	}
+	link, err := s.link()
+	if err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return permissionError(err)
+		}
+		if err = ioutil.WriteFile(p, data, s6FileMode(name)); err != nil {
+			return err
+		}
+	}
+	if err = s.labelFile(dir); err != nil {
+		return err
+	}
+	if _, ok := files["log/run"]; ok {
+		logDir := filepath.Join(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name)
+		if err = os.MkdirAll(logDir, 0755); err != nil {
+			return err
+		}
+	}
+	if err = os.Symlink(dir, link); err != nil {
+		return err
+	}
+	return run("s6-svscanctl", "-a", filepath.Dir(link))
+}
+
+func (s *s6) installTo(root string) error {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	link, err := s.link()
+	if err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := writeRootFile(root, filepath.Join(dir, name), data, s6FileMode(name)); err != nil {
+			return err
+		}
+	}
+	return linkRoot(root, link, dir)
+}
+
+// Uninstall stops the service, removes it from the scan directory and has
+// s6-svscan end its supervisor before removing the service directory.
+func (s *s6) Uninstall() error {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	link, err := s.link()
+	if err != nil {
+		return err
+	}
+	s.svc("-d")
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := run("s6-svscanctl", "-an", filepath.Dir(link)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	s.removePrivateTmp()
+	return nil
+}
+
+func (s *s6) Logger(errs chan<- error) (Logger, error) {
+	if system.Interactive() {
+		return ConsoleLogger, nil
+	}
+	return s.SystemLogger(errs)
+}
+
+func (s *s6) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *s6) Run() error {
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
+
+// RunContext runs the program like Run until ctx is done.
+func (s *s6) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
+}
+
+func (s *s6) Status() (Status, error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return StatusUnknown, ErrNotInstalled
+	}
+	link, err := s.link()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	// s6-svstat prints the state of the service, such as
+	// "up (pid 123) 42 seconds" or "down (exitcode 0) 3 seconds, normally up".
+	_, out, err := runWithOutput("s6-svstat", link)
+	switch {
+	case strings.HasPrefix(out, "up "):
+		return StatusRunning, nil
+	case strings.HasPrefix(out, "down "):
+		return StatusStopped, nil
+	case err != nil:
+		return StatusUnknown, err
+	}
+	return StatusUnknown, errors.New(strings.TrimSpace(out))
+}
+
+// Start starts the service, only once if the Restart option is never.
+func (s *s6) Start() error {
+	if err := s.waitSupervise(); err != nil {
+		return err
+	}
+	if s.Option.string(optionRestart, RestartAlways) == RestartNever {
+		return s.svc("-o")
+	}
+	return s.svc("-u")
+}
+
+func (s *s6) Stop() error {
+	return s.svc("-d")
+}
+
+// Restart signals the service to restart, and starts it if it was down.
+func (s *s6) Restart() error {
+	return s.svc("-r", "-u")
+}
+
+// waitSupervise waits for s6-supervise to supervise the service, which it
+// does shortly after Install.
+func (s *s6) waitSupervise() error {
+	link, err := s.link()
+	if err != nil {
+		return err
+	}
+	control := filepath.Join(link, "supervise", "control")
+	for i := 0; ; i++ {
+		_, err := os.Stat(control)
+		if err == nil || i == 60 {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (s *s6) svc(commands ...string) error {
+	link, err := s.link()
+	if err != nil {
+		return err
+	}
+	return run("s6-svc", append(commands, link)...)
+}
+
+const s6RunScript = `#!/bin/sh
+exec 2>&1
+{{- if .WorkingDirectory}}
+cd {{.WorkingDirectory|sh}} || exit 1
+{{- end}}
+{{- range $k, $v := .EnvVars}}
+export {{$k}}={{$v|sh}}
+{{- end}}
+exec {{if .UserName}}s6-setuidgid {{.UserName|sh}} {{end}}{{.Path|sh}}{{if .Arguments}} {{.Arguments|shArgs}}{{end}}
+`
+
+// s6FinishScript exits 125 to keep s6-supervise from restarting the program.
+const s6FinishScript = `#!/bin/sh
+# $1 is the exit code of run, 256 if it was killed by the signal $2.
+{{- if eq .Restart "never"}}
+exit 125
+{{- else if eq .Restart "on-failure"}}
+[ "$1" = 0 ] && exit 125
+{{- end}}
+{{- if .RestartSec}}
+exec sleep {{.RestartSec}}
+{{- end}}
+`
+
+const s6LogScript = `#!/bin/sh
+exec s6-log -b n10 s1000000 T {{.LogDirectory|sh}}
+`
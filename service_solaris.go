@@ -6,20 +6,30 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
-	"fmt"
+	"io"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"regexp"
-	"syscall"
+	"strings"
 	"text/template"
-	"time"
 )
 
 const maxPathSize = 32 * 1024
 
 const version = "solaris-smf"
 
+const (
+	optionSMFManifest    = "SMFManifest"
+	optionSMFManifestDir = "SMFManifestDir"
+)
+
+// smfManifestDir is the default directory of the manifests. The manifests
+// are imported with svccfg, so they need not be in a directory the
+// manifest-import service reads.
+const smfManifestDir = "/lib/svc/manifest"
+
 type solarisSystem struct{}
 
 func (solarisSystem) String() string {
@@ -79,6 +89,15 @@ func (s *solarisService) Platform() string {
 	return version
 }
 
+// appliesUserName reports that the service runs as the UserName, with method_credential.
+func (s *solarisService) appliesUserName() bool {
+	return true
+}
+
+func (s *solarisService) Capabilities() Capability {
+	return CapEnable
+}
+
 func (s *solarisService) template() *template.Template {
 	functions := template.FuncMap{
 		"bool": func(v bool) string {
@@ -87,9 +106,16 @@ func (s *solarisService) template() *template.Template {
 			}
 			return "false"
 		},
+		"sh":     shQuote,
+		"regexp": regexp.QuoteMeta,
+		// smf escapes the method tokens of SMF, such as %r, in a method.
+		"smf": func(v string) string {
+			return strings.Replace(v, "%", "%%", -1)
+		},
 	}
 
-	customConfig := s.Option.string(optionSysvScript, "")
+	// SysvScript was used for the manifest before SMFManifest.
+	customConfig := s.Option.string(optionSMFManifest, s.Option.string(optionSysvScript, ""))
 
 	if customConfig != "" {
 		return template.Must(template.New("").Funcs(functions).Parse(customConfig))
@@ -99,34 +125,32 @@ func (s *solarisService) template() *template.Template {
 }
 
 func (s *solarisService) configPath() (string, error) {
-	return "/lib/svc/manifest/" + s.Prefix + "/" + s.Config.Name + ".xml", nil
+	dir := s.Option.string(optionSMFManifestDir, smfManifestDir)
+	return filepath.Join(dir, s.Prefix, s.Config.Name+".xml"), nil
+}
+
+// serviceFMRI returns the FMRI of the service, which svccfg deletes with
+// its instances.
+func (s *solarisService) serviceFMRI() string {
+	return "svc:/" + s.Prefix + "/" + s.Config.Name
 }
 
 func (s *solarisService) getFMRI() string {
-	return "svc:/" + s.Prefix + "/" + s.Config.Name + ":default"
+	return s.serviceFMRI() + ":default"
 }
 
-func (s *solarisService) Install() error {
-	// write start script
-	confPath, err := s.configPath()
+// render writes the manifest Install installs.
+func (s *solarisService) render(w io.Writer) error {
+	path, err := s.execPath()
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Manifest already exists: %s", confPath)
-	}
 
-	f, err := os.Create(confPath)
+	conf, err := s.installConfig()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	path, err := s.execPath()
-	if err != nil {
-		return err
-	}
 	Display := ""
 	escaped := &bytes.Buffer{}
 	if err := xml.EscapeText(escaped, []byte(s.DisplayName)); err == nil {
@@ -137,98 +161,127 @@ func (s *solarisService) Install() error {
 		Prefix  string
 		Display string
 		Path    string
+		Restart string
 	}{
-		s.Config,
+		conf,
 		s.Prefix,
 		Display,
 		path,
+		s.Option.string(optionRestart, RestartAlways),
 	}
 
-	err = s.template().Execute(f, to)
+	return s.template().Execute(w, to)
+}
+
+func (s *solarisService) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
+	// write start script
+	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	_, err = os.Stat(confPath)
+	if err == nil {
+		return newError(ErrAlreadyInstalled, Message(MsgManifestExists, confPath))
+	}
+	if err = os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return err
+	}
 
-	// import service
-	err = run("svcadm", "restart", "manifest-import")
+	f, err := os.Create(confPath)
+	if err != nil {
+		return permissionError(err)
+	}
+	defer f.Close()
+
+	err = s.render(f)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// validate and import the manifest into the repository
+	if err = run("/usr/sbin/svccfg", "validate", confPath); err != nil {
+		return err
+	}
+	return run("/usr/sbin/svccfg", "import", confPath)
 }
 
 func (s *solarisService) Uninstall() error {
-	s.Stop()
+	run("/usr/sbin/svcadm", "disable", "-s", s.getFMRI())
 
 	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
-	err = os.Remove(confPath)
-	if err != nil {
+	// remove the service and its instances from the repository
+	if err = run("/usr/sbin/svccfg", "delete", "-f", s.serviceFMRI()); err != nil {
 		return err
 	}
-
-	// unregister service
-	err = run("svcadm", "restart", "manifest-import")
-	if err != nil {
+	err = os.Remove(confPath)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-
+	s.removePrivateTmp()
 	return nil
 }
 
+// Status maps the state of the instance: online and degraded instances are
+// running, while disabled, offline, maintenance and uninitialized ones are
+// stopped.
 func (s *solarisService) Status() (Status, error) {
-	fmri := s.getFMRI()
-	exitCode, out, err := runWithOutput("svcs", fmri)
+	exitCode, out, err := runWithOutput("/usr/bin/svcs", "-H", "-o", "state", s.getFMRI())
 	if exitCode != 0 {
 		return StatusUnknown, ErrNotInstalled
 	}
-
-	re := regexp.MustCompile(`(degraded|disabled|legacy_run|maintenance|offline|online)\s+\w+` + fmri)
-	matches := re.FindStringSubmatch(out)
-	if len(matches) == 2 {
-		status := string(matches[1])
-		if status == "online" {
-			return StatusRunning, nil
-		} else {
-			return StatusStopped, nil
-		}
+	switch strings.TrimSpace(out) {
+	case "online", "degraded":
+		return StatusRunning, nil
+	case "disabled", "offline", "maintenance", "uninitialized", "legacy_run":
+		return StatusStopped, nil
 	}
 	return StatusUnknown, err
 }
 
+// Start enables the instance and waits for it to come online, which fails
+// if it enters maintenance.
 func (s *solarisService) Start() error {
-	return run("/usr/sbin/svcadm", "enable", s.getFMRI())
+	return run("/usr/sbin/svcadm", "enable", "-s", s.getFMRI())
 }
 func (s *solarisService) Stop() error {
-	return run("/usr/sbin/svcadm", "disable", s.getFMRI())
+	return run("/usr/sbin/svcadm", "disable", "-s", s.getFMRI())
 }
+
+// Restart restarts the instance, and clears it first if it is in
+// maintenance after failing too often.
 func (s *solarisService) Restart() error {
-	err := s.Stop()
-	if err != nil {
-		return err
+	_, out, err := runWithOutput("/usr/bin/svcs", "-H", "-o", "state", s.getFMRI())
+	if err == nil && strings.TrimSpace(out) == "maintenance" {
+		return run("/usr/sbin/svcadm", "clear", s.getFMRI())
 	}
-	time.Sleep(50 * time.Millisecond)
-	return s.Start()
+	return run("/usr/sbin/svcadm", "restart", s.getFMRI())
 }
 
-func (s *solarisService) Run() error {
-	var err error
-
-	err = s.i.Start(s)
+// reloadConfig imports the changed manifest and refreshes the instance.
+func (s *solarisService) reloadConfig() error {
+	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	if err := run("/usr/sbin/svccfg", "import", confPath); err != nil {
+		return err
+	}
+	return run("/usr/sbin/svcadm", "refresh", s.getFMRI())
+}
 
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *solarisService) Run() error {
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *solarisService) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *solarisService) Logger(errs chan<- error) (Logger, error) {
@@ -275,23 +328,42 @@ var manifest = `<?xml version="1.0"?>
 		value='svc:/system/filesystem/local:default'/>
 	</dependency>
 
+	<method_context{{if .WorkingDirectory}} working_directory='{{.WorkingDirectory|html}}'{{end}}>
+	{{- if .UserName}}
+		<method_credential user='{{.UserName|html}}' />
+	{{- end}}
+	{{- if .EnvVars}}
+		<method_environment>
+		{{- range $k, $v := .EnvVars}}
+			<envvar name='{{$k|html}}' value='{{$v|html}}' />
+		{{- end}}
+		</method_environment>
+	{{- end}}
+	</method_context>
+
+	<!--
+	  The program runs as the child of svc.startd, which restarts it when
+	  it exits, unless the Restart option is never.
+	-->
 	<exec_method
 		type='method'
 		name='start'
-		exec='bash -c {{.Path}} &amp;'
+		exec='{{.Path|sh|smf|html}}{{range .Arguments}} {{.|sh|smf|html}}{{end}}{{if eq .Restart "never"}} &amp;{{end}}'
 		timeout_seconds='10' />
 
 	<exec_method
 		type='method'
 		name='stop'
-		exec='pkill -TERM -f {{.Path}}'
+		{{- if eq .Restart "never"}}
+		exec='pkill -TERM -f {{.Path|regexp|sh|smf|html}}'
+		{{- else}}
+		exec=':kill'
+		{{- end}}
 		timeout_seconds='60' />
 
-	<!--
 	<property_group name='startd' type='framework'>
-                <propval name='duration' type='astring' value='transient' />
-        </property_group>
-	-->
+		<propval name='duration' type='astring' value='{{if eq .Restart "never"}}transient{{else}}child{{end}}' />
+	</property_group>
 	
 	<stability value='Unstable' />
 
@@ -6,16 +6,22 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"text/template"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func isSystemd() bool {
@@ -44,6 +50,21 @@ type systemd struct {
 	i        Interface
 	platform string
 	*Config
+
+	versionOnce sync.Once
+	version     int64
+}
+
+// newSystemdUserService returns the systemd service of c as a service of
+// the user manager of the current user, as with the UserService option.
+func newSystemdUserService(i Interface, platform string, c *Config) (Service, error) {
+	uc := *c
+	uc.Option = make(KeyValue, len(c.Option)+1)
+	for k, v := range c.Option {
+		uc.Option[k] = v
+	}
+	uc.Option[optionUserService] = true
+	return newSystemdService(i, platform, &uc)
 }
 
 func newSystemdService(i Interface, platform string, c *Config) (Service, error) {
@@ -67,9 +88,39 @@ func (s *systemd) Platform() string {
 	return s.platform
 }
 
+// appliesUserName reports that the service runs as the UserName, with User=.
+func (s *systemd) appliesUserName() bool {
+	return true
+}
+
+// runsHookCommands reports that systemd runs the commands of the Hooks, see
+// systemdScript.
+func (s *systemd) runsHookCommands() bool {
+	return true
+}
+
+func (s *systemd) Capabilities() Capability {
+	return CapSocketActivation | CapUserMode | CapEnable | CapMask | CapStopFor | CapSignal
+}
+
+// Directories of system units. The runtime directory is used when the
+// persistent one is on a read-only file system, as on image based (ostree)
+// distributions, and is cleared at boot. The package cannot install a hook
+// installing the unit again at boot: systemd only reads units and
+// generators persistently from /etc and /usr, which are read-only then. The
+// image has to ship such a hook, a unit running Install early at boot.
+var (
+	systemdUnitDir    = "/etc/systemd/system"
+	systemdRuntimeDir = "/run/systemd/system"
+	systemdPresetDir  = "/etc/systemd/system-preset"
+)
+
 func (s *systemd) configPath() (cp string, err error) {
 	if !s.isUserService() {
-		cp = "/etc/systemd/system/" + s.unitName()
+		cp = filepath.Join(systemdUnitDir, s.unitName())
+		if s.runtimeUnit() {
+			cp = filepath.Join(systemdRuntimeDir, s.unitName())
+		}
 		return
 	}
 	homeDir, err := os.UserHomeDir()
@@ -85,10 +136,147 @@ func (s *systemd) configPath() (cp string, err error) {
 	return
 }
 
+// runtimeUnit reports whether the unit of a system service is kept in the
+// runtime directory, because it was installed there or the persistent
+// directory is read-only. The fallback is recorded as a Degradation.
+func (s *systemd) runtimeUnit() bool {
+	if s.isUserService() {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(systemdUnitDir, s.unitName())); err == nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(systemdRuntimeDir, s.unitName())); err == nil {
+		return true
+	}
+	if err := unix.Access(systemdUnitDir, unix.W_OK); err == unix.EROFS {
+		degrade("systemd-unit-dir", systemdRuntimeDir+" until reboot", err)
+		return true
+	}
+	return false
+}
+
+// enableArgs returns the arguments to enable or disable the unit, --runtime
+// for units in the runtime directory.
+func (s *systemd) enableArgs() []string {
+	if s.runtimeUnit() {
+		return []string{"--runtime", s.unitName()}
+	}
+	return []string{s.unitName()}
+}
+
+// presetPath returns the path of the preset file shipped for the service.
+func (s *systemd) presetPath() (string, error) {
+	dir := systemdPresetDir
+	if s.isUserService() {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(homeDir, ".config/systemd/user-preset")
+	}
+	return filepath.Join(dir, "50-"+s.Name+".preset"), nil
+}
+
+// enable enables the installed unit according to the Preset option.
+func (s *systemd) enable() error {
+	switch preset := s.Option.string(optionPreset, ""); preset {
+	case "":
+		return s.run("enable", s.enableArgs()...)
+	case PresetEnable, PresetDisable:
+		path, err := s.presetPath()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(path, []byte(preset+" "+s.unitName()+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case PresetPolicy:
+		return s.run("preset", s.enableArgs()...)
+	default:
+		return fmt.Errorf("unknown %s option %q", optionPreset, preset)
+	}
+}
+
+// removePreset removes the preset file shipped for the service, if any.
+func (s *systemd) removePreset() error {
+	path, err := s.presetPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *systemd) unitName() string {
 	return s.Config.Name + ".service"
 }
 
+func (s *systemd) socketName() string {
+	return s.Config.Name + ".socket"
+}
+
+// sockets returns the addresses of the ListenStream option.
+func (s *systemd) sockets() []string {
+	return strings.Fields(s.Option.string(optionListenStream, ""))
+}
+
+// socketArgs returns the arguments to enable or disable the socket unit.
+func (s *systemd) socketArgs() []string {
+	args := s.enableArgs()
+	args[len(args)-1] = s.socketName()
+	return args
+}
+
+// renderSocket writes the socket unit passing the ListenStream sockets to
+// the service.
+func (s *systemd) renderSocket(w io.Writer) error {
+	return template.Must(template.New("").Funcs(tf).Parse(systemdSocketScript)).Execute(w, &struct {
+		*Config
+		Sockets []string
+	}{
+		s.Config,
+		s.sockets(),
+	})
+}
+
+// installSocket writes and enables the socket unit next to the unit at
+// confPath.
+func (s *systemd) installSocket(confPath string) error {
+	var b bytes.Buffer
+	if err := s.renderSocket(&b); err != nil {
+		return err
+	}
+	path := filepath.Join(filepath.Dir(confPath), s.socketName())
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := s.labelFile(path); err != nil {
+		return err
+	}
+	return s.run("enable", s.socketArgs()...)
+}
+
+// removeSocket disables and removes the socket unit next to the unit at
+// confPath, if any.
+func (s *systemd) removeSocket(confPath string) error {
+	path := filepath.Join(filepath.Dir(confPath), s.socketName())
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	if err := s.run("disable", s.socketArgs()...); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
 func (s *systemd) getSystemdVersion() int64 {
 	_, out, err := s.runWithOutput("systemctl", "--version")
 	if err != nil {
@@ -109,54 +297,104 @@ func (s *systemd) getSystemdVersion() int64 {
 	return v
 }
 
-func (s *systemd) hasOutputFileSupport() bool {
-	defaultValue := true
-	version := s.getSystemdVersion()
-	if version == -1 {
-		return defaultValue
-	}
+// systemdFeatures are the directives of units newer than the oldest systemd
+// supported, by the version that introduced them.
+var systemdFeatures = map[string]int64{
+	"StartLimitIntervalSec": 230,
+	"StandardOutput=file":   236,
+	"RestartSteps":          254,
+}
 
-	if version < 236 {
-		return false
+// supports reports whether the installed systemd supports the unit feature,
+// one of systemdFeatures. An unknown version is taken to support all. Units
+// left without a feature report it in Degradations.
+func (s *systemd) supports(feature string) bool {
+	s.versionOnce.Do(func() { s.version = s.getSystemdVersion() })
+	if s.version == -1 || s.version >= systemdFeatures[feature] {
+		return true
 	}
+	degrade("systemd "+feature, "omitted", fmt.Errorf("systemd %d, %s requires %d", s.version, feature, systemdFeatures[feature]))
+	return false
+}
 
-	return defaultValue
+func (s *systemd) hasOutputFileSupport() bool {
+	return s.supports("StandardOutput=file")
 }
 
 func (s *systemd) template() *template.Template {
 	customScript := s.Option.string(optionSystemdScript, "")
 
+	functions := template.FuncMap{"supports": s.supports}
 	if customScript != "" {
-		return template.Must(template.New("").Funcs(tf).Parse(customScript))
+		return template.Must(template.New("").Funcs(tf).Funcs(functions).Parse(customScript))
 	}
-	return template.Must(template.New("").Funcs(tf).Parse(systemdScript))
+	return template.Must(template.New("").Funcs(tf).Funcs(functions).Parse(systemdScript))
 }
 
 func (s *systemd) isUserService() bool {
 	return s.Option.bool(optionUserService, optionUserServiceDefault)
 }
 
-func (s *systemd) Install() error {
-	confPath, err := s.configPath()
+// watchdogSec returns the WatchdogSec option in the syntax of systemd.
+func (s *systemd) watchdogSec() (string, error) {
+	v := s.Option.string(optionWatchdogSec, "")
+	if v == "" {
+		return "", nil
+	}
+	d, err := time.ParseDuration(v)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("%s: %v", optionWatchdogSec, err)
 	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+	return systemdDuration(d), nil
+}
+
+// systemdDuration formats d as a time span of systemd.
+func systemdDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
 	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms"
+}
 
-	f, err := os.OpenFile(confPath, os.O_WRONLY|os.O_CREATE, 0644)
+// restart returns the Restart, RestartSec, RestartSteps and
+// RestartMaxDelaySec directives of the unit. Restarts only back off with
+// systemd 254 and newer.
+func (s *systemd) restart() (restart, sec string, steps int, maxDelay string, err error) {
+	restart = s.Option.string(optionRestart, RestartAlways)
+	if restart == RestartNever {
+		restart = "no"
+	}
+	d, max, err := s.restartDelays()
 	if err != nil {
-		return err
+		return "", "", 0, "", err
+	}
+	if max > 0 && s.supports("RestartSteps") {
+		steps = s.Option.int(optionRestartSteps, optionRestartStepsDefault)
+		maxDelay = systemdDuration(max)
 	}
-	defer f.Close()
+	return restart, systemdDuration(d), steps, maxDelay, nil
+}
 
+// render writes the unit Install installs.
+func (s *systemd) render(w io.Writer) error {
 	path, err := s.execPath()
 	if err != nil {
 		return err
 	}
 
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+	watchdog, err := s.watchdogSec()
+	if err != nil {
+		return err
+	}
+	restart, restartSec, restartSteps, restartMaxDelay, err := s.restart()
+	if err != nil {
+		return err
+	}
+
 	var to = &struct {
 		*Config
 		Path                 string
@@ -165,48 +403,246 @@ func (s *systemd) Install() error {
 		PIDFile              string
 		LimitNOFILE          int
 		Restart              string
+		RestartSec           string
+		RestartSteps         int
+		RestartMaxDelaySec   string
 		SuccessExitStatus    string
 		LogOutput            bool
 		LogDirectory         string
+		PrivateTmp           bool
+		Sockets              []string
+		WatchdogSec          string
+		Notify               bool
+		PropagateTrace       bool
+		UserService          bool
 	}{
-		s.Config,
+		conf,
 		path,
 		s.hasOutputFileSupport(),
 		s.Option.string(optionReloadSignal, ""),
 		s.Option.string(optionPIDFile, ""),
 		s.Option.int(optionLimitNOFILE, optionLimitNOFILEDefault),
-		s.Option.string(optionRestart, "always"),
+		restart,
+		restartSec,
+		restartSteps,
+		restartMaxDelay,
 		s.Option.string(optionSuccessExitStatus, ""),
 		s.Option.bool(optionLogOutput, optionLogOutputDefault),
 		s.Option.string(optionLogDirectory, defaultLogDirectory),
+		s.Option.bool(optionPrivateTmp, false),
+		s.sockets(),
+		watchdog,
+		s.Option.bool(optionNotify, false),
+		s.propagateTrace(),
+		s.isUserService(),
 	}
 
-	err = s.template().Execute(f, to)
+	return s.template().Execute(w, to)
+}
+
+func (s *systemd) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
+	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	_, err = os.Stat(confPath)
+	if err == nil {
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
+	}
+
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(confPath, b.Bytes(), 0644); err != nil {
+		return permissionError(err)
+	}
+	if err := s.labelFile(confPath); err != nil {
+		return err
+	}
 
-	err = s.runAction("enable")
+	logDir := s.Option.string(optionLogDirectory, defaultLogDirectory)
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) && s.hasOutputFileSupport() {
+		err = s.installLogFiles(logDir, s.Name+".out", s.Name+".err")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.enable()
 	if err != nil {
 		return err
 	}
+	if len(s.sockets()) > 0 {
+		if err = s.installSocket(confPath); err != nil {
+			return err
+		}
+	}
+	if s.isUserService() {
+		if err = s.enableLinger(); err != nil {
+			return err
+		}
+	}
 
 	return s.run("daemon-reload")
 }
 
+func (s *systemd) installTo(root string) error {
+	if s.isUserService() {
+		return ErrNotSupported
+	}
+	// Without a version the systemd of root is taken to support all.
+	s.versionOnce.Do(func() {})
+
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	unit := filepath.Join(systemdUnitDir, s.unitName())
+	if err := writeRootFile(root, unit, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	enable := true
+	switch preset := s.Option.string(optionPreset, ""); preset {
+	case "":
+	case PresetEnable, PresetDisable:
+		enable = preset == PresetEnable
+		path := filepath.Join(systemdPresetDir, "50-"+s.Name+".preset")
+		if err := writeRootFile(root, path, []byte(preset+" "+s.unitName()+"\n"), 0644); err != nil {
+			return err
+		}
+	case PresetPolicy:
+		// Left to the presets of root when it first boots.
+		enable = false
+	default:
+		return fmt.Errorf("unknown %s option %q", optionPreset, preset)
+	}
+	if enable {
+		if err := linkRoot(root, filepath.Join(systemdUnitDir, "multi-user.target.wants", s.unitName()), unit); err != nil {
+			return err
+		}
+	}
+	if len(s.sockets()) == 0 {
+		return nil
+	}
+	b.Reset()
+	if err := s.renderSocket(&b); err != nil {
+		return err
+	}
+	socket := filepath.Join(systemdUnitDir, s.socketName())
+	if err := writeRootFile(root, socket, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if !enable {
+		return nil
+	}
+	return linkRoot(root, filepath.Join(systemdUnitDir, "sockets.target.wants", s.socketName()), socket)
+}
+
+// dependents returns the units requiring or bound to the unit. Units only
+// wanting it, such as the target it is enabled for, are not included.
+func (s *systemd) dependents() ([]string, error) {
+	_, out, err := s.runWithOutput("systemctl", "show", "-p", "RequiredBy,RequisiteOf,BoundBy", s.unitName())
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, props := range parseSystemdShow("Id=" + s.unitName() + "\n" + out) {
+		for _, p := range []string{"RequiredBy", "RequisiteOf", "BoundBy"} {
+			list = append(list, strings.Fields(props[p])...)
+		}
+	}
+	return list, nil
+}
+
 func (s *systemd) Uninstall() error {
-	err := s.runAction("disable")
+	if err := s.checkDependents(s.dependents); err != nil {
+		return err
+	}
+	cp, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	// A masked unit cannot be disabled.
+	if _, err := os.Stat(cp + ".masked"); err == nil {
+		if err := s.run("unmask", s.maskArgs(cp)...); err != nil {
+			return err
+		}
+	}
+	if err := s.run("disable", s.enableArgs()...); err != nil {
+		return err
+	}
+	if err := s.removeSocket(cp); err != nil {
+		return err
+	}
+	if err := removeUnitFile(cp); err != nil {
+		return err
+	}
+	s.removePrivateTmp()
+	if err := s.removePreset(); err != nil {
+		return err
+	}
+	return s.removeLogrotate()
+}
+
+// removeUnitFile removes the unit file at cp, or the one Mask set aside
+// together with the mask.
+func removeUnitFile(cp string) error {
+	err := os.Remove(cp + ".masked")
+	switch {
+	case err == nil:
+		if err := os.Remove(cp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	case !os.IsNotExist(err):
+		return err
+	}
+	return os.Remove(cp)
+}
+
+// Mask masks the unit. systemctl only masks units that have no unit file in
+// the directory of the mask, so the unit file is set aside until Unmask.
+func (s *systemd) Mask() error {
+	cp, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	if err := os.Rename(cp, cp+".masked"); err != nil {
+		return err
+	}
+	if err := s.run("mask", s.maskArgs(cp)...); err != nil {
+		os.Rename(cp+".masked", cp)
+		return err
+	}
+	return s.run("daemon-reload")
+}
+
+// maskArgs returns the arguments to mask or unmask the unit with the unit
+// file at cp, in the same directory.
+func (s *systemd) maskArgs(cp string) []string {
+	if filepath.Dir(cp) == systemdRuntimeDir {
+		return []string{"--runtime", s.unitName()}
+	}
+	return []string{s.unitName()}
+}
+
+// Unmask unmasks the unit and restores the unit file set aside by Mask.
+func (s *systemd) Unmask() error {
 	cp, err := s.configPath()
 	if err != nil {
 		return err
 	}
-	if err := os.Remove(cp); err != nil {
+	if err := s.run("unmask", s.maskArgs(cp)...); err != nil {
 		return err
 	}
-	return nil
+	if err := os.Rename(cp+".masked", cp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.run("daemon-reload")
 }
 
 func (s *systemd) Logger(errs chan<- error) (Logger, error) {
@@ -215,23 +651,19 @@ func (s *systemd) Logger(errs chan<- error) (Logger, error) {
 	}
 	return s.SystemLogger(errs)
 }
+
+// SystemLogger returns a JournalLogger, see the Journal option.
 func (s *systemd) SystemLogger(errs chan<- error) (Logger, error) {
-	return newSysLogger(s.Name, errs)
+	return newJournalLogger(s.Config, errs)
 }
 
-func (s *systemd) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *systemd) Run() error {
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *systemd) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *systemd) Status() (Status, error) {
@@ -251,6 +683,9 @@ func (s *systemd) Status() (Status, error) {
 		}
 		if strings.Contains(out, s.Name) {
 			// unit file exists, installed but not running
+			if strings.Contains(out, "masked") {
+				return StatusMasked, nil
+			}
 			return StatusStopped, nil
 		}
 		// no unit file
@@ -264,16 +699,211 @@ func (s *systemd) Status() (Status, error) {
 	}
 }
 
+func (s *systemd) batchKey() string {
+	if s.isUserService() {
+		return "systemd-user"
+	}
+	return "systemd"
+}
+
+// statuses queries the status of the systemd services in list with a single
+// systemctl show command.
+func (s *systemd) statuses(list []Service) []StatusResult {
+	results := make([]StatusResult, len(list))
+	args := []string{"show", "-p", "Id,LoadState,ActiveState"}
+	for _, ls := range list {
+		args = append(args, ls.(*systemd).unitName())
+	}
+	_, out, err := s.runWithOutput("systemctl", args...)
+	if err != nil {
+		for i := range results {
+			results[i] = StatusResult{StatusUnknown, err}
+		}
+		return results
+	}
+
+	units := parseSystemdShow(out)
+	for i, ls := range list {
+		u, found := units[ls.(*systemd).unitName()]
+		if !found {
+			results[i] = StatusResult{StatusUnknown, ErrNotInstalled}
+			continue
+		}
+		results[i] = systemdUnitStatus(u["LoadState"], u["ActiveState"])
+	}
+	return results
+}
+
+// parseSystemdShow parses the output of systemctl show for several units,
+// blocks of Key=Value lines separated by blank lines, by unit Id.
+func parseSystemdShow(out string) map[string]map[string]string {
+	units := map[string]map[string]string{}
+	props := map[string]string{}
+	for _, line := range strings.Split(out+"\n", "\n") {
+		if line == "" {
+			if id := props["Id"]; id != "" {
+				units[id] = props
+			}
+			props = map[string]string{}
+			continue
+		}
+		if i := strings.IndexByte(line, '='); i > 0 {
+			props[line[:i]] = line[i+1:]
+		}
+	}
+	return units
+}
+
+// systemdUnitStatus interprets the load and active state of a unit as Status
+// does.
+func systemdUnitStatus(loadState, activeState string) StatusResult {
+	if loadState == "not-found" {
+		return StatusResult{StatusUnknown, ErrNotInstalled}
+	}
+	switch activeState {
+	case "active", "activating", "reloading":
+		return StatusResult{StatusRunning, nil}
+	case "inactive":
+		if loadState == "masked" {
+			return StatusResult{StatusMasked, nil}
+		}
+		return StatusResult{StatusStopped, nil}
+	case "failed":
+		return StatusResult{StatusUnknown, errors.New("service in failed state")}
+	default:
+		return StatusResult{StatusUnknown, ErrNotInstalled}
+	}
+}
+
+func (s *systemd) StatusEx() (StatusInfo, error) {
+	_, out, err := s.runWithOutput("systemctl", "show", "-p",
+		"Id,LoadState,ActiveState,MainPID,ExecMainStartTimestamp,ExecMainStatus,NRestarts,StatusText", s.unitName())
+	if err != nil {
+		return StatusInfo{Status: StatusUnknown}, err
+	}
+	u, found := parseSystemdShow(out)[s.unitName()]
+	if !found {
+		return StatusInfo{Status: StatusUnknown}, ErrNotInstalled
+	}
+	return systemdStatusInfo(u)
+}
+
+// systemdStatusInfo interprets the properties of a unit as StatusEx does.
+func systemdStatusInfo(u map[string]string) (StatusInfo, error) {
+	r := systemdUnitStatus(u["LoadState"], u["ActiveState"])
+	si := StatusInfo{Status: r.Status}
+	si.PID, _ = strconv.Atoi(u["MainPID"])
+	si.ExitCode, _ = strconv.Atoi(u["ExecMainStatus"])
+	si.Restarts, _ = strconv.Atoi(u["NRestarts"])
+	// The Supervisor reports the health of its program as the status text.
+	si.Health = parseHealth(u["StatusText"])
+	if si.PID != 0 {
+		// systemctl formats the time in the local zone, whose abbreviation
+		// is known to ParseInLocation.
+		t, err := time.ParseInLocation("Mon 2006-01-02 15:04:05 MST", u["ExecMainStartTimestamp"], time.Local)
+		if err == nil {
+			si.setStarted(t)
+		}
+	}
+	return si, r.Err
+}
+
 func (s *systemd) Start() error {
-	return s.runAction("start")
+	return s.StartContext(context.Background())
 }
 
 func (s *systemd) Stop() error {
-	return s.runAction("stop")
+	return s.StopContext(context.Background())
 }
 
 func (s *systemd) Restart() error {
-	return s.runAction("restart")
+	return s.RestartContext(context.Background())
+}
+
+// StartContext starts the unit, killing systemctl when ctx is done. The
+// unit may still be started by systemd then.
+func (s *systemd) StartContext(ctx context.Context) error {
+	if s.isUserService() {
+		s.checkLinger()
+	}
+	return s.runContext(ctx, "start", s.unitName())
+}
+
+// StopContext stops the unit, see StartContext.
+func (s *systemd) StopContext(ctx context.Context) error {
+	return s.runContext(ctx, "stop", s.unitName())
+}
+
+// RestartContext restarts the unit, see StartContext.
+func (s *systemd) RestartContext(ctx context.Context) error {
+	return s.runContext(ctx, "restart", s.unitName())
+}
+
+// StopFor stops the unit and starts it again after d with the transient
+// timer <Name>-resume.timer, replacing the timer of an earlier StopFor. The
+// unit is started again if the timer cannot be created.
+func (s *systemd) StopFor(d time.Duration) error {
+	timer := resumeName(s.Name)
+	s.run("stop", timer+".timer")
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	start := []string{"systemctl", "start", s.unitName()}
+	args := []string{"--unit=" + timer, fmt.Sprintf("--on-active=%ds", int((d+time.Second-1)/time.Second)), "--timer-property=AccuracySec=1s"}
+	if s.isUserService() {
+		start = []string{"systemctl", "--user", "start", s.unitName()}
+		args = append([]string{"--user"}, args...)
+	}
+	if err := run("systemd-run", append(args, start...)...); err != nil {
+		s.Start()
+		return err
+	}
+	return nil
+}
+
+// Signal sends sig to all processes in the control group of the unit.
+func (s *systemd) Signal(sig os.Signal) error {
+	num, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+	return s.run("kill", "--kill-who=all", "--signal="+strconv.Itoa(int(num)), s.unitName())
+}
+
+// reloadConfig has systemd read the changed unit.
+func (s *systemd) reloadConfig() error {
+	return s.run("daemon-reload")
+}
+
+// traceEnvPath returns the path of the environment file passing the trace
+// context to the program, in the runtime directory of the service manager
+// as %t in the unit.
+func (s *systemd) traceEnvPath() (string, error) {
+	dir := "/run"
+	if s.isUserService() {
+		if dir = os.Getenv("XDG_RUNTIME_DIR"); dir == "" {
+			return "", errors.New("XDG_RUNTIME_DIR is not set")
+		}
+	}
+	return filepath.Join(dir, s.Name+".traceparent"), nil
+}
+
+// startTraced passes traceparent to the program through the environment
+// file of the unit, which is removed again once systemd started the
+// program, so later restarts do not belong to the trace.
+func (s *systemd) startTraced(traceparent string, restart bool) error {
+	path, err := s.traceEnvPath()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte("TRACEPARENT="+traceparent+"\n"), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if restart {
+		return s.Restart()
+	}
+	return s.Start()
 }
 
 func (s *systemd) runWithOutput(command string, arguments ...string) (int, string, error) {
@@ -284,45 +914,75 @@ func (s *systemd) runWithOutput(command string, arguments ...string) (int, strin
 }
 
 func (s *systemd) run(action string, args ...string) error {
-	if s.isUserService() {
-		return run("systemctl", append([]string{action, "--user"}, args...)...)
-	}
-	return run("systemctl", append([]string{action}, args...)...)
+	return s.runContext(context.Background(), action, args...)
 }
 
-func (s *systemd) runAction(action string) error {
-	return s.run(action, s.unitName())
+func (s *systemd) runContext(ctx context.Context, action string, args ...string) error {
+	if s.isUserService() {
+		return runContext(ctx, "systemctl", append([]string{action, "--user"}, args...)...)
+	}
+	return runContext(ctx, "systemctl", append([]string{action}, args...)...)
 }
 
 const systemdScript = `[Unit]
 Description={{.Description}}
-ConditionFileIsExecutable={{.Path|cmdEscape}}
+ConditionFileIsExecutable={{.Path|path}}
 {{range $i, $dep := .Dependencies}} 
 {{$dep}} {{end}}
+{{if .Sockets}}Requires={{.Name}}.socket
+After={{.Name}}.socket{{end}}
+{{if supports "StartLimitIntervalSec"}}StartLimitIntervalSec=5
+StartLimitBurst=10{{end}}
 
 [Service]
-StartLimitInterval=5
-StartLimitBurst=10
+{{if not (supports "StartLimitIntervalSec")}}StartLimitInterval=5
+StartLimitBurst=10{{end}}
 ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
-{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
-{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
-{{if .UserName}}User={{.UserName}}{{end}}
+{{range .Hooks.PreStart}}{{if .Command}}ExecStartPre=/bin/sh -c {{.Command|cmd}}
+{{end}}{{end -}}
+{{range .Hooks.PostStart}}{{if .Command}}ExecStartPost=/bin/sh -c {{.Command|cmd}}
+{{end}}{{end -}}
+{{range .Hooks.PreStop}}{{if .Command}}ExecStop=/bin/sh -c {{.Command|cmd}}
+{{end}}{{end -}}
+{{range .Hooks.PostStop}}{{if .Command}}ExecStopPost=/bin/sh -c {{.Command|cmd}}
+{{end}}{{end -}}
+{{if .ChRoot}}RootDirectory={{.ChRoot|path}}{{end}}
+{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|path}}{{end}}
+{{if and .UserName (not .UserService)}}User={{.UserName}}{{end}}
 {{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
-{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
+{{if .PIDFile}}PIDFile={{.PIDFile|path}}{{end}}
 {{if and .LogOutput .HasOutputFileSupport -}}
-StandardOutput=file:{{.LogDirectory}}/{{.Name}}.out
-StandardError=file:{{.LogDirectory}}/{{.Name}}.err
+StandardOutput=file:{{.LogDirectory|path}}/{{.Name}}.out
+StandardError=file:{{.LogDirectory|path}}/{{.Name}}.err
 {{- end}}
 {{if gt .LimitNOFILE -1 }}LimitNOFILE={{.LimitNOFILE}}{{end}}
 {{if .Restart}}Restart={{.Restart}}{{end}}
 {{if .SuccessExitStatus}}SuccessExitStatus={{.SuccessExitStatus}}{{end}}
-RestartSec=120
+{{if .PrivateTmp}}PrivateTmp=true{{end}}
+{{if .WatchdogSec}}WatchdogSec={{.WatchdogSec}}{{end}}
+{{if .Notify}}Type=notify{{end}}
+{{if or .WatchdogSec .Notify}}NotifyAccess=main{{end}}
+RestartSec={{.RestartSec}}
+{{if .RestartMaxDelaySec}}RestartSteps={{.RestartSteps}}
+RestartMaxDelaySec={{.RestartMaxDelaySec}}{{end}}
 EnvironmentFile=-/etc/sysconfig/{{.Name}}
+{{if .PropagateTrace}}EnvironmentFile=-%t/{{.Name}}.traceparent{{end}}
 
 {{range $k, $v := .EnvVars -}}
-Environment={{$k}}={{$v}}
+Environment={{env $k $v}}
 {{end -}}
 
 [Install]
-WantedBy=multi-user.target
+WantedBy={{if .UserService}}default.target{{else}}multi-user.target{{end}}
+`
+
+const systemdSocketScript = `[Unit]
+Description={{.Description}}
+
+[Socket]
+{{range .Sockets -}}
+ListenStream={{.}}
+{{end}}
+[Install]
+WantedBy=sockets.target
 `
@@ -5,12 +5,12 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"text/template"
 	"time"
 )
@@ -62,38 +62,58 @@ func (s *sysv) template() *template.Template {
 	return template.Must(template.New("").Funcs(tf).Parse(sysvScript))
 }
 
+// render writes the init script Install installs.
+func (s *sysv) render(w io.Writer) error {
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	conf, err := s.installConfig()
+	if err != nil {
+		return err
+	}
+
+	var to = &struct {
+		*Config
+		Shebang      string
+		Path         string
+		LogDirectory string
+	}{
+		conf,
+		shebang(s.Option, "/bin/sh"),
+		path,
+		s.Option.string(optionLogDirectory, defaultLogDirectory),
+	}
+
+	return s.template().Execute(w, to)
+}
+
 func (s *sysv) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
 	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
 	_, err = os.Stat(confPath)
 	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
 	}
 
 	f, err := os.Create(confPath)
 	if err != nil {
-		return err
+		return permissionError(err)
 	}
 	defer f.Close()
 
-	path, err := s.execPath()
+	err = s.render(f)
 	if err != nil {
 		return err
 	}
 
-	var to = &struct {
-		*Config
-		Path         string
-		LogDirectory string
-	}{
-		s.Config,
-		path,
-		s.Option.string(optionLogDirectory, defaultLogDirectory),
-	}
-
-	err = s.template().Execute(f, to)
+	err = s.installLogFiles(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name+".log", s.Name+".err")
 	if err != nil {
 		return err
 	}
@@ -101,6 +121,18 @@ func (s *sysv) Install() error {
 	if err = os.Chmod(confPath, 0755); err != nil {
 		return err
 	}
+	if err = s.labelFile(confPath); err != nil {
+		return err
+	}
+	switch {
+	case s.quirk(quirkUpdateRcD):
+		return run("update-rc.d", s.Name, "defaults")
+	case s.quirk(quirkChkconfig):
+		if err = run("chkconfig", "--add", s.Name); err != nil {
+			return err
+		}
+		return run("chkconfig", s.Name, "on")
+	}
 	for _, i := range [...]string{"2", "3", "4", "5"} {
 		if err = os.Symlink(confPath, "/etc/rc"+i+".d/S50"+s.Name); err != nil {
 			continue
@@ -115,15 +147,51 @@ func (s *sysv) Install() error {
 	return nil
 }
 
+func (s *sysv) installTo(root string) error {
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	if err := writeRootFile(root, confPath, b.Bytes(), 0755); err != nil {
+		return err
+	}
+	for _, i := range [...]string{"2", "3", "4", "5"} {
+		if err := linkRoot(root, "/etc/rc"+i+".d/S50"+s.Name, confPath); err != nil {
+			return err
+		}
+	}
+	for _, i := range [...]string{"0", "1", "6"} {
+		if err := linkRoot(root, "/etc/rc"+i+".d/K02"+s.Name, confPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *sysv) Uninstall() error {
 	cp, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	if s.quirk(quirkChkconfig) {
+		if err := run("chkconfig", "--del", s.Name); err != nil {
+			return err
+		}
+	}
 	if err := os.Remove(cp); err != nil {
 		return err
 	}
-	return nil
+	if s.quirk(quirkUpdateRcD) {
+		if err := run("update-rc.d", s.Name, "remove"); err != nil {
+			return err
+		}
+	}
+	s.removePrivateTmp()
+	return s.removeLogrotate()
 }
 
 func (s *sysv) Logger(errs chan<- error) (Logger, error) {
@@ -136,19 +204,16 @@ func (s *sysv) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *sysv) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
+func (s *sysv) Run() error {
+	if err := s.keepSession(); err != nil {
 		return err
 	}
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
-
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *sysv) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *sysv) Status() (Status, error) {
@@ -168,11 +233,19 @@ func (s *sysv) Status() (Status, error) {
 }
 
 func (s *sysv) Start() error {
-	return run("service", s.Name, "start")
+	return run(s.rcCommand(), s.Name, "start")
 }
 
 func (s *sysv) Stop() error {
-	return run("service", s.Name, "stop")
+	return run(s.rcCommand(), s.Name, "stop")
+}
+
+// rcCommand returns the command running the init script.
+func (s *sysv) rcCommand() string {
+	if s.quirk(quirkInvokeRcD) {
+		return "invoke-rc.d"
+	}
+	return "service"
 }
 
 func (s *sysv) Restart() error {
@@ -184,7 +257,9 @@ func (s *sysv) Restart() error {
 	return s.Start()
 }
 
-const sysvScript = `#!/bin/sh
+// sysvScript is the init script, in POSIX sh so that minimal shells such as
+// dash and busybox ash run it.
+const sysvScript = `{{.Shebang}}
 # For RedHat and cousins:
 # chkconfig: - 99 01
 # description: {{.Description}}
@@ -200,21 +275,25 @@ const sysvScript = `#!/bin/sh
 # Description:       {{.Description}}
 ### END INIT INFO
 
-cmd="{{.Path}}{{range .Arguments}} {{.|cmd}}{{end}}"
+cmd() {
+    exec {{.Path|sh}}{{range .Arguments}} {{.|sh}}{{end}}
+}
 
-name=$(basename $(readlink -f $0))
+# The script may be run through a link of a runlevel, such as S99name.
+name=$(basename "$0")
+name=${name#[SK][0-9][0-9]}
 pid_file="/var/run/$name.pid"
-stdout_log="{{.LogDirectory}}/$name.log"
-stderr_log="{{.LogDirectory}}/$name.err"
+stdout_log="{{.LogDirectory|dq}}/$name.log"
+stderr_log="{{.LogDirectory|dq}}/$name.err"
 
-[ -e /etc/sysconfig/$name ] && . /etc/sysconfig/$name
+[ -e "/etc/sysconfig/$name" ] && . "/etc/sysconfig/$name"
 
 get_pid() {
     cat "$pid_file"
 }
 
 is_running() {
-    [ -f "$pid_file" ] && cat /proc/$(get_pid)/stat > /dev/null 2>&1
+    [ -f "$pid_file" ] && cat "/proc/$(get_pid)/stat" > /dev/null 2>&1
 }
 
 case "$1" in
@@ -223,8 +302,8 @@ case "$1" in
             echo "Already started"
         else
             echo "Starting $name"
-            {{if .WorkingDirectory}}cd '{{.WorkingDirectory}}'{{end}}
-            $cmd >> "$stdout_log" 2>> "$stderr_log" &
+            {{if .WorkingDirectory}}cd {{.WorkingDirectory|sh}}{{end}}
+            cmd >> "$stdout_log" 2>> "$stderr_log" &
             echo $! > "$pid_file"
             if ! is_running; then
                 echo "Unable to start, see $stdout_log and $stderr_log"
@@ -234,15 +313,17 @@ case "$1" in
     ;;
     stop)
         if is_running; then
-            echo -n "Stopping $name.."
-            kill $(get_pid)
-            for i in $(seq 1 10)
+            printf '%s' "Stopping $name.."
+            kill "$(get_pid)"
+            i=0
+            while [ $i -lt 10 ]
             do
                 if ! is_running; then
                     break
                 fi
-                echo -n "."
+                printf '.'
                 sleep 1
+                i=$((i + 1))
             done
             echo
             if is_running; then
@@ -259,12 +340,12 @@ case "$1" in
         fi
     ;;
     restart)
-        $0 stop
+        "$0" stop
         if is_running; then
             echo "Unable to stop, will not attempt to start"
             exit 1
         fi
-        $0 start
+        "$0" start
     ;;
     status)
         if is_running; then
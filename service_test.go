@@ -32,7 +32,7 @@ func TestRunInterrupt(t *testing.T) {
 			<-time.After(200 * time.Millisecond)
 		}
 		if p.numStopped == 0 {
-			t.Fatal("Run() hasn't been stopped")
+			t.Error("Run() hasn't been stopped")
 		}
 	}()
 
@@ -84,3 +84,13 @@ func (p *program) Stop(s service.Service) error {
 	p.numStopped++
 	return nil
 }
+
+func TestCapabilityString(t *testing.T) {
+	c := service.CapSocketActivation | service.CapEnable
+	if got, want := c.String(), "socket-activation,enable"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if !c.Has(service.CapEnable) || c.Has(service.CapEnable|service.CapUserMode) {
+		t.Errorf("Has() wrong for %v", c)
+	}
+}
@@ -9,20 +9,30 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log/syslog"
 	"os/exec"
+	"path/filepath"
 	"syscall"
 )
 
 const defaultLogDirectory = "/var/log"
 
+// syslogNew connects to the syslog daemon, replaced by tests.
+var syslogNew = syslog.New
+
+// newSysLogger connects to the local syslog daemon. Minimal systems and
+// containers often have no syslog socket; in that case messages are written
+// to stderr, which the service manager usually captures, and the fallback is
+// reported through Degradations.
 func newSysLogger(name string, errs chan<- error) (Logger, error) {
-	w, err := syslog.New(syslog.LOG_INFO, name)
+	w, err := syslogNew(syslog.LOG_INFO, name)
 	if err != nil {
-		return nil, err
+		degrade("syslog", "stderr", err)
+		return newStderrLogger(name), nil
 	}
 	return sysLogger{w, errs}, nil
 }
@@ -59,7 +69,12 @@ func (s sysLogger) Infof(format string, a ...interface{}) error {
 }
 
 func run(command string, arguments ...string) error {
-	_, _, err := runCommand(command, false, arguments...)
+	return runContext(context.Background(), command, arguments...)
+}
+
+// runContext is like run but kills command when ctx is done.
+func runContext(ctx context.Context, command string, arguments ...string) error {
+	_, _, err := runCommandContext(ctx, command, false, arguments...)
 	return err
 }
 
@@ -67,12 +82,30 @@ func runWithOutput(command string, arguments ...string) (int, string, error) {
 	return runCommand(command, true, arguments...)
 }
 
+// runCommand runs command, recording it in the operation trace.
 func runCommand(command string, readStdout bool, arguments ...string) (int, string, error) {
-	cmd := exec.Command(command, arguments...)
+	return runCommandContext(context.Background(), command, readStdout, arguments...)
+}
+
+// runCommandContext is like runCommand but kills command when ctx is done,
+// returning the error of ctx.
+func runCommandContext(ctx context.Context, command string, readStdout bool, arguments ...string) (int, string, error) {
+	end := traceStep("exec %s", commandLine(command, arguments...))
+	status, output, err := runExternal(ctx, command, readStdout, arguments...)
+	end(err)
+	return status, output, err
+}
+
+// runExternal runs command, looked up in the system directories with a
+// cleaned environment, see toolCommand.
+func runExternal(ctx context.Context, command string, readStdout bool, arguments ...string) (int, string, error) {
+	cmd, err := toolCommandContext(ctx, command, arguments...)
+	if err != nil {
+		return 0, "", err
+	}
 
 	var output string
 	var stdout io.ReadCloser
-	var err error
 
 	if readStdout {
 		// Connect pipe to read Stdout
@@ -101,7 +134,7 @@ func runCommand(command string, readStdout bool, arguments ...string) (int, stri
 	// Zero exit status
 	// Darwin: launchctl can fail with a zero exit status,
 	// so check for emtpy stderr
-	if command == "launchctl" {
+	if filepath.Base(command) == "launchctl" {
 		slurp, _ := ioutil.ReadAll(stderr)
 		if len(slurp) > 0 && !bytes.HasSuffix(slurp, []byte("Operation now in progress\n")) {
 			return 0, "", fmt.Errorf("%q failed with stderr: %s", command, slurp)
@@ -118,6 +151,9 @@ func runCommand(command string, readStdout bool, arguments ...string) (int, stri
 	}
 
 	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return 0, output, ctx.Err()
+		}
 		exitStatus, ok := isExitError(err)
 		if ok {
 			// Command didn't exit with a zero exit status.
@@ -5,13 +5,14 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"regexp"
 	"strings"
-	"syscall"
 	"text/template"
 )
 
@@ -56,6 +57,11 @@ func (s *upstart) Platform() string {
 	return s.platform
 }
 
+// appliesUserName reports that the service runs as the UserName, with setuid or sudo.
+func (s *upstart) appliesUserName() bool {
+	return true
+}
+
 // Upstart has some support for user services in graphical sessions.
 // Due to the mix of actual support for user services over versions, just don't bother.
 // Upstart will be replaced by systemd in most cases anyway.
@@ -125,23 +131,14 @@ func (s *upstart) template() *template.Template {
 	}
 }
 
-func (s *upstart) Install() error {
-	confPath, err := s.configPath()
-	if err != nil {
-		return err
-	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
-	}
-
-	f, err := os.Create(confPath)
+// render writes the job configuration Install installs.
+func (s *upstart) render(w io.Writer) error {
+	path, err := s.execPath()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	path, err := s.execPath()
+	conf, err := s.installConfig()
 	if err != nil {
 		return err
 	}
@@ -154,7 +151,7 @@ func (s *upstart) Install() error {
 		LogOutput       bool
 		LogDirectory    string
 	}{
-		s.Config,
+		conf,
 		path,
 		s.hasKillStanza(),
 		s.hasSetUIDStanza(),
@@ -162,7 +159,51 @@ func (s *upstart) Install() error {
 		s.Option.string(optionLogDirectory, defaultLogDirectory),
 	}
 
-	return s.template().Execute(f, to)
+	return s.template().Execute(w, to)
+}
+
+func (s *upstart) Install() error {
+	if err := s.beginInstall(s, s); err != nil {
+		return err
+	}
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(confPath)
+	if err == nil {
+		return newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, confPath))
+	}
+
+	f, err := os.Create(confPath)
+	if err != nil {
+		return permissionError(err)
+	}
+	defer f.Close()
+
+	if s.Option.bool(optionLogOutput, optionLogOutputDefault) {
+		err = s.installLogFiles(s.Option.string(optionLogDirectory, defaultLogDirectory), s.Name+".out", s.Name+".err")
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = s.render(f); err != nil {
+		return err
+	}
+	return s.labelFile(confPath)
+}
+
+func (s *upstart) installTo(root string) error {
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.render(&b); err != nil {
+		return err
+	}
+	return writeRootFile(root, confPath, b.Bytes(), 0644)
 }
 
 func (s *upstart) Uninstall() error {
@@ -173,7 +214,8 @@ func (s *upstart) Uninstall() error {
 	if err := os.Remove(cp); err != nil {
 		return err
 	}
-	return nil
+	s.removePrivateTmp()
+	return s.removeLogrotate()
 }
 
 func (s *upstart) Logger(errs chan<- error) (Logger, error) {
@@ -186,19 +228,13 @@ func (s *upstart) SystemLogger(errs chan<- error) (Logger, error) {
 	return newSysLogger(s.Name, errs)
 }
 
-func (s *upstart) Run() (err error) {
-	err = s.i.Start(s)
-	if err != nil {
-		return err
-	}
-
-	s.Option.funcSingle(optionRunWait, func() {
-		var sigChan = make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
-	})()
+func (s *upstart) Run() error {
+	return s.runUntilSignal(context.Background(), s.i, s)
+}
 
-	return s.i.Stop(s)
+// RunContext runs the program like Run until ctx is done.
+func (s *upstart) RunContext(ctx context.Context) error {
+	return s.runUntilSignal(ctx, s.i, s)
 }
 
 func (s *upstart) Status() (Status, error) {
@@ -250,14 +286,14 @@ umask 022
 console none
 
 pre-start script
-    test -x {{.Path}} || { stop; exit 0; }
+    test -x {{.Path|sh}} || { stop; exit 0; }
 end script
 
 # Start
 script
 	{{if .LogOutput}}
-	stdout_log="{{.LogDirectory}}/{{.Name}}.out"
-	stderr_log="{{.LogDirectory}}/{{.Name}}.err"
+	stdout_log="{{.LogDirectory|dq}}/{{.Name}}.out"
+	stderr_log="{{.LogDirectory|dq}}/{{.Name}}.err"
 	{{end}}
 	
 	if [ -f "/etc/sysconfig/{{.Name}}" ]; then
@@ -266,6 +302,6 @@ script
 		set +a
 	fi
 
-	exec {{if and .UserName (not .HasSetUIDStanza)}}sudo -E -u {{.UserName}} {{end}}{{.Path}}{{range .Arguments}} {{.|cmd}}{{end}}{{if .LogOutput}} >> $stdout_log 2>> $stderr_log{{end}}
+	exec {{if and .UserName (not .HasSetUIDStanza)}}sudo -E -u {{.UserName}} {{end}}{{.Path|sh}}{{range .Arguments}} {{.|sh}}{{end}}{{if .LogOutput}} >> $stdout_log 2>> $stderr_log{{end}}
 end script
 `
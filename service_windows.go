@@ -5,14 +5,18 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
+	"unsafe"
 
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
@@ -35,6 +39,15 @@ const (
 	OnFailureNoAction      = "noaction"
 	OnFailureDelayDuration = "OnFailureDelayDuration"
 	OnFailureResetPeriod   = "OnFailureResetPeriod"
+	OnFailureActions       = "OnFailureActions"
+	OnFailureCommand       = "OnFailureCommand"
+	OnFailureRebootMessage = "OnFailureRebootMessage"
+	OnFailureNonCrash      = "OnFailureNonCrash"
+
+	LoadOrderGroup = "LoadOrderGroup"
+
+	DelayedAutoStart = "DelayedAutoStart"
+	StartTriggers    = "StartTriggers"
 
 	errnoServiceDoesNotExist syscall.Errno = 1060
 )
@@ -45,6 +58,8 @@ type windowsService struct {
 
 	errSync      sync.Mutex
 	stopStartErr error
+
+	done <-chan struct{} // Stops the program like a stop request, see RunContext.
 }
 
 // WindowsLogger allows using windows specific logging methods.
@@ -167,6 +182,15 @@ func (ws *windowsService) Platform() string {
 	return version
 }
 
+// appliesUserName reports that the service runs as the UserName, with the account of the service.
+func (ws *windowsService) appliesUserName() bool {
+	return true
+}
+
+func (ws *windowsService) Capabilities() Capability {
+	return CapEnable | CapMask | CapStopFor | CapSignal
+}
+
 func (ws *windowsService) setError(err error) {
 	ws.errSync.Lock()
 	defer ws.errSync.Unlock()
@@ -179,39 +203,58 @@ func (ws *windowsService) getError() error {
 }
 
 func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown
+	cmdsAccepted := svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPreShutdown
+	if _, ok := ws.i.(Reloader); ok {
+		cmdsAccepted |= svc.AcceptParamChange
+	}
+	sc, _ := ws.i.(SessionChanger)
+	if sc != nil {
+		cmdsAccepted |= svc.AcceptSessionChange
+	}
 	changes <- svc.Status{State: svc.StartPending}
 
-	if err := ws.i.Start(ws); err != nil {
+	if err := ws.startProgram(ws.i, ws); err != nil {
 		ws.setError(err)
-		return true, 1
+		return true, uint32(exitCode(err, ExitFailure))
 	}
+	stopFirstRun := ws.startFirstRun(ws.i, ws)
 
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 loop:
 	for {
-		c := <-r
+		var c svc.ChangeRequest
+		select {
+		case c = <-r:
+		case <-ws.done:
+			c.Cmd = svc.Stop
+		}
 		switch c.Cmd {
 		case svc.Interrogate:
 			changes <- c.CurrentStatus
+		case svc.ParamChange:
+			reload(ws.i, ws)
+			changes <- c.CurrentStatus
+		case svc.SessionChange:
+			if e, ok := sessionEvent(c.EventType, c.EventData); ok && sc != nil {
+				sc.SessionChange(ws, e)
+			}
 		case svc.Stop:
 			changes <- svc.Status{State: svc.StopPending}
-			if err := ws.i.Stop(ws); err != nil {
+			stopFirstRun()
+			if err := ws.stopProgram(ws.i, ws, false); err != nil {
 				ws.setError(err)
-				return true, 2
+				return true, uint32(exitCode(err, ExitStopFailed))
 			}
 			break loop
+		case svc.PreShutdown:
+			waitShutdownInhibitors(changes)
+			fallthrough
 		case svc.Shutdown:
 			changes <- svc.Status{State: svc.StopPending}
-			var err error
-			if wsShutdown, ok := ws.i.(Shutdowner); ok {
-				err = wsShutdown.Shutdown(ws)
-			} else {
-				err = ws.i.Stop(ws)
-			}
-			if err != nil {
+			stopFirstRun()
+			if err := ws.stopProgram(ws.i, ws, true); err != nil {
 				ws.setError(err)
-				return true, 2
+				return true, uint32(exitCode(err, ExitStopFailed))
 			}
 			break loop
 		default:
@@ -229,8 +272,9 @@ func (ws *windowsService) setEnvironmentVariablesInRegistry() error {
 	if err != nil {
 		return fmt.Errorf("failed creating env var registry key, err = %v", err)
 	}
-	envStrings := make([]string, 0, len(ws.EnvVars))
-	for k, v := range ws.EnvVars {
+	vars := ws.scrubEnvVars()
+	envStrings := make([]string, 0, len(vars))
+	for k, v := range vars {
 		envStrings = append(envStrings, k+"="+v)
 	}
 
@@ -243,31 +287,139 @@ func (ws *windowsService) setEnvironmentVariablesInRegistry() error {
 	return nil
 }
 
+// connectMgr connects to the service control manager with full access.
+func connectMgr() (*mgr.Mgr, error) {
+	end := traceStep("OpenSCManager")
+	m, err := mgr.Connect()
+	end(err)
+	return m, permissionError(err)
+}
+
 func lowPrivMgr() (*mgr.Mgr, error) {
+	end := traceStep("OpenSCManager")
 	h, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT|windows.SC_MANAGER_ENUMERATE_SERVICE)
+	end(err)
 	if err != nil {
-		return nil, err
+		return nil, permissionError(err)
 	}
 	return &mgr.Mgr{Handle: h}, nil
 }
 
+// managerError returns the error err of the service manager controlling a
+// service as the error of its condition, such as ErrAlreadyRunning.
+func managerError(err error) error {
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return err
+	}
+	switch errno {
+	case errnoServiceDoesNotExist:
+		return newError(ErrNotInstalled, err.Error())
+	case windows.ERROR_SERVICE_ALREADY_RUNNING:
+		return newError(ErrAlreadyRunning, err.Error())
+	case windows.ERROR_SERVICE_NOT_ACTIVE:
+		return newError(ErrNotRunning, err.Error())
+	}
+	return permissionError(err)
+}
+
 func lowPrivSvc(m *mgr.Mgr, name string) (*mgr.Service, error) {
+	end := traceStep("OpenService %s", name)
 	h, err := windows.OpenService(
 		m.Handle, syscall.StringToUTF16Ptr(name),
 		windows.SERVICE_QUERY_CONFIG|windows.SERVICE_QUERY_STATUS|windows.SERVICE_START|windows.SERVICE_STOP)
+	end(err)
 	if err != nil {
 		return nil, err
 	}
 	return &mgr.Service{Handle: h, Name: name}, nil
 }
 
-func (ws *windowsService) Install() error {
+// scriptInterpreter returns the program and leading arguments used to run
+// the script at path, or an empty program if path is not a known script.
+// The interpreters are taken from the system directory, never from PATH or
+// ComSpec.
+func scriptInterpreter(path string) (string, []string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".bat" && ext != ".cmd" && ext != ".ps1" {
+		return "", nil
+	}
+	system32, err := windows.GetSystemDirectory()
+	if err != nil {
+		system32 = filepath.Join(os.Getenv("SystemRoot"), "System32")
+	}
+	if ext == ".ps1" {
+		return filepath.Join(system32, `WindowsPowerShell\v1.0\powershell.exe`),
+			[]string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", path}
+	}
+	return filepath.Join(system32, "cmd.exe"), []string{"/D", "/S", "/C", path}
+}
+
+// batchCommandLine returns the command line running a batch file through
+// comspec. cmd.exe does not follow the quoting rules of syscall.EscapeArg:
+// with /S it strips the outer quotes of the command and parses the rest
+// itself, so each word is only enclosed in double quotes.
+func batchCommandLine(comspec string, args []string) string {
+	words := make([]string, 0, len(args))
+	for _, a := range args[3:] {
+		words = append(words, `"`+strings.Replace(a, `"`, `""`, -1)+`"`)
+	}
+	return syscall.EscapeArg(comspec) + " " + strings.Join(args[:3], " ") + ` "` + strings.Join(words, " ") + `"`
+}
+
+// imagePath returns the command line of the program exepath with args, with
+// exepath quoted even without spaces. Windows paths cannot contain quotes.
+func imagePath(exepath string, args []string) string {
+	line := `"` + exepath + `"`
+	for _, a := range args {
+		line += " " + syscall.EscapeArg(a)
+	}
+	return line
+}
+
+// execCommand returns the image path and arguments registered with the
+// service manager, and the command line replacing the one the service
+// manager makes of them, as the program path is always quoted. The program
+// has to exist, the service manager neither searches PATH nor adds an
+// extension, see execPath. Scripts are refused: their interpreter does not
+// talk to the service manager, which would time out starting them; a
+// Supervisor can run them instead.
+func (ws *windowsService) execCommand() (string, []string, string, error) {
 	exepath, err := ws.execPath()
 	if err != nil {
+		return "", nil, "", err
+	}
+	if _, err := os.Stat(exepath); err != nil {
+		return "", nil, "", err
+	}
+	if interp, _ := scriptInterpreter(exepath); interp != "" {
+		return "", nil, "", fmt.Errorf("%s is a script, which cannot run as a service itself; run it under a Supervisor", exepath)
+	}
+	conf, err := ws.installConfig()
+	if err != nil {
+		return "", nil, "", err
+	}
+	return exepath, conf.Arguments, imagePath(exepath, conf.Arguments), nil
+}
+
+func (ws *windowsService) Install() error {
+	if err := ws.beginInstall(ws, nil); err != nil {
+		return err
+	}
+	exepath, args, cmdLine, err := ws.execCommand()
+	if err != nil {
+		return err
+	}
+	if err := checkArch(exepath, hostArchs()); err != nil {
+		return err
+	}
+	password := ws.Option.string("Password", "")
+	userName := ws.userName()
+	if err := checkServiceAccount(ws.Name, userName, password); err != nil {
 		return err
 	}
 
-	m, err := mgr.Connect()
+	m, err := connectMgr()
 	if err != nil {
 		return err
 	}
@@ -280,63 +432,73 @@ func (ws *windowsService) Install() error {
 	s, err := m.OpenService(ws.Name)
 	if err == nil {
 		s.Close()
-		return fmt.Errorf("service %s already exists", ws.Name)
-	}
-	var startType int32
-	switch ws.Option.string(StartType, ServiceStartAutomatic) {
-	case ServiceStartAutomatic:
-		startType = mgr.StartAutomatic
-	case ServiceStartManual:
-		startType = mgr.StartManual
-	case ServiceStartDisabled:
-		startType = mgr.StartDisabled
+		return newError(ErrAlreadyInstalled, Message(MsgServiceExists, ws.Name))
 	}
+	startType := ws.startType()
 
 	serviceType := windows.SERVICE_WIN32_OWN_PROCESS
 	if ws.Option.bool("Interactive", false) {
 		serviceType = serviceType | windows.SERVICE_INTERACTIVE_PROCESS
 	}
 
+	end := traceStep("CreateService %s %s", ws.Name, commandLine(exepath, args...))
 	s, err = m.CreateService(ws.Name, exepath, mgr.Config{
 		DisplayName:      ws.DisplayName,
 		Description:      ws.Description,
-		StartType:        uint32(startType),
-		ServiceStartName: ws.UserName,
-		Password:         ws.Option.string("Password", ""),
+		StartType:        startType,
+		ServiceStartName: userName,
+		Password:         password,
 		Dependencies:     ws.Dependencies,
-		DelayedAutoStart: ws.Option.bool("DelayedAutoStart", false),
+		DelayedAutoStart: ws.Option.bool(DelayedAutoStart, false),
 		ServiceType:      uint32(serviceType),
-	}, ws.Arguments...)
+		LoadOrderGroup:   ws.Option.string(LoadOrderGroup, ""),
+	}, args...)
+	end(err)
+	if err == windows.ERROR_SERVICE_MARKED_FOR_DELETE {
+		// An earlier Uninstall is only complete once the service is not
+		// open anywhere, at the latest after a restart.
+		return ws.requireReboot("service " + ws.Name + " is marked for deletion")
+	}
 	if err != nil {
 		return err
 	}
-	if onFailure := ws.Option.string(OnFailure, ""); onFailure != "" {
-		var delay = 1 * time.Second
-		if d, err := time.ParseDuration(ws.Option.string(OnFailureDelayDuration, "1s")); err == nil {
-			delay = d
+	if cmdLine != "" {
+		c, err := s.Config()
+		if err == nil {
+			c.BinaryPathName = cmdLine
+			err = s.UpdateConfig(c)
 		}
-		var actionType int
-		switch onFailure {
-		case OnFailureReboot:
-			actionType = mgr.ComputerReboot
-		case OnFailureRestart:
-			actionType = mgr.ServiceRestart
-		case OnFailureNoAction:
-			actionType = mgr.NoAction
-		default:
-			actionType = mgr.ServiceRestart
-		}
-		if err := s.SetRecoveryActions([]mgr.RecoveryAction{
-			{
-				Type:  actionType,
-				Delay: delay,
-			},
-		}, uint32(ws.Option.int(OnFailureResetPeriod, 10))); err != nil {
+		if err != nil {
+			s.Delete()
+			s.Close()
 			return err
 		}
 	}
+	// Virtual and managed service accounts are only granted the right to
+	// run services once the service they run exists.
+	if accountKind(userName) != accountUser {
+		if err := grantServiceLogon(userName); err != nil {
+			s.Delete()
+			s.Close()
+			return fmt.Errorf("grant %s the right to log on as a service: %v", userName, err)
+		}
+	}
+	// The recovery actions are part of the install, a service without them
+	// is removed again.
+	if err := traceCall("set failure actions", func() error { return ws.setRecovery(s) }); err != nil {
+		s.Delete()
+		s.Close()
+		return err
+	}
+	if err := traceCall("set start triggers", func() error { return ws.setTriggers(s) }); err != nil {
+		s.Delete()
+		s.Close()
+		return err
+	}
 	defer s.Close()
-	err = eventlog.InstallAsEventCreate(ws.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	err = traceCall("install event log source", func() error {
+		return eventlog.InstallAsEventCreate(ws.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	})
 	if err != nil {
 		if !strings.Contains(err.Error(), "exists") {
 			s.Delete()
@@ -346,21 +508,198 @@ func (ws *windowsService) Install() error {
 	return nil
 }
 
+// recoveryTypes are the types of the recovery actions by their name.
+var recoveryTypes = map[string]int{
+	recoveryRestart:  mgr.ServiceRestart,
+	recoveryRun:      mgr.RunCommand,
+	recoveryReboot:   mgr.ComputerReboot,
+	recoveryNoAction: mgr.NoAction,
+}
+
+// serviceFailureActionsFlag is SERVICE_FAILURE_ACTIONS_FLAG.
+type serviceFailureActionsFlag struct {
+	failureActionsOnNonCrashFailures int32
+}
+
+// setRecovery configures the actions the service control manager takes
+// when the service fails: the OnFailureActions, or the single OnFailure
+// action, the OnFailureCommand run by run actions, the message broadcast
+// before a reboot and whether exiting with an error counts as failing.
+func (ws *windowsService) setRecovery(s *mgr.Service) error {
+	delay := 1 * time.Second
+	if d, err := time.ParseDuration(ws.Option.string(OnFailureDelayDuration, "1s")); err == nil {
+		delay = d
+	}
+	list := ws.Option.string(OnFailureActions, "")
+	if list == "" {
+		onFailure := ws.Option.string(OnFailure, "")
+		if onFailure == "" {
+			return nil
+		}
+		if _, ok := recoveryTypes[onFailure]; !ok || onFailure == recoveryRun {
+			onFailure = recoveryRestart
+		}
+		list = onFailure
+	}
+	parsed, err := parseRecoveryActions(list, delay)
+	if err != nil {
+		return err
+	}
+	actions := make([]mgr.RecoveryAction, len(parsed))
+	for k, a := range parsed {
+		actions[k] = mgr.RecoveryAction{Type: recoveryTypes[a.action], Delay: a.delay}
+		if a.action == recoveryRun && ws.Option.string(OnFailureCommand, "") == "" {
+			return fmt.Errorf("recovery action run requires the %s option", OnFailureCommand)
+		}
+	}
+	if err := s.SetRecoveryActions(actions, uint32(ws.Option.int(OnFailureResetPeriod, 10))); err != nil {
+		return err
+	}
+	if cmd := ws.Option.string(OnFailureCommand, ""); cmd != "" {
+		if err := s.SetRecoveryCommand(cmd); err != nil {
+			return err
+		}
+	}
+	if msg := ws.Option.string(OnFailureRebootMessage, ""); msg != "" {
+		if err := s.SetRebootMessage(msg); err != nil {
+			return err
+		}
+	}
+	if ws.Option.bool(OnFailureNonCrash, false) {
+		flag := serviceFailureActionsFlag{failureActionsOnNonCrashFailures: 1}
+		if err := windows.ChangeServiceConfig2(s.Handle, windows.SERVICE_CONFIG_FAILURE_ACTIONS_FLAG, (*byte)(unsafe.Pointer(&flag))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Service trigger structures of ChangeServiceConfig2.
+type serviceTriggerInfo struct {
+	triggers uint32
+	trigger  *serviceTrigger
+	reserved *byte
+}
+
+type serviceTrigger struct {
+	triggerType uint32
+	action      uint32
+	subtype     *windows.GUID
+	dataItems   uint32
+	dataItem    *serviceTriggerDataItem
+}
+
+type serviceTriggerDataItem struct {
+	dataType uint32
+	size     uint32
+	data     *byte
+}
+
+const (
+	serviceTriggerTypeDeviceInterfaceArrival = 1
+	serviceTriggerTypeIPAddressAvailability  = 2
+	serviceTriggerTypeCustom                 = 20
+	serviceTriggerActionServiceStart         = 1
+	serviceTriggerDataTypeString             = 2
+)
+
+// networkFirstIPAddressArrival is NETWORK_MANAGER_FIRST_IP_ADDRESS_ARRIVAL_GUID.
+var networkFirstIPAddressArrival = windows.GUID{Data1: 0x4f27f2de, Data2: 0x14e2, Data3: 0x430b, Data4: [8]byte{0xa5, 0x49, 0x7c, 0xd4, 0x8c, 0xbc, 0x82, 0x45}}
+
+// setTriggers registers the StartTriggers, upon which the service control
+// manager starts the service, usually installed with the manual StartType.
+func (ws *windowsService) setTriggers(s *mgr.Service) error {
+	parsed, err := parseStartTriggers(ws.Option.string(StartTriggers, ""))
+	if err != nil || len(parsed) == 0 {
+		return err
+	}
+	triggers := make([]serviceTrigger, len(parsed))
+	for k, t := range parsed {
+		st := &triggers[k]
+		st.action = serviceTriggerActionServiceStart
+		switch t.kind {
+		case triggerNetwork:
+			st.triggerType = serviceTriggerTypeIPAddressAvailability
+			guid := networkFirstIPAddressArrival
+			st.subtype = &guid
+			continue
+		case triggerDevice:
+			st.triggerType = serviceTriggerTypeDeviceInterfaceArrival
+		case triggerETW:
+			st.triggerType = serviceTriggerTypeCustom
+		}
+		guid, err := windows.GUIDFromString(t.guid)
+		if err != nil {
+			return err
+		}
+		st.subtype = &guid
+		if t.data != "" {
+			// A multi-string, ended by an empty string.
+			data, err := windows.UTF16FromString(t.data)
+			if err != nil {
+				return err
+			}
+			data = append(data, 0)
+			st.dataItems = 1
+			st.dataItem = &serviceTriggerDataItem{
+				dataType: serviceTriggerDataTypeString,
+				size:     uint32(2 * len(data)),
+				data:     (*byte)(unsafe.Pointer(&data[0])),
+			}
+		}
+	}
+	info := serviceTriggerInfo{triggers: uint32(len(triggers)), trigger: &triggers[0]}
+	return windows.ChangeServiceConfig2(s.Handle, windows.SERVICE_CONFIG_TRIGGER_INFO, (*byte)(unsafe.Pointer(&info)))
+}
+
+// dependents returns the services that list the service among their
+// dependencies.
+func (ws *windowsService) dependents(m *mgr.Mgr) ([]string, error) {
+	names, err := m.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, name := range names {
+		s, err := lowPrivSvc(m, name)
+		if err != nil {
+			continue
+		}
+		c, err := s.Config()
+		s.Close()
+		if err != nil {
+			continue
+		}
+		for _, dep := range c.Dependencies {
+			if strings.EqualFold(dep, ws.Name) {
+				list = append(list, name)
+				break
+			}
+		}
+	}
+	return list, nil
+}
+
 func (ws *windowsService) Uninstall() error {
-	m, err := mgr.Connect()
+	m, err := connectMgr()
 	if err != nil {
 		return err
 	}
 	defer m.Disconnect()
 	s, err := m.OpenService(ws.Name)
 	if err != nil {
-		return fmt.Errorf("service %s is not installed", ws.Name)
+		return newError(ErrNotInstalled, Message(MsgNotInstalledAs, ws.Name))
 	}
 	defer s.Close()
-	err = s.Delete()
+	err = ws.checkDependents(func() ([]string, error) { return ws.dependents(m) })
+	if err != nil {
+		return err
+	}
+	err = traceCall("DeleteService "+ws.Name, s.Delete)
 	if err != nil {
 		return err
 	}
+	ws.removePrivateTmp()
 	err = eventlog.Remove(ws.Name)
 	if err != nil {
 		return fmt.Errorf("RemoveEventLogSource() failed: %s", err)
@@ -369,7 +708,18 @@ func (ws *windowsService) Uninstall() error {
 }
 
 func (ws *windowsService) Run() error {
+	return ws.RunContext(context.Background())
+}
+
+// RunContext runs the program like Run until ctx is done.
+func (ws *windowsService) RunContext(ctx context.Context) error {
+	ws.done = ctx.Done()
 	ws.setError(nil)
+	cleanupTmp, err := ws.preparePrivateTmp()
+	if err != nil {
+		return err
+	}
+	defer cleanupTmp()
 	if !interactive {
 		// Return error messages from start and stop routines
 		// that get executed in the Execute method.
@@ -385,18 +735,100 @@ func (ws *windowsService) Run() error {
 		}
 		return nil
 	}
-	err := ws.i.Start(ws)
+	stop, err := ws.stopSignals()
+	if err != nil {
+		return err
+	}
+	err = ws.startProgram(ws.i, ws)
 	if err != nil {
 		return err
 	}
 
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, stop...)
+
+	stopFirstRun := ws.startFirstRun(ws.i, ws)
+	select {
+	case <-sigChan:
+	case <-ws.done:
+	}
+	signal.Stop(sigChan)
+	stopFirstRun()
 
-	<-sigChan
+	return ws.stopProgram(ws.i, ws, false)
+}
 
-	return ws.i.Stop(ws)
+// signalNum returns the signals delivered on Windows: INT for Ctrl-C and
+// Ctrl-Break and TERM when the console is closed. Other signals are known
+// but never delivered.
+func signalNum(name string) (os.Signal, bool) {
+	switch name {
+	case "SIGINT":
+		return os.Interrupt, true
+	case "SIGTERM":
+		return syscall.SIGTERM, true
+	case "SIGHUP", "SIGQUIT", "SIGKILL", "SIGUSR1", "SIGUSR2", "SIGPIPE", "SIGALRM":
+		return nil, true
+	}
+	return nil, false
+}
+
+// startType returns the start type of the StartType option.
+func (ws *windowsService) startType() uint32 {
+	var startType int32
+	switch ws.Option.string(StartType, ServiceStartAutomatic) {
+	case ServiceStartAutomatic:
+		startType = mgr.StartAutomatic
+	case ServiceStartManual:
+		startType = mgr.StartManual
+	case ServiceStartDisabled:
+		startType = mgr.StartDisabled
+	}
+	return uint32(startType)
+}
+
+// SetDisplayName changes the display name of the installed service.
+func (ws *windowsService) SetDisplayName(name string) error {
+	err := ws.updateConfig(func(c *mgr.Config) { c.DisplayName = name })
+	if err == nil {
+		ws.DisplayName = name
+	}
+	return err
+}
+
+// Mask disables the service, which the service manager then refuses to start.
+func (ws *windowsService) Mask() error {
+	return ws.setStartType(mgr.StartDisabled)
+}
+
+// Unmask restores the start type of the StartType option.
+func (ws *windowsService) Unmask() error {
+	return ws.setStartType(ws.startType())
+}
+
+func (ws *windowsService) setStartType(startType uint32) error {
+	return ws.updateConfig(func(c *mgr.Config) { c.StartType = startType })
+}
+
+// updateConfig changes the configuration of the installed service with f.
+func (ws *windowsService) updateConfig(f func(c *mgr.Config)) error {
+	m, err := connectMgr()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(ws.Name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	c, err := s.Config()
+	if err != nil {
+		return err
+	}
+	f(&c)
+	return s.UpdateConfig(c)
 }
 
 func (ws *windowsService) Status() (Status, error) {
@@ -434,13 +866,64 @@ func (ws *windowsService) Status() (Status, error) {
 	case svc.StopPending:
 		fallthrough
 	case svc.Stopped:
+		if c, err := s.Config(); err == nil && c.StartType == mgr.StartDisabled {
+			return StatusMasked, nil
+		}
 		return StatusStopped, nil
 	default:
 		return StatusUnknown, fmt.Errorf("unknown status %v", status)
 	}
 }
 
+func (ws *windowsService) StatusEx() (StatusInfo, error) {
+	st, err := ws.Status()
+	si := StatusInfo{Status: st}
+	if err != nil {
+		return si, err
+	}
+	m, err := lowPrivMgr()
+	if err != nil {
+		return si, err
+	}
+	defer m.Disconnect()
+	s, err := lowPrivSvc(m, ws.Name)
+	if err != nil {
+		return si, err
+	}
+	defer s.Close()
+	status, err := s.Query()
+	if err != nil {
+		return si, err
+	}
+
+	si.PID = int(status.ProcessId)
+	si.ExitCode = int(status.Win32ExitCode)
+	if status.Win32ExitCode == uint32(windows.ERROR_SERVICE_SPECIFIC_ERROR) {
+		si.ExitCode = int(status.ServiceSpecificExitCode)
+	}
+	if si.PID != 0 {
+		h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, status.ProcessId)
+		if err == nil {
+			var created, exited, kernel, user windows.Filetime
+			if windows.GetProcessTimes(h, &created, &exited, &kernel, &user) == nil {
+				si.setStarted(time.Unix(0, created.Nanoseconds()))
+			}
+			windows.CloseHandle(h)
+		}
+	}
+	return si, nil
+}
+
 func (ws *windowsService) Start() error {
+	return ws.StartContext(context.Background())
+}
+
+// StartContext starts the service. StartService returns once the service
+// process is created, so ctx is only checked before.
+func (ws *windowsService) StartContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	m, err := lowPrivMgr()
 	if err != nil {
 		return err
@@ -449,13 +932,18 @@ func (ws *windowsService) Start() error {
 
 	s, err := lowPrivSvc(m, ws.Name)
 	if err != nil {
-		return err
+		return managerError(err)
 	}
 	defer s.Close()
-	return s.Start()
+	return managerError(traceCall("StartService "+ws.Name, func() error { return s.Start() }))
 }
 
 func (ws *windowsService) Stop() error {
+	return ws.StopContext(context.Background())
+}
+
+// StopContext stops the service and waits for it to stop until ctx is done.
+func (ws *windowsService) StopContext(ctx context.Context) error {
 	m, err := lowPrivMgr()
 	if err != nil {
 		return err
@@ -464,14 +952,85 @@ func (ws *windowsService) Stop() error {
 
 	s, err := lowPrivSvc(m, ws.Name)
 	if err != nil {
-		return err
+		return managerError(err)
 	}
 	defer s.Close()
 
-	return ws.stopWait(s)
+	return ws.stopWait(ctx, s)
+}
+
+// StopFor stops the service and starts it again after d with the scheduled
+// task <Name>-resume, replacing the task of an earlier StopFor. The service
+// is started again if the task cannot be created.
+func (ws *windowsService) StopFor(d time.Duration) error {
+	if err := ws.Stop(); err != nil {
+		return err
+	}
+	if err := scheduleStart(ws.Name, time.Now().Add(d)); err != nil {
+		ws.Start()
+		return err
+	}
+	return nil
+}
+
+// scheduleStart creates the task starting service at at.
+func scheduleStart(service string, at time.Time) error {
+	task, err := resumeTaskXML(service, at)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "resume-*.xml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(task)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	args := []string{"/Create", "/F", "/TN", resumeName(service), "/XML", f.Name()}
+	end := traceStep("exec %s", commandLine("schtasks", args...))
+	out, err := runTool("schtasks", args...)
+	end(err)
+	if err != nil {
+		return fmt.Errorf("schtasks: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Signal ends the process tree of the service for os.Kill, the only signal
+// there is on windows. The service manager takes the failure actions.
+func (ws *windowsService) Signal(sig os.Signal) error {
+	if sig != os.Kill {
+		return fmt.Errorf("unsupported signal %v on windows", sig)
+	}
+	si, err := ws.StatusEx()
+	if err != nil {
+		return err
+	}
+	if si.PID == 0 {
+		return ErrNotRunning
+	}
+	args := []string{"/T", "/F", "/PID", strconv.Itoa(si.PID)}
+	end := traceStep("exec %s", commandLine("taskkill", args...))
+	out, err := runTool("taskkill", args...)
+	end(err)
+	if err != nil {
+		return fmt.Errorf("taskkill: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
 }
 
 func (ws *windowsService) Restart() error {
+	return ws.RestartContext(context.Background())
+}
+
+// RestartContext stops the service, waiting for it to stop until ctx is
+// done, and starts it again.
+func (ws *windowsService) RestartContext(ctx context.Context) error {
 	m, err := lowPrivMgr()
 	if err != nil {
 		return err
@@ -484,21 +1043,25 @@ func (ws *windowsService) Restart() error {
 	}
 	defer s.Close()
 
-	err = ws.stopWait(s)
+	err = ws.stopWait(ctx, s)
 	if err != nil {
 		return err
 	}
 
-	return s.Start()
+	return managerError(traceCall("StartService "+ws.Name, func() error { return s.Start() }))
 }
 
-func (ws *windowsService) stopWait(s *mgr.Service) error {
+func (ws *windowsService) stopWait(ctx context.Context, s *mgr.Service) error {
 	// First stop the service. Then wait for the service to
 	// actually stop before starting it.
+	end := traceStep("ControlService %s stop", ws.Name)
 	status, err := s.Control(svc.Stop)
+	end(err)
 	if err != nil {
-		return err
+		return managerError(err)
 	}
+	end = traceStep("wait for %s to stop", ws.Name)
+	defer func() { end(nil) }()
 
 	timeDuration := time.Millisecond * 50
 
@@ -515,6 +1078,8 @@ func (ws *windowsService) stopWait(s *mgr.Service) error {
 			}
 		case <-timeout:
 			break
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 	return nil
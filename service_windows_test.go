@@ -5,6 +5,10 @@
 package service
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -12,3 +16,86 @@ func TestTimeout(t *testing.T) {
 	stopSpan := getStopTimeout()
 	t.Log("Max Stop Duration", stopSpan)
 }
+
+func TestScriptInterpreter(t *testing.T) {
+	tests := []struct {
+		path     string
+		wantArgs []string
+	}{
+		{`C:\svc\agent.exe`, nil},
+		{`C:\svc\run.BAT`, []string{"/D", "/S", "/C", `C:\svc\run.BAT`}},
+		{`C:\svc\run.cmd`, []string{"/D", "/S", "/C", `C:\svc\run.cmd`}},
+		{`C:\svc\run.ps1`, []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", `C:\svc\run.ps1`}},
+	}
+	for _, tt := range tests {
+		interp, args := scriptInterpreter(tt.path)
+		if (interp == "") != (tt.wantArgs == nil) {
+			t.Errorf("scriptInterpreter(%q) interpreter = %q", tt.path, interp)
+		}
+		if strings.Join(args, " ") != strings.Join(tt.wantArgs, " ") {
+			t.Errorf("scriptInterpreter(%q) args = %q, want %q", tt.path, args, tt.wantArgs)
+		}
+	}
+}
+
+func TestBatchCommandLine(t *testing.T) {
+	args := []string{"/D", "/S", "/C", `C:\Program Files\Agent\run.cmd`, "--name", `say "hi"`, "Zürich"}
+	got := batchCommandLine(`C:\Windows\System32\cmd.exe`, args)
+	want := `C:\Windows\System32\cmd.exe /D /S /C ""C:\Program Files\Agent\run.cmd" "--name" "say ""hi""" "Zürich""`
+	if got != want {
+		t.Errorf("batchCommandLine() = %s, want %s", got, want)
+	}
+}
+
+func TestImagePath(t *testing.T) {
+	got := imagePath(`C:\svc\agent.exe`, []string{"-config", `C:\Program Files\Agent\agent.json`})
+	want := `"C:\svc\agent.exe" -config "C:\Program Files\Agent\agent.json"`
+	if got != want {
+		t.Errorf("imagePath() = %s, want %s", got, want)
+	}
+}
+
+func TestCompleteExt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pathext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"agent.exe", "deploy.cmd"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATHEXT", os.Getenv("PATHEXT"))
+	os.Setenv("PATHEXT", ".COM;.EXE;.BAT;.CMD")
+
+	tests := []struct {
+		name, want string
+	}{
+		{"agent", "agent.exe"},
+		{"agent.exe", "agent.exe"},
+		{"deploy", "deploy.cmd"},
+		{"missing", "missing"},
+	}
+	for _, tt := range tests {
+		if got := completeExt(filepath.Join(dir, tt.name)); got != filepath.Join(dir, tt.want) {
+			t.Errorf("completeExt(%q) = %q, want %q", tt.name, got, filepath.Join(dir, tt.want))
+		}
+	}
+}
+
+func TestExecCommandScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run.cmd")
+	if err := ioutil.WriteFile(path, []byte("@echo off\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws := &windowsService{Config: &Config{Name: "script", Executable: path}}
+	if _, _, _, err := ws.execCommand(); err == nil {
+		t.Error("execCommand() of a script succeeded, want an error")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"sync"
+)
+
+// SessionEventKind is the kind of a SessionEvent.
+type SessionEventKind int
+
+// Kinds of session events.
+const (
+	SessionLogon SessionEventKind = iota + 1
+	SessionLogoff
+	SessionLock
+	SessionUnlock
+)
+
+// SessionEvent is a change of an interactive user session.
+type SessionEvent struct {
+	Kind    SessionEventKind
+	Session uint32
+}
+
+// SessionChanger is an Interface notified when users log on to, log off from,
+// lock or unlock interactive sessions. Only Windows services are notified.
+type SessionChanger interface {
+	Interface
+	SessionChange(s Service, e SessionEvent)
+}
+
+// Session is an interactive user session.
+type Session struct {
+	ID      uint32
+	Station string // Window station, such as "Console" or "RDP-Tcp#3".
+}
+
+// SessionHelper runs a helper program, such as a tray icon, as the user of
+// each interactive session for a service running as the system. Only Windows
+// is supported; elsewhere its methods return ErrNotSupported.
+//
+// A program starts the helper in the sessions already active when it starts,
+// with StartAll, implements SessionChanger calling SessionChange so the helper
+// follows users logging on and off, and calls StopAll when it stops.
+type SessionHelper struct {
+	Path string
+	Args []string
+
+	mu    sync.Mutex
+	procs map[uint32]*os.Process
+}
+
+// Start runs the helper in session, unless it already runs there.
+func (h *SessionHelper) Start(session uint32) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.procs[session] != nil {
+		return nil
+	}
+	p, err := startInSession(session, h.Path, h.Args)
+	if err != nil {
+		return err
+	}
+	if h.procs == nil {
+		h.procs = map[uint32]*os.Process{}
+	}
+	h.procs[session] = p
+	go func() {
+		p.Wait()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.procs[session] == p {
+			delete(h.procs, session)
+		}
+	}()
+	return nil
+}
+
+// Stop ends the helper in session, if it runs there.
+func (h *SessionHelper) Stop(session uint32) error {
+	h.mu.Lock()
+	p := h.procs[session]
+	delete(h.procs, session)
+	h.mu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.Kill()
+}
+
+// StartAll runs the helper in every active interactive session.
+func (h *SessionHelper) StartAll() error {
+	sessions, err := Sessions()
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if err := h.Start(s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopAll ends the helper in all sessions.
+func (h *SessionHelper) StopAll() error {
+	h.mu.Lock()
+	sessions := make([]uint32, 0, len(h.procs))
+	for id := range h.procs {
+		sessions = append(sessions, id)
+	}
+	h.mu.Unlock()
+
+	var err error
+	for _, id := range sessions {
+		if stopErr := h.Stop(id); err == nil {
+			err = stopErr
+		}
+	}
+	return err
+}
+
+// SessionChange starts the helper in sessions users log on to and ends it in
+// sessions they log off from.
+func (h *SessionHelper) SessionChange(e SessionEvent) error {
+	switch e.Kind {
+	case SessionLogon:
+		return h.Start(e.Session)
+	case SessionLogoff:
+		return h.Stop(e.Session)
+	}
+	return nil
+}
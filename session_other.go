@@ -0,0 +1,20 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package service
+
+import "os"
+
+// Sessions returns the active interactive user sessions. It is only
+// supported on Windows.
+func Sessions() ([]Session, error) {
+	return nil, ErrNotSupported
+}
+
+func startInSession(session uint32, path string, args []string) (*os.Process, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,28 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSessionHelper(t *testing.T) {
+	h := &SessionHelper{Path: "helper"}
+	if err := h.SessionChange(SessionEvent{Kind: SessionLock, Session: 1}); err != nil {
+		t.Errorf("SessionChange(lock) = %v", err)
+	}
+	if err := h.SessionChange(SessionEvent{Kind: SessionLogoff, Session: 1}); err != nil {
+		t.Errorf("SessionChange(logoff) without a helper = %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if err := h.SessionChange(SessionEvent{Kind: SessionLogon, Session: 1}); err != ErrNotSupported {
+			t.Errorf("SessionChange(logon) = %v, want ErrNotSupported", err)
+		}
+	}
+	if err := h.StopAll(); err != nil {
+		t.Errorf("StopAll = %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Sessions returns the active interactive user sessions.
+func Sessions() ([]Session, error) {
+	var info *windows.WTS_SESSION_INFO
+	var n uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &info, &n); err != nil {
+		return nil, err
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(info)))
+
+	var sessions []Session
+	for _, si := range (*[1 << 16]windows.WTS_SESSION_INFO)(unsafe.Pointer(info))[:n:n] {
+		if si.State != windows.WTSActive || si.SessionID == 0 {
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:      si.SessionID,
+			Station: windows.UTF16PtrToString(si.WindowStationName),
+		})
+	}
+	return sessions, nil
+}
+
+// startInSession runs path as the user logged on to session, on their desktop
+// and with their environment.
+func startInSession(session uint32, path string, args []string) (*os.Process, error) {
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(session, &token); err != nil {
+		return nil, err
+	}
+	defer token.Close()
+
+	var env *uint16
+	if err := windows.CreateEnvironmentBlock(&env, token, false); err != nil {
+		return nil, err
+	}
+	defer windows.DestroyEnvironmentBlock(env)
+
+	cmdLine, err := windows.UTF16PtrFromString(windows.ComposeCommandLine(append([]string{path}, args...)))
+	if err != nil {
+		return nil, err
+	}
+	desktop, err := windows.UTF16PtrFromString(`winsta0\default`)
+	if err != nil {
+		return nil, err
+	}
+	si := &windows.StartupInfo{Desktop: desktop}
+	si.Cb = uint32(unsafe.Sizeof(*si))
+	pi := &windows.ProcessInformation{}
+	err = windows.CreateProcessAsUser(token, nil, cmdLine, nil, nil, false,
+		windows.CREATE_UNICODE_ENVIRONMENT, env, nil, si, pi)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(pi.Thread)
+	defer windows.CloseHandle(pi.Process)
+
+	return os.FindProcess(int(pi.ProcessId))
+}
+
+// sessionEvent returns the session event of a session change request.
+func sessionEvent(eventType uint32, eventData uintptr) (SessionEvent, bool) {
+	var kind SessionEventKind
+	switch eventType {
+	case windows.WTS_SESSION_LOGON:
+		kind = SessionLogon
+	case windows.WTS_SESSION_LOGOFF:
+		kind = SessionLogoff
+	case windows.WTS_SESSION_LOCK:
+		kind = SessionLock
+	case windows.WTS_SESSION_UNLOCK:
+		kind = SessionUnlock
+	default:
+		return SessionEvent{}, false
+	}
+	// eventData points to memory of the service manager, not the Go heap.
+	n := (*windows.WTSSESSION_NOTIFICATION)(*(*unsafe.Pointer)(unsafe.Pointer(&eventData)))
+	return SessionEvent{Kind: kind, Session: n.SessionID}, true
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+const optionShutdownTimeout = "ShutdownTimeout"
+
+// exit ends the process, replaced by tests.
+var exit = os.Exit
+
+// stopCanceler is implemented by interfaces that can cancel a running Stop.
+type stopCanceler interface {
+	cancelStop()
+}
+
+// stopWithin calls stop, Stop or Shutdown of i. If stop does not return
+// within the ShutdownTimeout option the stacks of all goroutines are logged
+// and the Stop context of a ContextInterface is cancelled. If stop still
+// did not return after another tenth of the timeout the process exits with
+// ExitStopTimeout, as a hung stop would otherwise have to be killed without
+// leaving any trace.
+func (c *Config) stopWithin(i Interface, s Service, stop func(Service) error) error {
+	timeout, err := time.ParseDuration(c.Option.string(optionShutdownTimeout, ""))
+	if err != nil || timeout <= 0 {
+		return stop(s)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- stop(s)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+	}
+
+	logger, _ := s.Logger(nil)
+	if logger != nil {
+		logger.Errorf("stop did not return within %v, goroutines:\n%s", timeout, stacks())
+	}
+	if sc, ok := i.(stopCanceler); ok {
+		sc.cancelStop()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout / 10):
+	}
+	if logger != nil {
+		logger.Error("stop did not return after cancellation, exiting")
+	}
+	exit(ExitStopTimeout)
+	return nil
+}
+
+// stacks returns the stacks of all goroutines.
+func stacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"strings"
+)
+
+// systemShuttingDown reports whether the host is shutting down or
+// rebooting: systemd is stopping, or the runlevel is 0 or 6 on other init
+// systems. It reports false if the init system does not answer before ctx
+// is done.
+func systemShuttingDown(ctx context.Context) bool {
+	if isSystemd() {
+		// is-system-running exits non-zero for all states but running.
+		_, out, _ := runCommandContext(ctx, "systemctl", true, "is-system-running")
+		return strings.TrimSpace(out) == "stopping"
+	}
+	_, out, err := runCommandContext(ctx, "runlevel", true)
+	if err != nil {
+		return false
+	}
+	f := strings.Fields(out)
+	return len(f) == 2 && (f[1] == "0" || f[1] == "6")
+}
@@ -0,0 +1,17 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || solaris || aix || freebsd
+// +build darwin solaris aix freebsd
+
+package service
+
+import "context"
+
+// systemShuttingDown reports whether the host is shutting down. The init
+// systems here stop services with the same signal either way and the sender
+// of a signal is not known to the program, so it is never detected.
+func systemShuttingDown(ctx context.Context) bool {
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// recordingLogger is a Logger recording the errors logged.
+type recordingLogger struct {
+	Logger
+	errors []string
+}
+
+func (l *recordingLogger) Error(v ...interface{}) error {
+	return l.Errorf("%v", v...)
+}
+
+func (l *recordingLogger) Errorf(format string, a ...interface{}) error {
+	l.errors = append(l.errors, strings.TrimSpace(format))
+	return nil
+}
+
+type loggingService struct {
+	Service
+	logger *recordingLogger
+}
+
+func (s loggingService) Logger(errs chan<- error) (Logger, error) {
+	return s.logger, nil
+}
+
+// hungProgram stops only once its Stop context is cancelled.
+type hungProgram struct{}
+
+func (hungProgram) Start(ctx context.Context, s Service) error { return nil }
+func (hungProgram) Stop(ctx context.Context, s Service) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestStopWithin(t *testing.T) {
+	defer func(e func(int)) { exit = e }(exit)
+	exitCode := -1
+	exit = func(code int) { exitCode = code }
+
+	s := loggingService{logger: &recordingLogger{}}
+	c := &Config{Option: KeyValue{optionShutdownTimeout: "50ms"}}
+	i := FromContextInterface(hungProgram{}, 0)
+	i.Start(s)
+	if err := c.stopWithin(i, s, i.Stop); err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != -1 {
+		t.Errorf("exited with %d after the Stop context was cancelled", exitCode)
+	}
+	if len(s.logger.errors) != 1 || !strings.Contains(s.logger.errors[0], "goroutines") {
+		t.Errorf("logged %q, want the goroutine stacks", s.logger.errors)
+	}
+
+	hung := make(chan struct{})
+	defer close(hung)
+	stop := func(Service) error {
+		<-hung
+		return nil
+	}
+	c.stopWithin(i, s, stop)
+	if exitCode != ExitStopTimeout {
+		t.Errorf("exit code %d, want %d", exitCode, ExitStopTimeout)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "os"
+
+// Signaler is implemented by the services of the service managers that
+// support CapSignal.
+type Signaler interface {
+	// Signal sends sig to all processes of the running service, its
+	// control group with systemd and its process group with launchd, such
+	// as SIGUSR1 to have them reopen their log files. On Windows only
+	// os.Kill is supported, which ends the process tree of the service.
+	Signal(sig os.Signal) error
+}
+
+// Signal sends sig to the processes of s, see Signaler. It returns
+// ErrNotSupported if the service manager of s cannot and ErrNotRunning if
+// s is not running.
+func Signal(s Service, sig os.Signal) error {
+	if sg, ok := s.(Signaler); ok {
+		return sg.Signal(sig)
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd || windows
+// +build linux darwin solaris aix freebsd windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	optionStopSignals        = "StopSignals"
+	optionStopSignalsDefault = "TERM,INT"
+	optionIgnoreSignals      = "IgnoreSignals"
+)
+
+// signals returns the signals listed in the option name, comma separated
+// names such as "TERM,INT" or "SIGHUP". Signals that are known but never
+// delivered on the system, such as HUP on Windows, are left out.
+func (c *Config) signals(name, defaultValue string) ([]os.Signal, error) {
+	var list []os.Signal
+	for _, n := range strings.Split(c.Option.string(name, defaultValue), ",") {
+		n = strings.ToUpper(strings.TrimSpace(n))
+		if n == "" {
+			continue
+		}
+		if !strings.HasPrefix(n, "SIG") {
+			n = "SIG" + n
+		}
+		sig, known := signalNum(n)
+		if !known {
+			return nil, fmt.Errorf("%s: unknown signal %s", name, n)
+		}
+		if sig != nil {
+			list = append(list, sig)
+		}
+	}
+	return list, nil
+}
+
+// stopSignals returns the StopSignals. An empty list is an error, as
+// signal.Notify would then deliver every signal, and the program would stop
+// on SIGCHLD or SIGWINCH.
+func (c *Config) stopSignals() ([]os.Signal, error) {
+	stop, err := c.signals(optionStopSignals, optionStopSignalsDefault)
+	if err == nil && len(stop) == 0 {
+		err = fmt.Errorf("%s: no signal delivered on this system", optionStopSignals)
+	}
+	return stop, err
+}
+
+// reload calls Reload of i, if it is a Reloader, logging a failure.
+func reload(i Interface, s Service) {
+	r, ok := i.(Reloader)
+	if !ok {
+		return
+	}
+	begin := time.Now()
+	err := r.Reload(s)
+	report(TelemetryLifecycle, s, "reload", begin, err)
+	if err != nil {
+		if logger, _ := s.Logger(nil); logger != nil {
+			logger.Error(err)
+		}
+	}
+}
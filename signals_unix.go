@@ -0,0 +1,137 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func signalNum(name string) (os.Signal, bool) {
+	sig := unix.SignalNum(name)
+	return sig, sig != 0
+}
+
+// signalGroup sends sig to the process group led by pid, or to pid alone if
+// it does not lead a group, so the group of the caller is never signalled.
+func signalGroup(pid int, sig os.Signal) error {
+	num, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+	if pgid, err := unix.Getpgid(pid); err == nil && pgid == pid {
+		return unix.Kill(-pid, num)
+	}
+	return unix.Kill(pid, num)
+}
+
+// shuttingDown reports whether the host is shutting down, replaced by tests.
+var shuttingDown = systemShuttingDown
+
+// shutdownCheckTimeout bounds asking the init system whether the host is
+// shutting down, which delays stopping the program.
+const shutdownCheckTimeout = 2 * time.Second
+
+// runUntilSignal runs i until one of the StopSignals arrives, or until the
+// RunWait option function returns. The IgnoreSignals are ignored meanwhile
+// and a Reloader is reloaded on the ReloadSignal. A Shutdowner is shut down
+// rather than stopped if the host is shutting down. i is also stopped once
+// ctx is done.
+func (c *Config) runUntilSignal(ctx context.Context, i Interface, s Service) error {
+	stop, err := c.stopSignals()
+	if err != nil {
+		return err
+	}
+	ignore, err := c.signals(optionIgnoreSignals, "")
+	if err != nil {
+		return err
+	}
+	var reloadOn []os.Signal
+	if _, ok := i.(Reloader); ok {
+		if reloadOn, err = c.signals(optionReloadSignal, ""); err != nil {
+			return err
+		}
+	}
+	if len(ignore) > 0 {
+		signal.Ignore(ignore...)
+	}
+
+	cleanupTmp, err := c.preparePrivateTmp()
+	if err != nil {
+		return err
+	}
+	defer cleanupTmp()
+	stopQuota, err := c.startQuota(s)
+	if err != nil {
+		return err
+	}
+	defer stopQuota()
+
+	err = c.startProgram(i, s)
+	if err != nil {
+		return err
+	}
+	stopFirstRun := c.startFirstRun(i, s)
+	stopWatchdog := c.startWatchdog(i, s)
+	if err := notifyReady(i); err != nil {
+		if logger, _ := s.Logger(nil); logger != nil {
+			logger.Error(err)
+		}
+	}
+
+	wait := c.Option.funcSingle(optionRunWait, func() {
+		var sigChan = make(chan os.Signal, 3)
+		signal.Notify(sigChan, stop...)
+		defer signal.Stop(sigChan)
+		var reloadChan = make(chan os.Signal, 1)
+		if len(reloadOn) > 0 {
+			signal.Notify(reloadChan, reloadOn...)
+			defer signal.Stop(reloadChan)
+		}
+		for {
+			select {
+			case <-sigChan:
+				return
+			case <-reloadChan:
+				reload(i, s)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	if ctx.Done() == nil {
+		wait()
+	} else {
+		// A RunWait function knows nothing of ctx and is left waiting.
+		waited := make(chan struct{})
+		go func() {
+			wait()
+			close(waited)
+		}()
+		select {
+		case <-waited:
+		case <-ctx.Done():
+		}
+	}
+
+	stopWatchdog()
+	stopFirstRun()
+	shutdown := false
+	if _, ok := i.(Shutdowner); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownCheckTimeout)
+		shutdown = shuttingDown(ctx)
+		cancel()
+	}
+	return c.stopProgram(i, s, shutdown)
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalsOption(t *testing.T) {
+	c := &Config{Option: KeyValue{optionIgnoreSignals: "hup, SIGUSR1"}}
+	stop, err := c.signals(optionStopSignals, optionStopSignalsDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []os.Signal{syscall.SIGTERM, syscall.SIGINT}; !reflect.DeepEqual(stop, want) {
+		t.Errorf("StopSignals = %v, want %v", stop, want)
+	}
+	ignore, err := c.signals(optionIgnoreSignals, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []os.Signal{syscall.SIGHUP, syscall.SIGUSR1}; !reflect.DeepEqual(ignore, want) {
+		t.Errorf("IgnoreSignals = %v, want %v", ignore, want)
+	}
+
+	c.Option[optionStopSignals] = "TERM,BOGUS"
+	if _, err := c.signals(optionStopSignals, optionStopSignalsDefault); err == nil {
+		t.Error("unknown signal accepted")
+	}
+	for _, empty := range []string{"", " , "} {
+		c.Option[optionStopSignals] = empty
+		if _, err := c.stopSignals(); err == nil {
+			t.Errorf("StopSignals %q accepted", empty)
+		}
+	}
+}
+
+type shutdownProgram struct {
+	called string
+}
+
+func (p *shutdownProgram) Start(s Service) error    { return nil }
+func (p *shutdownProgram) Stop(s Service) error     { p.called = "Stop"; return nil }
+func (p *shutdownProgram) Shutdown(s Service) error { p.called = "Shutdown"; return nil }
+
+// stopOnlyProgram can only be stopped.
+type stopOnlyProgram struct{}
+
+func (stopOnlyProgram) Start(s Service) error { return nil }
+func (stopOnlyProgram) Stop(s Service) error  { return nil }
+
+func TestRunUntilSignalShutdown(t *testing.T) {
+	defer func(f func(context.Context) bool) { shuttingDown = f }(shuttingDown)
+	c := &Config{Option: KeyValue{optionRunWait: func() {}}}
+	s := loggingService{logger: &recordingLogger{}}
+	for _, down := range []bool{false, true} {
+		shuttingDown = func(ctx context.Context) bool {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("shutdown checked without a deadline")
+			}
+			return down
+		}
+		p := &shutdownProgram{}
+		if err := c.runUntilSignal(context.Background(), p, s); err != nil {
+			t.Fatal(err)
+		}
+		want := "Stop"
+		if down {
+			want = "Shutdown"
+		}
+		if p.called != want {
+			t.Errorf("shutting down %v: %s called, want %s", down, p.called, want)
+		}
+	}
+
+	// Programs that cannot be shut down are stopped without checking.
+	shuttingDown = func(context.Context) bool {
+		t.Error("shutdown checked for a program without Shutdown")
+		return true
+	}
+	if err := c.runUntilSignal(context.Background(), stopOnlyProgram{}, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunUntilSignalContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	c := &Config{Option: KeyValue{optionRunWait: func() { <-block }}}
+	s := loggingService{logger: &recordingLogger{}}
+	p := &shutdownProgram{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.runUntilSignal(ctx, p, s); err != nil {
+		t.Fatal(err)
+	}
+	if p.called != "Stop" {
+		t.Errorf("%q called once ctx was done, want Stop", p.called)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := runContext(ctx, "sleep", "10"); err != context.DeadlineExceeded {
+		t.Errorf("runContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("runContext returned after %v, want sleep killed", d)
+	}
+}
+
+func TestSignalGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "pid")
+	cmd := exec.Command("sh", "-c", "sleep 60 & echo $! > "+pidFile+"; wait")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var child int
+	for i := 0; i < 200 && child == 0; i++ {
+		b, _ := ioutil.ReadFile(pidFile)
+		child, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if child == 0 {
+		t.Fatal("shell did not start its child")
+	}
+	if err := signalGroup(cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	for i := 0; i < 200; i++ {
+		if syscall.Kill(child, 0) != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	syscall.Kill(child, syscall.SIGKILL)
+	t.Error("child of the process group leader not signalled")
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package service
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogHandler returns a slog.Handler writing the records to l, usually
+// the logger of a service, so that a log/slog Logger writes to the system
+// logger. Records at or above slog.LevelError are errors, at or above
+// slog.LevelWarn warnings and the others information. The attributes are
+// passed as key/value pairs, see StructuredLogger, with the keys of groups
+// prefixed by the group name and a dot. Only opts.Level is used; without
+// it, records below slog.LevelInfo are dropped.
+//
+// Loggers of other packages that have a bridge to slog, such as zap and
+// logrus, write to the system logger through the handler as well.
+func NewSlogHandler(l Logger, opts *slog.HandlerOptions) slog.Handler {
+	h := &slogHandler{l: Structured(l)}
+	if opts != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+type slogHandler struct {
+	l      StructuredLogger
+	level  slog.Leveler
+	attrs  []interface{}
+	prefix string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := slog.LevelInfo
+	if h.level != nil {
+		min = h.level.Level()
+	}
+	return level >= min
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	kvs := append([]interface{}(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		kvs = appendAttr(kvs, h.prefix, a)
+		return true
+	})
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.l.Errorw(r.Message, kvs...)
+	case r.Level >= slog.LevelWarn:
+		return h.l.Warningw(r.Message, kvs...)
+	default:
+		return h.l.Infow(r.Message, kvs...)
+	}
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]interface{}(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.prefix, a)
+	}
+	return &c
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// appendAttr appends a as key/value pairs to kvs, flattening groups.
+func appendAttr(kvs []interface{}, prefix string, a slog.Attr) []interface{} {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			kvs = appendAttr(kvs, prefix, ga)
+		}
+		return kvs
+	}
+	if a.Key == "" {
+		return kvs
+	}
+	return append(kvs, prefix+a.Key, v.String())
+}
@@ -0,0 +1,37 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	rl := &recordLogger{}
+	log := slog.New(NewSlogHandler(rl, nil)).With("service", "agent")
+	log.Debug("dropped")
+	log.Info("started", "pid", 7)
+	log.WithGroup("http").Warn("slow", slog.Group("req", "path", "/"), "ms", 250)
+	log.Error("stopped", "err", fmt.Errorf("exit status 1"))
+	want := []string{
+		`I: started service=agent pid=7`,
+		`W: slow service=agent http.req.path=/ http.ms=250`,
+		`E: stopped service=agent err="exit status 1"`,
+	}
+	if fmt.Sprint(rl.entries) != fmt.Sprint(want) {
+		t.Errorf("entries = %q, want %q", rl.entries, want)
+	}
+
+	rl.entries = nil
+	slog.New(NewSlogHandler(rl, &slog.HandlerOptions{Level: slog.LevelDebug})).Debug("kept")
+	if len(rl.entries) != 1 || rl.entries[0] != "I: kept" {
+		t.Errorf("entries = %q, want the debug record", rl.entries)
+	}
+}
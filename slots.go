@@ -0,0 +1,209 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Slots keeps two copies of a program, in the slots "a" and "b", so that a
+// new version can be written next to the running one and the previous
+// version restored if the new one fails. The program of slot "a" is at
+// Dir/a/Name. The active slot is recorded in Dir/slots.json.
+type Slots struct {
+	Dir  string // Directory holding the slots.
+	Name string // File name of the program, such as "agent" or "agent.exe".
+}
+
+// SlotState is the state of Slots.
+type SlotState struct {
+	Active   string    // Slot of the program to run, "a" or "b".
+	Previous string    // Slot active before the last update or revert, if any.
+	Switched time.Time // Time the active slot last changed.
+	Reverted bool      // The active slot changed by Revert rather than Update.
+
+	Versions map[string]string // Version of the program in each slot, if known.
+	Channel  string            // Release channel followed by updates, if any.
+	Pin      string            // Version updates are restricted to, if any.
+}
+
+// Version returns the version of the program in the active slot, if known.
+func (st SlotState) Version() string {
+	return st.Versions[st.Active]
+}
+
+var errNoSlots = errors.New("slots: not installed")
+
+func (sl Slots) statePath() string {
+	return filepath.Join(sl.Dir, "slots.json")
+}
+
+// Path returns the path of the program in slot.
+func (sl Slots) Path(slot string) string {
+	return filepath.Join(sl.Dir, slot, sl.Name)
+}
+
+// State returns the state of the slots.
+func (sl Slots) State() (SlotState, error) {
+	var st SlotState
+	b, err := ioutil.ReadFile(sl.statePath())
+	if os.IsNotExist(err) {
+		return st, errNoSlots
+	}
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(b, &st)
+	return st, err
+}
+
+// Exec returns the path of the program in the active slot.
+func (sl Slots) Exec() (string, error) {
+	st, err := sl.State()
+	if err != nil {
+		return "", err
+	}
+	return sl.Path(st.Active), nil
+}
+
+// Install writes the program read from r, of the given version if known,
+// to slot "a" and makes it active. An error is returned if the slots are
+// installed already.
+func (sl Slots) Install(r io.Reader, version string) error {
+	if _, err := sl.State(); err != errNoSlots {
+		if err == nil {
+			err = newError(ErrAlreadyInstalled, Message(MsgAlreadyExists, sl.statePath()))
+		}
+		return err
+	}
+	if err := sl.write("a", r); err != nil {
+		return err
+	}
+	return sl.setState(SlotState{Active: "a", Switched: time.Now(), Versions: map[string]string{"a": version}})
+}
+
+// Update writes the program read from r, of the given version if known, to
+// the inactive slot and makes it active. The program running from the
+// previously active slot is not affected until it is restarted.
+func (sl Slots) Update(r io.Reader, version string) error {
+	st, err := sl.State()
+	if err != nil {
+		return err
+	}
+	next := "b"
+	if st.Active == "b" {
+		next = "a"
+	}
+	if err := sl.write(next, r); err != nil {
+		return err
+	}
+	st.Active, st.Previous = next, st.Active
+	st.Switched, st.Reverted = time.Now(), false
+	if st.Versions == nil {
+		st.Versions = map[string]string{}
+	}
+	st.Versions[next] = version
+	return sl.setState(st)
+}
+
+// Revert makes the previously active slot active again.
+func (sl Slots) Revert() error {
+	st, err := sl.State()
+	if err != nil {
+		return err
+	}
+	if st.Previous == "" {
+		return errors.New("slots: no previous slot to revert to")
+	}
+	st.Active, st.Previous = st.Previous, st.Active
+	st.Switched, st.Reverted = time.Now(), true
+	return sl.setState(st)
+}
+
+// Version returns the version of the program in the active slot, "" if
+// not known.
+func (sl Slots) Version() (string, error) {
+	st, err := sl.State()
+	return st.Version(), err
+}
+
+// Channel returns the release channel updates follow, "" for any.
+func (sl Slots) Channel() (string, error) {
+	st, err := sl.State()
+	return st.Channel, err
+}
+
+// SetChannel sets the release channel updates follow, "" for any.
+func (sl Slots) SetChannel(channel string) error {
+	st, err := sl.State()
+	if err != nil {
+		return err
+	}
+	st.Channel = channel
+	return sl.setState(st)
+}
+
+// Pin restricts updates to the given version, "" removes the restriction.
+func (sl Slots) Pin(version string) error {
+	st, err := sl.State()
+	if err != nil {
+		return err
+	}
+	st.Pin = version
+	return sl.setState(st)
+}
+
+// Uninstall removes the slots and their programs.
+func (sl Slots) Uninstall() error {
+	for _, p := range []string{sl.statePath(), filepath.Join(sl.Dir, "a"), filepath.Join(sl.Dir, "b")} {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the program read from r to slot, replacing the program in
+// it only once it is written completely.
+func (sl Slots) write(slot string, r io.Reader) error {
+	path := sl.Path(slot)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path+".new", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (sl Slots) setState(st SlotState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(sl.Dir, 0755); err != nil {
+		return err
+	}
+	tmp := sl.statePath() + ".new"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, sl.statePath())
+}
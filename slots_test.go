@@ -0,0 +1,62 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSlots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sl := Slots{Dir: dir, Name: "agent"}
+
+	if _, err := sl.Exec(); err == nil {
+		t.Error("Exec() succeeded before Install")
+	}
+	if err := sl.Install(strings.NewReader("v1"), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sl.Install(strings.NewReader("v1"), "1"); err == nil {
+		t.Error("second Install succeeded")
+	}
+	if err := sl.Update(strings.NewReader("v2"), "2"); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want string) {
+		t.Helper()
+		p, err := sl.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadFile(p); string(b) != want {
+			t.Errorf("active program %q, want %q", b, want)
+		}
+	}
+	check("v2")
+	if err := sl.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	check("v1")
+	if st, _ := sl.State(); !st.Reverted || st.Previous != "b" {
+		t.Errorf("state after Revert = %+v", st)
+	}
+	if err := sl.Update(strings.NewReader("v3"), "3"); err != nil {
+		t.Fatal(err)
+	}
+	check("v3")
+	if v, _ := sl.Version(); v != "3" {
+		t.Errorf("Version() = %q, want 3", v)
+	}
+	if err := sl.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// StatusCache is a Service that caches the result of Status for a short
+// time, so callers polling many services do not start a service manager
+// command for each query. StatusEx and Statuses are cached as well, the
+// latter querying the services of stale statuses together where the service
+// manager can. Control operations through the StatusCache clear the cached
+// status.
+type StatusCache struct {
+	Service
+	ttl time.Duration
+
+	mu       sync.Mutex
+	at       time.Time // When status was queried; zero if not cached.
+	info     StatusInfo
+	detailed bool // info holds the details of StatusEx, not only the status.
+	err      error
+}
+
+// NewStatusCache returns a StatusCache for s keeping a status for ttl.
+func NewStatusCache(s Service, ttl time.Duration) *StatusCache {
+	return &StatusCache{Service: s, ttl: ttl}
+}
+
+// Status returns the cached status, querying the service manager if it is
+// older than the ttl.
+func (c *StatusCache) Status() (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fresh() {
+		c.refresh(false)
+	}
+	return c.info.Status, c.err
+}
+
+// StatusEx returns the cached status with details, see StatusEx, querying
+// the service manager if it is older than the ttl or has no details.
+func (c *StatusCache) StatusEx() (StatusInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fresh() || !c.detailed {
+		c.refresh(true)
+	}
+	info := c.info
+	if !info.Started.IsZero() {
+		info.setStarted(info.Started)
+	}
+	return info, c.err
+}
+
+// ForceRefresh queries the service manager for the status regardless of the
+// cached status and caches the result.
+func (c *StatusCache) ForceRefresh() (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh(false)
+	return c.info.Status, c.err
+}
+
+// fresh reports whether the status is cached and younger than the ttl.
+// c.mu must be held.
+func (c *StatusCache) fresh() bool {
+	return !c.at.IsZero() && time.Since(c.at) < c.ttl
+}
+
+// refresh queries the status, with its details if detailed. c.mu must be
+// held.
+func (c *StatusCache) refresh(detailed bool) {
+	if detailed {
+		c.info, c.err = StatusEx(c.Service)
+	} else {
+		c.info = StatusInfo{}
+		c.info.Status, c.err = c.Service.Status()
+	}
+	c.detailed = detailed
+	c.at = time.Now()
+}
+
+// batchKey groups StatusCaches of services that can be queried together,
+// apart from the services themselves.
+func (c *StatusCache) batchKey() string {
+	if b, ok := c.Service.(statusBatcher); ok {
+		return "cache:" + b.batchKey()
+	}
+	return fmt.Sprintf("cache:%p", c)
+}
+
+// statuses returns the cached status of each of list, all StatusCaches,
+// querying the stale ones with Statuses.
+func (c *StatusCache) statuses(list []Service) []StatusResult {
+	results := make([]StatusResult, len(list))
+	var stale []int
+	var services []Service
+	for i, s := range list {
+		sc := s.(*StatusCache)
+		sc.mu.Lock()
+		if sc.fresh() {
+			results[i] = StatusResult{sc.info.Status, sc.err}
+		} else {
+			stale = append(stale, i)
+			services = append(services, sc.Service)
+		}
+		sc.mu.Unlock()
+	}
+	for j, r := range Statuses(services...) {
+		i := stale[j]
+		sc := list[i].(*StatusCache)
+		sc.mu.Lock()
+		sc.info, sc.err = StatusInfo{Status: r.Status}, r.Err
+		sc.detailed = false
+		sc.at = time.Now()
+		sc.mu.Unlock()
+		results[i] = r
+	}
+	return results
+}
+
+// Invalidate clears the cached status, for changes made other than through
+// c.
+func (c *StatusCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.at = time.Time{}
+}
+
+// control runs the control operation f and clears the cached status, which
+// f likely changed even if it failed.
+func (c *StatusCache) control(f func() error) error {
+	defer c.Invalidate()
+	return f()
+}
+
+func (c *StatusCache) Start() error     { return c.control(c.Service.Start) }
+func (c *StatusCache) Stop() error      { return c.control(c.Service.Stop) }
+func (c *StatusCache) Restart() error   { return c.control(c.Service.Restart) }
+func (c *StatusCache) Install() error   { return c.control(c.Service.Install) }
+func (c *StatusCache) Uninstall() error { return c.control(c.Service.Uninstall) }
+
+// Mask masks the cached Service, see Mask.
+func (c *StatusCache) Mask() error {
+	return c.control(func() error { return Mask(c.Service) })
+}
+
+// Unmask unmasks the cached Service, see Unmask.
+func (c *StatusCache) Unmask() error {
+	return c.control(func() error { return Unmask(c.Service) })
+}
+
+// StopFor stops the cached Service for d, see StopFor.
+func (c *StatusCache) StopFor(d time.Duration) error {
+	return c.control(func() error { return StopFor(c.Service, d) })
+}
+
+// Signal signals the processes of the cached Service, see Signal.
+func (c *StatusCache) Signal(sig os.Signal) error {
+	return Signal(c.Service, sig)
+}
+
+// Capabilities returns the capabilities of the cached Service.
+func (c *StatusCache) Capabilities() Capability {
+	return Capabilities(c.Service)
+}
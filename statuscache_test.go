@@ -0,0 +1,115 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// countingService is a Service counting Status queries.
+type countingService struct {
+	Service
+	queries int
+	status  Status
+}
+
+func (s *countingService) Status() (Status, error) {
+	s.queries++
+	return s.status, nil
+}
+
+func (s *countingService) Stop() error {
+	s.status = StatusStopped
+	return nil
+}
+
+func TestStatusCache(t *testing.T) {
+	s := &countingService{status: StatusRunning}
+	c := NewStatusCache(s, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if st, _ := c.Status(); st != StatusRunning {
+			t.Fatalf("Status() = %v, want %v", st, StatusRunning)
+		}
+	}
+	if s.queries != 1 {
+		t.Errorf("%d queries, want 1", s.queries)
+	}
+
+	c.Stop()
+	if st, _ := c.Status(); st != StatusStopped {
+		t.Errorf("Status() after Stop = %v, want %v", st, StatusStopped)
+	}
+	c.ForceRefresh()
+	if s.queries != 3 {
+		t.Errorf("%d queries, want 3", s.queries)
+	}
+
+	c = NewStatusCache(s, 0)
+	c.Status()
+	c.Status()
+	if s.queries != 5 {
+		t.Errorf("%d queries without caching, want 5", s.queries)
+	}
+}
+
+func TestStatusCacheMask(t *testing.T) {
+	c := NewStatusCache(&countingService{status: StatusStopped}, time.Minute)
+	if err := Mask(c); err != ErrNotSupported {
+		t.Errorf("Mask = %v, want ErrNotSupported", err)
+	}
+}
+
+// batchService is a Service reporting details and queried in batches.
+type batchService struct {
+	countingService
+	batches *int
+}
+
+func (s *batchService) StatusEx() (StatusInfo, error) {
+	s.queries++
+	return StatusInfo{Status: s.status, PID: 42}, nil
+}
+
+func (s *batchService) batchKey() string { return "batch" }
+
+func (s *batchService) statuses(list []Service) []StatusResult {
+	*s.batches++
+	results := make([]StatusResult, len(list))
+	for i, l := range list {
+		results[i].Status = l.(*batchService).status
+	}
+	return results
+}
+
+func TestStatusCacheForwards(t *testing.T) {
+	var batches int
+	a := &batchService{countingService{status: StatusRunning}, &batches}
+	b := &batchService{countingService{status: StatusStopped}, &batches}
+	ca, cb := NewStatusCache(a, time.Hour), NewStatusCache(b, time.Hour)
+
+	info, err := StatusEx(ca)
+	if err != nil || info.PID != 42 || info.Status != StatusRunning {
+		t.Errorf("StatusEx = %+v, %v, want the details of the service", info, err)
+	}
+	StatusEx(ca)
+	if a.queries != 1 {
+		t.Errorf("%d StatusEx queries, want 1", a.queries)
+	}
+
+	for i := 0; i < 2; i++ {
+		got := Statuses(ca, cb)
+		if got[0].Status != StatusRunning || got[1].Status != StatusStopped {
+			t.Errorf("Statuses = %v", got)
+		}
+	}
+	if batches != 1 || a.queries != 1 || b.queries != 0 {
+		t.Errorf("%d batches and %d, %d queries, want the stale status queried in one batch", batches, a.queries, b.queries)
+	}
+	if st, _ := cb.Status(); st != StatusStopped || b.queries != 0 {
+		t.Errorf("Status = %v after %d queries, want the status cached by Statuses", st, b.queries)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// StatusResult is the status of one of the services queried by Statuses.
+type StatusResult struct {
+	Status Status
+	Err    error
+}
+
+// statusBatcher is implemented by services whose service manager can report
+// the status of several services with a single query.
+type statusBatcher interface {
+	// batchKey identifies the services that can be queried together.
+	batchKey() string
+	// statuses returns the status of each of list, which all have the
+	// batch key of the receiver.
+	statuses(list []Service) []StatusResult
+}
+
+// Statuses returns the status of each of services, as Status would. Services
+// of service managers able to, such as systemd, are queried together with a
+// single command rather than a command each, which matters to agents
+// watching many services.
+func Statuses(services ...Service) []StatusResult {
+	results := make([]StatusResult, len(services))
+	batches := map[string][]int{}
+	var keys []string
+	for i, s := range services {
+		b, ok := s.(statusBatcher)
+		if !ok {
+			results[i].Status, results[i].Err = s.Status()
+			continue
+		}
+		k := b.batchKey()
+		if _, found := batches[k]; !found {
+			keys = append(keys, k)
+		}
+		batches[k] = append(batches[k], i)
+	}
+	for _, k := range keys {
+		idx := batches[k]
+		list := make([]Service, len(idx))
+		for j, i := range idx {
+			list[j] = services[i]
+		}
+		for j, r := range services[idx[0]].(statusBatcher).statuses(list) {
+			results[idx[j]] = r
+		}
+	}
+	return results
+}
@@ -0,0 +1,19 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+func TestStatusesFallback(t *testing.T) {
+	a := &countingService{status: StatusRunning}
+	b := &countingService{status: StatusStopped}
+	got := Statuses(a, b)
+	if len(got) != 2 || got[0].Status != StatusRunning || got[1].Status != StatusStopped {
+		t.Errorf("Statuses() = %v", got)
+	}
+	if a.queries != 1 || b.queries != 1 {
+		t.Errorf("queries = %d, %d, want 1 each", a.queries, b.queries)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "time"
+
+// StatusInfo is the status of a service with details on its process.
+// Details the service manager does not report are left zero.
+type StatusInfo struct {
+	Status   Status
+	PID      int           // Process of the running service.
+	Started  time.Time     // Start of the running service.
+	Uptime   time.Duration // Time since Started.
+	ExitCode int           // Exit code of the last run that ended.
+	Restarts int           // Automatic restarts since the service was started.
+	Health   Health        // Health of the program, as reported by a Supervisor under systemd.
+}
+
+// StatusExer is implemented by the services of the service managers that
+// report details on the process of a service.
+type StatusExer interface {
+	StatusEx() (StatusInfo, error)
+}
+
+// StatusEx returns the status of s with details on its process. Services of
+// service managers that do not report details only fill in Status.
+func StatusEx(s Service) (StatusInfo, error) {
+	if se, ok := s.(StatusExer); ok {
+		return se.StatusEx()
+	}
+	st, err := s.Status()
+	return StatusInfo{Status: st}, err
+}
+
+// setStarted sets the start of the running service and its uptime.
+func (si *StatusInfo) setStarted(t time.Time) {
+	si.Started = t
+	si.Uptime = time.Since(t)
+}
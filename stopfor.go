@@ -0,0 +1,96 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"text/template"
+	"time"
+	"unicode/utf16"
+)
+
+// StopScheduler is implemented by the services of the service managers that
+// support CapStopFor.
+type StopScheduler interface {
+	// StopFor stops the service and has the service manager start it
+	// again after d, so a service stopped for maintenance is not left
+	// stopped. Starting the service earlier does not cancel the start.
+	StopFor(d time.Duration) error
+}
+
+// StopFor stops s for d, see StopScheduler. It returns ErrNotSupported if
+// the service manager of s cannot schedule the start.
+func StopFor(s Service, d time.Duration) error {
+	if st, ok := s.(StopScheduler); ok {
+		return st.StopFor(d)
+	}
+	return ErrNotSupported
+}
+
+// resumeName is the name of the timer or task starting service after
+// StopFor.
+func resumeName(service string) string {
+	return service + "-resume"
+}
+
+// resumeTask is the scheduled task starting a Windows service after StopFor,
+// once, as the local system account. The task deletes itself once expired.
+var resumeTask = template.Must(template.New("").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b bytes.Buffer
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>Starts {{.Name|xml}} after a maintenance stop.</Description>
+  </RegistrationInfo>
+  <Triggers>
+    <TimeTrigger>
+      <StartBoundary>{{.At.Format "2006-01-02T15:04:05-07:00"}}</StartBoundary>
+      <EndBoundary>{{.Expires.Format "2006-01-02T15:04:05-07:00"}}</EndBoundary>
+    </TimeTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <UserId>S-1-5-18</UserId>
+      <RunLevel>HighestAvailable</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <DeleteExpiredTaskAfter>PT0S</DeleteExpiredTaskAfter>
+    <StartWhenAvailable>true</StartWhenAvailable>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>%SystemRoot%\System32\sc.exe</Command>
+      <Arguments>start "{{.Name|xml}}"</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`))
+
+// resumeTaskXML returns the definition of the task starting service at at,
+// in UTF-16 as schtasks expects.
+func resumeTaskXML(service string, at time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	err := resumeTask.Execute(&b, struct {
+		Name        string
+		At, Expires time.Time
+	}{service, at, at.Add(time.Hour)})
+	if err != nil {
+		return nil, err
+	}
+	u := utf16.Encode([]rune("\ufeff" + b.String()))
+	out := make([]byte, 0, 2*len(u))
+	for _, c := range u {
+		out = append(out, byte(c), byte(c>>8))
+	}
+	return out, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestResumeTaskXML(t *testing.T) {
+	at := time.Date(2026, 3, 1, 2, 30, 0, 0, time.FixedZone("", -5*3600))
+	b, err := resumeTaskXML("a&b", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b)%2 != 0 || b[0] != 0xff || b[1] != 0xfe {
+		t.Fatalf("task not in UTF-16LE with a byte order mark: % x", b[:4])
+	}
+	u := make([]uint16, len(b)/2)
+	for k := range u {
+		u[k] = uint16(b[2*k]) | uint16(b[2*k+1])<<8
+	}
+	task := string(utf16.Decode(u[1:]))
+	for _, want := range []string{
+		"<StartBoundary>2026-03-01T02:30:00-05:00</StartBoundary>",
+		"<EndBoundary>2026-03-01T03:30:00-05:00</EndBoundary>",
+		`<Arguments>start "a&amp;b"</Arguments>`,
+	} {
+		if !strings.Contains(task, want) {
+			t.Errorf("task lacks %s:\n%s", want, task)
+		}
+	}
+	d := xml.NewDecoder(strings.NewReader(task))
+	d.CharsetReader = func(charset string, r io.Reader) (io.Reader, error) { return r, nil }
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("task is not well-formed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StructuredLogger is a Logger also taking key/value pairs with a message,
+// as in Infow("listening", "port", 8080). A system logger that keeps fields
+// with its entries, such as the JournalLogger, writes them as fields.
+type StructuredLogger interface {
+	Logger
+
+	Errorw(msg string, keysAndValues ...interface{}) error
+	Warningw(msg string, keysAndValues ...interface{}) error
+	Infow(msg string, keysAndValues ...interface{}) error
+}
+
+// Structured returns l as a StructuredLogger. The key/value pairs are
+// appended to the message as key=value if l does not implement
+// StructuredLogger itself.
+func Structured(l Logger) StructuredLogger {
+	if sl, ok := l.(StructuredLogger); ok {
+		return sl
+	}
+	return structuredLogger{l}
+}
+
+type structuredLogger struct {
+	Logger
+}
+
+func (l structuredLogger) Errorw(msg string, keysAndValues ...interface{}) error {
+	return l.Error(formatKeyValues(msg, keysAndValues))
+}
+func (l structuredLogger) Warningw(msg string, keysAndValues ...interface{}) error {
+	return l.Warning(formatKeyValues(msg, keysAndValues))
+}
+func (l structuredLogger) Infow(msg string, keysAndValues ...interface{}) error {
+	return l.Info(formatKeyValues(msg, keysAndValues))
+}
+
+// badKey is the key of a value passed without one, as log/slog names it.
+const badKey = "!BADKEY"
+
+// keyValues returns the pairs of keysAndValues as strings. A value in the
+// place of a key that is not a string gets badKey.
+func keyValues(keysAndValues []interface{}) [][2]string {
+	var kvs [][2]string
+	for len(keysAndValues) > 0 {
+		k, ok := keysAndValues[0].(string)
+		if !ok || len(keysAndValues) == 1 {
+			kvs = append(kvs, [2]string{badKey, fmt.Sprint(keysAndValues[0])})
+			keysAndValues = keysAndValues[1:]
+			continue
+		}
+		kvs = append(kvs, [2]string{k, fmt.Sprint(keysAndValues[1])})
+		keysAndValues = keysAndValues[2:]
+	}
+	return kvs
+}
+
+// formatKeyValues appends the key/value pairs to msg as key=value, quoting
+// the values that are empty or contain spaces, quotes or equal signs.
+func formatKeyValues(msg string, keysAndValues []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, kv := range keyValues(keysAndValues) {
+		b.WriteByte(' ')
+		b.WriteString(kv[0])
+		b.WriteByte('=')
+		if kv[1] == "" || strings.ContainsAny(kv[1], " \t\n\"=") {
+			b.WriteString(strconv.Quote(kv[1]))
+		} else {
+			b.WriteString(kv[1])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordLogger records the entries logged to it, with their level.
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordLogger) log(level string, msg string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, level+": "+msg)
+	return nil
+}
+
+// text returns the entries, one per line.
+func (l *recordLogger) text() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.entries, "\n")
+}
+
+func (l *recordLogger) Error(v ...interface{}) error   { return l.log("E", fmt.Sprint(v...)) }
+func (l *recordLogger) Warning(v ...interface{}) error { return l.log("W", fmt.Sprint(v...)) }
+func (l *recordLogger) Info(v ...interface{}) error    { return l.log("I", fmt.Sprint(v...)) }
+func (l *recordLogger) Errorf(format string, a ...interface{}) error {
+	return l.log("E", fmt.Sprintf(format, a...))
+}
+func (l *recordLogger) Warningf(format string, a ...interface{}) error {
+	return l.log("W", fmt.Sprintf(format, a...))
+}
+func (l *recordLogger) Infof(format string, a ...interface{}) error {
+	return l.log("I", fmt.Sprintf(format, a...))
+}
+
+func TestStructured(t *testing.T) {
+	rl := &recordLogger{}
+	l := Structured(rl)
+	l.Infow("listening", "port", 8080, "addr", "")
+	l.Warningw("slow", "took", "1.5 s", "path", `a"b`)
+	l.Errorw("failed", 42, "dangling")
+	want := []string{
+		`I: listening port=8080 addr=""`,
+		`W: slow took="1.5 s" path="a\"b"`,
+		`E: failed !BADKEY=42 !BADKEY=dangling`,
+	}
+	if fmt.Sprint(rl.entries) != fmt.Sprint(want) {
+		t.Errorf("entries = %q, want %q", rl.entries, want)
+	}
+	if Structured(l) != l {
+		t.Error("Structured wraps a StructuredLogger")
+	}
+}
@@ -0,0 +1,808 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// SupervisorConfig describes a program run by a Supervisor. It is usually
+// loaded from a JSON file with LoadSupervisorConfig, for example:
+//
+//	{
+//		"Name": "builder",
+//		"Exec": "/usr/local/bin/builder",
+//		"Args": ["-v"],
+//		"Env": ["HOME=/var/lib/builder"],
+//		"Stdout": "/var/log/builder.log",
+//		"Restart": "on-failure"
+//	}
+type SupervisorConfig struct {
+	Name, DisplayName, Description string
+
+	// Namespace, if set, is the Namespace option of the service, and the
+	// file name of the ControlSocket is put in it, see NamespacedPath.
+	Namespace string
+
+	Dir  string   // Working directory of the program.
+	Exec string   // Program to run, looked up in PATH if not a path.
+	Args []string // Arguments passed to the program.
+	Env  []string // Variables in KEY=VALUE form added to the environment.
+
+	// ScrubEnv lists variables removed from the environment the program
+	// inherits from the supervisor, by name or shell pattern such as
+	// "*_TOKEN", compared without regard to case. Env is kept as is.
+	ScrubEnv []string
+
+	Stderr, Stdout string // Files the output is appended to; discarded if empty.
+
+	// LogRotate, if set, rotates the Stderr and Stdout files, so the output
+	// of a program that crashed is kept without the files growing unbounded.
+	LogRotate *LogRotate
+
+	// ControlSocket is the path of a unix socket operators can use to attach
+	// to the program's standard input and output, see Attach. The socket is
+	// only accessible to the owner of the supervisor process and root,
+	// which is checked by the credentials of the connecting process where
+	// the system passes them (Linux, macOS and FreeBSD).
+	ControlSocket string
+
+	// ControlUsers and ControlGroups are the ids of further users and
+	// groups allowed to use the control socket, which is then accessible
+	// to all users and only checked by their credentials. Systems that do
+	// not pass credentials refuse them.
+	ControlUsers  []int
+	ControlGroups []int
+
+	// ControlToken, if set, is the path of a file holding a token clients
+	// have to present as well, see AttachWithToken.
+	ControlToken string
+
+	// ControlRateLimit is the number of commands each user may send to the
+	// control socket per minute, 60 if zero; a negative value disables the
+	// limit. Allowed and denied commands are logged with their user and
+	// process for auditing.
+	ControlRateLimit int
+
+	// LeaderLock, if set, is the path of a lock file on storage shared by
+	// the instances of an active/standby pair. The program only runs while
+	// the supervisor holds the lock, and is stopped for the other instance
+	// to take over when the lock is lost, see FileLocker.
+	LeaderLock string
+
+	// WarmStandby starts the program in standby, with SERVICE_STANDBY=1 in
+	// its environment, for it to load its state without serving. It is made
+	// active by the "promote" control command, see Promote, which sends it
+	// SIGUSR2; it is restarted without the variable from then on. Not
+	// supported on windows.
+	WarmStandby bool
+
+	// StopTimeout is how long Stop waits for the program to exit after
+	// asking it to, time.Duration string ("10s"). The program is killed
+	// then, on unix with the processes it started in its process group.
+	StopTimeout string
+
+	Restart       string // RestartNever, RestartOnFailure (default) or RestartAlways.
+	RestartDelay  string // Delay before restarting, time.Duration string ("1s").
+	RestartLimit  int    // Restarts allowed within RestartWindow before giving up (5).
+	RestartWindow string // Period for RestartLimit, time.Duration string ("1m").
+
+	// Slots, if set, is the directory of the Slots holding the program, with
+	// Exec as the file name of the program in the slots. If the program
+	// restarts more than RestartLimit times within Probation after an update
+	// the previous slot is made active again and the program restarted.
+	Slots     string
+	Probation string // time.Duration string ("10m").
+
+	// Maintenance, if set, is the path of a MaintenanceCalendar file. The
+	// program is only restarted automatically when the calendar allows.
+	Maintenance string
+
+	// SafeMode, if set, runs the program in a safe mode once it restarted
+	// more than RestartLimit times instead of giving up, so a minimal
+	// diagnostic workload keeps reporting. The supervisor gives up if the
+	// program restarts too often in safe mode as well.
+	SafeMode *SafeMode
+
+	// Listen enables socket activation: the supervisor listens on these
+	// addresses, such as "tcp://:8080" or "unix:///run/builder.sock", and
+	// starts the program on demand when the first connection arrives. The
+	// program receives the listening sockets as file descriptors 3 and up with
+	// LISTEN_FDS set, as with systemd socket activation, and is started again
+	// on the next connection after it exits.
+	Listen []string
+
+	// Accept starts one instance of the program per connection instead, with
+	// the connection as its standard input and output and REMOTE_ADDR set.
+	Accept         bool
+	MaxConnections int // Instances allowed to run at once with Accept (64).
+
+	// IdleTimeout stops a program started on demand after no connection
+	// arrived for this long, time.Duration string ("5m"). The program should
+	// finish in-flight work when asked to stop; long lived connections do not
+	// count as activity.
+	IdleTimeout string
+
+	// PostExit are commands run by /bin/sh -c, or cmd /C on Windows, after
+	// each exit of the program, for cleanup such as releasing a DHCP lease,
+	// before it is restarted. They run in Dir with the environment of the
+	// program and, as systemd sets for ExecStopPost, EXIT_CODE set to
+	// "exited", "killed" or "dumped" and EXIT_STATUS to the exit status or
+	// the name of the signal, such as "TERM". Their errors are logged.
+	PostExit []string
+
+	// HealthCheck, if set, checks the health of the program while it runs,
+	// reported by Health and, under systemd, StatusEx. With the Notify
+	// option the service is started once the program is healthy. It is not
+	// supported with Listen.
+	HealthCheck *HealthCheck
+}
+
+// SafeMode describes how a supervised program is run in safe mode.
+type SafeMode struct {
+	Args []string // Arguments replacing Args.
+	Env  []string // Variables added to Env, such as "SAFE_MODE=1".
+}
+
+// LoadSupervisorConfig reads a SupervisorConfig from the JSON file at path.
+func LoadSupervisorConfig(path string) (*SupervisorConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &SupervisorConfig{}
+	if err := json.NewDecoder(f).Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, c.validate()
+}
+
+func (c *SupervisorConfig) validate() error {
+	if c.Exec == "" {
+		return errors.New("supervisor: Exec field is required")
+	}
+	switch c.Restart {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("supervisor: unknown Restart policy %q", c.Restart)
+	}
+	if len(c.Listen) > 0 && c.LeaderLock != "" {
+		return errors.New("supervisor: LeaderLock is not supported with Listen")
+	}
+	if c.WarmStandby && (len(c.Listen) > 0 || c.LeaderLock != "") {
+		return errors.New("supervisor: WarmStandby is not supported with Listen or LeaderLock")
+	}
+	if c.WarmStandby && runtime.GOOS == "windows" {
+		return errors.New("supervisor: WarmStandby is not supported on windows")
+	}
+	if len(c.Listen) > 0 && !c.Accept && runtime.GOOS == "windows" {
+		return errors.New("supervisor: Listen without Accept is not supported on windows")
+	}
+	if c.LogRotate != nil {
+		if err := c.LogRotate.validate(); err != nil {
+			return err
+		}
+	}
+	if c.HealthCheck != nil {
+		if len(c.Listen) > 0 {
+			return errors.New("supervisor: HealthCheck is not supported with Listen")
+		}
+		if err := c.HealthCheck.validate(); err != nil {
+			return err
+		}
+	}
+	for _, a := range c.Listen {
+		if _, _, err := listenAddress(a); err != nil {
+			return fmt.Errorf("supervisor: %v", err)
+		}
+	}
+	for _, d := range []string{c.StopTimeout, c.RestartDelay, c.RestartWindow, c.IdleTimeout, c.Probation} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("supervisor: %v", err)
+		}
+	}
+	return nil
+}
+
+// ServiceConfig returns the Config used to install the supervisor itself as
+// a service.
+func (c *SupervisorConfig) ServiceConfig() *Config {
+	conf := &Config{
+		Name:        c.Name,
+		DisplayName: c.DisplayName,
+		Description: c.Description,
+	}
+	if c.Namespace != "" {
+		conf.Option = KeyValue{optionNamespace: c.Namespace}
+	}
+	return conf
+}
+
+func duration(s string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	return defaultValue
+}
+
+// Supervisor is an Interface that runs another program as the workload of
+// the service. It allows programs that know nothing about service managers
+// to be installed and controlled as services: the program's output is
+// captured to files, the program is restarted according to the restart
+// policy and stopped when the service stops.
+type Supervisor struct {
+	*SupervisorConfig
+
+	// Locker, if set, replaces the file lock of LeaderLock, to elect the
+	// instance running the program with another service.
+	Locker Locker
+
+	// HealthChecker, if set, replaces the check of HealthCheck, whose
+	// timing is used if set.
+	HealthChecker HealthChecker
+
+	service  Service
+	logger   Logger
+	calendar *MaintenanceCalendar
+
+	console      console
+	control      net.Listener
+	controlToken string
+	controlLimit *rateLimiter
+
+	mu        sync.Mutex
+	child     *child
+	conns     map[*child]struct{}      // Per connection instances with Accept.
+	outputs   map[string]*rotatingFile // Output files with LogRotate, by path.
+	listeners []net.Listener
+	sockets   []*os.File // Watched for connections to start on demand.
+	stopping  bool
+	standby   bool      // Waiting for the leader lock, or stopping after losing it.
+	promoted  bool      // Made active with WarmStandby.
+	resumeAt  time.Time // Start of the program stopped by StopFor.
+	safeMode  bool
+	health    Health
+	ready     bool          // Readiness was reported to the service manager.
+	stop      chan struct{} // Closed by Stop.
+	done      chan struct{} // Closed when the program ended for good.
+	restarts  []time.Time
+}
+
+// NewSupervisor returns a Supervisor running the program described by c.
+func NewSupervisor(c *SupervisorConfig) *Supervisor {
+	return &Supervisor{SupervisorConfig: c}
+}
+
+// Start starts the program. An error is returned if the program cannot be
+// started at all; later exits are handled by the restart policy.
+func (sv *Supervisor) Start(s Service) error {
+	if err := sv.validate(); err != nil {
+		return err
+	}
+	if len(sv.Listen) > 0 && sv.Locker != nil {
+		return errors.New("supervisor: Locker is not supported with Listen")
+	}
+	if len(sv.Listen) > 0 && sv.HealthChecker != nil {
+		return errors.New("supervisor: HealthChecker is not supported with Listen")
+	}
+	sv.service = s
+	sv.logger, _ = s.Logger(nil)
+	sv.calendar = nil
+	if sv.Maintenance != "" {
+		c, err := LoadMaintenanceCalendar(sv.Maintenance)
+		if err != nil {
+			return err
+		}
+		sv.calendar = c
+	}
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	sv.stopping = false
+	sv.standby = false
+	sv.promoted = false
+	sv.resumeAt = time.Time{}
+	sv.safeMode = false
+	sv.health = HealthUnknown
+	sv.ready = false
+	sv.restarts = nil
+	if err := sv.listenControl(); err != nil {
+		return err
+	}
+	if len(sv.Listen) > 0 {
+		if err := sv.listen(); err != nil {
+			sv.closeControl()
+			return err
+		}
+		stop, done := make(chan struct{}), make(chan struct{})
+		sv.stop, sv.done = stop, done
+		go func() {
+			ended := sv.activate(stop)
+			close(done)
+			if ended {
+				sv.exit()
+			}
+		}()
+		return nil
+	}
+	if l := sv.locker(); l != nil {
+		stop, done := make(chan struct{}), make(chan struct{})
+		sv.stop, sv.done = stop, done
+		sv.standby = true
+		go func() {
+			ended := sv.lead(l, stop)
+			close(done)
+			if ended {
+				sv.exit()
+			}
+		}()
+		return nil
+	}
+	ch, err := sv.startChild()
+	if err != nil {
+		sv.closeControl()
+		sv.closeOutputs()
+		return err
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	sv.stop, sv.done = stop, done
+	go func() {
+		ended := sv.supervise(ch, stop)
+		close(done)
+		if ended {
+			sv.exit()
+		}
+	}()
+	return nil
+}
+
+// Stop asks the program to exit and waits for it to do so, killing it
+// after the StopTimeout.
+func (sv *Supervisor) Stop(s Service) error {
+	sv.mu.Lock()
+	if sv.done == nil {
+		sv.mu.Unlock()
+		return nil
+	}
+	if !sv.stopping {
+		sv.stopping = true
+		close(sv.stop)
+	}
+	children := []*child{}
+	if sv.child != nil {
+		children = append(children, sv.child)
+	}
+	for ch := range sv.conns {
+		children = append(children, ch)
+	}
+	sv.closeListeners()
+	done := sv.done
+	sv.mu.Unlock()
+
+	for _, ch := range children {
+		if err := stopProcess(ch); err != nil {
+			sv.logf("stop %s: %v", sv.Exec, err)
+		}
+	}
+	timeout := duration(sv.StopTimeout, 10*time.Second)
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		sv.logf("%s did not stop within %v, killing it", sv.Exec, timeout)
+		for _, ch := range children {
+			if err := killProcess(ch); err != nil {
+				sv.logf("kill %s: %v", sv.Exec, err)
+			}
+		}
+		<-done
+	}
+	sv.closeControl()
+	sv.mu.Lock()
+	sv.closeOutputs()
+	sv.mu.Unlock()
+	return nil
+}
+
+// envStandby is set in the environment of a program started in WarmStandby.
+const envStandby = "SERVICE_STANDBY"
+
+// Promote makes the program started in WarmStandby active, notifying it
+// with SIGUSR2. Promoting an active program does nothing.
+func (sv *Supervisor) Promote() error {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	if !sv.WarmStandby {
+		return errors.New("supervisor: not in warm standby")
+	}
+	if sv.promoted {
+		return nil
+	}
+	if sv.child != nil {
+		if err := promoteProcess(sv.child); err != nil {
+			return err
+		}
+	}
+	sv.promoted = true
+	sv.logInfof("%s promoted to active", sv.Exec)
+	return nil
+}
+
+// StopFor stops the program and starts it again after d, while the
+// supervisor keeps running, for short maintenance. It is not supported with
+// Listen and leader election, which start the program themselves.
+func (sv *Supervisor) StopFor(d time.Duration) error {
+	if len(sv.Listen) > 0 || sv.locker() != nil {
+		return errors.New("supervisor: StopFor is not supported with Listen or leader election")
+	}
+	sv.mu.Lock()
+	ch := sv.child
+	if ch == nil || sv.stopping {
+		sv.mu.Unlock()
+		return newError(ErrNotRunning, "supervisor: program is not running")
+	}
+	sv.resumeAt = time.Now().Add(d)
+	sv.mu.Unlock()
+
+	sv.logInfof("stopping %s for %v", sv.Exec, d)
+	return stopProcess(ch)
+}
+
+// child is a running instance of the supervised program.
+type child struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser // Nil unless a control socket is configured.
+	closers []io.Closer
+
+	mu     sync.Mutex
+	pidfd  *os.File // Nil unless pidfds are available.
+	closed bool
+	exited chan struct{} // Closed by close.
+}
+
+// start starts the program. Its exit is detected by waiting for it with
+// cmd.Wait, which also reports the exact exit status.
+func (ch *child) start() error {
+	if err := ch.cmd.Start(); err != nil {
+		return err
+	}
+	if ch.pidfd = openPidfd(ch.cmd.Process); ch.pidfd != nil {
+		ch.closers = append(ch.closers, ch.pidfd)
+	}
+	return nil
+}
+
+func (ch *child) close() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, c := range ch.closers {
+		c.Close()
+	}
+	if !ch.closed {
+		close(ch.exited)
+	}
+	ch.closed = true
+}
+
+// signal sends sig to the program, through its pidfd where available so a
+// process that reused the PID of an exited instance is not signalled. A
+// program that exited already is not an error.
+func (ch *child) signal(sig os.Signal) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	switch {
+	case ch.closed:
+		return nil
+	case ch.pidfd != nil:
+		return signalPidfd(ch.pidfd, sig)
+	}
+	return ch.cmd.Process.Signal(sig)
+}
+
+// command prepares an instance of the program writing errors to Stderr.
+// sv.mu must be held.
+func (sv *Supervisor) command() (*child, error) {
+	path, err := sv.execPath()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find executable %q: %v", sv.Exec, err)
+	}
+	args, env := sv.Args, append(scrubEnv(sv.ScrubEnv, os.Environ()), sv.Env...)
+	if sv.safeMode {
+		args, env = sv.SafeMode.Args, append(env, sv.SafeMode.Env...)
+	}
+	if sv.WarmStandby && !sv.promoted {
+		env = append(env, envStandby+"=1")
+	}
+	// A script is run by its interpreter directly, so its "#!" line is
+	// not limited to the length the kernel reads.
+	if interp, err := readShebang(path); err == nil && interp != nil {
+		if interp, err = resolveInterpreter(interp); err != nil {
+			return nil, fmt.Errorf("Failed to find the interpreter of %q: %v", path, err)
+		}
+		args = append(append(interp[1:], path), args...)
+		path = interp[0]
+	}
+	cmd := scriptCommand(path, args)
+	if cmd == nil {
+		cmd = exec.Command(path, args...)
+	}
+	ch := &child{cmd: cmd, exited: make(chan struct{})}
+	ch.cmd.Dir = sv.Dir
+	ch.cmd.Env = env
+	setProcessGroup(ch.cmd)
+	if ch.cmd.Stderr, err = sv.output(ch, sv.Stderr); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// execPath returns the path of the program, in the active slot if Slots
+// is set.
+func (sv *Supervisor) execPath() (string, error) {
+	if sv.Slots != "" {
+		return sv.slots().Exec()
+	}
+	return exec.LookPath(sv.Exec)
+}
+
+func (sv *Supervisor) slots() Slots {
+	return Slots{Dir: sv.Slots, Name: sv.Exec}
+}
+
+// revert makes the previous slot active if the program was updated within
+// the probation period. It reports whether it did.
+func (sv *Supervisor) revert() bool {
+	if sv.Slots == "" {
+		return false
+	}
+	st, err := sv.slots().State()
+	if err != nil || st.Previous == "" || st.Reverted || time.Since(st.Switched) > duration(sv.Probation, 10*time.Minute) {
+		return false
+	}
+	if err := sv.slots().Revert(); err != nil {
+		sv.logf("revert %s to slot %s: %v", sv.Exec, st.Previous, err)
+		return false
+	}
+	sv.logf("%s failing since the update to slot %s, reverted to slot %s", sv.Exec, st.Active, st.Previous)
+	return true
+}
+
+// startChild starts the program. sv.mu must be held.
+func (sv *Supervisor) startChild() (*child, error) {
+	ch, err := sv.command()
+	if err != nil {
+		return nil, err
+	}
+	if ch.cmd.Stdout, err = sv.output(ch, sv.Stdout); err != nil {
+		ch.close()
+		return nil, err
+	}
+	if err := sv.activationFiles(ch); err != nil {
+		ch.close()
+		return nil, err
+	}
+	if sv.ControlSocket != "" {
+		if ch.stdin, err = ch.cmd.StdinPipe(); err != nil {
+			ch.close()
+			return nil, err
+		}
+	}
+	if err := ch.start(); err != nil {
+		ch.close()
+		return nil, err
+	}
+	sv.child = ch
+	if hc := sv.healthChecker(); hc != nil {
+		sv.setHealth(HealthStarting, nil)
+		go sv.monitorHealth(ch, hc)
+	}
+	return ch, nil
+}
+
+// output returns the writer for an output stream of ch: the file at path, if
+// any, and the attached console session when a control socket is configured.
+func (sv *Supervisor) output(ch *child, path string) (io.Writer, error) {
+	var w []io.Writer
+	switch {
+	case path == "":
+	case sv.LogRotate != nil:
+		r, err := sv.rotatingFile(path)
+		if err != nil {
+			return nil, err
+		}
+		w = append(w, r)
+	default:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		ch.closers = append(ch.closers, f)
+		w = append(w, f)
+	}
+	if sv.ControlSocket != "" {
+		w = append(w, &sv.console)
+	}
+	switch len(w) {
+	case 0:
+		return nil, nil
+	case 1:
+		return w[0], nil
+	}
+	return io.MultiWriter(w...), nil
+}
+
+// supervise waits for the program to exit and applies the restart policy.
+// It reports whether the program ended on its own rather than being stopped.
+func (sv *Supervisor) supervise(ch *child, stop <-chan struct{}) bool {
+	for {
+		err := ch.cmd.Wait()
+		ch.close()
+		sv.postExit(ch)
+
+		sv.mu.Lock()
+		sv.child = nil
+		if sv.stopping || sv.standby {
+			sv.mu.Unlock()
+			return false
+		}
+		if resume := sv.resumeAt; !resume.IsZero() {
+			// Stopped by StopFor, which is not a restart.
+			sv.resumeAt = time.Time{}
+			sv.mu.Unlock()
+			select {
+			case <-stop:
+				return false
+			case <-time.After(time.Until(resume)):
+			}
+			sv.logInfof("starting %s after the maintenance stop", sv.Exec)
+		} else {
+			if err != nil {
+				sv.logf("%s exited: %v", sv.Exec, err)
+			} else {
+				sv.logf("%s exited", sv.Exec)
+			}
+			restart := sv.shouldRestart(err)
+			sv.mu.Unlock()
+
+			if !restart {
+				return true
+			}
+			select {
+			case <-stop:
+				return false
+			case <-time.After(duration(sv.RestartDelay, time.Second)):
+			}
+			if !sv.waitMaintenance(stop) {
+				return false
+			}
+		}
+
+		sv.mu.Lock()
+		if sv.stopping || sv.standby {
+			sv.mu.Unlock()
+			return false
+		}
+		ch, err = sv.startChild()
+		sv.mu.Unlock()
+		if err != nil {
+			sv.logf("restart %s: %v", sv.Exec, err)
+			return true
+		}
+	}
+}
+
+// waitMaintenance waits until the maintenance calendar allows a restart.
+// It reports false if the supervisor was stopped meanwhile.
+func (sv *Supervisor) waitMaintenance(stop <-chan struct{}) bool {
+	if sv.calendar.Allowed(time.Now()) {
+		return true
+	}
+	sv.logf("restart of %s waiting for a maintenance window", sv.Exec)
+	for !sv.calendar.Allowed(time.Now()) {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(time.Minute):
+		}
+	}
+	return true
+}
+
+// shouldRestart applies the restart policy and limit. sv.mu must be held.
+func (sv *Supervisor) shouldRestart(exitErr error) bool {
+	switch sv.Restart {
+	case RestartNever:
+		return false
+	case RestartAlways:
+	default:
+		if exitErr == nil {
+			return false
+		}
+	}
+
+	limit := sv.RestartLimit
+	if limit == 0 {
+		limit = 5
+	}
+	now := time.Now()
+	window := duration(sv.RestartWindow, time.Minute)
+	recent := sv.restarts[:0]
+	for _, t := range sv.restarts {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	sv.restarts = append(recent, now)
+	if len(sv.restarts) > limit {
+		if sv.revert() {
+			sv.restarts = nil
+			return true
+		}
+		if sv.SafeMode != nil && !sv.safeMode {
+			sv.logf("%s restarted %d times within %v, restarting in safe mode", sv.Exec, limit, window)
+			sv.safeMode = true
+			sv.restarts = nil
+			return true
+		}
+		sv.logf("%s restarted %d times within %v, giving up", sv.Exec, limit, window)
+		return false
+	}
+	return true
+}
+
+// exit stops the service after the program ended for good, so the service
+// manager sees the service as stopped. It runs after sv.done is closed as
+// the service manager in turn waits for Stop to return.
+func (sv *Supervisor) exit() {
+	if Interactive() || sv.service == nil {
+		return
+	}
+	if err := sv.service.Stop(); err != nil {
+		sv.logf("stop service: %v", err)
+	}
+}
+
+func (sv *Supervisor) logf(format string, a ...interface{}) {
+	if sv.logger != nil {
+		sv.logger.Warningf(format, a...)
+	}
+}
+
+// postExit runs the PostExit commands after ch exited.
+func (sv *Supervisor) postExit(ch *child) {
+	ps := ch.cmd.ProcessState
+	if len(sv.PostExit) == 0 || ps == nil {
+		return
+	}
+	code, status := exitStatus(ps)
+	for _, line := range sv.PostExit {
+		cmd := shellCommand(line)
+		cmd.Dir = ch.cmd.Dir
+		cmd.Env = append(append([]string(nil), ch.cmd.Env...), "EXIT_CODE="+code, "EXIT_STATUS="+status)
+		if err := cmd.Run(); err != nil {
+			sv.logf("post-exit command %q of %s: %v", line, sv.Exec, err)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenAddress splits a Listen address into network and address. Addresses
+// without a scheme are TCP addresses.
+func listenAddress(a string) (network, address string, err error) {
+	i := strings.Index(a, "://")
+	if i < 0 {
+		return "tcp", a, nil
+	}
+	network, address = a[:i], a[i+3:]
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return network, address, nil
+	}
+	return "", "", fmt.Errorf("unsupported listen address %q", a)
+}
+
+// listen opens the Listen addresses. sv.mu must be held.
+func (sv *Supervisor) listen() error {
+	sv.listeners = nil
+	for _, a := range sv.Listen {
+		network, address, err := listenAddress(a)
+		if err != nil {
+			sv.closeListeners()
+			return err
+		}
+		if network == "unix" {
+			// Remove a socket left behind by a previous run.
+			os.Remove(address)
+		}
+		l, err := net.Listen(network, address)
+		if err != nil {
+			sv.closeListeners()
+			return err
+		}
+		sv.listeners = append(sv.listeners, l)
+		if sv.Accept {
+			continue
+		}
+		// A separate descriptor is watched for connections as the listener
+		// itself cannot be waited on without accepting.
+		f, err := l.(filer).File()
+		if err != nil {
+			sv.closeListeners()
+			return err
+		}
+		sv.sockets = append(sv.sockets, f)
+	}
+	return nil
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// closeListeners closes the Listen addresses. sv.mu must be held.
+func (sv *Supervisor) closeListeners() {
+	for _, l := range sv.listeners {
+		l.Close()
+	}
+	for _, f := range sv.sockets {
+		f.Close()
+	}
+	sv.listeners, sv.sockets = nil, nil
+}
+
+// activationFiles passes the listening sockets to a program started on
+// demand. LISTEN_PID cannot be set as the pid is only known after the start.
+// sv.mu must be held.
+func (sv *Supervisor) activationFiles(ch *child) error {
+	if len(sv.listeners) == 0 || sv.Accept {
+		return nil
+	}
+	for _, l := range sv.listeners {
+		f, err := l.(filer).File()
+		if err != nil {
+			return err
+		}
+		ch.closers = append(ch.closers, f)
+		ch.cmd.ExtraFiles = append(ch.cmd.ExtraFiles, f)
+	}
+	ch.cmd.Env = append(ch.cmd.Env, "LISTEN_FDS="+strconv.Itoa(len(sv.listeners)))
+	return nil
+}
+
+// activate serves the listening sockets until the supervisor stops. It
+// reports whether the program ended for good rather than being stopped.
+func (sv *Supervisor) activate(stop <-chan struct{}) bool {
+	sv.mu.Lock()
+	listeners, sockets := sv.listeners, sv.sockets
+	sv.mu.Unlock()
+
+	if sv.Accept {
+		sv.serveAccept(listeners)
+		return false
+	}
+	return sv.serveOnDemand(sockets, stop)
+}
+
+// serveAccept starts one instance of the program per connection.
+func (sv *Supervisor) serveAccept(listeners []net.Listener) {
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l net.Listener) {
+			defer wg.Done()
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				sv.startConn(conn, &wg)
+			}
+		}(l)
+	}
+	wg.Wait()
+}
+
+// startConn starts an instance of the program serving conn.
+func (sv *Supervisor) startConn(conn net.Conn, wg *sync.WaitGroup) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	limit := sv.MaxConnections
+	if limit == 0 {
+		limit = 64
+	}
+	if sv.stopping || len(sv.conns) >= limit {
+		sv.logf("%s: refusing connection from %v, %d instances running", sv.Exec, conn.RemoteAddr(), len(sv.conns))
+		conn.Close()
+		return
+	}
+	ch, err := sv.command()
+	if err != nil {
+		sv.logf("start %s: %v", sv.Exec, err)
+		conn.Close()
+		return
+	}
+	ch.closers = append(ch.closers, conn)
+	ch.cmd.Env = append(ch.cmd.Env, "REMOTE_ADDR="+conn.RemoteAddr().String())
+	ch.cmd.Stdin, ch.cmd.Stdout = conn, conn
+	// Hand over the socket itself where possible so no copying is needed.
+	if c, ok := conn.(filer); ok {
+		if f, err := c.File(); err == nil {
+			ch.closers = append(ch.closers, f)
+			ch.cmd.Stdin, ch.cmd.Stdout = f, f
+		}
+	}
+	if err := ch.start(); err != nil {
+		sv.logf("start %s: %v", sv.Exec, err)
+		ch.close()
+		return
+	}
+	if sv.conns == nil {
+		sv.conns = make(map[*child]struct{})
+	}
+	sv.conns[ch] = struct{}{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := ch.cmd.Wait(); err != nil {
+			sv.logf("%s (%v) exited: %v", sv.Exec, conn.RemoteAddr(), err)
+		}
+		ch.close()
+		sv.postExit(ch)
+		sv.mu.Lock()
+		delete(sv.conns, ch)
+		sv.mu.Unlock()
+	}()
+}
+
+// serveOnDemand starts the program when a connection arrives and again after
+// it exits. It reports whether the program ended for good.
+func (sv *Supervisor) serveOnDemand(sockets []*os.File, stop <-chan struct{}) bool {
+	idle := duration(sv.IdleTimeout, 0)
+	for {
+		if err := waitConnection(sockets); err != nil {
+			return false
+		}
+
+		sv.mu.Lock()
+		if sv.stopping {
+			sv.mu.Unlock()
+			return false
+		}
+		ch, err := sv.startChild()
+		sv.mu.Unlock()
+		if err != nil {
+			sv.logf("start %s: %v", sv.Exec, err)
+			return true
+		}
+
+		idled := make(chan struct{})
+		exited := make(chan struct{})
+		if idle > 0 {
+			go func() {
+				if watchIdle(sockets, idle, exited) {
+					sv.logInfof("%s idle for %v, stopping", sv.Exec, idle)
+					close(idled)
+					stopProcess(ch)
+				}
+			}()
+		}
+		err = ch.cmd.Wait()
+		close(exited)
+		ch.close()
+		sv.postExit(ch)
+
+		sv.mu.Lock()
+		sv.child = nil
+		if sv.stopping {
+			sv.mu.Unlock()
+			return false
+		}
+		select {
+		case <-idled:
+			// Stopped for being idle, start again on demand.
+			err = nil
+		default:
+		}
+		restart := true
+		if err != nil {
+			sv.logf("%s exited: %v", sv.Exec, err)
+			restart = sv.shouldRestart(err)
+		}
+		sv.mu.Unlock()
+
+		if !restart {
+			return true
+		}
+		if err == nil {
+			continue
+		}
+		// A program failing on every connection must not spin.
+		select {
+		case <-stop:
+			return false
+		case <-time.After(duration(sv.RestartDelay, time.Second)):
+		}
+	}
+}
+
+// waitConnection blocks until a connection is pending on one of sockets.
+// An error is returned once the sockets are closed.
+func waitConnection(sockets []*os.File) error {
+	ready := make(chan error, len(sockets))
+	for _, f := range sockets {
+		go func(f *os.File) {
+			ready <- waitSocket(f, func(pending bool) bool { return pending })
+		}(f)
+	}
+	err := <-ready
+	// Release the remaining waiters.
+	for _, f := range sockets {
+		f.SetReadDeadline(time.Now())
+	}
+	for i := 1; i < len(sockets); i++ {
+		<-ready
+	}
+	for _, f := range sockets {
+		f.SetReadDeadline(time.Time{})
+	}
+	return err
+}
+
+// watchIdle reports true once no connection arrived on sockets for idle,
+// or false when exited is closed first.
+func watchIdle(sockets []*os.File, idle time.Duration, exited <-chan struct{}) bool {
+	var mu sync.Mutex
+	last, stopped := time.Now(), false
+	touch := func() {
+		mu.Lock()
+		last = time.Now()
+		mu.Unlock()
+	}
+	expired := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Since(last) >= idle
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range sockets {
+		wg.Add(1)
+		go func(f *os.File) {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if stopped {
+					mu.Unlock()
+					return
+				}
+				f.SetReadDeadline(time.Now().Add(idle))
+				mu.Unlock()
+				woken := false
+				err := waitSocket(f, func(bool) bool {
+					// Every wake up after the first call is a new connection,
+					// whether or not the program accepted it already.
+					if woken {
+						touch()
+					}
+					woken = true
+					return false
+				})
+				if err != nil && !isTimeout(err) {
+					return
+				}
+			}
+		}(f)
+	}
+
+	tick := idle / 10
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	result := false
+loop:
+	for {
+		select {
+		case <-exited:
+			break loop
+		case <-ticker.C:
+			if expired() {
+				result = true
+				break loop
+			}
+		}
+	}
+	mu.Lock()
+	stopped = true
+	for _, f := range sockets {
+		f.SetReadDeadline(time.Now())
+	}
+	mu.Unlock()
+	wg.Wait()
+	for _, f := range sockets {
+		f.SetReadDeadline(time.Time{})
+	}
+	return result
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
@@ -0,0 +1,495 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Control socket protocol: a client sends a single command line and reads a
+// reply line starting with "ok" or "error". After "attach" is acknowledged
+// the connection carries the program's input and output; "promote" makes a
+// program in warm standby active and "stop-for <duration>" stops the program
+// for a while, see StopFor. With a control
+// token the command is preceded by "auth <token>", acknowledged likewise.
+// Denied commands are answered with "error denied <reason>".
+const (
+	controlAttach  = "attach"
+	controlPromote = "promote"
+	controlStopFor = "stop-for"
+	controlAuth    = "auth"
+	controlOK      = "ok"
+	controlError   = "error"
+)
+
+// Time a client has to send its token and command, and an attached session
+// may stay without input, before the connection is closed.
+var (
+	controlCommandTimeout = 10 * time.Second
+	controlSessionTimeout = 15 * time.Minute
+)
+
+// Reasons a control command is denied, reported in a ControlDeniedError and
+// the audit log.
+const (
+	DeniedCredentials    = "credentials"     // The user may not use the socket.
+	DeniedToken          = "token"           // The control token is wrong or missing.
+	DeniedRateLimit      = "rate-limit"      // The user exceeded ControlRateLimit.
+	DeniedBusy           = "busy"            // Another session is attached.
+	DeniedUnknownCommand = "unknown-command" // The command is not supported.
+)
+
+var deniedMessages = map[string]string{
+	DeniedCredentials:    "permission denied",
+	DeniedToken:          "permission denied",
+	DeniedRateLimit:      "too many commands",
+	DeniedBusy:           "another session is attached",
+	DeniedUnknownCommand: "unknown command",
+}
+
+// ControlDeniedError is returned by Attach when the supervisor denies the
+// command, for the Reason, one of the Denied constants.
+type ControlDeniedError struct {
+	Reason string
+}
+
+func (e *ControlDeniedError) Error() string {
+	if msg, ok := deniedMessages[e.Reason]; ok {
+		return fmt.Sprintf("control socket: %s (%s)", msg, e.Reason)
+	}
+	return "control socket: denied (" + e.Reason + ")"
+}
+
+// errNoPeerCred is returned by peerCred on systems that do not pass the
+// credentials of the process at the other end of a unix socket.
+var errNoPeerCred = errors.New("peer credentials are not supported on this system")
+
+// peer holds the credentials of the process at the other end of a control
+// connection. The pid is 0 where the system does not pass it, and the uid
+// is -1 where it does not pass credentials at all.
+type peer struct {
+	uid, pid int
+	gids     []int
+}
+
+// String formats the peer for the audit log.
+func (p peer) String() string {
+	s := "uid=-"
+	if p.uid >= 0 {
+		s = fmt.Sprintf("uid=%d", p.uid)
+	}
+	if p.pid > 0 {
+		s += fmt.Sprintf(" pid=%d", p.pid)
+	}
+	return s
+}
+
+// defaultControlRateLimit is the number of commands a user may send to the
+// control socket per minute unless ControlRateLimit is set.
+const defaultControlRateLimit = 60
+
+// rateLimiter is a token bucket per user, refilled at rate tokens per second
+// up to burst tokens.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[int]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing perMinute commands per minute,
+// nil if perMinute is not positive.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: make(map[int]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of uid at now, reporting whether there
+// was one. A nil limiter allows everything.
+func (l *rateLimiter) allow(uid int, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[uid]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[uid] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// console forwards the program's output to the attached session, if any.
+type console struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		// A slow or broken session must not block or fail the program.
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.conn.Write(p)
+	}
+	return len(p), nil
+}
+
+// listenControl opens the control socket, if configured.
+func (sv *Supervisor) listenControl() error {
+	if sv.ControlSocket == "" {
+		return nil
+	}
+	sv.controlToken = ""
+	limit := sv.ControlRateLimit
+	if limit == 0 {
+		limit = defaultControlRateLimit
+	}
+	sv.controlLimit = newRateLimiter(limit)
+	if sv.ControlToken != "" {
+		b, err := ioutil.ReadFile(sv.ControlToken)
+		if err != nil {
+			return err
+		}
+		if sv.controlToken = strings.TrimSpace(string(b)); sv.controlToken == "" {
+			return fmt.Errorf("supervisor: control token file %s is empty", sv.ControlToken)
+		}
+	}
+	// Remove a socket left behind by a previous run.
+	socket := NamespacedPath(sv.Namespace, sv.ControlSocket)
+	os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	var mode os.FileMode = 0600
+	if len(sv.ControlUsers) > 0 || len(sv.ControlGroups) > 0 {
+		mode = 0666
+	}
+	if err := os.Chmod(socket, mode); err != nil {
+		l.Close()
+		return err
+	}
+	sv.control = l
+	go sv.serveControl(l)
+	return nil
+}
+
+func (sv *Supervisor) closeControl() {
+	if sv.control == nil {
+		return
+	}
+	sv.control.Close()
+	sv.control = nil
+	sv.console.mu.Lock()
+	if sv.console.conn != nil {
+		sv.console.conn.Close()
+	}
+	sv.console.mu.Unlock()
+}
+
+func (sv *Supervisor) serveControl(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go sv.handleControl(conn)
+	}
+}
+
+// allowed reports whether the process at the other end of conn may use
+// the control socket, returning its credentials.
+func (sv *Supervisor) allowed(conn net.Conn) (peer, bool) {
+	p, err := peerCred(conn)
+	if err != nil {
+		// The socket is only accessible to the owner without an allowlist.
+		p = peer{uid: -1}
+		return p, err == errNoPeerCred && len(sv.ControlUsers) == 0 && len(sv.ControlGroups) == 0
+	}
+	if p.uid == 0 || p.uid == os.Geteuid() {
+		return p, true
+	}
+	for _, u := range sv.ControlUsers {
+		if u == p.uid {
+			return p, true
+		}
+	}
+	for _, g := range sv.ControlGroups {
+		for _, gid := range p.gids {
+			if g == gid {
+				return p, true
+			}
+		}
+	}
+	return p, false
+}
+
+// authenticate reads the token line of a session and reports whether it
+// carries the control token, if one is required.
+func (sv *Supervisor) authenticate(conn net.Conn, r *bufio.Reader) bool {
+	if sv.controlToken == "" {
+		return true
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	token := strings.TrimPrefix(strings.TrimSpace(line), controlAuth+" ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(sv.controlToken)) != 1 {
+		return false
+	}
+	fmt.Fprintf(conn, "%s\n", controlOK)
+	return true
+}
+
+// handleControl serves a control connection. The rate limit is applied
+// before the token is checked, so tokens cannot be guessed at speed, and
+// every command is written to the audit log.
+func (sv *Supervisor) handleControl(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(controlCommandTimeout))
+	r := bufio.NewReader(conn)
+	p, ok := sv.allowed(conn)
+	if !ok {
+		sv.deny(conn, p, "connect", DeniedCredentials)
+		return
+	}
+	if !sv.controlLimit.allow(p.uid, time.Now()) {
+		sv.deny(conn, p, "connect", DeniedRateLimit)
+		return
+	}
+	if !sv.authenticate(conn, r) {
+		sv.deny(conn, p, controlAuth, DeniedToken)
+		return
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	cmd := strings.TrimSpace(line)
+	fields := strings.Fields(cmd)
+	if len(fields) == 2 && fields[0] == controlStopFor {
+		sv.audit(p, cmd, "")
+		d, err := time.ParseDuration(fields[1])
+		if err == nil {
+			err = sv.StopFor(d)
+		}
+		sv.reply(conn, err)
+		return
+	}
+	switch cmd {
+	case controlAttach:
+		sv.attach(conn, r, p)
+	case controlPromote:
+		sv.audit(p, cmd, "")
+		sv.reply(conn, sv.Promote())
+	default:
+		sv.deny(conn, p, cmd, DeniedUnknownCommand)
+	}
+}
+
+// audit logs a control command of p, denied for reason unless it is empty,
+// as key=value pairs: allowed commands at the info level and denied ones as
+// warnings.
+func (sv *Supervisor) audit(p peer, command, reason string) {
+	if reason == "" {
+		sv.logInfof("control %s command=%q result=allowed", p, command)
+		return
+	}
+	sv.logf("control %s command=%q result=denied reason=%s", p, command, reason)
+}
+
+// deny audits and replies to a denied command.
+func (sv *Supervisor) deny(conn net.Conn, p peer, command, reason string) {
+	sv.audit(p, command, reason)
+	fmt.Fprintf(conn, "%s denied %s\n", controlError, reason)
+}
+
+// reply replies to a command with its result.
+func (sv *Supervisor) reply(conn net.Conn, err error) {
+	if err != nil {
+		fmt.Fprintf(conn, "%s %v\n", controlError, err)
+		return
+	}
+	fmt.Fprintf(conn, "%s\n", controlOK)
+}
+
+// attach connects conn to the program until the client disconnects or
+// sends no input for controlSessionTimeout. Only one session may be
+// attached at a time; sessions are logged, but not their input, which may
+// hold secrets.
+func (sv *Supervisor) attach(conn net.Conn, r *bufio.Reader, p peer) {
+	sv.console.mu.Lock()
+	if sv.console.conn != nil {
+		sv.console.mu.Unlock()
+		sv.deny(conn, p, controlAttach, DeniedBusy)
+		return
+	}
+	sv.console.conn = conn
+	sv.console.mu.Unlock()
+	sv.audit(p, controlAttach, "")
+	fmt.Fprintf(conn, "%s\n", controlOK)
+
+	sv.logInfof("session attached")
+	defer func() {
+		sv.console.mu.Lock()
+		sv.console.conn = nil
+		sv.console.mu.Unlock()
+		sv.logInfof("session detached")
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(controlSessionTimeout))
+		line, err := r.ReadString('\n')
+		if len(line) > 0 {
+			sv.logInfof("session input: %d bytes", len(line))
+			sv.mu.Lock()
+			var stdin io.Writer
+			if sv.child != nil {
+				stdin = sv.child.stdin
+			}
+			sv.mu.Unlock()
+			if stdin != nil {
+				stdin.Write([]byte(line))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sv *Supervisor) logInfof(format string, a ...interface{}) {
+	if sv.logger != nil {
+		sv.logger.Infof(format, a...)
+	}
+}
+
+// Attach connects to the control socket of a running Supervisor. Input read
+// from in is sent to the program's standard input and the program's output is
+// written to out until in is exhausted or the supervisor closes the session.
+func Attach(socket string, in io.Reader, out io.Writer) error {
+	return AttachWithToken(socket, "", in, out)
+}
+
+// AttachWithToken is Attach presenting token to a Supervisor requiring the
+// ControlToken.
+func AttachWithToken(socket, token string, in io.Reader, out io.Writer) error {
+	conn, r, err := sendControl(socket, token, controlAttach)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, in)
+		if c, ok := conn.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// Promote asks the Supervisor listening on the control socket to make the
+// program in WarmStandby active, presenting token unless it is empty.
+func Promote(socket, token string) error {
+	conn, _, err := sendControl(socket, token, controlPromote)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// StopProgramFor asks the Supervisor listening on the control socket to stop
+// the program for d, see Supervisor.StopFor, presenting token unless it is
+// empty.
+func StopProgramFor(socket, token string, d time.Duration) error {
+	conn, _, err := sendControl(socket, token, fmt.Sprintf("%s %v", controlStopFor, d))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// sendControl connects to the control socket and sends command, returning
+// the connection once the command is acknowledged.
+func sendControl(socket, token, command string) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	lines := []string{command}
+	if token != "" {
+		lines = []string{controlAuth + " " + token, command}
+	}
+	for _, line := range lines {
+		if _, err = fmt.Fprintf(conn, "%s\n", line); err == nil {
+			err = readReply(r)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, r, nil
+}
+
+// readReply reads a reply line, returning the error it reports if any, a
+// ControlDeniedError if the command was denied.
+func readReply(r *bufio.Reader) error {
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if reply = strings.TrimSpace(reply); reply == controlOK {
+		return nil
+	}
+	reply = strings.TrimPrefix(reply, controlError+" ")
+	if strings.HasPrefix(reply, "denied ") {
+		return &ControlDeniedError{Reason: strings.TrimPrefix(reply, "denied ")}
+	}
+	return errors.New(reply)
+}
@@ -0,0 +1,218 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && !service_minimal
+// +build linux,!service_minimal
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlSocketAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "control.sock")
+	sv := NewSupervisor(&SupervisorConfig{Exec: "agent", ControlSocket: socket, ControlToken: token})
+	if err := sv.listenControl(); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.closeControl()
+
+	if err, ok := AttachWithToken(socket, "guess", strings.NewReader(""), ioutil.Discard).(*ControlDeniedError); !ok || err.Reason != DeniedToken {
+		t.Errorf("attach with a wrong token = %v, want denied by token", err)
+	}
+	if err := Attach(socket, strings.NewReader(""), ioutil.Discard); err == nil {
+		t.Error("attach without the token succeeded")
+	}
+	var out bytes.Buffer
+	if err := AttachWithToken(socket, "s3cr3t", strings.NewReader(""), &out); err != nil {
+		t.Errorf("attach with the token = %v", err)
+	}
+
+	l, err := net.Listen("unix", filepath.Join(dir, "peer.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conn, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	p, err := peerCred(server)
+	if err != nil || p.uid != os.Geteuid() || p.pid != os.Getpid() {
+		t.Errorf("peerCred = %+v, %v, want uid %d and pid %d", p, err, os.Geteuid(), os.Getpid())
+	}
+	groups, _ := os.Getgroups()
+	if want := append([]int{os.Getegid()}, groups...); fmt.Sprint(p.gids) != fmt.Sprint(want) {
+		t.Errorf("peerCred groups = %v, want %v", p.gids, want)
+	}
+}
+
+func TestControlRateLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "control.sock")
+	sv := NewSupervisor(&SupervisorConfig{Exec: "agent", ControlSocket: socket, ControlRateLimit: 2})
+	if err := sv.listenControl(); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.closeControl()
+
+	for i := 0; i < 2; i++ {
+		if err := Attach(socket, strings.NewReader(""), ioutil.Discard); err != nil {
+			t.Fatalf("attach %d = %v", i, err)
+		}
+	}
+	if err, ok := Attach(socket, strings.NewReader(""), ioutil.Discard).(*ControlDeniedError); !ok || err.Reason != DeniedRateLimit {
+		t.Errorf("attach over the limit = %v, want denied by rate limit", err)
+	}
+
+	l := newRateLimiter(60)
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		l.allow(1000, now)
+	}
+	if l.allow(1000, now) {
+		t.Error("bucket of uid 1000 not exhausted")
+	}
+	if !l.allow(1001, now) {
+		t.Error("uid 1001 limited by the commands of uid 1000")
+	}
+	if !l.allow(1000, now.Add(time.Second)) {
+		t.Error("bucket of uid 1000 not refilled after a second")
+	}
+	if newRateLimiter(-1) != nil {
+		t.Error("negative limit does not disable the limiter")
+	}
+}
+
+func TestControlPromote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "control.sock")
+	out := filepath.Join(dir, "out")
+	script := `trap 'echo promoted >> ` + out + `' USR2; echo "standby=$SERVICE_STANDBY" > ` + out + `; while :; do sleep 0.05; done`
+	sv := NewSupervisor(&SupervisorConfig{Exec: "sh", Args: []string{"-c", script}, ControlSocket: socket, WarmStandby: true})
+	s := quietService{}
+	if err := sv.Start(s); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.Stop(s)
+
+	read := func(want string) {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			if b, _ := ioutil.ReadFile(out); string(b) == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		b, _ := ioutil.ReadFile(out)
+		t.Fatalf("program wrote %q, want %q", b, want)
+	}
+	read("standby=1\n")
+	if err := Promote(socket, ""); err != nil {
+		t.Fatal(err)
+	}
+	read("standby=1\npromoted\n")
+	if err := Promote(socket, ""); err != nil {
+		t.Errorf("promote again = %v", err)
+	}
+	read("standby=1\npromoted\n")
+}
+
+func TestControlStopFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "control.sock")
+	sv := NewSupervisor(&SupervisorConfig{Exec: "sleep", Args: []string{"60"}, ControlSocket: socket, Restart: RestartNever})
+	s := quietService{}
+	if err := sv.Start(s); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.Stop(s)
+
+	if err := StopProgramFor(socket, "", 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	running(t, sv, false)
+	running(t, sv, true)
+	sv.mu.Lock()
+	restarts := len(sv.restarts)
+	sv.mu.Unlock()
+	if restarts != 0 {
+		t.Errorf("stops counted as %d restarts", restarts)
+	}
+}
+
+func TestControlTimeoutAndRedaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { controlCommandTimeout = d }(controlCommandTimeout)
+	controlCommandTimeout = 50 * time.Millisecond
+
+	socket := filepath.Join(dir, "control.sock")
+	sv := NewSupervisor(&SupervisorConfig{Exec: "agent", ControlSocket: socket})
+	rl := &recordLogger{}
+	sv.logger = rl
+	if err := sv.listenControl(); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.closeControl()
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Errorf("idle client not disconnected: %v", err)
+	}
+
+	if err := Attach(socket, strings.NewReader("password=hunter2\n"), ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && !strings.Contains(rl.text(), "session detached"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if log := rl.text(); strings.Contains(log, "hunter2") || !strings.Contains(log, "session input: 17 bytes") {
+		t.Errorf("session logged as:\n%s", log)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// HealthCheck describes how a Supervisor checks the health of its program,
+// with one of HTTP, TCP or Exec, for example:
+//
+//	"HealthCheck": {
+//		"HTTP": "http://127.0.0.1:8080/healthz",
+//		"Interval": "10s",
+//		"StartPeriod": "30s"
+//	}
+//
+// The program is healthy once a check passed and unhealthy after Retries
+// checks in a row failed. Failures within StartPeriod after the program
+// started are not counted until a check passed.
+type HealthCheck struct {
+	HTTP string   // URL answered with a 2xx or 3xx status.
+	TCP  string   // Address accepting connections, "host:port".
+	Exec []string // Command exiting with status 0, and its arguments.
+
+	Interval    string // Time between checks, time.Duration string ("10s").
+	Timeout     string // Time a check may take, time.Duration string ("5s").
+	StartPeriod string // Time.Duration string ("0s").
+	Retries     int    // Failures in a row before the program is unhealthy (3).
+}
+
+func (hc *HealthCheck) validate() error {
+	n := 0
+	for _, set := range []bool{hc.HTTP != "", hc.TCP != "", len(hc.Exec) > 0} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("supervisor: HealthCheck takes only one of HTTP, TCP and Exec")
+	}
+	for _, d := range []string{hc.Interval, hc.Timeout, hc.StartPeriod} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("supervisor: HealthCheck: %v", err)
+		}
+	}
+	return nil
+}
+
+// checker returns the HealthChecker of the check, nil if it has none.
+func (hc *HealthCheck) checker() HealthChecker {
+	switch {
+	case hc.HTTP != "":
+		return HTTPCheck{URL: hc.HTTP}
+	case hc.TCP != "":
+		return TCPCheck{Address: hc.TCP}
+	case len(hc.Exec) > 0:
+		return ExecCheck{Path: hc.Exec[0], Args: hc.Exec[1:]}
+	}
+	return nil
+}
+
+// HTTPCheck is a HealthChecker passing if a GET request of URL is answered
+// with a 2xx or 3xx status. Redirects are not followed.
+type HTTPCheck struct {
+	URL string
+}
+
+var httpCheckClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Check requests the URL.
+func (c HTTPCheck) Check(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, c.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpCheckClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s: %s", c.URL, resp.Status)
+	}
+	return nil
+}
+
+// TCPCheck is a HealthChecker passing if Address accepts connections.
+type TCPCheck struct {
+	Address string
+}
+
+// Check connects to the address.
+func (c TCPCheck) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// ExecCheck is a HealthChecker passing if the command Path, looked up in
+// PATH if not a path, exits with status 0.
+type ExecCheck struct {
+	Path string
+	Args []string
+}
+
+// Check runs the command, which is killed when ctx is done.
+func (c ExecCheck) Check(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, c.Path, c.Args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %v: %s", c.Path, err, msg)
+		}
+		return fmt.Errorf("%s: %v", c.Path, err)
+	}
+	return nil
+}
+
+// healthChecker returns the HealthChecker of the program, nil if it has no
+// health checks.
+func (sv *Supervisor) healthChecker() HealthChecker {
+	if sv.HealthChecker != nil {
+		return sv.HealthChecker
+	}
+	if sv.HealthCheck != nil {
+		return sv.HealthCheck.checker()
+	}
+	return nil
+}
+
+// notifiesReady reports that the supervisor tells the service manager it is
+// ready once the program is healthy, see the Notify option.
+func (sv *Supervisor) notifiesReady() bool {
+	return sv.healthChecker() != nil
+}
+
+// Health returns the health of the program, HealthUnknown if it has no
+// health checks.
+func (sv *Supervisor) Health() Health {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	return sv.health
+}
+
+// monitorHealth checks the health of ch with hc until it exits.
+func (sv *Supervisor) monitorHealth(ch *child, hc HealthChecker) {
+	conf := sv.HealthCheck
+	if conf == nil {
+		conf = &HealthCheck{}
+	}
+	interval := duration(conf.Interval, 10*time.Second)
+	timeout := duration(conf.Timeout, 5*time.Second)
+	startPeriod := duration(conf.StartPeriod, 0)
+	retries := conf.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	started, failures := time.Now(), 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := hc.Check(ctx)
+		cancel()
+
+		sv.mu.Lock()
+		if sv.child != ch {
+			sv.mu.Unlock()
+			return
+		}
+		switch {
+		case err == nil:
+			failures = 0
+			sv.setHealth(HealthHealthy, nil)
+		case sv.health == HealthStarting && time.Since(started) < startPeriod:
+		default:
+			failures++
+			if failures >= retries {
+				sv.setHealth(HealthUnhealthy, err)
+			}
+		}
+		sv.mu.Unlock()
+
+		select {
+		case <-ch.exited:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// setHealth records the health of the program, logs changes and reports them
+// to the service manager as the status text, with readiness the first time
+// the program is healthy. sv.mu must be held.
+func (sv *Supervisor) setHealth(h Health, err error) {
+	if h == sv.health {
+		return
+	}
+	sv.health = h
+	switch h {
+	case HealthHealthy:
+		sv.logInfof("%s is healthy", sv.Exec)
+	case HealthUnhealthy:
+		sv.logf("%s is unhealthy: %v", sv.Exec, err)
+	}
+	state := "STATUS=" + h.String()
+	if h == HealthHealthy && !sv.ready {
+		sv.ready = true
+		state = "READY=1\n" + state
+	}
+	if err := sdNotify(state); err != nil {
+		sv.logf("notify service manager: %v", err)
+	}
+}
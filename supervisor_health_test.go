@@ -0,0 +1,136 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && !service_minimal
+// +build linux,!service_minimal
+
+package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// healthy waits for sv to report the health want.
+func healthy(t *testing.T, sv *Supervisor, want Health) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if sv.Health() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("program %v, want %v", sv.Health(), want)
+}
+
+func TestSupervisorHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notify.Close()
+	os.Setenv("NOTIFY_SOCKET", notify.LocalAddr().String())
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	var ok int32
+	sv := NewSupervisor(&SupervisorConfig{
+		Exec:        "sleep",
+		Args:        []string{"60"},
+		HealthCheck: &HealthCheck{Interval: "20ms", Retries: 2},
+	})
+	sv.HealthChecker = HealthFunc(func(ctx context.Context) error {
+		if atomic.LoadInt32(&ok) == 0 {
+			return errors.New("not listening")
+		}
+		return nil
+	})
+	if !sv.notifiesReady() {
+		t.Error("supervisor with a health check does not notify readiness")
+	}
+	s := quietService{}
+	if err := sv.Start(s); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.Stop(s)
+
+	healthy(t, sv, HealthUnhealthy)
+	atomic.StoreInt32(&ok, 1)
+	healthy(t, sv, HealthHealthy)
+
+	var states []string
+	buf := make([]byte, 256)
+	for len(states) < 3 {
+		notify.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := notify.Read(buf)
+		if err != nil {
+			t.Fatalf("notifications %q: %v", states, err)
+		}
+		states = append(states, string(buf[:n]))
+	}
+	want := []string{"STATUS=starting", "STATUS=unhealthy", "READY=1\nSTATUS=healthy"}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("notifications %q, want %q", states, want)
+			break
+		}
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusFound {
+			http.Redirect(w, r, "/elsewhere", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		status int
+		ok     bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusFound, true},
+		{http.StatusServiceUnavailable, false},
+	} {
+		status = tt.status
+		if err := (HTTPCheck{URL: srv.URL}).Check(ctx); (err == nil) != tt.ok {
+			t.Errorf("HTTPCheck of status %d: %v", tt.status, err)
+		}
+	}
+	if err := (TCPCheck{Address: srv.Listener.Addr().String()}).Check(ctx); err != nil {
+		t.Errorf("TCPCheck of a listener: %v", err)
+	}
+	if err := (TCPCheck{Address: closed.Addr().String()}).Check(ctx); err == nil {
+		t.Error("TCPCheck of a closed port passed")
+	}
+	if err := (ExecCheck{Path: "true"}).Check(ctx); err != nil {
+		t.Errorf("ExecCheck of true: %v", err)
+	}
+	if err := (ExecCheck{Path: "sh", Args: []string{"-c", "exit 1"}}).Check(ctx); err == nil {
+		t.Error("ExecCheck of a failing command passed")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !solaris && !aix && !windows && !service_minimal
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly,!solaris,!aix,!windows,!service_minimal
+
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup does nothing on the remaining systems.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// scriptCommand returns nil on the remaining systems.
+func scriptCommand(path string, args []string) *exec.Cmd { return nil }
+
+// killProcess kills ch.
+func killProcess(ch *child) error {
+	return ch.signal(os.Kill)
+}
+
+// stopProcess asks ch to exit. Without a signal to ask with on the remaining
+// systems, ch is interrupted.
+func stopProcess(ch *child) error {
+	return ch.signal(os.Interrupt)
+}
+
+// exitStatus returns how the program of ps exited and its exit status, as
+// systemd sets them in EXIT_CODE and EXIT_STATUS.
+func exitStatus(ps *os.ProcessState) (code, status string) {
+	return "exited", strconv.Itoa(ps.ExitCode())
+}
+
+// waitSocket is not supported on the remaining systems.
+func waitSocket(f *os.File, ready func(pending bool) bool) error {
+	return errors.New("supervisor: waiting for connections is not supported on this system")
+}
+
+// promoteProcess is not supported on the remaining systems.
+func promoteProcess(ch *child) error {
+	return errors.New("supervisor: warm standby is not supported on this system")
+}
+
+// tryLock is not supported on the remaining systems.
+func tryLock(f *os.File) (bool, error) {
+	return false, errors.New("supervisor: file locks are not supported on this system")
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPidfd returns a file referring to the process p, so p can be signalled
+// without the risk of its PID having been reused after it exited. It returns
+// nil on kernels without pidfds (before Linux 5.3).
+func openPidfd(p *os.Process) *os.File {
+	fd, err := unix.PidfdOpen(p.Pid, 0)
+	if err != nil {
+		degrade("pidfd", "pid", err)
+		return nil
+	}
+	return os.NewFile(uintptr(fd), "pidfd")
+}
+
+// signalPidfd sends sig to the process f refers to. A process that exited
+// already is not an error.
+func signalPidfd(f *os.File, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.New("supervisor: unsupported signal " + sig.String())
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sigErr error
+	err = rc.Control(func(fd uintptr) {
+		sigErr = unix.PidfdSendSignal(int(fd), s, nil, 0)
+	})
+	switch {
+	case err != nil:
+		return err
+	case sigErr == unix.ESRCH:
+		return nil
+	}
+	return sigErr
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestStopProcessPidfd(t *testing.T) {
+	ch := &child{cmd: exec.Command("sleep", "10"), exited: make(chan struct{})}
+	if err := ch.start(); err != nil {
+		t.Skip(err)
+	}
+	if ch.pidfd == nil {
+		ch.cmd.Process.Kill()
+		ch.cmd.Wait()
+		t.Skip("pidfds are not available")
+	}
+	if err := stopProcess(ch); err != nil {
+		t.Fatal(err)
+	}
+	err := ch.cmd.Wait()
+	if ws, ok := ch.cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || ws.Signal() != syscall.SIGTERM {
+		t.Errorf("Wait() = %v, want terminated by SIGTERM", err)
+	}
+	if err := stopProcess(ch); err != nil {
+		t.Errorf("stopping an exited process: %v", err)
+	}
+	ch.close()
+	if err := stopProcess(ch); err != nil {
+		t.Errorf("stopping a process after close: %v", err)
+	}
+}
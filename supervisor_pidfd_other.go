@@ -0,0 +1,22 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !service_minimal
+// +build !linux,!service_minimal
+
+package service
+
+import (
+	"errors"
+	"os"
+)
+
+// openPidfd returns nil, pidfds are only available on Linux.
+func openPidfd(p *os.Process) *os.File {
+	return nil
+}
+
+func signalPidfd(f *os.File, sig os.Signal) error {
+	return errors.New("supervisor: pidfds are not supported on this system")
+}
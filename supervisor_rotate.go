@@ -0,0 +1,216 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogRotate describes how a Supervisor rotates the Stdout and Stderr files:
+// a file that grew to MaxSize or was written to for MaxAge is renamed to
+// path.1, the previous path.1 to path.2 and so on, up to Keep files, for
+// example:
+//
+//	"LogRotate": {
+//		"MaxSize": 10485760,
+//		"MaxAge": "24h",
+//		"Keep": 7,
+//		"Compress": true
+//	}
+type LogRotate struct {
+	MaxSize  int64  // Size in bytes a file is rotated at; no limit if zero.
+	MaxAge   string // Time a file is written to before it is rotated, time.Duration string; no limit if empty.
+	Keep     int    // Rotated files kept (5).
+	Compress bool   // Compress rotated files with gzip, as path.1.gz and so on.
+}
+
+func (lr *LogRotate) validate() error {
+	if lr.MaxSize < 0 || lr.Keep < 0 {
+		return errors.New("supervisor: LogRotate MaxSize and Keep must not be negative")
+	}
+	if lr.MaxAge != "" {
+		if _, err := time.ParseDuration(lr.MaxAge); err != nil {
+			return fmt.Errorf("supervisor: LogRotate: %v", err)
+		}
+	}
+	return nil
+}
+
+// rotatingFile is an output file of the program rotated as described by a
+// LogRotate. It is shared by the instances of the program, and by both
+// output streams if they go to the same file.
+type rotatingFile struct {
+	path   string
+	conf   *LogRotate
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	f      *os.File // Nil once closed.
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, conf *LogRotate) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, conf: conf, maxAge: duration(conf.MaxAge, 0)}
+	return r, r.open()
+}
+
+// open opens the file, appending to it. r.mu must be held once r is shared.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, fi.Size(), time.Now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if it is due. Output is not
+// lost if the rotation fails, it is written to the file as it is.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, errors.New("supervisor: output file closed")
+	}
+	if r.due(len(p)) {
+		if err := r.rotate(); err != nil && r.f == nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file is to be rotated before n bytes are written.
+// An empty file is not rotated.
+func (r *rotatingFile) due(n int) bool {
+	switch {
+	case r.size == 0:
+		return false
+	case r.conf.MaxSize > 0 && r.size+int64(n) > r.conf.MaxSize:
+		return true
+	}
+	return r.maxAge > 0 && time.Since(r.opened) >= r.maxAge
+}
+
+// rotated returns the name of the rotated file i.
+func (r *rotatingFile) rotated(i int) string {
+	name := fmt.Sprintf("%s.%d", r.path, i)
+	if r.conf.Compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// rotate renames the file and the files rotated before, removing the
+// oldest, and opens a new file. r.f is the file written to afterwards, nil
+// if none could be opened.
+func (r *rotatingFile) rotate() error {
+	keep := r.conf.Keep
+	if keep == 0 {
+		keep = 5
+	}
+	r.f.Close()
+	r.f = nil
+	os.Remove(r.rotated(keep))
+	for i := keep - 1; i > 0; i-- {
+		os.Rename(r.rotated(i), r.rotated(i+1))
+	}
+	name := r.path + ".1"
+	err := os.Rename(r.path, name)
+	if oerr := r.open(); oerr != nil {
+		return oerr
+	}
+	if err != nil {
+		return err
+	}
+	if r.conf.Compress {
+		return compressFile(name)
+	}
+	return nil
+}
+
+// compressFile replaces the file at path with path.gz, compressed.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// Close closes the file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// rotatingFile returns the rotating output file at path, opening it the
+// first time. sv.mu must be held.
+func (sv *Supervisor) rotatingFile(path string) (*rotatingFile, error) {
+	if r, ok := sv.outputs[path]; ok {
+		return r, nil
+	}
+	r, err := openRotatingFile(path, sv.LogRotate)
+	if err != nil {
+		return nil, err
+	}
+	if sv.outputs == nil {
+		sv.outputs = make(map[string]*rotatingFile)
+	}
+	sv.outputs[path] = r
+	return r, nil
+}
+
+// closeOutputs closes the rotating output files once no program writes to
+// them. sv.mu must be held.
+func (sv *Supervisor) closeOutputs() {
+	for path, r := range sv.outputs {
+		r.Close()
+		delete(sv.outputs, path)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.log")
+
+	r, err := openRotatingFile(path, &LogRotate{MaxSize: 10, Keep: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	read := func(name string) string {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if !strings.HasSuffix(name, ".gz") {
+			b, _ := ioutil.ReadAll(f)
+			return string(b)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	for name, want := range map[string]string{
+		path:           "fourth\n",
+		path + ".1.gz": "third\n",
+		path + ".2.gz": "second\n",
+	} {
+		if got := read(name); got != want {
+			t.Errorf("%s holds %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	for _, name := range []string{path + ".3.gz", path + ".1"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s exists beyond Keep or uncompressed", filepath.Base(name))
+		}
+	}
+	if _, err := r.Write([]byte("late\n")); err == nil {
+		t.Error("write to a closed file succeeded")
+	}
+}
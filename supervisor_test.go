@@ -0,0 +1,106 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSupervisorConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       SupervisorConfig
+		wantErr bool
+	}{
+		{"minimal", SupervisorConfig{Exec: "agent"}, false},
+		{"no-exec", SupervisorConfig{}, true},
+		{"bad-policy", SupervisorConfig{Exec: "agent", Restart: "sometimes"}, true},
+		{"bad-delay", SupervisorConfig{Exec: "agent", RestartDelay: "5"}, true},
+		{"full", SupervisorConfig{Exec: "agent", Restart: RestartAlways, RestartDelay: "2s", RestartWindow: "1h"}, false},
+		{"accept", SupervisorConfig{Exec: "agent", Listen: []string{":8080", "unix:///run/agent.sock"}, Accept: true}, false},
+		{"bad-listen", SupervisorConfig{Exec: "agent", Listen: []string{"udp://:53"}, Accept: true}, true},
+		{"bad-idle", SupervisorConfig{Exec: "agent", Listen: []string{":8080"}, Accept: true, IdleTimeout: "soon"}, true},
+		{"leader-listen", SupervisorConfig{Exec: "agent", Listen: []string{":8080"}, Accept: true, LeaderLock: "/shared/agent.lock"}, true},
+		{"standby-leader", SupervisorConfig{Exec: "agent", WarmStandby: true, LeaderLock: "/shared/agent.lock"}, true},
+		{"health", SupervisorConfig{Exec: "agent", HealthCheck: &HealthCheck{TCP: ":8080", Interval: "5s"}}, false},
+		{"health-probes", SupervisorConfig{Exec: "agent", HealthCheck: &HealthCheck{TCP: ":8080", HTTP: "http://:8080/"}}, true},
+		{"log-rotate", SupervisorConfig{Exec: "agent", Stdout: "/var/log/agent.log", LogRotate: &LogRotate{MaxSize: 1 << 20, MaxAge: "24h"}}, false},
+		{"bad-log-rotate", SupervisorConfig{Exec: "agent", LogRotate: &LogRotate{MaxAge: "daily"}}, true},
+		{"health-listen", SupervisorConfig{Exec: "agent", Listen: []string{":8080"}, Accept: true, HealthCheck: &HealthCheck{TCP: ":8080"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSupervisorShouldRestart(t *testing.T) {
+	failed := errors.New("exit status 1")
+	tests := []struct {
+		policy string
+		err    error
+		want   bool
+	}{
+		{RestartNever, failed, false},
+		{RestartOnFailure, failed, true},
+		{RestartOnFailure, nil, false},
+		{"", failed, true},
+		{RestartAlways, nil, true},
+	}
+	for _, tt := range tests {
+		sv := NewSupervisor(&SupervisorConfig{Exec: "agent", Restart: tt.policy})
+		if got := sv.shouldRestart(tt.err); got != tt.want {
+			t.Errorf("policy %q, err %v: shouldRestart() = %v, want %v", tt.policy, tt.err, got, tt.want)
+		}
+	}
+
+	sv := NewSupervisor(&SupervisorConfig{Exec: "agent", RestartLimit: 2})
+	for i, want := range []bool{true, true, false} {
+		if got := sv.shouldRestart(failed); got != want {
+			t.Errorf("restart %d: shouldRestart() = %v, want %v", i, got, want)
+		}
+	}
+
+	sv = NewSupervisor(&SupervisorConfig{Exec: os.Args[0], RestartLimit: 1, SafeMode: &SafeMode{Args: []string{"-safe"}}})
+	for i, want := range []bool{true, true, true, false} {
+		if got := sv.shouldRestart(failed); got != want {
+			t.Errorf("restart %d with safe mode: shouldRestart() = %v, want %v", i, got, want)
+		}
+	}
+	if !sv.safeMode {
+		t.Error("not in safe mode after the restart limit")
+	}
+	ch, err := sv.command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.cmd.Args) != 2 || ch.cmd.Args[1] != "-safe" {
+		t.Errorf("safe mode command %q, want the safe mode arguments", ch.cmd.Args)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		in, network, address string
+	}{
+		{":8080", "tcp", ":8080"},
+		{"tcp6://[::1]:8080", "tcp6", "[::1]:8080"},
+		{"unix:///run/agent.sock", "unix", "/run/agent.sock"},
+	}
+	for _, tt := range tests {
+		network, address, err := listenAddress(tt.in)
+		if err != nil || network != tt.network || address != tt.address {
+			t.Errorf("listenAddress(%q) = %q, %q, %v, want %q, %q", tt.in, network, address, err, tt.network, tt.address)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux || darwin || solaris || aix || freebsd || openbsd || netbsd || dragonfly) && !service_minimal
+// +build linux darwin solaris aix freebsd openbsd netbsd dragonfly
+// +build !service_minimal
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup runs the program of cmd in a process group of its own,
+// so killProcess reaches the processes it started as well.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// stopProcess asks ch to exit.
+func stopProcess(ch *child) error {
+	return ch.signal(syscall.SIGTERM)
+}
+
+// scriptCommand returns nil on the unix systems, where a script is
+// started by its "#!" line.
+func scriptCommand(path string, args []string) *exec.Cmd { return nil }
+
+// killProcess kills ch and its process group. The group is signalled by its
+// ID, the PID of ch, which the kernel keeps from reuse only while a member
+// of the group is left: once Wait reaped ch, which is before ch is closed,
+// the ID of an empty group can be reused. A process reusing it is only
+// signalled if it also leads a group of its own.
+func killProcess(ch *child) error {
+	if err := ch.signal(syscall.SIGKILL); err != nil {
+		return err
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.closed {
+		return nil
+	}
+	if err := unix.Kill(-ch.cmd.Process.Pid, unix.SIGKILL); err != nil && err != unix.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// promoteProcess notifies ch that it was promoted from warm standby.
+func promoteProcess(ch *child) error {
+	return ch.signal(syscall.SIGUSR2)
+}
+
+// exitStatus returns how the program of ps exited and its exit status or
+// signal, as systemd sets them in EXIT_CODE and EXIT_STATUS.
+func exitStatus(ps *os.ProcessState) (code, status string) {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "exited", strconv.Itoa(ps.ExitCode())
+	}
+	code = "killed"
+	if ws.CoreDump() {
+		code = "dumped"
+	}
+	return code, strings.TrimPrefix(unix.SignalName(ws.Signal()), "SIG")
+}
+
+// waitSocket waits for the listening socket f to become readable, calling ready with whether a
+// connection is pending each time it wakes up, until ready returns true.
+// The connection is left for the program to accept.
+func waitSocket(f *os.File, ready func(pending bool) bool) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return rc.Read(func(fd uintptr) bool {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 0)
+		return ready(err == nil && n > 0)
+	})
+}
+
+// tryLock takes an exclusive lock on f, reporting false if another process
+// holds it. POSIX record locks are used, as flock does not work across
+// hosts on all network filesystems.
+func tryLock(f *os.File) (bool, error) {
+	lk := unix.Flock_t{Type: unix.F_WRLCK}
+	err := unix.FcntlFlock(f.Fd(), unix.F_SETLK, &lk)
+	if err == unix.EAGAIN || err == unix.EACCES {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,109 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux || darwin || solaris || aix || freebsd) && !service_minimal
+// +build linux darwin solaris aix freebsd
+// +build !service_minimal
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSupervisorPostExit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postexit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	for _, tt := range []struct {
+		script, want string
+	}{
+		{"exit 3", "exited 3 agent\n"},
+		{"kill -TERM $$", "killed TERM agent\n"},
+	} {
+		os.Remove(out)
+		sv := NewSupervisor(&SupervisorConfig{
+			Exec:     "sh",
+			Args:     []string{"-c", tt.script},
+			Env:      []string{"NAME=agent"},
+			Restart:  RestartNever,
+			PostExit: []string{`echo "$EXIT_CODE $EXIT_STATUS $NAME" > ` + out},
+		})
+		s := quietService{}
+		if err := sv.Start(s); err != nil {
+			t.Fatal(err)
+		}
+		var b []byte
+		for i := 0; i < 200 && string(b) != tt.want; i++ {
+			time.Sleep(10 * time.Millisecond)
+			b, _ = ioutil.ReadFile(out)
+		}
+		sv.Stop(s)
+		if string(b) != tt.want {
+			t.Errorf("%s: post-exit command wrote %q, want %q", tt.script, b, tt.want)
+		}
+	}
+}
+
+func TestSupervisorStopTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stoptimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	// The program and the process it starts ignore SIGTERM.
+	sv := NewSupervisor(&SupervisorConfig{
+		Exec:        "sh",
+		Args:        []string{"-c", "trap '' TERM; sleep 60 & echo $! > " + out + "; wait"},
+		StopTimeout: "200ms",
+	})
+	s := quietService{}
+	if err := sv.Start(s); err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	for i := 0; i < 200 && !strings.HasSuffix(string(b), "\n"); i++ {
+		time.Sleep(10 * time.Millisecond)
+		b, _ = ioutil.ReadFile(out)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatalf("program wrote %q: %v", b, err)
+	}
+
+	begin := time.Now()
+	sv.Stop(s)
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("Stop took %v with a StopTimeout of 200ms", d)
+	}
+	for i := 0; i < 100 && processAlive(pid); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		t.Errorf("process %d of the program's group still running", pid)
+	}
+}
+
+// processAlive reports whether the process pid runs, and is not a zombie
+// left for an init that does not reap it.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	return err != nil || !strings.Contains(string(stat), ") Z ")
+}
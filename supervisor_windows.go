@@ -0,0 +1,93 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// setProcessGroup runs the program of cmd in a process group of its own,
+// which console control events can be sent to.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+}
+
+// scriptCommand returns the command running the batch or PowerShell script
+// path with args through its interpreter, or nil if path is not a script.
+func scriptCommand(path string, args []string) *exec.Cmd {
+	interp, iargs := scriptInterpreter(path)
+	if interp == "" {
+		return nil
+	}
+	iargs = append(iargs, args...)
+	cmd := exec.Command(interp, iargs...)
+	if iargs[1] == "/S" {
+		cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: batchCommandLine(interp, iargs)}
+	}
+	return cmd
+}
+
+// stopProcess asks ch to exit with a Ctrl-Break event to its process group.
+// Console control events cannot be sent without a console, as when the
+// supervisor runs as a service, so ch is terminated then.
+func stopProcess(ch *child) error {
+	ch.mu.Lock()
+	closed := ch.closed
+	var err error
+	if !closed {
+		err = windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(ch.cmd.Process.Pid))
+	}
+	ch.mu.Unlock()
+	if closed || err == nil {
+		return nil
+	}
+	return killProcess(ch)
+}
+
+// killProcess terminates ch.
+func killProcess(ch *child) error {
+	return ch.signal(os.Kill)
+}
+
+// promoteProcess is not supported on windows, which has no signal to
+// notify the process with.
+func promoteProcess(ch *child) error {
+	return errors.New("supervisor: warm standby is not supported on windows")
+}
+
+// exitStatus returns how the program of ps exited and its exit status, as
+// systemd sets them in EXIT_CODE and EXIT_STATUS.
+func exitStatus(ps *os.ProcessState) (code, status string) {
+	return "exited", strconv.Itoa(ps.ExitCode())
+}
+
+// waitSocket is not supported on windows, programs are only started per
+// connection there.
+func waitSocket(f *os.File, ready func(pending bool) bool) error {
+	return errors.New("supervisor: waiting for connections is not supported on windows")
+}
+
+// tryLock takes an exclusive lock on f, reporting false if another process
+// holds it.
+func tryLock(f *os.File) (bool, error) {
+	var ol windows.Overlapped
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return false, nil
+	}
+	return err == nil, err
+}
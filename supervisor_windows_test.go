@@ -0,0 +1,32 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestSupervisorScriptCommand(t *testing.T) {
+	cmd := scriptCommand(`C:\svc\run.ps1`, []string{"-Name", "agent"})
+	if cmd == nil {
+		t.Fatal("scriptCommand() = nil")
+	}
+	system32, err := windows.GetSystemDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cmd.Path, system32+`\`) {
+		t.Errorf("scriptCommand() path = %q, want it in %q", cmd.Path, system32)
+	}
+	if scriptCommand(`C:\svc\agent.exe`, nil) != nil {
+		t.Error("scriptCommand() of an executable is not nil")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// TelemetryKind is the kind of a TelemetryEvent.
+type TelemetryKind int
+
+const (
+	// TelemetryLifecycle events are the program being started, stopped,
+	// shut down or reloaded by Run.
+	TelemetryLifecycle TelemetryKind = iota + 1
+	// TelemetryControl events are the outcome of a Control action.
+	TelemetryControl
+)
+
+// TelemetryEvent is a lifecycle event or control operation that completed.
+type TelemetryEvent struct {
+	Kind     TelemetryKind
+	Service  Service
+	Op       string        // "start", "stop", "shutdown" or "reload", or a ControlAction.
+	Duration time.Duration // Time the operation took.
+	Err      error         // Error of the operation, nil if it succeeded.
+}
+
+// Telemetry receives the events of all services in the process, for
+// instance to forward them as metrics or spans. Event is called
+// synchronously from the operation reported and should return quickly.
+type Telemetry interface {
+	Event(e TelemetryEvent)
+}
+
+var (
+	telemetryLock sync.Mutex
+	telemetry     Telemetry
+)
+
+// SetTelemetry sets the Telemetry receiving the events of this process, or
+// stops reporting them if t is nil.
+func SetTelemetry(t Telemetry) {
+	telemetryLock.Lock()
+	defer telemetryLock.Unlock()
+	telemetry = t
+}
+
+// report reports op of s, which began at begin, to the Telemetry.
+func report(kind TelemetryKind, s Service, op string, begin time.Time, err error) {
+	telemetryLock.Lock()
+	t := telemetry
+	telemetryLock.Unlock()
+	if t == nil {
+		return
+	}
+	t.Event(TelemetryEvent{
+		Kind:     kind,
+		Service:  s,
+		Op:       op,
+		Duration: time.Since(begin),
+		Err:      err,
+	})
+}
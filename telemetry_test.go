@@ -0,0 +1,77 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+type recordingTelemetry []TelemetryEvent
+
+func (r *recordingTelemetry) Event(e TelemetryEvent) {
+	*r = append(*r, e)
+}
+
+// failingService fails to start.
+type failingService struct {
+	Service
+}
+
+func (failingService) Start() error   { return errors.New("unit not found") }
+func (failingService) String() string { return "agent" }
+
+// quietService is a Service without a logger.
+type quietService struct {
+	Service
+}
+
+func (quietService) Logger(errs chan<- error) (Logger, error) { return nil, nil }
+
+// stoppingProgram is stopped or shut down.
+type stoppingProgram struct{}
+
+func (stoppingProgram) Start(s Service) error    { return nil }
+func (stoppingProgram) Stop(s Service) error     { return nil }
+func (stoppingProgram) Shutdown(s Service) error { return errors.New("flush failed") }
+
+func TestTelemetry(t *testing.T) {
+	var r recordingTelemetry
+	SetTelemetry(&r)
+	defer SetTelemetry(nil)
+
+	s := failingService{}
+	Control(s, "start")
+	c := &Config{}
+	c.startProgram(stoppingProgram{}, s)
+	c.stopProgram(stoppingProgram{}, s, false)
+	c.stopProgram(stoppingProgram{}, s, true)
+
+	want := []struct {
+		kind TelemetryKind
+		op   string
+		err  bool
+	}{
+		{TelemetryControl, "start", true},
+		{TelemetryLifecycle, "start", false},
+		{TelemetryLifecycle, "stop", false},
+		{TelemetryLifecycle, "shutdown", true},
+	}
+	if len(r) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(r), len(want), r)
+	}
+	for n, w := range want {
+		e := r[n]
+		if e.Kind != w.kind || e.Op != w.op || (e.Err != nil) != w.err || e.Service != s {
+			t.Errorf("event %d = %+v, want %s of kind %d failing %v", n, e, w.op, w.kind, w.err)
+		}
+	}
+
+	SetTelemetry(nil)
+	Control(s, "start")
+	if len(r) != len(want) {
+		t.Errorf("event reported after SetTelemetry(nil)")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const optionPrivateTmp = "PrivateTmp"
+
+// privateTmpDir returns the private temporary directory of the service, in
+// the StateDirectory.
+func (c *Config) privateTmpDir() (string, error) {
+	dir, err := c.stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tmp"), nil
+}
+
+// preparePrivateTmp creates an empty private temporary directory, if the
+// PrivateTmp option is set, and exports it to the program and the processes
+// it starts in TMPDIR, or TMP and TEMP on Windows. Files left by a crashed
+// run are removed. The returned function removes the directory.
+func (c *Config) preparePrivateTmp() (cleanup func(), err error) {
+	if !c.Option.bool(optionPrivateTmp, false) {
+		return func() {}, nil
+	}
+	dir, err := c.privateTmpDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	vars := []string{"TMPDIR"}
+	if runtime.GOOS == "windows" {
+		vars = []string{"TMP", "TEMP"}
+	}
+	for _, v := range vars {
+		os.Setenv(v, dir)
+	}
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// removePrivateTmp removes the private temporary directory, left behind if
+// the service did not stop cleanly, on Uninstall.
+func (c *Config) removePrivateTmp() {
+	if dir, err := c.privateTmpDir(); err == nil {
+		os.RemoveAll(dir)
+	}
+}
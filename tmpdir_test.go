@@ -0,0 +1,47 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPrivateTmp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "privatetmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	env := "TMPDIR"
+	if runtime.GOOS == "windows" {
+		env = "TMP"
+	}
+	defer os.Setenv(env, os.Getenv(env))
+
+	c := &Config{Name: "agent", Option: KeyValue{optionStateDirectory: dir, optionPrivateTmp: true}}
+	tmp := filepath.Join(dir, "tmp")
+	leftover := filepath.Join(tmp, "crashed")
+	os.MkdirAll(tmp, 0755)
+	ioutil.WriteFile(leftover, nil, 0644)
+
+	cleanup, err := c.preparePrivateTmp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(env) != tmp {
+		t.Errorf("%s = %q, want %q", env, os.Getenv(env), tmp)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("files of an earlier run were kept")
+	}
+	cleanup()
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("the private temporary directory was not removed")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// toolEnvScrubbed are the environment variables left out of the environment
+// of the commands of the service managers. They change which programs and
+// libraries the commands load or what the shells they run execute.
+var toolEnvScrubbed = []string{
+	"PATH", "LD_*", "DYLD_*", "LIBPATH", "IFS", "ENV", "BASH_ENV", "CDPATH",
+	"SHELLOPTS", "BASHOPTS", "PS4", "GCONV_PATH", "NLSPATH", "PATHEXT", "COMSPEC",
+}
+
+// lookTool returns the absolute path of the command name of a service
+// manager, such as systemctl or launchctl. Rather than searching PATH, which
+// an installer run from an untrusted shell does not control, a bare name is
+// looked up in the system directories only, see toolDirs. The command and
+// its directory must not be writable by everyone.
+func lookTool(name string) (string, error) {
+	var path string
+	if filepath.IsAbs(name) {
+		path = name
+	} else {
+		for _, dir := range toolDirs() {
+			p := filepath.Join(dir, name)
+			if runtime.GOOS == "windows" {
+				p += ".exe"
+			}
+			if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return "", fmt.Errorf("%q not found in %s", name, strings.Join(toolDirs(), string(os.PathListSeparator)))
+		}
+	}
+	if err := checkToolPerm(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// checkToolPerm returns an error if the file path or its directory, after
+// following symbolic links, is writable by everyone. The mode bits do not
+// reflect the access lists of windows, which are left to the system.
+func checkToolPerm(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{real, filepath.Dir(real)} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		// A sticky directory such as /tmp is writable by everyone too.
+		if fi.Mode().Perm()&0002 != 0 {
+			return fmt.Errorf("refusing to run %s: %s is writable by everyone", path, p)
+		}
+	}
+	return nil
+}
+
+// toolEnv returns the environment of the commands of the service managers:
+// the environment of the process without toolEnvScrubbed and PATH set to
+// the system directories.
+func toolEnv() []string {
+	env := scrubEnv(toolEnvScrubbed, os.Environ())
+	return append(env, "PATH="+strings.Join(toolDirs(), string(os.PathListSeparator)))
+}
+
+// toolCommand returns the command to run the command name of a service
+// manager with args, see lookTool and toolEnv.
+func toolCommand(name string, args ...string) (*exec.Cmd, error) {
+	return toolCommandContext(context.Background(), name, args...)
+}
+
+// toolCommandContext is like toolCommand but the command is killed when
+// ctx is done.
+func toolCommandContext(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	path, err := lookTool(name)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = toolEnv()
+	return cmd, nil
+}
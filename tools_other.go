@@ -0,0 +1,14 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package service
+
+// toolDirs returns the directories the commands of the service managers are
+// looked up in, most trusted first.
+func toolDirs() []string {
+	return []string{"/usr/sbin", "/usr/bin", "/sbin", "/bin", "/usr/local/sbin", "/usr/local/bin"}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookTool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fake := filepath.Join(dir, "sh")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	p, err := lookTool("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(p) == dir || !filepath.IsAbs(p) {
+		t.Errorf("lookTool(sh) = %q, want sh of the system directories", p)
+	}
+	if _, err := lookTool("no-such-tool"); err == nil {
+		t.Error("lookTool found a missing command")
+	}
+
+	if _, err := lookTool(fake); err != nil {
+		t.Errorf("lookTool(%q) = %v", fake, err)
+	}
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lookTool(fake); err == nil {
+		t.Error("lookTool accepted a command in a directory writable by everyone")
+	}
+
+	os.Setenv("LD_PRELOAD", "/tmp/evil.so")
+	defer os.Unsetenv("LD_PRELOAD")
+	var path string
+	for _, kv := range toolEnv() {
+		if strings.HasPrefix(kv, "LD_PRELOAD=") {
+			t.Errorf("toolEnv kept %s", kv)
+		}
+		if strings.HasPrefix(kv, "PATH=") {
+			path = kv
+		}
+	}
+	if strings.Contains(path, dir) {
+		t.Errorf("toolEnv %s, want the system directories", path)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "golang.org/x/sys/windows"
+
+// toolDirs returns the directories the commands of the service manager are
+// looked up in: the system directory, asked of the system rather than taken
+// from the SystemRoot environment variable.
+func toolDirs() []string {
+	dir, err := windows.GetSystemDirectory()
+	if err != nil {
+		return nil
+	}
+	return []string{dir}
+}
+
+// runTool runs the command name of the system with args and returns its
+// combined output, see toolCommand.
+func runTool(name string, args ...string) ([]byte, error) {
+	cmd, err := toolCommand(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.CombinedOutput()
+}
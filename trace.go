@@ -0,0 +1,69 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const optionPropagateTrace = "PropagateTrace"
+
+// traceParentPattern matches a W3C trace context traceparent header value.
+var traceParentPattern = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// propagateTrace reports whether the PropagateTrace option is set.
+func (c *Config) propagateTrace() bool {
+	return c.Option.bool(optionPropagateTrace, false)
+}
+
+// traceStarter is a Service that can pass a trace context to the program
+// it starts.
+type traceStarter interface {
+	// startTraced starts, or restarts if restart, the service with
+	// TRACEPARENT set to traceparent in the environment of the program.
+	startTraced(traceparent string, restart bool) error
+}
+
+// ControlTraced is Control for an action taken on behalf of a traced
+// request, with traceparent the W3C trace context of the request, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". If the
+// PropagateTrace option is set and the action is start or restart, the
+// program is started with TRACEPARENT set to traceparent in its environment,
+// so the trace of the request continues in the startup of the program. Only
+// systemd passes it on; elsewhere the action is taken without it, which is
+// recorded as a Degradation.
+func ControlTraced(s Service, action, traceparent string) error {
+	if !traceParentPattern.MatchString(traceparent) || traceparent[:2] == "ff" {
+		return fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	if action != ControlAction[0] && action != ControlAction[2] {
+		return Control(s, action)
+	}
+	if c, ok := s.(interface{ propagateTrace() bool }); !ok || !c.propagateTrace() {
+		return Control(s, action)
+	}
+	ts, ok := s.(traceStarter)
+	if !ok {
+		degrade("trace-propagation", "none", ErrNotSupported)
+		return Control(s, action)
+	}
+	return Control(traceStarted{s, ts, traceparent}, action)
+}
+
+// traceStarted is a Service whose Start and Restart pass a trace context.
+type traceStarted struct {
+	Service
+	ts          traceStarter
+	traceparent string
+}
+
+func (t traceStarted) Start() error {
+	return t.ts.startTraced(t.traceparent, false)
+}
+
+func (t traceStarted) Restart() error {
+	return t.ts.startTraced(t.traceparent, true)
+}
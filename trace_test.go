@@ -0,0 +1,53 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+// tracedService records how it was started.
+type tracedService struct {
+	Service
+	*Config
+	started string
+}
+
+func (s *tracedService) Start() error {
+	s.started = "untraced"
+	return nil
+}
+
+func (s *tracedService) startTraced(traceparent string, restart bool) error {
+	s.started = traceparent
+	return nil
+}
+
+func TestControlTraced(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	for _, invalid := range []string{"", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "ff" + traceparent[2:], traceparent + "\nEVIL=1"} {
+		if err := ControlTraced(&tracedService{Config: &Config{}}, "start", invalid); err == nil {
+			t.Errorf("ControlTraced accepted traceparent %q", invalid)
+		}
+	}
+
+	s := &tracedService{Config: &Config{}}
+	if err := ControlTraced(s, "start", traceparent); err != nil {
+		t.Fatal(err)
+	}
+	if s.started != "untraced" {
+		t.Errorf("started %s without the PropagateTrace option", s.started)
+	}
+	s.Option = KeyValue{optionPropagateTrace: true}
+	if err := ControlTraced(s, "start", traceparent); err != nil {
+		t.Fatal(err)
+	}
+	if s.started != traceparent {
+		t.Errorf("started %s, want the trace context", s.started)
+	}
+
+	u := failingService{}
+	if err := ControlTraced(u, "start", traceparent); err == nil {
+		t.Errorf("ControlTraced of a service without trace support = %v, want the Start error", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kinds of the StartTriggers option of Windows services.
+const (
+	triggerNetwork = "network" // The first IP address becomes available.
+	triggerDevice  = "device"  // A device of an interface class arrives.
+	triggerETW     = "etw"     // An ETW provider writes an event.
+)
+
+var guidPattern = regexp.MustCompile(`^\{?[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}?$`)
+
+// startTrigger is an event upon which the service control manager starts
+// the service.
+type startTrigger struct {
+	kind string
+	guid string // Device interface class or ETW provider, in braces.
+	data string // Hardware ID of a device, if any.
+}
+
+// parseStartTriggers parses the StartTriggers option, triggers separated by
+// commas: "network", "device:<interface class GUID>[/<hardware ID>]" or
+// "etw:<provider GUID>".
+func parseStartTriggers(s string) ([]startTrigger, error) {
+	var triggers []startTrigger
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, ":", 2)
+		t := startTrigger{kind: strings.ToLower(parts[0])}
+		switch t.kind {
+		case triggerNetwork:
+			if len(parts) == 2 {
+				return nil, fmt.Errorf("start trigger %q takes no argument", field)
+			}
+		case triggerDevice, triggerETW:
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("start trigger %q requires a GUID", field)
+			}
+			guid := parts[1]
+			if t.kind == triggerDevice {
+				if i := strings.Index(guid, "/"); i >= 0 {
+					guid, t.data = guid[:i], guid[i+1:]
+				}
+			}
+			if !guidPattern.MatchString(guid) {
+				return nil, fmt.Errorf("invalid GUID in start trigger %q", field)
+			}
+			t.guid = "{" + strings.Trim(guid, "{}") + "}"
+		default:
+			return nil, fmt.Errorf("unknown start trigger %q", field)
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
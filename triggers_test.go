@@ -0,0 +1,30 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStartTriggers(t *testing.T) {
+	got, err := parseStartTriggers("network, device:53f56307-b6bf-11d0-94f2-00a0c91efb8b/USBSTOR\\Disk,etw:{22fb2cd6-0e7b-422b-a0c7-2fad1fd0e716}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []startTrigger{
+		{kind: triggerNetwork},
+		{kind: triggerDevice, guid: "{53f56307-b6bf-11d0-94f2-00a0c91efb8b}", data: "USBSTOR\\Disk"},
+		{kind: triggerETW, guid: "{22fb2cd6-0e7b-422b-a0c7-2fad1fd0e716}"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("triggers %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"usb", "etw", "etw:not-a-guid", "network:eth0"} {
+		if _, err := parseStartTriggers(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+// Package tui shows the status of services on a terminal, for operators
+// logged in to the host, and lets them start, stop and restart the
+// services. The status is queried with service.Statuses and StatusEx, and
+// changes of it are listed as recent events.
+//
+// Commands are typed as lines: "restart 2" or "restart agent" restarts the
+// second service listed or the one named agent, likewise "start" and
+// "stop"; "q" quits.
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+// Screen shows the status of Services until its Run returns.
+type Screen struct {
+	Services []service.Service
+	Interval time.Duration // Time between refreshes, 2s if zero.
+	Events   int           // Recent events shown, 10 if zero.
+
+	In  io.Reader // Commands, os.Stdin if nil.
+	Out io.Writer // Terminal, os.Stdout if nil.
+
+	rows   []row
+	events []string
+}
+
+// row is the status of a service as shown.
+type row struct {
+	name string
+	info service.StatusInfo
+	err  error
+}
+
+// clear moves the cursor home and clears the terminal.
+const clear = "\x1b[H\x1b[2J"
+
+// Run shows the status until ctx is done, the input ends or "q" is typed.
+func (s *Screen) Run(ctx context.Context) error {
+	in, out := s.In, s.Out
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+	interval := s.Interval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(in)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		s.refresh(time.Now())
+		io.WriteString(out, clear)
+		if err := s.render(out); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		case line, ok := <-lines:
+			if !ok || strings.TrimSpace(line) == "q" {
+				return nil
+			}
+			s.command(line, time.Now())
+		}
+	}
+}
+
+// refresh queries the status of the services, recording changes as events.
+func (s *Screen) refresh(now time.Time) {
+	rows := make([]row, len(s.Services))
+	for i, r := range service.Statuses(s.Services...) {
+		rows[i] = row{name: s.Services[i].String(), info: service.StatusInfo{Status: r.Status}, err: r.Err}
+		if r.Err == nil {
+			if _, ok := s.Services[i].(service.StatusExer); ok {
+				rows[i].info, rows[i].err = service.StatusEx(s.Services[i])
+			}
+		}
+	}
+	if len(s.rows) == len(rows) {
+		for i, r := range rows {
+			old := s.rows[i].info
+			switch {
+			case r.info.Status != old.Status:
+				s.event(now, "%s: %v -> %v", r.name, old.Status, r.info.Status)
+			case r.info.Restarts > old.Restarts:
+				s.event(now, "%s: restarted (%d)", r.name, r.info.Restarts)
+			case r.info.Health != old.Health && r.info.Health != service.HealthUnknown:
+				s.event(now, "%s: %v", r.name, r.info.Health)
+			}
+		}
+	}
+	s.rows = rows
+}
+
+// event adds an event to the recent events.
+func (s *Screen) event(now time.Time, format string, a ...interface{}) {
+	max := s.Events
+	if max == 0 {
+		max = 10
+	}
+	s.events = append(s.events, now.Format("15:04:05")+" "+fmt.Sprintf(format, a...))
+	if len(s.events) > max {
+		s.events = s.events[len(s.events)-max:]
+	}
+}
+
+// command runs the command line, recording its outcome as an event.
+func (s *Screen) command(line string, now time.Time) {
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return
+	}
+	if len(f) != 2 || f[0] != "start" && f[0] != "stop" && f[0] != "restart" {
+		s.event(now, "unknown command %q, use start, stop or restart with a service, or q", line)
+		return
+	}
+	svc := s.lookup(f[1])
+	if svc == nil {
+		s.event(now, "no service %s", f[1])
+		return
+	}
+	if err := service.Control(svc, f[0]); err != nil {
+		s.event(now, "%v", err)
+		return
+	}
+	s.event(now, "%s: %s done", svc, f[0])
+}
+
+// lookup returns the service numbered or named arg, nil if there is none.
+func (s *Screen) lookup(arg string) service.Service {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(s.Services) {
+			return nil
+		}
+		return s.Services[n-1]
+	}
+	for _, svc := range s.Services {
+		if svc.String() == arg {
+			return svc
+		}
+	}
+	return nil
+}
+
+// render writes the status table and the recent events.
+func (s *Screen) render(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSERVICE\tSTATUS\tHEALTH\tPID\tUPTIME\tRESTARTS")
+	for i, r := range s.rows {
+		status := r.info.Status.String()
+		if r.err != nil {
+			status = "error: " + r.err.Error()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\n", i+1, r.name, status, health(r.info.Health), pid(r.info.PID), uptime(r.info.Uptime), r.info.Restarts)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Recent events:")
+	for _, e := range s.events {
+		fmt.Fprintln(w, "  "+e)
+	}
+	_, err := fmt.Fprintln(w, "\nCommands: start|stop|restart <# or name>, q")
+	return err
+}
+
+func health(h service.Health) string {
+	if h == service.HealthUnknown {
+		return "-"
+	}
+	return h.String()
+}
+
+func pid(p int) string {
+	if p == 0 {
+		return "-"
+	}
+	return strconv.Itoa(p)
+}
+
+func uptime(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Truncate(time.Second).String()
+}
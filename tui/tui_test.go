@@ -0,0 +1,58 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package tui
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+// fakeService is stopped until it is restarted.
+type fakeService struct {
+	service.Service
+	name    string
+	running bool
+}
+
+func (f *fakeService) String() string { return f.name }
+func (f *fakeService) Restart() error { f.running = true; return nil }
+
+func (f *fakeService) Status() (service.Status, error) {
+	if f.running {
+		return service.StatusRunning, nil
+	}
+	return service.StatusStopped, nil
+}
+
+func TestScreen(t *testing.T) {
+	var out bytes.Buffer
+	s := &Screen{
+		Services: []service.Service{&fakeService{name: "agent"}, &fakeService{name: "builder"}},
+		Interval: time.Hour,
+		In:       strings.NewReader("restart agent\nstop 3\nq\n"),
+		Out:      &out,
+	}
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	screens := strings.Split(out.String(), clear)
+	last := screens[len(screens)-1]
+	for _, want := range []string{
+		"1  agent    running",
+		"2  builder  stopped",
+		" agent: restart done\n",
+		" agent: stopped -> running\n",
+		" no service 3\n",
+	} {
+		if !strings.Contains(last, want) {
+			t.Errorf("screen does not show %q:\n%s", want, last)
+		}
+	}
+}
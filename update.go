@@ -0,0 +1,354 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UpdateManifest describes a release of a program. It is served as JSON,
+// for example:
+//
+//	{
+//		"Version": "1.4.0",
+//		"URL": "agent-1.4.0",
+//		"SHA256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+//		"Deltas": [{"From": "<SHA256 of 1.3.2>", "URL": "agent-1.3.2-1.4.0.patch", "SHA256": "..."}]
+//	}
+type UpdateManifest struct {
+	Version string
+	Channel string // Release channel, such as "stable" or "beta", if any.
+	URL     string // Program, relative to the manifest.
+	SHA256  string // Checksum of the program, hex encoded.
+	Deltas  []UpdateDelta
+}
+
+// UpdateDelta is a binary delta from an earlier release to the program of
+// an UpdateManifest.
+type UpdateDelta struct {
+	From   string // Checksum of the program the delta applies to.
+	URL    string // Delta, relative to the manifest.
+	SHA256 string // Checksum of the delta.
+}
+
+// Updater updates a program kept in Slots from an UpdateManifest served
+// over HTTP(S). Interrupted downloads are resumed by the next Update.
+type Updater struct {
+	Slots Slots
+
+	// Manifest is the URL of the UpdateManifest. "{channel}" in it is
+	// replaced by the Channel of the Slots.
+	Manifest string
+	Client   *http.Client // Client used, http.DefaultClient if nil.
+
+	// Calendar, if set, restricts Update to its maintenance windows.
+	Calendar *MaintenanceCalendar
+
+	// Accept, if set, decides whether to update to the release of m. By
+	// default a release is accepted unless it is from another channel than
+	// the one of the Slots or the Slots are pinned to another version.
+	Accept func(st SlotState, m *UpdateManifest) bool
+
+	// RateLimit limits downloads to this many bytes per second, if set.
+	RateLimit int
+
+	// Patch, if set, applies the binary delta read from delta to the
+	// program read from old, writing the new program to w. Deltas are only
+	// downloaded if Patch is set; the whole program is downloaded if no
+	// delta applies or patching fails.
+	Patch func(old, delta io.Reader, w io.Writer) error
+}
+
+// Update downloads the program of the manifest into the inactive slot and
+// makes it active, unless the active slot holds it already or the release
+// is not accepted. It reports whether the program was updated; the new
+// program runs once restarted. Outside the maintenance windows of the
+// Calendar nothing is done.
+func (u *Updater) Update(ctx context.Context) (*UpdateManifest, bool, error) {
+	if !u.Calendar.Allowed(time.Now()) {
+		return nil, false, nil
+	}
+	return u.ForceUpdate(ctx)
+}
+
+// ForceUpdate is Update regardless of the Calendar, for updates an operator
+// asked for.
+func (u *Updater) ForceUpdate(ctx context.Context) (*UpdateManifest, bool, error) {
+	st, err := u.Slots.State()
+	if err != nil {
+		return nil, false, err
+	}
+	m, err := u.fetchManifest(ctx, st.Channel)
+	if err != nil {
+		return nil, false, err
+	}
+	accept := u.Accept
+	if accept == nil {
+		accept = acceptRelease
+	}
+	if !accept(st, m) {
+		return m, false, nil
+	}
+	current := u.Slots.Path(st.Active)
+	sum, err := fileSHA256(current)
+	if err != nil {
+		return m, false, err
+	}
+	if sum == m.SHA256 {
+		return m, false, nil
+	}
+
+	path := ""
+	if u.Patch != nil {
+		path = u.patch(ctx, m, current, sum)
+	}
+	if path == "" {
+		if path, err = u.download(ctx, m.URL, m.SHA256); err != nil {
+			return m, false, err
+		}
+	}
+	defer os.Remove(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return m, false, err
+	}
+	defer f.Close()
+	if err := u.Slots.Update(f, m.Version); err != nil {
+		return m, false, err
+	}
+	return m, true, nil
+}
+
+func (u *Updater) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+	return http.DefaultClient
+}
+
+// acceptRelease is the default Updater.Accept.
+func acceptRelease(st SlotState, m *UpdateManifest) bool {
+	if st.Channel != "" && m.Channel != "" && m.Channel != st.Channel {
+		return false
+	}
+	return st.Pin == "" || m.Version == st.Pin
+}
+
+func (u *Updater) manifestURL(channel string) string {
+	return strings.Replace(u.Manifest, "{channel}", url.PathEscape(channel), -1)
+}
+
+func (u *Updater) fetchManifest(ctx context.Context, channel string) (*UpdateManifest, error) {
+	req, err := http.NewRequest("GET", u.manifestURL(channel), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update: %s: %s", u.Manifest, resp.Status)
+	}
+	m := &UpdateManifest{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		return nil, fmt.Errorf("update: %s: %v", u.Manifest, err)
+	}
+	if m.URL == "" || m.SHA256 == "" {
+		return nil, fmt.Errorf("update: %s: URL and SHA256 are required", u.Manifest)
+	}
+	return m, nil
+}
+
+// patch builds the program of m from a delta applying to the current
+// program. It returns the path of the program, or "" if no delta applies or
+// patching failed.
+func (u *Updater) patch(ctx context.Context, m *UpdateManifest, current, sum string) string {
+	for _, d := range m.Deltas {
+		if d.From != sum {
+			continue
+		}
+		delta, err := u.download(ctx, d.URL, d.SHA256)
+		if err != nil {
+			return ""
+		}
+		defer os.Remove(delta)
+		path, err := u.applyPatch(current, delta, m.SHA256)
+		if err != nil {
+			return ""
+		}
+		return path
+	}
+	return ""
+}
+
+func (u *Updater) applyPatch(current, delta, sum string) (string, error) {
+	old, err := os.Open(current)
+	if err != nil {
+		return "", err
+	}
+	defer old.Close()
+	d, err := os.Open(delta)
+	if err != nil {
+		return "", err
+	}
+	defer d.Close()
+
+	path := u.cachePath(sum)
+	w, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	err = u.Patch(old, d, io.MultiWriter(w, h))
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("update: patched program does not match checksum %s", sum)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// cachePath returns the path downloads with the checksum sum are kept at.
+func (u *Updater) cachePath(sum string) string {
+	return filepath.Join(u.Slots.Dir, "download-"+sum)
+}
+
+// download downloads ref, relative to the manifest, resuming an earlier
+// partial download, and verifies it has the checksum sum. It returns the
+// path of the downloaded file.
+func (u *Updater) download(ctx context.Context, ref, sum string) (string, error) {
+	st, err := u.Slots.State()
+	if err != nil {
+		return "", err
+	}
+	base, err := url.Parse(u.manifestURL(st.Channel))
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	src := base.ResolveReference(r).String()
+
+	path := u.cachePath(sum)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", src, nil)
+	if err != nil {
+		return "", err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server does not support ranges, start over.
+		if err := f.Truncate(0); err != nil {
+			return "", err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Downloaded completely before.
+	default:
+		return "", fmt.Errorf("update: %s: %s", src, resp.Status)
+	}
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		var body io.Reader = resp.Body
+		if u.RateLimit > 0 {
+			body = &rateLimitReader{r: body, rate: u.RateLimit, start: time.Now()}
+		}
+		if _, err := io.Copy(f, body); err != nil {
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	got, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	if got != sum {
+		os.Remove(path)
+		return "", fmt.Errorf("update: %s does not match checksum %s", src, sum)
+	}
+	return path, nil
+}
+
+// rateLimitReader limits the rate data is read from r to rate bytes per
+// second.
+type rateLimitReader struct {
+	r     io.Reader
+	rate  int
+	start time.Time
+	n     int64
+}
+
+func (l *rateLimitReader) Read(p []byte) (int, error) {
+	if len(p) > l.rate {
+		p = p[:l.rate]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	due := l.start.Add(time.Duration(l.n) * time.Second / time.Duration(l.rate))
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+	return n, err
+}
+
+// fileSHA256 returns the hex encoded SHA-256 checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
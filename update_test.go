@@ -0,0 +1,130 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build !service_minimal
+// +build !service_minimal
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestUpdater(t *testing.T) {
+	dir, err := ioutil.TempDir("", "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sl := Slots{Dir: dir, Name: "agent"}
+	if err := sl.Install(strings.NewReader("v1"), "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	v2 := strings.Repeat("v2", 1000)
+	m := UpdateManifest{Version: "2", URL: "agent-2", SHA256: sha256Hex(v2)}
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			json.NewEncoder(w).Encode(m)
+		case "/agent-2":
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "agent", time.Time{}, strings.NewReader(v2))
+		case "/delta":
+			w.Write([]byte("3"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// A partial earlier download is resumed.
+	u := &Updater{Slots: sl, Manifest: srv.URL + "/manifest.json"}
+	ioutil.WriteFile(u.cachePath(m.SHA256), []byte(v2[:100]), 0644)
+	_, updated, err := u.Update(context.Background())
+	if err != nil || !updated {
+		t.Fatalf("Update() = %v, %v", updated, err)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=100-" {
+		t.Errorf("requested ranges %q, want resuming at 100", ranges)
+	}
+	if p, _ := sl.Exec(); readFile(p) != v2 {
+		t.Error("updated program does not match")
+	}
+	if _, updated, _ := u.Update(context.Background()); updated {
+		t.Error("updated again to the same program")
+	}
+
+	// A delta from the active program is used if Patch is set.
+	v3 := v2 + "3"
+	m = UpdateManifest{Version: "3", URL: "missing", SHA256: sha256Hex(v3),
+		Deltas: []UpdateDelta{{From: sha256Hex(v2), URL: "delta", SHA256: sha256Hex("3")}}}
+	u.Patch = func(old, delta io.Reader, w io.Writer) error {
+		var b bytes.Buffer
+		io.Copy(&b, old)
+		io.Copy(&b, delta)
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+	if _, _, err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := sl.Exec(); readFile(p) != v3 {
+		t.Error("patched program does not match")
+	}
+	if v, _ := sl.Version(); v != "3" {
+		t.Errorf("Version() = %q after the update, want 3", v)
+	}
+}
+
+func TestAcceptRelease(t *testing.T) {
+	tests := []struct {
+		st   SlotState
+		m    UpdateManifest
+		want bool
+	}{
+		{SlotState{}, UpdateManifest{Version: "2", Channel: "beta"}, true},
+		{SlotState{Channel: "stable"}, UpdateManifest{Version: "2", Channel: "beta"}, false},
+		{SlotState{Channel: "stable"}, UpdateManifest{Version: "2", Channel: "stable"}, true},
+		{SlotState{Pin: "1.5"}, UpdateManifest{Version: "2"}, false},
+		{SlotState{Pin: "2"}, UpdateManifest{Version: "2"}, true},
+	}
+	for _, tt := range tests {
+		if got := acceptRelease(tt.st, &tt.m); got != tt.want {
+			t.Errorf("acceptRelease(%+v, %+v) = %v, want %v", tt.st, tt.m, got, tt.want)
+		}
+	}
+}
+
+func readFile(path string) string {
+	b, _ := ioutil.ReadFile(path)
+	return string(b)
+}
+
+func TestRateLimitReader(t *testing.T) {
+	start := time.Now()
+	r := &rateLimitReader{r: strings.NewReader(strings.Repeat("x", 300)), rate: 1000, start: start}
+	io.Copy(ioutil.Discard, r)
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("read 300 bytes at 1000 bytes/s in %v", d)
+	}
+}
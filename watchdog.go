@@ -0,0 +1,16 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+const optionWatchdogSec = "WatchdogSec"
+
+// Watchdog is an Interface that can veto the keep-alive notifications sent
+// to the watchdog of the service manager, see the WatchdogSec option. While
+// Healthy returns an error no notification is sent, the error is logged and
+// the service manager restarts the service once the watchdog times out.
+type Watchdog interface {
+	Interface
+	Healthy(s Service) error
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends state to the service manager on NOTIFY_SOCKET. It does
+// nothing if the variable is not set.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the interval of keep-alive notifications, half
+// the WATCHDOG_USEC timeout the service manager passed to this process, or
+// zero if there is no watchdog.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// startWatchdog sends keep-alive notifications while i is running, as long
+// as a Watchdog reports i healthy. It returns a function stopping them.
+func (c *Config) startWatchdog(i Interface, s Service) (stop func()) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return func() {}
+	}
+	wd, _ := i.(Watchdog)
+	logger, _ := s.Logger(nil)
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			var err error
+			if wd != nil {
+				err = wd.Healthy(s)
+			}
+			if err == nil {
+				err = sdNotify("WATCHDOG=1")
+			}
+			if err != nil && logger != nil {
+				logger.Error(err)
+			}
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || solaris || aix || freebsd
+// +build linux darwin solaris aix freebsd
+
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type watchdogProgram struct {
+	healthy error
+}
+
+func (p *watchdogProgram) Start(s Service) error   { return nil }
+func (p *watchdogProgram) Stop(s Service) error    { return nil }
+func (p *watchdogProgram) Healthy(s Service) error { return p.healthy }
+
+func TestWatchdog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for k, v := range map[string]string{
+		"NOTIFY_SOCKET": path,
+		"WATCHDOG_USEC": "20000",
+		"WATCHDOG_PID":  strconv.Itoa(os.Getpid()),
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	c := &Config{Name: "watchdog"}
+	s := loggingService{logger: &recordingLogger{}}
+	p := &watchdogProgram{}
+	stop := c.startWatchdog(p, s)
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "WATCHDOG=1" {
+		t.Errorf("notification %q, want WATCHDOG=1", buf[:n])
+	}
+
+	// Drain notifications sent before the stop.
+	time.Sleep(50 * time.Millisecond)
+	for conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); ; {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	p.healthy = errors.New("stuck")
+	stop = c.startWatchdog(p, s)
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err = conn.Read(buf)
+	stop()
+	if err == nil {
+		t.Errorf("unhealthy service sent %q", buf[:n])
+	}
+}